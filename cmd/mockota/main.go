@@ -0,0 +1,20 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/Poojasadgir/room-reservation/internal/channels/mockota"
+)
+
+// main runs the mock OTA on its own, so that a channel can be added in the admin tool and synced locally.
+// Bookings can be added by posting them as JSON to /v1/bookings.
+func main() {
+	addr := flag.String("addr", "localhost:8090", "Address to listen on")
+	apiKey := flag.String("apikey", "mock-key", "API key channels must send as a bearer token")
+	flag.Parse()
+
+	log.Printf("Mock OTA listening on http://%s with API key %q", *addr, *apiKey)
+	log.Fatal(http.ListenAndServe(*addr, mockota.New(*apiKey)))
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"time"
+
+	"github.com/Poojasadgir/room-reservation/internal/handlers"
+)
+
+// channelPollInterval is how often the channel sync queue is checked for pushes to send
+const channelPollInterval = 5 * time.Second
+
+// channelBatchSize is the most pushes claimed from the queue at a time
+const channelBatchSize = 20
+
+// listenForChannelSyncs polls the channel sync queue for pending pushes and sends them to their channels.
+func listenForChannelSyncs() {
+	go func() {
+		ticker := time.NewTicker(channelPollInterval)
+		defer ticker.Stop()
+
+		for {
+			pushed, err := handlers.Repo.ProcessChannelSyncs(time.Now(), channelBatchSize)
+			if err != nil {
+				errorLog.Println("cannot push to channels:", err)
+			}
+			if pushed > 0 {
+				infoLog.Printf("Sent %d push(es) to channels", pushed)
+			}
+			<-ticker.C
+		}
+	}()
+}
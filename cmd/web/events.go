@@ -0,0 +1,23 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/Poojasadgir/room-reservation/internal/events"
+)
+
+// eventRelayRetry is how long to wait before listening again after the relay connection is lost
+const eventRelayRetry = 5 * time.Second
+
+// eventRelayDSN is the database the event relay listens on, or blank when events stay in this instance
+var eventRelayDSN string
+
+// listenForEvents listens for the live updates relayed by every instance of the app and passes them to the
+// pages open on this one. Without a relay, events are published straight to this instance's bus.
+func listenForEvents() {
+	if eventRelayDSN == "" {
+		return
+	}
+	go events.Listen(context.Background(), eventRelayDSN, app.Events, eventRelayRetry, errorLog)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Poojasadgir/room-reservation/internal/handlers"
+	"github.com/Poojasadgir/room-reservation/internal/jobs"
+)
+
+// startJobs registers the background jobs and starts the scheduler. Jobs are persisted in the database,
+// so each scheduled run happens on only one instance when several instances of the app are running.
+func startJobs() (*jobs.Scheduler, error) {
+	hostname, _ := os.Hostname()
+	instance := fmt.Sprintf("%s-%d", hostname, os.Getpid())
+
+	scheduler := jobs.New(handlers.Repo.DB, instance, infoLog, errorLog)
+
+	err := scheduler.Register("no-show-sweep", "@hourly", func(now time.Time) error {
+		flagged, err := handlers.Repo.SweepNoShows(now)
+		if len(flagged) > 0 {
+			infoLog.Printf("Marked %d reservation(s) as no-shows", len(flagged))
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = scheduler.Register("no-show-summary", "0 7 * * *", func(now time.Time) error {
+		return handlers.Repo.SendNoShowSummary(now.AddDate(0, 0, -1))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = scheduler.Register("arrival-reminders", "0 9 * * *", func(now time.Time) error {
+		queued, err := handlers.Repo.SendArrivalReminders(time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC))
+		if queued > 0 {
+			infoLog.Printf("Queued %d arrival reminder(s)", queued)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = scheduler.Register("housekeeping-tasks", "0 5 * * *", func(now time.Time) error {
+		return handlers.Repo.GenerateHousekeepingTasks(time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = scheduler.Register("calendar-import", "@every 30m", func(now time.Time) error {
+		conflicts, err := handlers.Repo.SyncCalendarImports(now)
+		if conflicts > 0 {
+			infoLog.Printf("Imported calendars overlap %d reservation(s)", conflicts)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = scheduler.Register("channel-push", "@every 15m", func(now time.Time) error {
+		_, err := handlers.Repo.QueueChannelPushes(now)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = scheduler.Register("channel-pull", "@every 10m", func(now time.Time) error {
+		_, err := handlers.Repo.PullAllChannelBookings()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("Starting background jobs...")
+	scheduler.Start()
+	return scheduler, nil
+}
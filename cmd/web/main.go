@@ -7,12 +7,15 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/Poojasadgir/room-reservation/internal/config"
 	"github.com/Poojasadgir/room-reservation/internal/driver"
+	"github.com/Poojasadgir/room-reservation/internal/events"
 	"github.com/Poojasadgir/room-reservation/internal/handlers"
 	"github.com/Poojasadgir/room-reservation/internal/helpers"
+	"github.com/Poojasadgir/room-reservation/internal/mailer"
 	"github.com/Poojasadgir/room-reservation/internal/models"
 	"github.com/Poojasadgir/room-reservation/internal/render"
 	"github.com/alexedwards/scs/v2"
@@ -25,7 +28,7 @@ var session *scs.SessionManager
 var infoLog, errorLog *log.Logger
 
 // main is the entry point of the web application.
-// It initializes the database connection, starts the mail listener,
+// It initializes the database connection, starts the mail, webhook and channel listeners,
 // and sets up the HTTP server to listen on the specified port.
 func main() {
 	db, err := run()
@@ -33,8 +36,16 @@ func main() {
 		log.Fatal(err)
 	}
 	defer db.SQL.Close()
-	defer close(app.MailChannel)
 	listenForMail()
+	listenForWebhooks()
+	listenForChannelSyncs()
+	listenForEvents()
+
+	scheduler, err := startJobs()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer scheduler.Stop()
 
 	fmt.Println("Starting mail listener...")
 	fmt.Printf("Starting port number on port %s\n", portNumber)
@@ -67,6 +78,23 @@ func run() (*driver.DB, error) {
 	dbPass := flag.String("dbpass", "Pooja@2706", "Database password")
 	dbPort := flag.Int("dbport", 5432, "Database port")
 	dbSSL := flag.String("dbssl", "disable", "Database SSL settings (disable, prefer, require)")
+	baseURL := flag.String("baseurl", "http://localhost:1023", "Public URL of the site, used in links sent by email")
+	noShowCutoff := flag.Duration("noshowcutoff", 30*time.Hour, "Time after midnight on the arrival date before a guest who has not checked in is a no-show")
+	propertyName := flag.String("propertyname", "Fort Oak Bed and Breakfast", "Name of the property, used in calendar invites")
+	propertyAddress := flag.String("propertyaddress", "", "Street address of the property, used in calendar invites")
+	checkIn := flag.Duration("checkin", 15*time.Hour, "Time after midnight that guests can check in")
+	checkOut := flag.Duration("checkout", 11*time.Hour, "Time after midnight that guests must check out")
+	timeZone := flag.String("timezone", "Local", "Time zone of the property, such as America/New_York")
+	mailTransport := flag.String("mailtransport", "smtp", "Mail transport (smtp, file, memory)")
+	smtpHost := flag.String("smtphost", "localhost", "SMTP server host")
+	smtpPort := flag.Int("smtpport", 1025, "SMTP server port")
+	smtpUser := flag.String("smtpuser", "", "SMTP username")
+	smtpPass := flag.String("smtppass", "", "SMTP password")
+	smtpEncryption := flag.String("smtpencryption", "none", "SMTP encryption (none, starttls, tls)")
+	smtpKeepAlive := flag.Bool("smtpkeepalive", false, "Keep the SMTP connection open between emails")
+	smtpTimeout := flag.Duration("smtptimeout", mailer.DefaultTimeout, "Timeout for connecting to and sending through the SMTP server")
+	mailDir := flag.String("maildir", "./tmp/mail", "Maildir the file mail transport writes to")
+	eventRelay := flag.String("eventrelay", "none", "How live calendar updates reach other instances of the app (none, postgres)")
 
 	flag.Parse()
 
@@ -79,13 +107,23 @@ func run() (*driver.DB, error) {
 		portNumber = ":8080"
 	}
 
-	// Channel for sending and receiving mail
-	mailChannel := make(chan models.MailData)
-	app.MailChannel = mailChannel
-
 	// Change this to true when in production
 	app.InProduction = *inProduction
 	app.UseCache = *useCache
+	app.BaseURL = strings.TrimSuffix(*baseURL, "/")
+	app.NoShowCutoff = *noShowCutoff
+
+	location, err := time.LoadLocation(*timeZone)
+	if err != nil {
+		return nil, err
+	}
+	app.Property = config.Property{
+		Name:     *propertyName,
+		Address:  *propertyAddress,
+		CheckIn:  *checkIn,
+		CheckOut: *checkOut,
+		Location: location,
+	}
 
 	// Logging and error handling
 	infoLog = log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
@@ -93,6 +131,23 @@ func run() (*driver.DB, error) {
 	errorLog = log.New(os.Stdout, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
 	app.ErrorLog = errorLog
 
+	// Mail transport
+	mailTransporter, err := mailer.New(mailer.Config{
+		Transport:  *mailTransport,
+		Host:       *smtpHost,
+		Port:       *smtpPort,
+		Username:   *smtpUser,
+		Password:   *smtpPass,
+		Encryption: *smtpEncryption,
+		KeepAlive:  *smtpKeepAlive,
+		Timeout:    *smtpTimeout,
+		Dir:        *mailDir,
+	})
+	if err != nil {
+		return nil, err
+	}
+	app.Mailer = mailTransporter
+
 	// Session info
 	session = scs.New()
 	session.Lifetime = 24 * time.Hour
@@ -109,6 +164,17 @@ func run() (*driver.DB, error) {
 		log.Fatal("cannot connect to database.")
 	}
 
+	// Live updates, relayed through the database when several instances share it
+	switch *eventRelay {
+	case "none":
+		app.Events = events.NewBus(nil)
+	case "postgres":
+		app.Events = events.NewBus(events.PostgresRelay{DB: db.SQL})
+		eventRelayDSN = connestionString
+	default:
+		return nil, fmt.Errorf("unknown event relay %q", *eventRelay)
+	}
+
 	tc, err := render.CreateTemplateCache()
 	if err != nil {
 		log.Fatal("cannot create template cache")
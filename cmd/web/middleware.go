@@ -21,9 +21,29 @@ func NoSurf(next http.Handler) http.Handler {
 	return csrfHandler
 }
 
-// SessionLoad loads and saves the session on each request.
+// SessionLoad loads and saves the session on each request. Event streams only load it, because saving
+// it holds the whole response back until the handler returns, and a stream never does until the page
+// goes away.
 func SessionLoad(next http.Handler) http.Handler {
-	return session.LoadAndSave(next)
+	loadAndSave := session.LoadAndSave(next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != "text/event-stream" {
+			loadAndSave.ServeHTTP(w, r)
+			return
+		}
+
+		var token string
+		if cookie, err := r.Cookie(session.Cookie.Name); err == nil {
+			token = cookie.Value
+		}
+		ctx, err := session.Load(r.Context(), token)
+		if err != nil {
+			session.ErrorFunc(w, r, err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
 }
 
 // Auth is a middleware that checks if the user is authenticated before allowing access to the next handler.
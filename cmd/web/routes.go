@@ -35,13 +35,20 @@ func routes(app *config.AppConfig) http.Handler {
 	mux.Get("/search-availability", handlers.Repo.Availability)
 	mux.Post("/search-availability", handlers.Repo.PostAvailability)
 	mux.Post("/search-availability-json", handlers.Repo.AvailabilityJSON)
+	mux.Get("/availability/events", handlers.Repo.AvailabilityEvents)
 	mux.Get("/choose-room/{id}", handlers.Repo.ChooseRoom)
+	mux.Get("/choose-split", handlers.Repo.ChooseSplit)
 	mux.Get("/book-room", handlers.Repo.BookRoom)
 
 	// Reservation page handlers
 	mux.Get("/make-reservation", handlers.Repo.Reservation)
 	mux.Post("/make-reservation", handlers.Repo.PostReservation)
 	mux.Get("/reservation-summary", handlers.Repo.ReservationSummary)
+	mux.Get("/reservations/{id}/cancel", handlers.Repo.GuestCancelReservation)
+	mux.Post("/reservations/{id}/cancel", handlers.Repo.PostGuestCancelReservation)
+
+	// Calendar feeds for external booking sites
+	mux.Get("/ical/rooms/{id}.ics", handlers.Repo.RoomCalendarFeed)
 
 	// Login/Logout page handlers
 	mux.Get("/user/login", handlers.Repo.Login)
@@ -53,14 +60,82 @@ func routes(app *config.AppConfig) http.Handler {
 		mux.Use(Auth)
 
 		mux.Get("/dashboard", handlers.Repo.AdminDashboard)
+		mux.Get("/events", handlers.Repo.AdminEvents)
+		mux.Get("/dashboard.json", handlers.Repo.AdminDashboardJSON)
+		mux.Get("/dashboard/export", handlers.Repo.AdminExportDashboard)
 		mux.Get("/reservations-new", handlers.Repo.AdminNewReservations)
 		mux.Get("/reservations-all", handlers.Repo.AdminAllReservations)
+		mux.Get("/reservations-new/export", handlers.Repo.AdminExportNewReservations)
+		mux.Get("/reservations-all/export", handlers.Repo.AdminExportAllReservations)
 		mux.Get("/reservations-calendar", handlers.Repo.AdminReservationsCalendar)
+		mux.Get("/reservations-timeline", handlers.Repo.AdminReservationsTimeline)
 		mux.Post("/reservations-calendar", handlers.Repo.AdminPostReservationsCalendar)
 		mux.Get("/process-reservation/{src}/{id}/process", handlers.Repo.AdminProcessReservation)
 		mux.Get("/delete-reservation/{src}/{id}", handlers.Repo.AdminDeleteReservation)
 		mux.Get("/reservations/{src}/{id}/show", handlers.Repo.AdminShowReservation)
 		mux.Post("/reservations/{src}/{id}", handlers.Repo.AdminPostShowReservation)
+		mux.Post("/reservations/{src}/{id}/notes", handlers.Repo.AdminPostReservationNote)
+		mux.Post("/reservations/{src}/{id}/dates", handlers.Repo.AdminPostReservationDates)
+		mux.Post("/reservations/{src}/{id}/extend", handlers.Repo.AdminPostExtendReservation)
+		mux.Post("/reservations/{src}/{id}/move", handlers.Repo.AdminPostMoveReservation)
+		mux.Get("/cancel-reservation/{src}/{id}", handlers.Repo.AdminCancelReservation)
+		mux.Post("/cancel-reservation/{src}/{id}", handlers.Repo.AdminPostCancelReservation)
+
+		mux.Get("/guests", handlers.Repo.AdminGuests)
+		mux.Get("/guests/export", handlers.Repo.AdminExportGuests)
+		mux.Get("/guests/{id}", handlers.Repo.AdminShowGuest)
+		mux.Post("/guests/{id}", handlers.Repo.AdminPostShowGuest)
+		mux.Post("/guests/{id}/merge", handlers.Repo.AdminMergeGuest)
+
+		mux.Get("/cancellation-policies", handlers.Repo.AdminCancellationPolicies)
+		mux.Post("/cancellation-policies", handlers.Repo.AdminPostCancellationPolicy)
+		mux.Post("/rooms/{id}/cancellation-policy", handlers.Repo.AdminPostRoomCancellationPolicy)
+
+		mux.Get("/booking-questions", handlers.Repo.AdminBookingQuestions)
+		mux.Post("/booking-questions", handlers.Repo.AdminPostBookingQuestion)
+
+		mux.Get("/front-desk", handlers.Repo.AdminFrontDesk)
+		mux.Post("/front-desk/{id}/check-in", handlers.Repo.AdminPostCheckIn)
+		mux.Post("/front-desk/{id}/check-out", handlers.Repo.AdminPostCheckOut)
+
+		mux.Get("/housekeeping", handlers.Repo.AdminHousekeeping)
+		mux.Post("/housekeeping/generate", handlers.Repo.AdminPostGenerateHousekeepingTasks)
+		mux.Post("/housekeeping/tasks/{id}/done", handlers.Repo.AdminPostCompleteHousekeepingTask)
+		mux.Post("/rooms/{id}/housekeeping-status", handlers.Repo.AdminPostRoomHousekeepingStatus)
+
+		mux.Get("/jobs", handlers.Repo.AdminJobs)
+		mux.Post("/jobs/{name}/run", handlers.Repo.AdminPostRunJob)
+
+		mux.Get("/outbox", handlers.Repo.AdminOutbox)
+		mux.Post("/outbox/{id}/resend", handlers.Repo.AdminPostResendOutboxMessage)
+
+		mux.Get("/email-templates", handlers.Repo.AdminEmailTemplates)
+		mux.Get("/email-templates/{name}", handlers.Repo.AdminEmailTemplates)
+
+		mux.Get("/calendar-sync", handlers.Repo.AdminCalendarSync)
+		mux.Post("/rooms/{id}/calendar-feed", handlers.Repo.AdminPostRoomCalendarFeed)
+		mux.Post("/calendar-imports", handlers.Repo.AdminPostCalendarImport)
+		mux.Post("/calendar-imports/{id}/sync", handlers.Repo.AdminPostSyncCalendarImport)
+		mux.Post("/calendar-imports/{id}/delete", handlers.Repo.AdminPostDeleteCalendarImport)
+
+		mux.Get("/webhooks", handlers.Repo.AdminWebhooks)
+		mux.Post("/webhooks", handlers.Repo.AdminPostWebhookEndpoint)
+		mux.Get("/webhooks/{id}", handlers.Repo.AdminShowWebhookEndpoint)
+		mux.Post("/webhooks/{id}/delete", handlers.Repo.AdminPostDeleteWebhookEndpoint)
+		mux.Post("/webhooks/{id}/deliveries/{deliveryID}/replay", handlers.Repo.AdminPostReplayWebhookDelivery)
+
+		mux.Get("/channels", handlers.Repo.AdminChannels)
+		mux.Post("/channels", handlers.Repo.AdminPostChannel)
+		mux.Get("/channels/{id}", handlers.Repo.AdminShowChannel)
+		mux.Post("/channels/{id}/mappings", handlers.Repo.AdminPostChannelMappings)
+		mux.Post("/channels/{id}/push", handlers.Repo.AdminPostChannelPush)
+		mux.Post("/channels/{id}/pull", handlers.Repo.AdminPostChannelPull)
+		mux.Post("/channels/{id}/syncs/{syncID}/retry", handlers.Repo.AdminPostRetryChannelSync)
+
+		mux.Get("/import", handlers.Repo.AdminImport)
+		mux.Post("/import", handlers.Repo.AdminPostImport)
+		mux.Post("/import/preview", handlers.Repo.AdminPostImportPreview)
+		mux.Post("/import/{id}/undo", handlers.Repo.AdminPostRevertImport)
 	})
 
 	return mux
@@ -1,59 +1,32 @@
 package main
 
 import (
-	"fmt"
-	"io/ioutil"
-	"strings"
 	"time"
 
-	"github.com/Poojasadgir/room-reservation/internal/models"
-	mail "github.com/xhit/go-simple-mail/v2"
+	"github.com/Poojasadgir/room-reservation/internal/handlers"
 )
 
-// listenForMail listens for incoming messages on the app.MailChannel and sends them using the sendMessage function.
+// mailPollInterval is how often the outbox is checked for emails to send
+const mailPollInterval = 5 * time.Second
+
+// mailBatchSize is the most emails claimed from the outbox at a time
+const mailBatchSize = 20
+
+// listenForMail polls the outbox for pending emails and sends them with the configured mail transport.
 func listenForMail() {
 	go func() {
+		ticker := time.NewTicker(mailPollInterval)
+		defer ticker.Stop()
+
 		for {
-			message := <-app.MailChannel
-			sendMessage(message)
+			sent, err := handlers.Repo.SendPendingMail(time.Now(), mailBatchSize)
+			if err != nil {
+				errorLog.Println("cannot send pending mail:", err)
+			}
+			if sent > 0 {
+				infoLog.Printf("Sent %d email(s)", sent)
+			}
+			<-ticker.C
 		}
 	}()
 }
-
-// sendMessage sends an email using the provided MailData.
-// If a template is provided, it will be used to format the email content.
-// Otherwise, the content will be used as is.
-func sendMessage(m models.MailData) {
-	const mailTimeout = 10 * time.Second
-	server := mail.NewSMTPClient()
-	server.Host = "localhost"
-	server.Port = 1025
-	server.KeepAlive = false
-	server.ConnectTimeout = mailTimeout
-	server.SendTimeout = mailTimeout
-
-	client, err := server.Connect()
-	if err != nil {
-		errorLog.Println(err)
-	}
-
-	email := mail.NewMSG()
-	email.SetFrom(m.From).AddTo(m.To).SetSubject(m.Subject)
-	if m.Template == "" {
-		email.SetBody(mail.TextHTML, m.Content)
-	} else {
-		data, err := ioutil.ReadFile(fmt.Sprintf("./email-templates/%s", m.Template))
-		if err != nil {
-			app.ErrorLog.Println(err)
-		}
-		mailTemplate := string(data)
-		messageToSend := strings.Replace(mailTemplate, "[%body%]", m.Content, 1)
-		email.SetBody(mail.TextHTML, messageToSend)
-	}
-	err = email.Send(client)
-	if err != nil {
-		errorLog.Println(err)
-	} else {
-		infoLog.Println("Email sent!")
-	}
-}
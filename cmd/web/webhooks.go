@@ -0,0 +1,32 @@
+package main
+
+import (
+	"time"
+
+	"github.com/Poojasadgir/room-reservation/internal/handlers"
+)
+
+// webhookPollInterval is how often the webhook queue is checked for deliveries to send
+const webhookPollInterval = 5 * time.Second
+
+// webhookBatchSize is the most deliveries claimed from the queue at a time
+const webhookBatchSize = 20
+
+// listenForWebhooks polls the webhook queue for pending deliveries and posts them to their endpoints.
+func listenForWebhooks() {
+	go func() {
+		ticker := time.NewTicker(webhookPollInterval)
+		defer ticker.Stop()
+
+		for {
+			delivered, err := handlers.Repo.DeliverPendingWebhooks(time.Now(), webhookBatchSize)
+			if err != nil {
+				errorLog.Println("cannot deliver webhooks:", err)
+			}
+			if delivered > 0 {
+				infoLog.Printf("Delivered %d webhook(s)", delivered)
+			}
+			<-ticker.C
+		}
+	}()
+}
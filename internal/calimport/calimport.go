@@ -0,0 +1,83 @@
+package calimport
+
+import (
+	"time"
+
+	"github.com/Poojasadgir/room-reservation/internal/ical"
+	"github.com/Poojasadgir/room-reservation/internal/models"
+)
+
+// Nights returns the first night and the departure date an event blocks. Events with a time of day block
+// every night from the date they start to the date they end, and always at least one night.
+func Nights(ev ical.Event) (time.Time, time.Time) {
+	start := time.Date(ev.Start.Year(), ev.Start.Month(), ev.Start.Day(), 0, 0, 0, 0, time.UTC)
+	end := time.Date(ev.End.Year(), ev.End.Month(), ev.End.Day(), 0, 0, 0, 0, time.UTC)
+	if !end.After(start) {
+		end = start.AddDate(0, 0, 1)
+	}
+	return start, end
+}
+
+// Diff works out the changes that bring the blocks already imported from a calendar in line with the
+// events it now holds. Cancelled events and events that end on or before from are ignored, and blocks that
+// ended before from are kept as history. Each event that overlaps one of the room's reservations is
+// returned as a conflict; its block is still created, since the room is taken elsewhere either way.
+func Diff(imp models.CalendarImport, events []ical.Event, existing, restrictions []models.RoomRestriction, from time.Time) models.CalendarImportSync {
+	sync := models.CalendarImportSync{ImportID: imp.ID}
+
+	blocks := make(map[string]models.RoomRestriction, len(existing))
+	for _, b := range existing {
+		blocks[b.ExternalUID] = b
+	}
+
+	seen := make(map[string]bool, len(events))
+	for _, ev := range events {
+		// overridden occurrences of a recurring event share its UID, only the first is used
+		if ev.Status == ical.StatusCancelled || seen[ev.UID] {
+			continue
+		}
+		start, end := Nights(ev)
+		if !end.After(from) {
+			continue
+		}
+		seen[ev.UID] = true
+
+		if b, ok := blocks[ev.UID]; ok {
+			if !b.StartDate.Equal(start) || !b.EndDate.Equal(end) {
+				b.StartDate = start
+				b.EndDate = end
+				sync.Update = append(sync.Update, b)
+			}
+		} else {
+			sync.Create = append(sync.Create, models.RoomRestriction{
+				StartDate:     start,
+				EndDate:       end,
+				RoomID:        imp.RoomID,
+				RestrictionID: 2,
+				ImportID:      imp.ID,
+				ExternalUID:   ev.UID,
+			})
+		}
+
+		for _, r := range restrictions {
+			if r.ReservationID > 0 && start.Before(r.EndDate) && end.After(r.StartDate) {
+				sync.Conflicts = append(sync.Conflicts, models.CalendarImportConflict{
+					ImportID:      imp.ID,
+					ExternalUID:   ev.UID,
+					Summary:       ev.Summary,
+					StartDate:     start,
+					EndDate:       end,
+					ReservationID: r.ReservationID,
+				})
+			}
+		}
+	}
+
+	for _, b := range existing {
+		if !seen[b.ExternalUID] && b.EndDate.After(from) {
+			sync.Delete = append(sync.Delete, b.ID)
+		}
+	}
+
+	return sync
+}
@@ -0,0 +1,82 @@
+package calimport
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Poojasadgir/room-reservation/internal/ical"
+	"github.com/Poojasadgir/room-reservation/internal/models"
+)
+
+var from = time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func day(d int) time.Time {
+	return from.AddDate(0, 0, d-1)
+}
+
+func TestNights(t *testing.T) {
+	tests := []struct {
+		name          string
+		ev            ical.Event
+		expectedStart time.Time
+		expectedEnd   time.Time
+	}{
+		{"all-day", ical.Event{Start: day(10), End: day(13), AllDay: true}, day(10), day(13)},
+		{"timed", ical.Event{Start: day(10).Add(15 * time.Hour), End: day(13).Add(11 * time.Hour)}, day(10), day(13)},
+		{"same-day", ical.Event{Start: day(10).Add(9 * time.Hour), End: day(10).Add(17 * time.Hour)}, day(10), day(11)},
+	}
+
+	for _, e := range tests {
+		start, end := Nights(e.ev)
+		if !start.Equal(e.expectedStart) || !end.Equal(e.expectedEnd) {
+			t.Errorf("%s: expected %s to %s but got %s to %s", e.name, e.expectedStart, e.expectedEnd, start, end)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	imp := models.CalendarImport{ID: 7, RoomID: 1}
+
+	events := []ical.Event{
+		{UID: "new", Start: day(10), End: day(12), AllDay: true, Summary: "Reserved"},
+		{UID: "moved", Start: day(20), End: day(23), AllDay: true},
+		{UID: "same", Start: day(5), End: day(6), AllDay: true},
+		{UID: "cancelled", Start: day(15), End: day(16), AllDay: true, Status: ical.StatusCancelled},
+		{UID: "past", Start: day(-5), End: day(-2), AllDay: true},
+		{UID: "new", Start: day(11), End: day(12), AllDay: true},
+	}
+
+	existing := []models.RoomRestriction{
+		{ID: 1, ExternalUID: "moved", StartDate: day(20), EndDate: day(22)},
+		{ID: 2, ExternalUID: "same", StartDate: day(5), EndDate: day(6)},
+		{ID: 3, ExternalUID: "cancelled", StartDate: day(15), EndDate: day(16)},
+		{ID: 4, ExternalUID: "gone", StartDate: day(25), EndDate: day(26)},
+		{ID: 5, ExternalUID: "history", StartDate: day(-10), EndDate: day(-8)},
+	}
+
+	restrictions := []models.RoomRestriction{
+		{ID: 10, ReservationID: 3, StartDate: day(11), EndDate: day(14)},
+		{ID: 11, StartDate: day(20), EndDate: day(21)},
+	}
+
+	sync := Diff(imp, events, existing, restrictions, from)
+
+	if len(sync.Create) != 1 || sync.Create[0].ExternalUID != "new" || !sync.Create[0].EndDate.Equal(day(12)) {
+		t.Errorf("expected only the new event to be created but got %+v", sync.Create)
+	}
+	if c := sync.Create[0]; c.ImportID != 7 || c.RoomID != 1 || c.RestrictionID != 2 {
+		t.Errorf("expected a block for the import's room but got %+v", c)
+	}
+
+	if len(sync.Update) != 1 || sync.Update[0].ID != 1 || !sync.Update[0].EndDate.Equal(day(23)) {
+		t.Errorf("expected only the moved event to be updated but got %+v", sync.Update)
+	}
+
+	if len(sync.Delete) != 2 || sync.Delete[0] != 3 || sync.Delete[1] != 4 {
+		t.Errorf("expected the cancelled and removed blocks to be deleted but got %v", sync.Delete)
+	}
+
+	if len(sync.Conflicts) != 1 || sync.Conflicts[0].ReservationID != 3 || sync.Conflicts[0].ExternalUID != "new" {
+		t.Errorf("expected one conflict with reservation 3 but got %+v", sync.Conflicts)
+	}
+}
@@ -0,0 +1,68 @@
+package cancellation
+
+import (
+	"time"
+
+	"github.com/Poojasadgir/room-reservation/internal/models"
+)
+
+// Nights returns the number of nights in a reservation.
+func Nights(res models.Reservation) int {
+	nights := int(res.EndDate.Sub(res.StartDate).Hours() / 24)
+	if nights < 0 {
+		return 0
+	}
+	return nights
+}
+
+// Deadline returns the last moment the reservation can be cancelled free of charge under the given policy.
+// A policy without free cancellation hours is non-refundable, so its deadline is the zero time.
+func Deadline(p models.CancellationPolicy, res models.Reservation) time.Time {
+	if p.FreeCancellationHours <= 0 {
+		return time.Time{}
+	}
+	return res.StartDate.Add(-time.Duration(p.FreeCancellationHours) * time.Hour)
+}
+
+// Fee calculates the cancellation fee, in cents, for cancelling the reservation at the given time.
+// Nothing is charged before the policy deadline. After it, the policy's fee nights are charged at the
+// room's nightly rate, plus the policy's percentage of the remaining stay value, capped at the full stay.
+func Fee(p models.CancellationPolicy, res models.Reservation, nightlyRate int, at time.Time) int {
+	if p.ID == 0 || at.Before(Deadline(p, res)) {
+		return 0
+	}
+
+	nights := Nights(res)
+	total := nights * nightlyRate
+
+	feeNights := p.FeeNights
+	if feeNights > nights {
+		feeNights = nights
+	}
+
+	fee := feeNights*nightlyRate + (total-feeNights*nightlyRate)*p.FeePercent/100
+	if fee > total {
+		fee = total
+	}
+	return fee
+}
+
+// NoShowFee calculates the fee, in cents, charged when a guest never arrives: the policy's no-show
+// nights at the room's nightly rate, capped at the length of the stay.
+func NoShowFee(p models.CancellationPolicy, res models.Reservation, nightlyRate int) int {
+	if p.ID == 0 {
+		return 0
+	}
+
+	feeNights := p.NoShowFeeNights
+	if nights := Nights(res); feeNights > nights {
+		feeNights = nights
+	}
+	return feeNights * nightlyRate
+}
+
+// ReleasesNoShow reports whether the remaining nights of a no-show are freed under the given policy.
+// Without a policy the room is always released.
+func ReleasesNoShow(p models.CancellationPolicy) bool {
+	return p.ID == 0 || p.ReleaseNoShows
+}
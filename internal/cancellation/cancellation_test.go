@@ -0,0 +1,91 @@
+package cancellation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Poojasadgir/room-reservation/internal/models"
+)
+
+var flexible = models.CancellationPolicy{
+	ID:                    1,
+	PolicyName:            "Flexible",
+	FreeCancellationHours: 48,
+	FeeNights:             1,
+}
+
+var nonRefundable = models.CancellationPolicy{
+	ID:         2,
+	PolicyName: "Non-refundable",
+	FeePercent: 100,
+}
+
+var feeTests = []struct {
+	name        string
+	policy      models.CancellationPolicy
+	cancelledAt time.Time
+	expectedFee int
+}{
+	{"no-policy", models.CancellationPolicy{}, time.Date(2050, 1, 10, 0, 0, 0, 0, time.UTC), 0},
+	{"flexible-before-deadline", flexible, time.Date(2050, 1, 7, 23, 0, 0, 0, time.UTC), 0},
+	{"flexible-after-deadline", flexible, time.Date(2050, 1, 8, 1, 0, 0, 0, time.UTC), 10000},
+	{"non-refundable", nonRefundable, time.Date(2049, 6, 1, 0, 0, 0, 0, time.UTC), 30000},
+	{"mixed", models.CancellationPolicy{ID: 3, FeeNights: 1, FeePercent: 50}, time.Date(2050, 1, 10, 0, 0, 0, 0, time.UTC), 20000},
+}
+
+func TestFee(t *testing.T) {
+	res := models.Reservation{
+		StartDate: time.Date(2050, 1, 10, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2050, 1, 13, 0, 0, 0, 0, time.UTC),
+	}
+
+	for _, e := range feeTests {
+		fee := Fee(e.policy, res, 10000, e.cancelledAt)
+		if fee != e.expectedFee {
+			t.Errorf("%s: expected fee %d but got %d", e.name, e.expectedFee, fee)
+		}
+	}
+}
+
+func TestNights(t *testing.T) {
+	res := models.Reservation{
+		StartDate: time.Date(2050, 1, 10, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2050, 1, 13, 0, 0, 0, 0, time.UTC),
+	}
+	if Nights(res) != 3 {
+		t.Errorf("expected 3 nights but got %d", Nights(res))
+	}
+
+	if Nights(models.Reservation{StartDate: res.EndDate, EndDate: res.StartDate}) != 0 {
+		t.Error("expected 0 nights for reversed dates")
+	}
+}
+
+func TestNoShowFee(t *testing.T) {
+	res := models.Reservation{
+		StartDate: time.Date(2050, 1, 10, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2050, 1, 13, 0, 0, 0, 0, time.UTC),
+	}
+
+	if fee := NoShowFee(models.CancellationPolicy{}, res, 10000); fee != 0 {
+		t.Errorf("expected no fee without a policy but got %d", fee)
+	}
+
+	if fee := NoShowFee(models.CancellationPolicy{ID: 1, NoShowFeeNights: 1}, res, 10000); fee != 10000 {
+		t.Errorf("expected fee of one night but got %d", fee)
+	}
+
+	if fee := NoShowFee(models.CancellationPolicy{ID: 1, NoShowFeeNights: 5}, res, 10000); fee != 30000 {
+		t.Errorf("expected fee capped at the stay but got %d", fee)
+	}
+}
+
+func TestReleasesNoShow(t *testing.T) {
+	if !ReleasesNoShow(models.CancellationPolicy{}) {
+		t.Error("expected no-shows to be released without a policy")
+	}
+
+	if ReleasesNoShow(models.CancellationPolicy{ID: 1}) {
+		t.Error("expected no-shows to be held when the policy does not release them")
+	}
+}
@@ -0,0 +1,135 @@
+package channels
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Poojasadgir/room-reservation/internal/models"
+)
+
+// ChannelConnector pushes a property's availability, rates and restrictions to an external distribution
+// channel, such as an online travel agency, and pulls the bookings made there. Each room is a single unit,
+// so availability is either 0 or 1.
+type ChannelConnector interface {
+	// PushAvailability sends how many units of each room are free to sell on each date
+	PushAvailability(ctx context.Context, updates []AvailabilityUpdate) error
+	// PushRates sends the nightly rate of each room on each date
+	PushRates(ctx context.Context, updates []RateUpdate) error
+	// PushRestrictions sends the stay restrictions of each room on each date
+	PushRestrictions(ctx context.Context, updates []RestrictionUpdate) error
+	// PullBookings returns the bookings made, changed or cancelled on the channel since a time
+	PullBookings(ctx context.Context, since time.Time) ([]Booking, error)
+}
+
+// AvailabilityUpdate is the number of units of a room free to sell on a date
+type AvailabilityUpdate struct {
+	RoomCode  string `json:"room_code"`
+	Date      string `json:"date"`
+	Available int    `json:"available"`
+}
+
+// RateUpdate is the nightly rate of a room on a date, in cents
+type RateUpdate struct {
+	RoomCode string `json:"room_code"`
+	Date     string `json:"date"`
+	Rate     int    `json:"rate"`
+}
+
+// RestrictionUpdate is the stay restrictions of a room on a date. A closed date cannot be sold at all,
+// whatever its availability.
+type RestrictionUpdate struct {
+	RoomCode string `json:"room_code"`
+	Date     string `json:"date"`
+	MinStay  int    `json:"min_stay"`
+	Closed   bool   `json:"closed"`
+}
+
+// Booking statuses reported by channels
+const (
+	BookingConfirmed = "confirmed"
+	BookingCancelled = "cancelled"
+)
+
+// Booking is a booking made on a channel
+type Booking struct {
+	ID        string    `json:"id"`
+	RoomCode  string    `json:"room_code"`
+	FirstName string    `json:"first_name"`
+	LastName  string    `json:"last_name"`
+	Email     string    `json:"email"`
+	Phone     string    `json:"phone"`
+	StartDate string    `json:"start_date"`
+	EndDate   string    `json:"end_date"`
+	Status    string    `json:"status"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Dates returns the arrival and departure dates of a booking
+func (b Booking) Dates() (time.Time, time.Time, error) {
+	start, err := time.Parse("2006-01-02", b.StartDate)
+	if err != nil {
+		return start, start, fmt.Errorf("booking %s: invalid start date %q", b.ID, b.StartDate)
+	}
+	end, err := time.Parse("2006-01-02", b.EndDate)
+	if err != nil || !end.After(start) {
+		return start, end, fmt.Errorf("booking %s: invalid end date %q", b.ID, b.EndDate)
+	}
+	return start, end, nil
+}
+
+// Kinds of connector that can be configured for a channel
+const (
+	KindHTTP = "http"
+)
+
+// Kinds lists every kind of connector, in the order they are offered to staff
+var Kinds = []string{KindHTTP}
+
+// DefaultTimeout is how long a connector waits for a channel to respond
+const DefaultTimeout = 20 * time.Second
+
+// New returns the connector for a channel's configuration
+func New(ch models.Channel) (ChannelConnector, error) {
+	switch ch.Kind {
+	case KindHTTP, "":
+		return NewHTTP(ch.BaseURL, ch.APIKey, DefaultTimeout), nil
+	default:
+		return nil, fmt.Errorf("unknown channel kind %q", ch.Kind)
+	}
+}
+
+// Horizon is how many days ahead availability, rates and restrictions are pushed
+const Horizon = 365
+
+// Inventory works out the availability, rates and restrictions of a room for the days from a date. Nights
+// with a reservation or a block have no availability, and nights with a block are also closed, since the
+// owner has taken the room off sale. Rates are left out for rooms without a nightly rate.
+func Inventory(code string, room models.Room, restrictions []models.RoomRestriction, from time.Time, days int) ([]AvailabilityUpdate, []RateUpdate, []RestrictionUpdate) {
+	availability := make([]AvailabilityUpdate, 0, days)
+	rates := make([]RateUpdate, 0, days)
+	closures := make([]RestrictionUpdate, 0, days)
+
+	for i := 0; i < days; i++ {
+		d := from.AddDate(0, 0, i)
+		available, closed := 1, false
+		for _, r := range restrictions {
+			if d.Before(r.StartDate) || !d.Before(r.EndDate) {
+				continue
+			}
+			available = 0
+			if r.ReservationID == 0 {
+				closed = true
+			}
+		}
+
+		date := d.Format("2006-01-02")
+		availability = append(availability, AvailabilityUpdate{RoomCode: code, Date: date, Available: available})
+		if room.NightlyRate > 0 {
+			rates = append(rates, RateUpdate{RoomCode: code, Date: date, Rate: room.NightlyRate})
+		}
+		closures = append(closures, RestrictionUpdate{RoomCode: code, Date: date, MinStay: 1, Closed: closed})
+	}
+
+	return availability, rates, closures
+}
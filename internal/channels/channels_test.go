@@ -0,0 +1,85 @@
+package channels
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Poojasadgir/room-reservation/internal/models"
+)
+
+func date(s string) time.Time {
+	t, _ := time.Parse("2006-01-02", s)
+	return t
+}
+
+func TestInventory(t *testing.T) {
+	room := models.Room{ID: 1, NightlyRate: 12000}
+	restrictions := []models.RoomRestriction{
+		// a reservation for the nights of the 2nd and 3rd
+		{RoomID: 1, ReservationID: 5, RestrictionID: 1, StartDate: date("2050-01-02"), EndDate: date("2050-01-04")},
+		// a block for the night of the 5th
+		{RoomID: 1, RestrictionID: 2, StartDate: date("2050-01-05"), EndDate: date("2050-01-06")},
+	}
+
+	availability, rates, closures := Inventory("GQ", room, restrictions, date("2050-01-01"), 6)
+
+	if len(availability) != 6 || len(rates) != 6 || len(closures) != 6 {
+		t.Fatalf("expected 6 days of each update but got %d, %d and %d", len(availability), len(rates), len(closures))
+	}
+
+	wantAvailable := []int{1, 0, 0, 1, 0, 1}
+	wantClosed := []bool{false, false, false, false, true, false}
+	for i, a := range availability {
+		if a.RoomCode != "GQ" || a.Date != date("2050-01-01").AddDate(0, 0, i).Format("2006-01-02") {
+			t.Errorf("day %d: unexpected room code or date %+v", i, a)
+		}
+		if a.Available != wantAvailable[i] {
+			t.Errorf("day %d: expected availability %d but got %d", i, wantAvailable[i], a.Available)
+		}
+		if closures[i].Closed != wantClosed[i] {
+			t.Errorf("day %d: expected closed %t but got %t", i, wantClosed[i], closures[i].Closed)
+		}
+		if rates[i].Rate != 12000 {
+			t.Errorf("day %d: expected the nightly rate but got %d", i, rates[i].Rate)
+		}
+	}
+
+	_, rates, _ = Inventory("GQ", models.Room{ID: 1}, nil, date("2050-01-01"), 3)
+	if len(rates) != 0 {
+		t.Errorf("expected no rates for a room without a nightly rate but got %d", len(rates))
+	}
+}
+
+func TestBookingDates(t *testing.T) {
+	b := Booking{ID: "b1", StartDate: "2050-01-10", EndDate: "2050-01-12"}
+	start, end, err := b.Dates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !start.Equal(date("2050-01-10")) || !end.Equal(date("2050-01-12")) {
+		t.Errorf("unexpected dates %s to %s", start, end)
+	}
+
+	tests := []Booking{
+		{ID: "b2", StartDate: "10/01/2050", EndDate: "2050-01-12"},
+		{ID: "b3", StartDate: "2050-01-10", EndDate: ""},
+		{ID: "b4", StartDate: "2050-01-10", EndDate: "2050-01-10"},
+	}
+	for _, b := range tests {
+		if _, _, err := b.Dates(); err == nil {
+			t.Errorf("expected an error for booking %s", b.ID)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	conn, err := New(models.Channel{Kind: KindHTTP, BaseURL: "http://example.com"})
+	if err != nil || conn == nil {
+		t.Errorf("expected an http connector but got %v", err)
+	}
+
+	_, err = New(models.Channel{Kind: "carrier-pigeon"})
+	if err == nil {
+		t.Error("expected an error for an unknown kind of channel")
+	}
+}
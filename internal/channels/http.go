@@ -0,0 +1,111 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// HTTP is a connector for channels that speak a simple JSON API: updates are posted to /v1/availability,
+// /v1/rates and /v1/restrictions as {"updates": [...]}, and bookings are read from /v1/bookings?since=.
+// Requests carry the channel's API key as a bearer token. The mock OTA server speaks the same API.
+type HTTP struct {
+	baseURL string
+	apiKey  string
+	client  *http.Client
+}
+
+// NewHTTP returns a connector for the JSON API at baseURL
+func NewHTTP(baseURL, apiKey string, timeout time.Duration) *HTTP {
+	return &HTTP{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		apiKey:  apiKey,
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+// PushAvailability posts availability updates
+func (c *HTTP) PushAvailability(ctx context.Context, updates []AvailabilityUpdate) error {
+	return c.post(ctx, "/v1/availability", updates)
+}
+
+// PushRates posts rate updates
+func (c *HTTP) PushRates(ctx context.Context, updates []RateUpdate) error {
+	return c.post(ctx, "/v1/rates", updates)
+}
+
+// PushRestrictions posts restriction updates
+func (c *HTTP) PushRestrictions(ctx context.Context, updates []RestrictionUpdate) error {
+	return c.post(ctx, "/v1/restrictions", updates)
+}
+
+// PullBookings reads the bookings changed since a time
+func (c *HTTP) PullBookings(ctx context.Context, since time.Time) ([]Booking, error) {
+	req, err := c.request(ctx, http.MethodGet, "/v1/bookings?since="+url.QueryEscape(since.UTC().Format(time.RFC3339Nano)), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var body struct {
+		Bookings []Booking `json:"bookings"`
+	}
+	err = c.do(req, &body)
+	if err != nil {
+		return nil, err
+	}
+	return body.Bookings, nil
+}
+
+// post sends a batch of updates
+func (c *HTTP) post(ctx context.Context, path string, updates interface{}) error {
+	b, err := json.Marshal(map[string]interface{}{"updates": updates})
+	if err != nil {
+		return err
+	}
+
+	req, err := c.request(ctx, http.MethodPost, path, b)
+	if err != nil {
+		return err
+	}
+	return c.do(req, nil)
+}
+
+func (c *HTTP) request(ctx context.Context, method, path string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+// do sends a request, decoding a JSON response into out when it is not nil. Any response other than a
+// 2xx is an error.
+func (c *HTTP) do(req *http.Request, out interface{}) error {
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 200))
+		return fmt.Errorf("%s %s: %s: %s", req.Method, req.URL.Path, resp.Status, strings.TrimSpace(string(snippet)))
+	}
+
+	if out == nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
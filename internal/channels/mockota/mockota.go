@@ -0,0 +1,236 @@
+package mockota
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Poojasadgir/room-reservation/internal/channels"
+)
+
+// Server is a small in-memory online travel agency that speaks the JSON API of the HTTP channel connector.
+// It keeps the latest availability, rate and restrictions pushed for each room code and date, and the
+// bookings added to it. It is used in tests, and can be run on its own with cmd/mockota.
+type Server struct {
+	apiKey string
+
+	mu           sync.Mutex
+	availability map[string]int
+	rates        map[string]int
+	restrictions map[string]channels.RestrictionUpdate
+	bookings     map[string]channels.Booking
+	failNext     int
+	requests     int
+	mux          *http.ServeMux
+}
+
+// New returns a mock OTA that accepts requests carrying apiKey as a bearer token
+func New(apiKey string) *Server {
+	s := &Server{
+		apiKey:       apiKey,
+		availability: make(map[string]int),
+		rates:        make(map[string]int),
+		restrictions: make(map[string]channels.RestrictionUpdate),
+		bookings:     make(map[string]channels.Booking),
+		mux:          http.NewServeMux(),
+	}
+
+	s.mux.HandleFunc("/v1/availability", s.postAvailability)
+	s.mux.HandleFunc("/v1/rates", s.postRates)
+	s.mux.HandleFunc("/v1/restrictions", s.postRestrictions)
+	s.mux.HandleFunc("/v1/bookings", s.bookingsHandler)
+	return s
+}
+
+// ServeHTTP checks the API key, and fails the request if failures were asked for with FailNext
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+s.apiKey {
+		http.Error(w, "invalid api key", http.StatusUnauthorized)
+		return
+	}
+
+	s.mu.Lock()
+	s.requests++
+	fail := s.failNext > 0
+	if fail {
+		s.failNext--
+	}
+	s.mu.Unlock()
+
+	if fail {
+		http.Error(w, "temporarily unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// FailNext makes the next n requests fail with 503 Service Unavailable
+func (s *Server) FailNext(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failNext = n
+}
+
+// Requests returns how many authorised requests the server has received
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// Availability returns the availability last pushed for a room code on a date
+func (s *Server) Availability(code, date string) (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, ok := s.availability[key(code, date)]
+	return n, ok
+}
+
+// Rate returns the rate last pushed for a room code on a date
+func (s *Server) Rate(code, date string) (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n, ok := s.rates[key(code, date)]
+	return n, ok
+}
+
+// Restriction returns the restrictions last pushed for a room code on a date
+func (s *Server) Restriction(code, date string) (channels.RestrictionUpdate, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.restrictions[key(code, date)]
+	return r, ok
+}
+
+// AddBooking adds or replaces a booking, as if a guest had booked, changed or cancelled on the OTA. The
+// booking's UpdatedAt is set to now if it is empty.
+func (s *Server) AddBooking(b channels.Booking) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if b.UpdatedAt.IsZero() {
+		b.UpdatedAt = time.Now()
+	}
+	if b.Status == "" {
+		b.Status = channels.BookingConfirmed
+	}
+	s.bookings[b.ID] = b
+}
+
+func key(code, date string) string {
+	return code + "|" + date
+}
+
+// decodeUpdates reads a {"updates": [...]} request body
+func decodeUpdates(w http.ResponseWriter, r *http.Request, updates interface{}) bool {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+
+	body := struct {
+		Updates interface{} `json:"updates"`
+	}{updates}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid body: %s", err), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// accepted replies with how many updates were stored
+func accepted(w http.ResponseWriter, n int) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]int{"accepted": n})
+}
+
+func (s *Server) postAvailability(w http.ResponseWriter, r *http.Request) {
+	var updates []channels.AvailabilityUpdate
+	if !decodeUpdates(w, r, &updates) {
+		return
+	}
+
+	s.mu.Lock()
+	for _, u := range updates {
+		s.availability[key(u.RoomCode, u.Date)] = u.Available
+	}
+	s.mu.Unlock()
+	accepted(w, len(updates))
+}
+
+func (s *Server) postRates(w http.ResponseWriter, r *http.Request) {
+	var updates []channels.RateUpdate
+	if !decodeUpdates(w, r, &updates) {
+		return
+	}
+
+	s.mu.Lock()
+	for _, u := range updates {
+		s.rates[key(u.RoomCode, u.Date)] = u.Rate
+	}
+	s.mu.Unlock()
+	accepted(w, len(updates))
+}
+
+func (s *Server) postRestrictions(w http.ResponseWriter, r *http.Request) {
+	var updates []channels.RestrictionUpdate
+	if !decodeUpdates(w, r, &updates) {
+		return
+	}
+
+	s.mu.Lock()
+	for _, u := range updates {
+		s.restrictions[key(u.RoomCode, u.Date)] = u
+	}
+	s.mu.Unlock()
+	accepted(w, len(updates))
+}
+
+// bookingsHandler lists the bookings changed since the since parameter, oldest first. Posting a booking
+// adds it, which is handy when trying the channel manager by hand.
+func (s *Server) bookingsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var b channels.Booking
+		err := json.NewDecoder(r.Body).Decode(&b)
+		if err != nil || strings.TrimSpace(b.ID) == "" {
+			http.Error(w, "invalid booking", http.StatusBadRequest)
+			return
+		}
+		s.AddBooking(b)
+		w.WriteHeader(http.StatusCreated)
+		return
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var since time.Time
+	if v := r.URL.Query().Get("since"); v != "" {
+		var err error
+		since, err = time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "invalid since", http.StatusBadRequest)
+			return
+		}
+	}
+
+	s.mu.Lock()
+	bookings := []channels.Booking{}
+	for _, b := range s.bookings {
+		if b.UpdatedAt.After(since) {
+			bookings = append(bookings, b)
+		}
+	}
+	s.mu.Unlock()
+
+	sort.Slice(bookings, func(i, j int) bool { return bookings[i].UpdatedAt.Before(bookings[j].UpdatedAt) })
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"bookings": bookings})
+}
@@ -0,0 +1,99 @@
+package mockota
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Poojasadgir/room-reservation/internal/channels"
+)
+
+func TestHTTPConnector(t *testing.T) {
+	ota := New("secret-key")
+	srv := httptest.NewServer(ota)
+	defer srv.Close()
+
+	ctx := context.Background()
+	conn := channels.NewHTTP(srv.URL, "secret-key", time.Second)
+
+	err := conn.PushAvailability(ctx, []channels.AvailabilityUpdate{{RoomCode: "GQ", Date: "2050-01-01", Available: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = conn.PushRates(ctx, []channels.RateUpdate{{RoomCode: "GQ", Date: "2050-01-01", Rate: 12000}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = conn.PushRestrictions(ctx, []channels.RestrictionUpdate{{RoomCode: "GQ", Date: "2050-01-01", MinStay: 1, Closed: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n, ok := ota.Availability("GQ", "2050-01-01"); !ok || n != 1 {
+		t.Errorf("expected availability 1 to be pushed but got %d (%t)", n, ok)
+	}
+	if n, ok := ota.Rate("GQ", "2050-01-01"); !ok || n != 12000 {
+		t.Errorf("expected rate 12000 to be pushed but got %d (%t)", n, ok)
+	}
+	if r, ok := ota.Restriction("GQ", "2050-01-01"); !ok || !r.Closed || r.MinStay != 1 {
+		t.Errorf("expected the date to be closed but got %+v (%t)", r, ok)
+	}
+
+	earlier := time.Date(2050, 1, 1, 9, 0, 0, 0, time.UTC)
+	later := earlier.Add(time.Hour)
+	ota.AddBooking(channels.Booking{ID: "b2", RoomCode: "GQ", StartDate: "2050-02-01", EndDate: "2050-02-03", UpdatedAt: later})
+	ota.AddBooking(channels.Booking{ID: "b1", RoomCode: "GQ", StartDate: "2050-01-10", EndDate: "2050-01-12", UpdatedAt: earlier})
+
+	bookings, err := conn.PullBookings(ctx, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bookings) != 2 || bookings[0].ID != "b1" || bookings[1].ID != "b2" {
+		t.Fatalf("expected both bookings, oldest first, but got %+v", bookings)
+	}
+	if bookings[0].Status != channels.BookingConfirmed {
+		t.Errorf("expected bookings to be confirmed by default but got %q", bookings[0].Status)
+	}
+
+	bookings, err = conn.PullBookings(ctx, earlier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bookings) != 1 || bookings[0].ID != "b2" {
+		t.Errorf("expected only the booking changed since the first but got %+v", bookings)
+	}
+}
+
+func TestFailures(t *testing.T) {
+	ota := New("secret-key")
+	srv := httptest.NewServer(ota)
+	defer srv.Close()
+
+	ctx := context.Background()
+	update := []channels.AvailabilityUpdate{{RoomCode: "GQ", Date: "2050-01-01", Available: 0}}
+
+	wrongKey := channels.NewHTTP(srv.URL, "wrong-key", time.Second)
+	if err := wrongKey.PushAvailability(ctx, update); err == nil {
+		t.Error("expected an error for the wrong api key")
+	}
+
+	conn := channels.NewHTTP(srv.URL, "secret-key", time.Second)
+	ota.FailNext(1)
+	if err := conn.PushAvailability(ctx, update); err == nil {
+		t.Error("expected the first push to fail")
+	}
+	if _, ok := ota.Availability("GQ", "2050-01-01"); ok {
+		t.Error("expected the failed push not to be stored")
+	}
+
+	if err := conn.PushAvailability(ctx, update); err != nil {
+		t.Errorf("expected the retried push to succeed but got %s", err)
+	}
+	if n, ok := ota.Availability("GQ", "2050-01-01"); !ok || n != 0 {
+		t.Errorf("expected availability 0 after the retry but got %d (%t)", n, ok)
+	}
+	if ota.Requests() != 2 {
+		t.Errorf("expected 2 authorised requests but got %d", ota.Requests())
+	}
+}
@@ -3,8 +3,10 @@ package config
 import (
 	"html/template"
 	"log"
+	"time"
 
-	"github.com/Poojasadgir/room-reservation/internal/models"
+	"github.com/Poojasadgir/room-reservation/internal/events"
+	"github.com/Poojasadgir/room-reservation/internal/mailer"
 	"github.com/alexedwards/scs/v2"
 )
 
@@ -16,5 +18,20 @@ type AppConfig struct {
 	ErrorLog      *log.Logger
 	InProduction  bool
 	Session       *scs.SessionManager
-	MailChannel   chan models.MailData
+	BaseURL       string
+	NoShowCutoff  time.Duration
+	Mailer        mailer.Mailer
+	Property      Property
+	Events        *events.Bus
+}
+
+// Property describes the bed and breakfast, for calendar invites sent to guests
+type Property struct {
+	Name    string
+	Address string
+	// CheckIn and CheckOut are the times after midnight that guests arrive and leave
+	CheckIn  time.Duration
+	CheckOut time.Duration
+	// Location is the time zone of the property
+	Location *time.Location
 }
@@ -0,0 +1,228 @@
+package emails
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"path/filepath"
+	"sync"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/Poojasadgir/room-reservation/internal/models"
+	"github.com/Poojasadgir/room-reservation/internal/render"
+)
+
+// Email is the typed data for one of the email templates
+type Email interface {
+	// Template is the name of the template the email is rendered with
+	Template() string
+	// Subject is the subject line of the email
+	Subject() string
+}
+
+// Names of the email templates. Each has a <name>.html.tmpl and a <name>.txt.tmpl file, rendered
+// inside layout.html.tmpl and layout.txt.tmpl.
+const (
+	ConfirmationTemplate      = "confirmation"
+	ModificationTemplate      = "modification"
+	OwnerNotificationTemplate = "owner-notification"
+	CancellationTemplate      = "cancellation"
+	ReminderTemplate          = "reminder"
+	NoShowSummaryTemplate     = "no-show-summary"
+)
+
+// LegacyTemplate wraps the body of a message queued before the email templates in the shared layout. It is
+// not shown to staff, since there is nothing to preview.
+const LegacyTemplate = "legacy"
+
+// Names lists every email template, in the order they are shown to staff
+var Names = []string{
+	ConfirmationTemplate,
+	ModificationTemplate,
+	OwnerNotificationTemplate,
+	CancellationTemplate,
+	ReminderTemplate,
+	NoShowSummaryTemplate,
+}
+
+// Confirmation is sent to a guest when their reservation is made
+type Confirmation struct {
+	Reservation models.Reservation
+	CancelURL   string
+}
+
+// Template returns the template name
+func (e Confirmation) Template() string { return ConfirmationTemplate }
+
+// Subject returns the subject line
+func (e Confirmation) Subject() string { return "Reservation Confirmation" }
+
+// Modification is sent to a guest when the dates or room of their reservation change
+type Modification struct {
+	Reservation models.Reservation
+	CancelURL   string
+}
+
+// Template returns the template name
+func (e Modification) Template() string { return ModificationTemplate }
+
+// Subject returns the subject line
+func (e Modification) Subject() string { return "Reservation Updated" }
+
+// OwnerNotification tells the property owner that a reservation was made, or cancelled when Cancelled is set
+type OwnerNotification struct {
+	Reservation models.Reservation
+	Cancelled   bool
+	Fee         int
+}
+
+// Template returns the template name
+func (e OwnerNotification) Template() string { return OwnerNotificationTemplate }
+
+// Subject returns the subject line
+func (e OwnerNotification) Subject() string {
+	if e.Cancelled {
+		return "Cancellation Notification"
+	}
+	return "Reservation Notification"
+}
+
+// Cancellation is sent to a guest when their reservation is cancelled
+type Cancellation struct {
+	Reservation models.Reservation
+	Fee         int
+}
+
+// Template returns the template name
+func (e Cancellation) Template() string { return CancellationTemplate }
+
+// Subject returns the subject line
+func (e Cancellation) Subject() string { return "Reservation Cancelled" }
+
+// Reminder is sent to a guest shortly before they arrive
+type Reminder struct {
+	Reservation models.Reservation
+	CancelURL   string
+}
+
+// Template returns the template name
+func (e Reminder) Template() string { return ReminderTemplate }
+
+// Subject returns the subject line
+func (e Reminder) Subject() string {
+	return fmt.Sprintf("Your stay starts %s", e.Reservation.StartDate.Format("Monday, January 2"))
+}
+
+// NoShowSummary tells the property owner which reservations were flagged as no-shows since a time
+type NoShowSummary struct {
+	Since        time.Time
+	Reservations []models.Reservation
+}
+
+// Template returns the template name
+func (e NoShowSummary) Template() string { return NoShowSummaryTemplate }
+
+// Subject returns the subject line
+func (e NoShowSummary) Subject() string {
+	return fmt.Sprintf("No-show Summary: %d reservation(s)", len(e.Reservations))
+}
+
+// Legacy is a message queued in the outbox before the email templates, which holds only the HTML body that
+// used to be spliced into the basic.html layout when it was sent
+type Legacy struct {
+	Title string
+	Body  htmltemplate.HTML
+}
+
+// NewLegacy wraps the body of a message queued before the email templates. The body was built by the app
+// itself, so it is trusted as HTML.
+func NewLegacy(subject, body string) Legacy {
+	return Legacy{Title: subject, Body: htmltemplate.HTML(body)}
+}
+
+// Template returns the template name
+func (e Legacy) Template() string { return LegacyTemplate }
+
+// Subject returns the subject line
+func (e Legacy) Subject() string { return e.Title }
+
+var functions = map[string]interface{}{
+	"humanDate":  render.HumanDate,
+	"formatDate": render.FormatDate,
+	"currency":   render.FormatCurrency,
+}
+
+// Renderer renders emails from the templates in a directory. Templates are parsed the first time they
+// are used and kept for later emails.
+type Renderer struct {
+	dir string
+
+	mu    sync.Mutex
+	html  map[string]*htmltemplate.Template
+	text  map[string]*texttemplate.Template
+	cache bool
+}
+
+// New creates a renderer for the templates in dir. When cache is false the templates are parsed again
+// for every email, so that changes show up without a restart.
+func New(dir string, cache bool) *Renderer {
+	return &Renderer{
+		dir:   dir,
+		html:  make(map[string]*htmltemplate.Template),
+		text:  make(map[string]*texttemplate.Template),
+		cache: cache,
+	}
+}
+
+// Render renders an email, returning its HTML body and its plain-text alternative
+func (r *Renderer) Render(e Email) (string, string, error) {
+	ht, tt, err := r.templates(e.Template())
+	if err != nil {
+		return "", "", err
+	}
+
+	var html, text bytes.Buffer
+	err = ht.ExecuteTemplate(&html, "email", e)
+	if err != nil {
+		return "", "", err
+	}
+	err = tt.ExecuteTemplate(&text, "email", e)
+	if err != nil {
+		return "", "", err
+	}
+
+	return html.String(), text.String(), nil
+}
+
+// templates returns the parsed HTML and text templates for an email template name
+func (r *Renderer) templates(name string) (*htmltemplate.Template, *texttemplate.Template, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cache {
+		if ht, ok := r.html[name]; ok {
+			return ht, r.text[name], nil
+		}
+	}
+
+	ht, err := htmltemplate.New(name).Funcs(functions).ParseFiles(
+		filepath.Join(r.dir, name+".html.tmpl"),
+		filepath.Join(r.dir, "layout.html.tmpl"),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tt, err := texttemplate.New(name).Funcs(functions).ParseFiles(
+		filepath.Join(r.dir, name+".txt.tmpl"),
+		filepath.Join(r.dir, "layout.txt.tmpl"),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r.html[name] = ht
+	r.text[name] = tt
+	return ht, tt, nil
+}
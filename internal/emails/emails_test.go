@@ -0,0 +1,104 @@
+package emails
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Poojasadgir/room-reservation/internal/models"
+)
+
+var pathToTemplates = "./../../email-templates"
+
+func TestRenderSamples(t *testing.T) {
+	r := New(pathToTemplates, true)
+
+	for _, name := range Names {
+		e, ok := Sample(name)
+		if !ok {
+			t.Errorf("%s: no sample", name)
+			continue
+		}
+
+		html, text, err := r.Render(e)
+		if err != nil {
+			t.Errorf("%s: %s", name, err)
+			continue
+		}
+
+		if !strings.Contains(html, "<title>"+e.Subject()+"</title>") {
+			t.Errorf("%s: expected the HTML to be rendered in the layout", name)
+		}
+		if strings.TrimSpace(text) == "" || strings.Contains(text, "<") {
+			t.Errorf("%s: expected a plain-text part but got %q", name, text)
+		}
+	}
+
+	if _, ok := Sample("missing"); ok {
+		t.Error("expected no sample for a missing template")
+	}
+}
+
+func TestRenderSplitStay(t *testing.T) {
+	r := New(pathToTemplates, false)
+
+	e, _ := Sample(ReminderTemplate)
+	reminder := e.(Reminder)
+	res := reminder.Reservation
+	res.Segments = []models.StaySegment{
+		{RoomID: 1, StartDate: res.StartDate, EndDate: res.StartDate.AddDate(0, 0, 1), Room: models.Room{RoomName: "General's Quarters"}},
+		{RoomID: 2, StartDate: res.StartDate.AddDate(0, 0, 1), EndDate: res.EndDate, Room: models.Room{RoomName: "Major's Suite"}},
+	}
+
+	for _, e := range []Email{Confirmation{Reservation: res}, Reminder{Reservation: res}, OwnerNotification{Reservation: res}} {
+		_, text, err := r.Render(e)
+		if err != nil {
+			t.Errorf("%s: %s", e.Template(), err)
+			continue
+		}
+		if !strings.Contains(text, ", then Major's Suite from ") {
+			t.Errorf("%s: expected each room of the stay to be named but got %q", e.Template(), text)
+		}
+	}
+}
+
+func TestRenderEscapesGuestInput(t *testing.T) {
+	r := New(pathToTemplates, false)
+
+	e := Confirmation{
+		Reservation: models.Reservation{
+			FirstName: `<script>alert("hi")</script>`,
+			Answers:   []models.ReservationAnswer{{Label: "Notes", Answer: "<b>late</b>"}},
+		},
+		CancelURL: "http://localhost/reservations/1/cancel?token=abc",
+	}
+
+	html, text, err := r.Render(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(html, "<script>alert") || strings.Contains(html, "<b>late</b>") {
+		t.Error("expected guest input to be escaped in the HTML part")
+	}
+	if !strings.Contains(html, "&lt;script&gt;") {
+		t.Error("expected the escaped guest name in the HTML part")
+	}
+	if !strings.Contains(text, `<script>alert("hi")</script>`) {
+		t.Error("expected the guest name as written in the plain-text part")
+	}
+	if !strings.Contains(text, "- Notes: <b>late</b>") {
+		t.Error("expected the answers in the plain-text part")
+	}
+}
+
+func TestRenderLegacy(t *testing.T) {
+	r := New(pathToTemplates, false)
+
+	html, _, err := r.Render(NewLegacy("Reservation Confirmation", "<strong>Reservation Confirmation</strong>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(html, "<title>Reservation Confirmation</title>") || !strings.Contains(html, "<strong>Reservation Confirmation</strong>") {
+		t.Errorf("expected the body to be rendered as written in the layout but got %q", html)
+	}
+}
@@ -0,0 +1,48 @@
+package emails
+
+import (
+	"time"
+
+	"github.com/Poojasadgir/room-reservation/internal/models"
+)
+
+// Sample returns an email filled with example data, for previewing a template. It returns false if
+// there is no template with the name.
+func Sample(name string) (Email, bool) {
+	start := time.Now().AddDate(0, 0, 14).Truncate(24 * time.Hour)
+	res := models.Reservation{
+		ID:        1,
+		FirstName: "Jane",
+		LastName:  "Smith",
+		Email:     "jane@example.com",
+		Phone:     "555-555-5555",
+		StartDate: start,
+		EndDate:   start.AddDate(0, 0, 3),
+		Status:    models.ReservationStatusConfirmed,
+		Answers: []models.ReservationAnswer{
+			{Label: "Bed type", Answer: "Queen"},
+			{Label: "Arrival time", Answer: "After 6pm"},
+		},
+		Room: models.Room{ID: 1, RoomName: "General's Quarters", NightlyRate: 12500},
+	}
+	cancelURL := "http://localhost:1023/reservations/1/cancel?token=example"
+
+	switch name {
+	case ConfirmationTemplate:
+		return Confirmation{Reservation: res, CancelURL: cancelURL}, true
+	case ModificationTemplate:
+		return Modification{Reservation: res, CancelURL: cancelURL}, true
+	case OwnerNotificationTemplate:
+		return OwnerNotification{Reservation: res}, true
+	case CancellationTemplate:
+		return Cancellation{Reservation: res, Fee: 12500}, true
+	case ReminderTemplate:
+		return Reminder{Reservation: res, CancelURL: cancelURL}, true
+	case NoShowSummaryTemplate:
+		noShow := res
+		noShow.Status = models.ReservationStatusNoShow
+		noShow.NoShowFee = 12500
+		return NoShowSummary{Since: time.Now().AddDate(0, 0, -1), Reservations: []models.Reservation{noShow}}, true
+	}
+	return nil, false
+}
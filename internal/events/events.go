@@ -0,0 +1,158 @@
+package events
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// Kinds of event
+const (
+	ReservationChanged = "reservation"
+	BlockChanged       = "block"
+)
+
+// Event tells open pages that the nights a room is free for changed. It holds no guest details, so that
+// the same events can be streamed to the public availability widgets.
+type Event struct {
+	Kind string `json:"kind"`
+	// RoomID is the room whose availability changed, or 0 when any room may have changed
+	RoomID int `json:"room_id"`
+	// Start and End are the first night changed and the day after the last, or blank when any night
+	// may have changed
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+}
+
+// New returns an event for the nights of a room from start up to end. Zero dates mean any night.
+func New(kind string, roomID int, start, end time.Time) Event {
+	e := Event{Kind: kind, RoomID: roomID}
+	if !start.IsZero() && !end.IsZero() {
+		e.Start = start.Format("2006-01-02")
+		e.End = end.Format("2006-01-02")
+	}
+	return e
+}
+
+// Affects reports whether the event may have changed the room for any of the nights from start up to end.
+// A room ID of 0 matches every room.
+func (e Event) Affects(roomID int, start, end time.Time) bool {
+	if roomID != 0 && e.RoomID != 0 && e.RoomID != roomID {
+		return false
+	}
+	if e.Start == "" {
+		return true
+	}
+	first, err1 := time.Parse("2006-01-02", e.Start)
+	last, err2 := time.Parse("2006-01-02", e.End)
+	if err1 != nil || err2 != nil {
+		return true
+	}
+	return first.Before(end) && last.After(start)
+}
+
+// Encode returns the JSON form of an event, as sent to pages and between instances
+func (e Event) Encode() []byte {
+	data, _ := json.Marshal(e)
+	return data
+}
+
+// Decode reads an event encoded by Encode
+func Decode(data []byte) (Event, error) {
+	var e Event
+	err := json.Unmarshal(data, &e)
+	return e, err
+}
+
+// Relay carries events between the instances of the app. A bus with a relay sends every event through it
+// rather than delivering it directly, and the relay delivers it back to the bus of every instance, this one
+// included.
+type Relay interface {
+	Send(e Event) error
+}
+
+// SubscriberBuffer is how many events a subscriber can fall behind by before further events are dropped
+const SubscriberBuffer = 16
+
+// Subscription receives the events published after it was made
+type Subscription struct {
+	Events <-chan Event
+
+	bus *Bus
+	ch  chan Event
+}
+
+// Close stops the subscription. Its channel is closed once no more events will be sent on it.
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+
+	if _, ok := s.bus.subscribers[s]; ok {
+		delete(s.bus.subscribers, s)
+		close(s.ch)
+	}
+}
+
+// Bus fans events out to the subscribers of this instance. A subscriber that falls behind misses events
+// rather than holding up the others, since pages reload what they show from the database anyway.
+type Bus struct {
+	relay Relay
+
+	mu          sync.Mutex
+	subscribers map[*Subscription]struct{}
+}
+
+// NewBus creates a bus. With a nil relay, events are only delivered to subscribers of this instance.
+func NewBus(relay Relay) *Bus {
+	return &Bus{
+		relay:       relay,
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish sends an event to every subscriber, through the relay when there is one. If the relay fails
+// the event is still delivered here and the error is returned.
+func (b *Bus) Publish(e Event) error {
+	if b.relay != nil {
+		err := b.relay.Send(e)
+		if err != nil {
+			b.Deliver(e)
+		}
+		return err
+	}
+	b.Deliver(e)
+	return nil
+}
+
+// Deliver sends an event to the subscribers of this instance, without going through the relay. Relays
+// call it with the events they receive.
+func (b *Bus) Deliver(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for s := range b.subscribers {
+		select {
+		case s.ch <- e:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a subscription to the events published from now on. It must be closed when done.
+func (b *Bus) Subscribe() *Subscription {
+	ch := make(chan Event, SubscriberBuffer)
+	s := &Subscription{Events: ch, bus: b, ch: ch}
+
+	b.mu.Lock()
+	b.subscribers[s] = struct{}{}
+	b.mu.Unlock()
+
+	return s
+}
+
+// Subscribers returns the number of open subscriptions
+func (b *Bus) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subscribers)
+}
@@ -0,0 +1,120 @@
+package events
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func date(s string) time.Time {
+	d, _ := time.Parse("2006-01-02", s)
+	return d
+}
+
+func TestAffects(t *testing.T) {
+	e := New(ReservationChanged, 1, date("2050-01-10"), date("2050-01-12"))
+
+	tests := []struct {
+		name     string
+		event    Event
+		roomID   int
+		start    string
+		end      string
+		expected bool
+	}{
+		{"same nights", e, 1, "2050-01-11", "2050-01-20", true},
+		{"any room", e, 0, "2050-01-01", "2050-01-11", true},
+		{"other room", e, 2, "2050-01-10", "2050-01-12", false},
+		{"departure day", e, 1, "2050-01-12", "2050-01-14", false},
+		{"before", e, 1, "2050-01-01", "2050-01-10", false},
+		{"every room", New(BlockChanged, 0, date("2050-01-10"), date("2050-01-12")), 2, "2050-01-11", "2050-01-12", true},
+		{"every night", New(BlockChanged, 1, time.Time{}, time.Time{}), 1, "2050-06-01", "2050-06-02", true},
+	}
+
+	for _, tt := range tests {
+		if got := tt.event.Affects(tt.roomID, date(tt.start), date(tt.end)); got != tt.expected {
+			t.Errorf("%s: expected %t but got %t", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	e := New(BlockChanged, 2, date("2050-01-10"), date("2050-01-12"))
+	if string(e.Encode()) != `{"kind":"block","room_id":2,"start":"2050-01-10","end":"2050-01-12"}` {
+		t.Errorf("unexpected encoding %s", e.Encode())
+	}
+
+	decoded, err := Decode(e.Encode())
+	if err != nil || decoded != e {
+		t.Errorf("expected %+v but got %+v with %v", e, decoded, err)
+	}
+}
+
+func TestBus(t *testing.T) {
+	bus := NewBus(nil)
+	a := bus.Subscribe()
+	b := bus.Subscribe()
+	if bus.Subscribers() != 2 {
+		t.Fatalf("expected 2 subscribers but got %d", bus.Subscribers())
+	}
+
+	e := New(ReservationChanged, 1, date("2050-01-10"), date("2050-01-12"))
+	if err := bus.Publish(e); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []*Subscription{a, b} {
+		if got := <-s.Events; got != e {
+			t.Errorf("expected %+v but got %+v", e, got)
+		}
+	}
+
+	b.Close()
+	b.Close()
+	if _, ok := <-b.Events; ok || bus.Subscribers() != 1 {
+		t.Error("expected a closed subscription to stop receiving events")
+	}
+
+	// a subscriber that falls behind misses events rather than blocking the bus
+	for i := 0; i < SubscriberBuffer+5; i++ {
+		bus.Publish(e)
+	}
+	if len(a.Events) != SubscriberBuffer {
+		t.Errorf("expected %d buffered events but got %d", SubscriberBuffer, len(a.Events))
+	}
+	a.Close()
+}
+
+// loopback relays events straight back to a bus, as the database does for every instance
+type loopback struct {
+	bus  *Bus
+	sent int
+	err  error
+}
+
+func (l *loopback) Send(e Event) error {
+	l.sent++
+	if l.err != nil {
+		return l.err
+	}
+	l.bus.Deliver(e)
+	return nil
+}
+
+func TestBusRelay(t *testing.T) {
+	relay := &loopback{}
+	bus := NewBus(relay)
+	relay.bus = bus
+	s := bus.Subscribe()
+	defer s.Close()
+
+	e := New(ReservationChanged, 1, date("2050-01-10"), date("2050-01-12"))
+	if err := bus.Publish(e); err != nil || relay.sent != 1 || len(s.Events) != 1 {
+		t.Errorf("expected the event to be delivered once through the relay but got %d sent, %d delivered, %v", relay.sent, len(s.Events), err)
+	}
+	<-s.Events
+
+	relay.err = errors.New("connection refused")
+	if err := bus.Publish(e); err == nil || len(s.Events) != 1 {
+		t.Errorf("expected the event to be delivered here when the relay fails but got %d delivered, %v", len(s.Events), err)
+	}
+}
@@ -0,0 +1,74 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Channel is the Postgres notification channel events are relayed on
+const Channel = "room_events"
+
+// PostgresRelay relays events between the instances of the app that share a database, with NOTIFY
+type PostgresRelay struct {
+	DB *sql.DB
+}
+
+// Send notifies every instance listening on the channel, this one included
+func (p PostgresRelay) Send(e Event) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := p.DB.ExecContext(ctx, "SELECT pg_notify($1, $2)", Channel, string(e.Encode()))
+	return err
+}
+
+// Listen delivers the events relayed by every instance to the bus until ctx is done. It keeps a connection
+// of its own open for LISTEN, since pooled connections are shared, and connects again after retry when the
+// connection is lost. Events sent while it is reconnecting are missed.
+func Listen(ctx context.Context, dsn string, bus *Bus, retry time.Duration, errorLog *log.Logger) {
+	for {
+		err := listen(ctx, dsn, bus, errorLog)
+		if ctx.Err() != nil {
+			return
+		}
+		errorLog.Printf("event relay stopped, reconnecting in %s: %s", retry, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retry):
+		}
+	}
+}
+
+// listen holds a single connection listening on the channel, until it fails or ctx is done
+func listen(ctx context.Context, dsn string, bus *Bus, errorLog *log.Logger) error {
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	_, err = conn.Exec(ctx, "LISTEN "+Channel)
+	if err != nil {
+		return err
+	}
+
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		e, err := Decode([]byte(n.Payload))
+		if err != nil {
+			errorLog.Printf("cannot read relayed event %q: %s", n.Payload, err)
+			continue
+		}
+		bus.Deliver(e)
+	}
+}
@@ -0,0 +1,69 @@
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CSV writes a table as comma separated values
+type CSV struct {
+	w *csv.Writer
+}
+
+// NewCSV returns a writer of comma separated values
+func NewCSV(w io.Writer) *CSV {
+	return &CSV{w: csv.NewWriter(w)}
+}
+
+// plainNumber matches a signed number or phone number, such as -12.5 or +1 (555) 010-0100, which a
+// spreadsheet cannot run as a formula
+var plainNumber = regexp.MustCompile(`^[+-][0-9][0-9 ().-]*$`)
+
+// formula reports whether a spreadsheet would take text for a formula
+func formula(v string) bool {
+	if v == "" {
+		return false
+	}
+	if strings.ContainsRune("=@\t\r", rune(v[0])) {
+		return true
+	}
+	return strings.ContainsRune("+-", rune(v[0])) && !plainNumber.MatchString(v)
+}
+
+// Write writes a row. Text that a spreadsheet would take for a formula is prefixed with an apostrophe so
+// that opening the file cannot run it. Numbers and phone numbers starting with a sign are left as they are.
+func (c *CSV) Write(row ...interface{}) error {
+	record := make([]string, len(row))
+	for i, cell := range row {
+		switch v := cell.(type) {
+		case string:
+			if formula(v) {
+				v = "'" + v
+			}
+			record[i] = v
+		case time.Time:
+			if !v.IsZero() {
+				record[i] = v.Format("2006-01-02")
+			}
+		case int:
+			record[i] = strconv.Itoa(v)
+		case float64:
+			record[i] = strconv.FormatFloat(v, 'f', -1, 64)
+		case nil:
+		default:
+			record[i] = fmt.Sprint(v)
+		}
+	}
+	return c.w.Write(record)
+}
+
+// Close flushes the rows written
+func (c *CSV) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
@@ -0,0 +1,53 @@
+package export
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Formats that tables can be exported in
+const (
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+)
+
+// ErrUnknownFormat is returned by New for a format other than FormatCSV or FormatXLSX
+var ErrUnknownFormat = errors.New("unknown export format")
+
+// Writer writes a table one row at a time, so that rows can be streamed from the database as they are
+// read. Cells may be strings, ints, float64s, bools or times; times are written as dates. Close must be
+// called once the last row has been written.
+type Writer interface {
+	Write(row ...interface{}) error
+	Close() error
+}
+
+// New returns a writer for a format. The sheet name is used by formats that have one.
+func New(w io.Writer, format, sheet string) (Writer, error) {
+	switch format {
+	case FormatCSV, "":
+		return NewCSV(w), nil
+	case FormatXLSX:
+		return NewXLSX(w, sheet)
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+// ContentType returns the media type of a format
+func ContentType(format string) string {
+	if format == FormatXLSX {
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// Filename returns the name to download an export as, stamped with the date it was made
+func Filename(name, format string, now time.Time) string {
+	if format == "" {
+		format = FormatCSV
+	}
+	return fmt.Sprintf("%s-%s.%s", name, now.Format("2006-01-02"), format)
+}
@@ -0,0 +1,119 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"testing"
+	"time"
+)
+
+var arrival = time.Date(2050, 1, 10, 0, 0, 0, 0, time.UTC)
+
+func TestCSV(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := New(&buf, FormatCSV, "Reservations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = w.Write("ID", "Name", "Arrival", "Rate")
+	_ = w.Write(1, "Smith, Jane", arrival, 120.5)
+	_ = w.Write(2, "=HYPERLINK(\"x\")", time.Time{}, nil)
+	_ = w.Write(3, "+1 (555) 010-0100", "-12.5", "-2+3+cmd|' /C calc'!A0")
+	_ = w.Write(4, "@SUM(A1)", "+A1", "-")
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "ID,Name,Arrival,Rate\n1,\"Smith, Jane\",2050-01-10,120.5\n2,\"'=HYPERLINK(\"\"x\"\")\",,\n" +
+		"3,+1 (555) 010-0100,-12.5,'-2+3+cmd|' /C calc'!A0\n" +
+		"4,'@SUM(A1),'+A1,'-\n"
+	if buf.String() != want {
+		t.Errorf("expected\n%q\nbut got\n%q", want, buf.String())
+	}
+}
+
+func TestXLSX(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := New(&buf, FormatXLSX, "Guests: all")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = w.Write("ID", "Name", "Arrival", "VIP")
+	_ = w.Write(7, "Jane <Smith> & co", arrival, true)
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := make(map[string][]byte)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name], _ = io.ReadAll(rc)
+		rc.Close()
+	}
+
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/styles.xml", "xl/worksheets/sheet1.xml"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("expected the workbook to have %s", name)
+		}
+	}
+	if !bytes.Contains(files["xl/workbook.xml"], []byte(`name="Guests- all"`)) {
+		t.Errorf("expected the sheet name to be cleaned up but got %s", files["xl/workbook.xml"])
+	}
+
+	var sheet struct {
+		Rows []struct {
+			Cells []struct {
+				Type   string `xml:"t,attr"`
+				Style  string `xml:"s,attr"`
+				Value  string `xml:"v"`
+				Inline string `xml:"is>t"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	err = xml.Unmarshal(files["xl/worksheets/sheet1.xml"], &sheet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sheet.Rows) != 2 || len(sheet.Rows[1].Cells) != 4 {
+		t.Fatalf("expected 2 rows of 4 cells but got %+v", sheet.Rows)
+	}
+	cells := sheet.Rows[1].Cells
+	if cells[0].Value != "7" || cells[0].Type != "" {
+		t.Errorf("expected a number but got %+v", cells[0])
+	}
+	if cells[1].Inline != "Jane <Smith> & co" || cells[1].Type != "inlineStr" {
+		t.Errorf("expected inline text but got %+v", cells[1])
+	}
+	if cells[2].Value != "54798" || cells[2].Style != "1" {
+		t.Errorf("expected a date serial with the date style but got %+v", cells[2])
+	}
+	if cells[3].Value != "1" || cells[3].Type != "b" {
+		t.Errorf("expected a boolean but got %+v", cells[3])
+	}
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(io.Discard, "pdf", "x")
+	if err != ErrUnknownFormat {
+		t.Errorf("expected ErrUnknownFormat but got %v", err)
+	}
+
+	if got := Filename("guests", FormatXLSX, arrival); got != "guests-2050-01-10.xlsx" {
+		t.Errorf("unexpected filename %s", got)
+	}
+}
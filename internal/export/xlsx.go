@@ -0,0 +1,173 @@
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// XLSX writes a table as an Excel workbook with a single sheet. Rows are written straight into the
+// compressed sheet as they come, so the workbook is never held in memory. Text is written inline rather
+// than in a shared strings table, which every spreadsheet reads but which keeps the writer streaming.
+type XLSX struct {
+	zw    *zip.Writer
+	sheet *bufio.Writer
+}
+
+// xlsxParts are the parts of the workbook written before its sheet
+var xlsxParts = []struct {
+	name    string
+	content string
+}{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+</Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>
+</Relationships>`},
+	// style 1 is the built-in short date format, used for dates
+	{"xl/styles.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<fonts count="1"><font><sz val="11"/><name val="Calibri"/></font></fonts>
+<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>
+<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>
+<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>
+<cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/><xf numFmtId="14" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/></cellXfs>
+</styleSheet>`},
+}
+
+// NewXLSX starts a workbook with a sheet of the given name
+func NewXLSX(w io.Writer, sheet string) (*XLSX, error) {
+	zw := zip.NewWriter(w)
+
+	parts := append(xlsxParts, struct {
+		name    string
+		content string
+	}{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="` + escape(sheetName(sheet)) + `" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`})
+
+	for _, p := range parts {
+		f, err := zw.Create(p.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, p.content); err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	x := &XLSX{zw: zw, sheet: bufio.NewWriter(f)}
+	_, err = x.sheet.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	if err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// excelEpoch is day 0 of the dates Excel stores as serial numbers
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// Write writes a row
+func (x *XLSX) Write(row ...interface{}) error {
+	var b strings.Builder
+	b.WriteString("<row>")
+	for _, cell := range row {
+		switch v := cell.(type) {
+		case string:
+			if v == "" {
+				b.WriteString("<c/>")
+				continue
+			}
+			b.WriteString(`<c t="inlineStr"><is><t xml:space="preserve">`)
+			b.WriteString(escape(v))
+			b.WriteString("</t></is></c>")
+		case time.Time:
+			if v.IsZero() {
+				b.WriteString("<c/>")
+				continue
+			}
+			day := time.Date(v.Year(), v.Month(), v.Day(), 0, 0, 0, 0, time.UTC)
+			fmt.Fprintf(&b, `<c s="1"><v>%d</v></c>`, int(day.Sub(excelEpoch).Hours()/24))
+		case int:
+			fmt.Fprintf(&b, "<c><v>%d</v></c>", v)
+		case float64:
+			fmt.Fprintf(&b, "<c><v>%s</v></c>", strconv.FormatFloat(v, 'f', -1, 64))
+		case bool:
+			n := 0
+			if v {
+				n = 1
+			}
+			fmt.Fprintf(&b, `<c t="b"><v>%d</v></c>`, n)
+		case nil:
+			b.WriteString("<c/>")
+		default:
+			b.WriteString(`<c t="inlineStr"><is><t xml:space="preserve">`)
+			b.WriteString(escape(fmt.Sprint(v)))
+			b.WriteString("</t></is></c>")
+		}
+	}
+	b.WriteString("</row>")
+
+	_, err := x.sheet.WriteString(b.String())
+	return err
+}
+
+// Close finishes the sheet and the workbook
+func (x *XLSX) Close() error {
+	_, err := x.sheet.WriteString("</sheetData></worksheet>")
+	if err != nil {
+		return err
+	}
+	err = x.sheet.Flush()
+	if err != nil {
+		return err
+	}
+	return x.zw.Close()
+}
+
+// escape escapes text for XML, replacing characters XML cannot hold
+func escape(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// sheetName returns a name Excel accepts for a sheet: at most 31 characters, none of them []:*?/\
+func sheetName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '-'
+		}
+		return r
+	}, name)
+	if name == "" {
+		name = "Sheet1"
+	}
+	if r := []rune(name); len(r) > 31 {
+		name = string(r[:31])
+	}
+	return name
+}
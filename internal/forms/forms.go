@@ -3,6 +3,7 @@ package forms
 import (
 	"fmt"
 	"net/url"
+	"strconv"
 	"strings"
 
 	"github.com/asaskevich/govalidator"
@@ -63,3 +64,31 @@ func (f *Form) IsEmail(field string) {
 		f.Errors.Add(field, "Invalid email address")
 	}
 }
+
+// IsInt checks if the value of the given field is a whole number no smaller than min.
+// If it is not, an error message is added to the form errors.
+func (f *Form) IsInt(field string, min int) bool {
+	x, err := strconv.Atoi(strings.TrimSpace(f.Get(field)))
+	if err != nil {
+		f.Errors.Add(field, "This field must be a whole number")
+		return false
+	}
+	if x < min {
+		f.Errors.Add(field, fmt.Sprintf("This field must be at least %d", min))
+		return false
+	}
+	return true
+}
+
+// In checks if the value of the given field is one of the allowed options.
+// If it is not, an error message is added to the form errors.
+func (f *Form) In(field string, options ...string) bool {
+	x := f.Get(field)
+	for _, option := range options {
+		if x == option {
+			return true
+		}
+	}
+	f.Errors.Add(field, "Please choose one of the listed options")
+	return false
+}
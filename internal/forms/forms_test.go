@@ -126,3 +126,61 @@ func TestForm_IsEmail(t *testing.T) {
 		t.Error("got valid for invalid email address")
 	}
 }
+
+func TestForm_IsInt(t *testing.T) {
+	postedValues := url.Values{}
+	form := New(postedValues)
+
+	form.IsInt("x", 0)
+	if form.Valid() {
+		t.Error("form shows valid number for non-existent field")
+	}
+
+	postedValues = url.Values{}
+	postedValues.Add("hours", "48")
+	form = New(postedValues)
+
+	form.IsInt("hours", 0)
+	if !form.Valid() {
+		t.Error("got an invalid number when we should not have")
+	}
+
+	postedValues = url.Values{}
+	postedValues.Add("hours", "-1")
+	form = New(postedValues)
+
+	form.IsInt("hours", 0)
+	if form.Valid() {
+		t.Error("got valid for number below minimum")
+	}
+
+	postedValues = url.Values{}
+	postedValues.Add("hours", "abc")
+	form = New(postedValues)
+
+	form.IsInt("hours", 0)
+	if form.Valid() {
+		t.Error("got valid for non-numeric value")
+	}
+}
+
+func TestForm_In(t *testing.T) {
+	postedValues := url.Values{}
+	postedValues.Add("bed", "twin")
+	form := New(postedValues)
+
+	form.In("bed", "queen", "twin")
+	if !form.Valid() {
+		t.Error("got invalid for an allowed option")
+	}
+
+	form = New(postedValues)
+	form.In("bed", "queen", "king")
+	if form.Valid() {
+		t.Error("got valid for an option that is not allowed")
+	}
+
+	if form.Errors.Get("bed") == "" {
+		t.Error("should have an error, but did not get one")
+	}
+}
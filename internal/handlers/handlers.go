@@ -1,29 +1,57 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/csv"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/Poojasadgir/room-reservation/internal/calimport"
+	"github.com/Poojasadgir/room-reservation/internal/cancellation"
+	"github.com/Poojasadgir/room-reservation/internal/channels"
 	"github.com/Poojasadgir/room-reservation/internal/config"
 	"github.com/Poojasadgir/room-reservation/internal/driver"
+	"github.com/Poojasadgir/room-reservation/internal/emails"
+	"github.com/Poojasadgir/room-reservation/internal/events"
+	"github.com/Poojasadgir/room-reservation/internal/export"
 	"github.com/Poojasadgir/room-reservation/internal/forms"
 	"github.com/Poojasadgir/room-reservation/internal/helpers"
+	"github.com/Poojasadgir/room-reservation/internal/housekeeping"
+	"github.com/Poojasadgir/room-reservation/internal/ical"
+	"github.com/Poojasadgir/room-reservation/internal/jobs"
+	"github.com/Poojasadgir/room-reservation/internal/mailer"
 	"github.com/Poojasadgir/room-reservation/internal/models"
 	"github.com/Poojasadgir/room-reservation/internal/render"
+	"github.com/Poojasadgir/room-reservation/internal/reports"
 	"github.com/Poojasadgir/room-reservation/internal/repository"
 	"github.com/Poojasadgir/room-reservation/internal/repository/dbrepo"
+	"github.com/Poojasadgir/room-reservation/internal/resimport"
+	"github.com/Poojasadgir/room-reservation/internal/splitstay"
+	"github.com/Poojasadgir/room-reservation/internal/timeline"
+	"github.com/Poojasadgir/room-reservation/internal/webhooks"
 	"github.com/go-chi/chi"
 )
 
 // Repo is the repository used by the handlers
 var Repo *Repository
 
+// pathToEmailTemplates is where the email templates are found
+var pathToEmailTemplates = "./email-templates"
+
+// emailTemplates renders the emails sent by the handlers
+var emailTemplates *emails.Renderer
+
 // Repository is the repository type
 type Repository struct {
 	App *config.AppConfig
@@ -51,6 +79,7 @@ func NewTestRepo(a *config.AppConfig) *Repository {
 // NewHandlers creates a new instance of the handlers struct with the given repository.
 func NewHandlers(r *Repository) {
 	Repo = r
+	emailTemplates = emails.New(pathToEmailTemplates, r.App.UseCache)
 }
 
 // Home handles the home page request
@@ -78,6 +107,12 @@ func (m *Repository) Reservation(w http.ResponseWriter, r *http.Request) {
 	}
 	res.Room.RoomName = room.RoomName
 
+	questions, err := m.DB.GetBookingQuestionsForRoom(res.RoomID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
 	m.App.Session.Put(r.Context(), "reservation", res)
 
 	sd := res.StartDate.Format("2006-01-02")
@@ -88,6 +123,7 @@ func (m *Repository) Reservation(w http.ResponseWriter, r *http.Request) {
 
 	data := make(map[string]interface{})
 	data["reservation"] = res
+	data["questions"] = questions
 
 	render.Template(w, r, "make-reservation.page.tmpl", &models.TemplateData{
 		Form:      forms.New(nil),
@@ -117,14 +153,22 @@ func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
 	reservation.Phone = r.Form.Get("phone")
 	reservation.Email = r.Form.Get("email")
 
+	questions, err := m.DB.GetBookingQuestionsForRoom(reservation.RoomID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
 	form := forms.New(r.PostForm)
 	form.Required("first_name", "last_name", "email")
 	form.MinLength("first_name", 3)
 	form.IsEmail("email")
+	answers := validateBookingQuestions(form, questions)
 
 	if !form.Valid() {
 		data := make(map[string]interface{})
 		data["reservation"] = reservation
+		data["questions"] = questions
 
 		render.Template(w, r, "make-reservation.page.tmpl", &models.TemplateData{
 			Form: form,
@@ -133,60 +177,193 @@ func (m *Repository) PostReservation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	newReservationID, err := m.DB.InsertReservation(reservation)
+	reservation.CancelToken, err = helpers.GenerateToken(16)
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
 
-	restriction := models.RoomRestriction{
-		StartDate:     reservation.StartDate,
-		EndDate:       reservation.EndDate,
-		RoomID:        reservation.RoomID,
-		ReservationID: newReservationID,
-		RestrictionID: 1,
-		CreatedAt:     time.Time{},
-		UpdatedAt:     time.Time{},
+	reservation.GuestID, err = m.DB.FindOrCreateGuest(guestFromReservation(reservation))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
 	}
-	err = m.DB.InsertRoomRestriction(restriction)
+
+	// the reservation, its room restriction, the answers and both notification emails are saved together,
+	// so the emails go out only if the reservation exists and survive a restart before they are sent
+	reservation.Answers = answers
+	newReservationID, err := m.DB.CreateReservation(reservation, answers, func(id int) ([]models.MailData, error) {
+		saved := reservation
+		saved.ID = id
+		return m.reservationNotices(saved)
+	})
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
+	reservation.ID = newReservationID
+	m.publishWebhook(webhooks.ReservationCreated, webhooks.NewReservation(reservation))
+	m.publishReservationEvent(reservation)
 
-	// send notification - first to guest
-	htmlMessage := fmt.Sprintf(`
-		<strong>Reservation Confirmation</strong><br>
-		Dear %s, <br>
-		This is to confirm your reservation from %s to %s.
-	`, reservation.FirstName, reservation.StartDate.Format("2006-01-02"), reservation.EndDate.Format("2006-01-02"))
+	m.App.Session.Put(r.Context(), "reservation", reservation)
 
-	message := models.MailData{
-		To:       reservation.Email,
-		From:     "me@here.com",
-		Subject:  "Reservation Confirmation",
-		Content:  htmlMessage,
-		Template: "basic.html",
+	http.Redirect(w, r, "/reservation-summary", http.StatusSeeOther)
+}
+
+// reservationNotices builds the confirmation email to the guest and the notification email to the property owner
+func (m *Repository) reservationNotices(reservation models.Reservation) ([]models.MailData, error) {
+	guest, err := composeMail(reservation.Email, emails.Confirmation{
+		Reservation: reservation,
+		CancelURL:   m.guestCancelURL(reservation),
+	})
+	if err != nil {
+		return nil, err
 	}
-	m.App.MailChannel <- message
+	guest.Attachments = append(guest.Attachments, m.calendarInvite(reservation, ical.MethodRequest))
 
-	// send email to property owner
-	htmlMessage = fmt.Sprintf(`
-	<strong>Reservation Notification</strong><br>
-	A reservation has been made for %s from %s to %s.
-	`, reservation.Room.RoomName, reservation.StartDate.Format("2006-01-02"), reservation.EndDate.Format("2006-01-02"))
+	owner, err := composeMail("me@here.com", emails.OwnerNotification{Reservation: reservation})
+	if err != nil {
+		return nil, err
+	}
+
+	return []models.MailData{guest, owner}, nil
+}
 
-	message = models.MailData{
-		To:      "me@here.com",
-		From:    "me@here.com",
-		Subject: "Reservation Notification",
-		Content: htmlMessage,
+// reservationChangedNotices builds the email telling the guest that the dates or room of their reservation
+// changed, with an updated calendar invite. The reservation's iCal sequence must already have been increased.
+func (m *Repository) reservationChangedNotices(reservation models.Reservation) ([]models.MailData, error) {
+	guest, err := composeMail(reservation.Email, emails.Modification{
+		Reservation: reservation,
+		CancelURL:   m.guestCancelURL(reservation),
+	})
+	if err != nil {
+		return nil, err
 	}
-	m.App.MailChannel <- message
+	guest.Attachments = append(guest.Attachments, m.calendarInvite(reservation, ical.MethodRequest))
 
-	m.App.Session.Put(r.Context(), "reservation", reservation)
+	return []models.MailData{guest}, nil
+}
 
-	http.Redirect(w, r, "/reservation-summary", http.StatusSeeOther)
+// calendarInvite returns the .ics attachment for a reservation's stay, sent with the given iTIP method so that
+// the guest's calendar adds, updates or removes the event
+func (m *Repository) calendarInvite(res models.Reservation, method string) models.MailAttachment {
+	event := m.reservationEvent(res)
+	if method == ical.MethodCancel {
+		event.Status = ical.StatusCancelled
+	}
+
+	cal := ical.Calendar{Method: method, Events: []ical.Event{event}}
+
+	return models.MailAttachment{
+		Filename:    "invite.ics",
+		ContentType: fmt.Sprintf("%s; method=%s", ical.ContentType, method),
+		Data:        cal.Bytes(),
+	}
+}
+
+// reservationEvent returns the calendar event for a stay, running from check-in on the arrival date to
+// check-out on the departure date. Its UID stays the same for the life of the reservation.
+func (m *Repository) reservationEvent(res models.Reservation) ical.Event {
+	property := m.App.Property
+	loc := property.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	day := func(t time.Time) time.Time {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	}
+
+	var description strings.Builder
+	fmt.Fprintf(&description, "Reservation %d", res.ID)
+	if res.Split() {
+		for _, s := range res.Segments {
+			fmt.Fprintf(&description, "\nRoom: %s from %s to %s", s.Room.RoomName, s.StartDate.Format("Jan 2"), s.EndDate.Format("Jan 2"))
+		}
+	} else if res.Room.RoomName != "" {
+		fmt.Fprintf(&description, "\nRoom: %s", res.Room.RoomName)
+	}
+	if res.CancelToken != "" {
+		fmt.Fprintf(&description, "\nTo cancel: %s", m.guestCancelURL(res))
+	}
+
+	return ical.Event{
+		UID:           fmt.Sprintf("reservation-%d@%s", res.ID, m.calendarDomain()),
+		Sequence:      res.ICalSequence,
+		Stamp:         time.Now(),
+		Start:         day(res.StartDate).Add(property.CheckIn),
+		End:           day(res.EndDate).Add(property.CheckOut),
+		Summary:       fmt.Sprintf("Stay at %s", property.Name),
+		Description:   description.String(),
+		Location:      property.Address,
+		Status:        ical.StatusConfirmed,
+		Organizer:     "me@here.com",
+		OrganizerName: property.Name,
+		Attendee:      res.Email,
+		AttendeeName:  strings.TrimSpace(res.FirstName + " " + res.LastName),
+	}
+}
+
+// calendarDomain returns the host name used to make calendar UIDs unique to this site
+func (m *Repository) calendarDomain() string {
+	u, err := url.Parse(m.App.BaseURL)
+	if err != nil || u.Hostname() == "" {
+		return "localhost"
+	}
+	return u.Hostname()
+}
+
+// composeMail renders an email template for a recipient, ready to be queued in the outbox
+func composeMail(to string, e emails.Email) (models.MailData, error) {
+	html, text, err := emailTemplates.Render(e)
+	if err != nil {
+		return models.MailData{}, err
+	}
+
+	return models.MailData{
+		To:       to,
+		From:     "me@here.com",
+		Subject:  e.Subject(),
+		Content:  html,
+		Text:     text,
+		Template: e.Template(),
+	}, nil
+}
+
+// validateBookingQuestions checks the posted answers to the booking questions and adds any
+// errors to the form. It returns the answers to store with the reservation.
+func validateBookingQuestions(form *forms.Form, questions []models.BookingQuestion) []models.ReservationAnswer {
+	var answers []models.ReservationAnswer
+
+	for _, q := range questions {
+		field := q.FieldName()
+
+		switch q.Kind {
+		case models.QuestionKindCheckbox:
+			answer := "No"
+			if form.Has(field) {
+				answer = "Yes"
+			} else if q.Required {
+				form.Errors.Add(field, "This box must be ticked")
+			}
+			answers = append(answers, models.ReservationAnswer{QuestionID: q.ID, Label: q.Label, Answer: answer})
+			continue
+		case models.QuestionKindChoice:
+			if form.Has(field) {
+				form.In(field, q.Choices...)
+			}
+		}
+
+		if q.Required {
+			form.Required(field)
+		}
+
+		if answer := strings.TrimSpace(form.Get(field)); answer != "" {
+			answers = append(answers, models.ReservationAnswer{QuestionID: q.ID, Label: q.Label, Answer: answer})
+		}
+	}
+
+	return answers
 }
 
 // ReservationSummary displays the reservation summary page to the user.
@@ -226,8 +403,9 @@ func (m *Repository) Availability(w http.ResponseWriter, r *http.Request) {
 // redirects to the choose-room page if there are available rooms for the given dates.
 // It parses the form data from the request, searches for availability for all rooms
 // for the given dates, and stores the reservation details in the session.
-// If there are no available rooms, it sets an error message in the session and redirects
-// to the search-availability page.
+// If no single room is free for the whole stay, it offers ways of splitting the stay across
+// rooms instead, and only when there are none does it set an error message in the session
+// and redirect to the search-availability page.
 func (m *Repository) PostAvailability(w http.ResponseWriter, r *http.Request) {
 	err := r.ParseForm()
 	if err != nil {
@@ -255,14 +433,23 @@ func (m *Repository) PostAvailability(w http.ResponseWriter, r *http.Request) {
 		helpers.ServerError(w, err)
 		return
 	}
-	if len(rooms) == 0 {
-		m.App.Session.Put(r.Context(), "error", "No availability")
-		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
-		return
-	}
 	data := make(map[string]interface{})
 	data["rooms"] = rooms
 
+	if len(rooms) == 0 {
+		splits, err := m.splitStays(startDate, endDate)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		if len(splits) == 0 {
+			m.App.Session.Put(r.Context(), "error", "No availability")
+			http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+			return
+		}
+		data["splits"] = splits
+	}
+
 	res := models.Reservation{
 		StartDate: startDate,
 		EndDate:   endDate,
@@ -346,6 +533,21 @@ func (m *Repository) Contact(w http.ResponseWriter, r *http.Request) {
 	render.Template(w, r, "contact.page.tmpl", &models.TemplateData{})
 }
 
+// splitStays proposes ways of covering a stay by moving between rooms, for when no single room is free
+func (m *Repository) splitStays(start, end time.Time) ([]splitstay.Option, error) {
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		return nil, err
+	}
+
+	restrictions, err := m.DB.GetRestrictionsByDate(start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	return splitstay.Propose(start, end, rooms, restrictions), nil
+}
+
 // ChooseRoom handles GET requests to choose a specific room for a reservation.
 // It takes a room ID from the URL parameter and sets it in the reservation session.
 // If the room ID is not a valid integer, it returns a server error.
@@ -363,6 +565,48 @@ func (m *Repository) ChooseRoom(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	res.RoomID = roomID
+	res.Segments = nil
+	m.App.Session.Put(r.Context(), "reservation", res)
+	http.Redirect(w, r, "/make-reservation", http.StatusSeeOther)
+}
+
+// ChooseSplit chooses one of the split stays offered by the search. The rooms are checked again, since they
+// may have been booked since the search, and the guest arrives in the room of the first segment.
+func (m *Repository) ChooseSplit(w http.ResponseWriter, r *http.Request) {
+	res, ok := m.App.Session.Get(r.Context(), "reservation").(models.Reservation)
+	if !ok {
+		helpers.ServerError(w, errors.New("cannot get reservation from session"))
+		return
+	}
+
+	option, err := splitstay.Decode(r.URL.Query().Get("segments"))
+	if err != nil || !option.Start().Equal(res.StartDate) || !option.End().Equal(res.EndDate) {
+		m.App.Session.Put(r.Context(), "error", "Invalid choice of rooms")
+		http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+		return
+	}
+
+	for i, s := range option.Segments {
+		available, err := m.DB.SearchAvailabilityByDatesByRoomID(s.StartDate, s.EndDate, s.RoomID)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		if !available {
+			m.App.Session.Put(r.Context(), "error", "Those rooms are no longer available. Please search again.")
+			http.Redirect(w, r, "/search-availability", http.StatusSeeOther)
+			return
+		}
+
+		option.Segments[i].Room, err = m.DB.GetRoomByID(s.RoomID)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	res.RoomID = option.Segments[0].RoomID
+	res.Segments = option.Segments
 	m.App.Session.Put(r.Context(), "reservation", res)
 	http.Redirect(w, r, "/make-reservation", http.StatusSeeOther)
 }
@@ -500,139 +744,635 @@ func (m *Repository) Logout(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/user/login", http.StatusSeeOther)
 }
 
-// AdminDashboard handles GET requests to the admin dashboard page.
-func (m *Repository) AdminDashboard(w http.ResponseWriter, r *http.Request) {
-	render.Template(w, r, "admin-dashboard.page.tmpl", &models.TemplateData{})
+// maxReportNights is the longest date range the dashboard reports on
+const maxReportNights = 731
+
+// errInvalidReportRange is returned by reportRange for dates that cannot be reported on
+var errInvalidReportRange = errors.New("invalid report range")
+
+// reportRange reads the nights to report on from the start and end query parameters, where end is the last
+// night included. It defaults to the current month. The range returned ends the day after the last night.
+func reportRange(r *http.Request, now time.Time) (time.Time, time.Time, error) {
+	layout := "2006-01-02"
+
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 1, 0)
+
+	if sd := r.URL.Query().Get("start"); sd != "" {
+		t, err := time.Parse(layout, sd)
+		if err != nil {
+			return start, end, errInvalidReportRange
+		}
+		start = t
+	}
+	if ed := r.URL.Query().Get("end"); ed != "" {
+		t, err := time.Parse(layout, ed)
+		if err != nil {
+			return start, end, errInvalidReportRange
+		}
+		end = t.AddDate(0, 0, 1)
+	}
+
+	if !end.After(start) || end.Sub(start) > maxReportNights*24*time.Hour {
+		return start, end, errInvalidReportRange
+	}
+	return start, end, nil
 }
 
-// AdminNewReservations handles GET requests on the admin/new-reservations route
-func (m *Repository) AdminNewReservations(w http.ResponseWriter, r *http.Request) {
-	reservations, err := m.DB.AllReservations()
+// occupancyMetrics works out the occupancy and revenue metrics for the range asked for in a request
+func (m *Repository) occupancyMetrics(w http.ResponseWriter, r *http.Request) (reports.Metrics, bool) {
+	start, end, err := reportRange(r, time.Now())
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return reports.Metrics{}, false
+	}
+
+	report, err := m.DB.GetOccupancyReport(start, end)
 	if err != nil {
 		helpers.ServerError(w, err)
-		return
+		return reports.Metrics{}, false
 	}
 
-	data := make(map[string]interface{})
-	data["reservations"] = reservations
-	render.Template(w, r, "admin-new-reservations.page.tmpl", &models.TemplateData{
-		Data: data,
-	})
+	return reports.Summarize(report), true
 }
 
-// AdminAllReservations handles GET requests on the admin/reservations/all route
-func (m *Repository) AdminAllReservations(w http.ResponseWriter, r *http.Request) {
-	reservations, err := m.DB.AllNewReservations()
-	if err != nil {
-		helpers.ServerError(w, err)
+// lastNight returns the last night metrics cover, which is how the dashboard asks for the end of a range
+func lastNight(metrics reports.Metrics) string {
+	end, _ := time.Parse("2006-01-02", metrics.End)
+	return end.AddDate(0, 0, -1).Format("2006-01-02")
+}
+
+// AdminDashboard shows the occupancy and revenue metrics for a date range, with charts of occupancy per
+// night and per room
+func (m *Repository) AdminDashboard(w http.ResponseWriter, r *http.Request) {
+	metrics, ok := m.occupancyMetrics(w, r)
+	if !ok {
 		return
 	}
 
+	stringMap := make(map[string]string)
+	stringMap["start"] = metrics.Start
+	stringMap["end"] = lastNight(metrics)
+
 	data := make(map[string]interface{})
-	data["reservations"] = reservations
-	render.Template(w, r, "admin-all-reservations.page.tmpl", &models.TemplateData{
-		Data: data,
+	data["metrics"] = metrics
+
+	render.Template(w, r, "admin-dashboard.page.tmpl", &models.TemplateData{
+		StringMap: stringMap,
+		Data:      data,
 	})
 }
 
-// AdminReservationsCalendar handles GET requests to display the reservations calendar in the admin interface.
-// It retrieves the current month and year from the URL query parameters, or uses the current month and year if not provided.
-// It then retrieves all rooms and their restrictions for the current month, and creates maps to display the reservations and blocks for each room.
-// Finally, it renders the admin-reservations-calendar page template with the necessary data.
-func (m *Repository) AdminReservationsCalendar(w http.ResponseWriter, r *http.Request) {
-	now := time.Now()
-	if r.URL.Query().Get("y") != "" {
-		year, err := strconv.Atoi(r.URL.Query().Get("y"))
-		if err != nil {
-			helpers.ServerError(w, err)
-			return
-		}
-		month, err := strconv.Atoi(r.URL.Query().Get("m"))
-		if err != nil {
-			helpers.ServerError(w, err)
-			return
-		}
-		now = time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+// AdminExportDashboard downloads one of the dashboard's tables for a date range as CSV or XLSX: the rooms
+// table by default, or the nights when table is daily
+func (m *Repository) AdminExportDashboard(w http.ResponseWriter, r *http.Request) {
+	table := r.URL.Query().Get("table")
+	if table != "" && table != "rooms" && table != "daily" {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
 	}
 
-	data := make(map[string]interface{})
-	data["now"] = now
-
-	next := now.AddDate(0, 1, 0)
-	last := now.AddDate(0, -1, 0)
-
-	nextMonth := next.Format("01")
-	nextMonthYear := next.Format("2006")
-	lastMonth := last.Format("01")
-	lastMonthYear := last.Format("2006")
+	metrics, ok := m.occupancyMetrics(w, r)
+	if !ok {
+		return
+	}
 
-	stringMap := make(map[string]string)
-	stringMap["next_month"] = nextMonth
-	stringMap["next_month_year"] = nextMonthYear
-	stringMap["last_month"] = lastMonth
-	stringMap["last_month_year"] = lastMonthYear
+	name := fmt.Sprintf("occupancy-%s-to-%s", metrics.Start, lastNight(metrics))
+	if table == "daily" {
+		name = fmt.Sprintf("occupancy-by-night-%s-to-%s", metrics.Start, lastNight(metrics))
+	}
 
-	stringMap["this_month"] = now.Format("01")
-	stringMap["this_month_year"] = now.Format("2006")
+	xw, ok := startExport(w, r, name, "Occupancy")
+	if !ok {
+		return
+	}
 
-	// get the first and last days of the month
-	currentYear, currentMonth, _ := now.Date()
-	currentLocation := now.Location()
-	firstOfMonth := time.Date(currentYear, currentMonth, 1, 0, 0, 0, 0, currentLocation)
-	lastOfMonth := firstOfMonth.AddDate(0, 1, -1)
+	var err error
+	if table == "daily" {
+		err = xw.Write("Night", "Rooms Sold", "Rooms Blocked", "Occupancy %")
+		for _, d := range metrics.Daily {
+			if err != nil {
+				break
+			}
+			night, _ := time.Parse("2006-01-02", d.Date)
+			err = xw.Write(night, d.RoomsSold, d.RoomsBlocked, d.Occupancy)
+		}
+	} else {
+		err = xw.Write("Room", "Nights Available", "Nights Sold", "Nights Blocked", "Occupancy %", "Revenue", "ADR", "RevPAR")
+		for _, rm := range metrics.Rooms {
+			if err != nil {
+				break
+			}
+			err = xw.Write(rm.RoomName, rm.NightsAvailable, rm.NightsSold, rm.NightsBlocked, rm.Occupancy, money(rm.Revenue), money(rm.ADR), money(rm.RevPAR))
+		}
+		if err == nil {
+			err = xw.Write("All rooms", metrics.NightsAvailable, metrics.NightsSold, metrics.NightsBlocked, metrics.Occupancy,
+				money(metrics.Revenue), money(metrics.ADR), money(metrics.RevPAR))
+		}
+	}
+	m.finishExport(xw, err)
+}
 
-	intMap := make(map[string]int)
-	intMap["days_in_month"] = lastOfMonth.Day()
+// AdminDashboardJSON serves the dashboard's metrics for a date range as JSON
+func (m *Repository) AdminDashboardJSON(w http.ResponseWriter, r *http.Request) {
+	metrics, ok := m.occupancyMetrics(w, r)
+	if !ok {
+		return
+	}
 
-	rooms, err := m.DB.AllRooms()
+	out, err := json.MarshalIndent(metrics, "", "    ")
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
 
-	data["rooms"] = rooms
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(out)
+}
 
-	for _, x := range rooms {
-		// create maps
-		reservationMap := make(map[string]int)
-		blockMap := make(map[string]int)
+// reservationsPerPage is how many reservations an admin list shows on a page unless asked for another number,
+// and maxReservationsPerPage the most it shows
+const (
+	reservationsPerPage    = 25
+	maxReservationsPerPage = 200
+)
 
-		for d := firstOfMonth; !d.After(lastOfMonth); d = d.AddDate(0, 0, 1) {
-			reservationMap[d.Format("2006-01-2")] = 0
-			blockMap[d.Format("2006-01-2")] = 0
-		}
+// reservationStatuses are the statuses a reservation list can be filtered by
+var reservationStatuses = []string{
+	models.ReservationStatusConfirmed,
+	models.ReservationStatusCheckedIn,
+	models.ReservationStatusCheckedOut,
+	models.ReservationStatusNoShow,
+	models.ReservationStatusCancelled,
+}
 
-		// get all the restrictions for the current room
-		restrictions, err := m.DB.GetRestrictionsForRoomByDate(x.ID, firstOfMonth, lastOfMonth)
-		if err != nil {
-			helpers.ServerError(w, err)
-			return
-		}
+// reservationSorts are the columns a reservation list can be sorted by
+var reservationSorts = []string{
+	models.ReservationSortArrival,
+	models.ReservationSortDeparture,
+	models.ReservationSortID,
+	models.ReservationSortName,
+	models.ReservationSortRoom,
+	models.ReservationSortStatus,
+	models.ReservationSortBooked,
+}
 
-		for _, y := range restrictions {
-			if y.ReservationID > 0 {
-				// it's a reservation
-				for d := y.StartDate; !d.After(y.EndDate); d = d.AddDate(0, 0, 1) {
-					reservationMap[d.Format("2006-01-2")] = y.ReservationID
-				}
-			} else {
-				// it's a block
-				blockMap[y.StartDate.Format("2006-01-2")] = y.ID
-			}
+// contains reports whether list holds s
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
 		}
-		data[fmt.Sprintf("reservation_map_%d", x.ID)] = reservationMap
-		data[fmt.Sprintf("block_map_%d", x.ID)] = blockMap
+	}
+	return false
+}
 
-		m.App.Session.Put(r.Context(), fmt.Sprintf("block_map_%d", x.ID), blockMap)
+// reservationListFilters are the query parameters that select the reservations of an admin list
+var reservationListFilters = []string{"q", "tag", "room", "status", "from", "to"}
+
+// errInvalidReservationQuery is returned for a reservation list query with a value that cannot be read
+var errInvalidReservationQuery = errors.New("invalid reservation list query")
+
+// reservationQuery reads the search, filters, sort order and page of an admin reservation list from a
+// request. The to date is the last night a stay may include, so the list shows everyone staying between from
+// and to. Unknown sort columns fall back to arrival; other values that cannot be read are an error.
+func reservationQuery(r *http.Request, newOnly bool) (models.ReservationQuery, error) {
+	v := r.URL.Query()
+	q := models.ReservationQuery{
+		NewOnly: newOnly,
+		Search:  strings.TrimSpace(v.Get("q")),
+		Tag:     v.Get("tag"),
+		Status:  v.Get("status"),
+		Sort:    models.ReservationSortArrival,
+		Desc:    v.Get("dir") == "desc",
+		Page:    1,
+		PerPage: reservationsPerPage,
 	}
 
-	render.Template(w, r, "admin-reservations-calendar.page.tmpl", &models.TemplateData{
-		StringMap: stringMap,
+	if contains(reservationSorts, v.Get("sort")) {
+		q.Sort = v.Get("sort")
+	}
+
+	var err error
+	if room := v.Get("room"); room != "" {
+		q.RoomID, err = strconv.Atoi(room)
+		if err != nil {
+			return q, errInvalidReservationQuery
+		}
+	}
+
+	if q.Status != "" && !contains(reservationStatuses, q.Status) {
+		return q, errInvalidReservationQuery
+	}
+
+	if from := v.Get("from"); from != "" {
+		q.From, err = time.Parse("2006-01-02", from)
+		if err != nil {
+			return q, errInvalidReservationQuery
+		}
+	}
+	if to := v.Get("to"); to != "" {
+		q.To, err = time.Parse("2006-01-02", to)
+		if err != nil {
+			return q, errInvalidReservationQuery
+		}
+		q.To = q.To.AddDate(0, 0, 1)
+	}
+
+	if page := v.Get("page"); page != "" {
+		q.Page, err = strconv.Atoi(page)
+		if err != nil || q.Page < 1 {
+			return q, errInvalidReservationQuery
+		}
+	}
+	if perPage := v.Get("per_page"); perPage != "" {
+		q.PerPage, err = strconv.Atoi(perPage)
+		if err != nil || q.PerPage < 1 || q.PerPage > maxReservationsPerPage {
+			return q, errInvalidReservationQuery
+		}
+	}
+
+	return q, nil
+}
+
+// AdminNewReservations handles GET requests on the admin/new-reservations route
+func (m *Repository) AdminNewReservations(w http.ResponseWriter, r *http.Request) {
+	m.renderReservationList(w, r, "admin-new-reservations.page.tmpl", "/admin/reservations-new", true)
+}
+
+// AdminAllReservations handles GET requests on the admin/reservations/all route
+func (m *Repository) AdminAllReservations(w http.ResponseWriter, r *http.Request) {
+	m.renderReservationList(w, r, "admin-all-reservations.page.tmpl", "/admin/reservations-all", false)
+}
+
+// renderReservationList renders a page of an admin reservation list, searched, filtered and sorted as the
+// request asks, along with the rooms, statuses and tags available to filter it by. Links to sort, page
+// through and export the list keep the filters in use.
+func (m *Repository) renderReservationList(w http.ResponseWriter, r *http.Request, tmpl, path string, newOnly bool) {
+	q, err := reservationQuery(r, newOnly)
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	page, err := m.DB.FindReservations(q)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	tags, err := m.DB.AllTags()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	v := r.URL.Query()
+	stringMap := make(map[string]string)
+	filters := url.Values{}
+	for _, f := range reservationListFilters {
+		stringMap[f] = v.Get(f)
+		if v.Get(f) != "" {
+			filters.Set(f, v.Get(f))
+		}
+	}
+	stringMap["sort"] = q.Sort
+	stringMap["dir"] = "asc"
+	if q.Desc {
+		stringMap["dir"] = "desc"
+	}
+
+	for _, column := range reservationSorts {
+		dir := "asc"
+		if column == q.Sort && !q.Desc {
+			dir = "desc"
+		}
+		stringMap["sort_"+column] = listURL(path, filters, "sort", column, "dir", dir)
+	}
+
+	sorted := listValues(filters, "sort", q.Sort, "dir", stringMap["dir"])
+	if v.Get("per_page") != "" {
+		sorted.Set("per_page", v.Get("per_page"))
+	}
+	if page.Page > 1 {
+		stringMap["prev_page"] = listURL(path, sorted, "page", strconv.Itoa(page.Page-1))
+	}
+	if page.Page < page.Pages() {
+		stringMap["next_page"] = listURL(path, sorted, "page", strconv.Itoa(page.Page+1))
+	}
+	stringMap["export_csv"] = listURL(path+"/export", sorted, "format", export.FormatCSV)
+	stringMap["export_xlsx"] = listURL(path+"/export", sorted, "format", export.FormatXLSX)
+
+	data := make(map[string]interface{})
+	data["page"] = page
+	data["rooms"] = rooms
+	data["statuses"] = reservationStatuses
+	data["tags"] = tags
+
+	render.Template(w, r, tmpl, &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+	})
+}
+
+// listValues copies query parameters, setting the name and value pairs in set
+func listValues(params url.Values, set ...string) url.Values {
+	v := url.Values{}
+	for k, vs := range params {
+		v[k] = vs
+	}
+	for i := 0; i+1 < len(set); i += 2 {
+		v.Set(set[i], set[i+1])
+	}
+	return v
+}
+
+// listURL links to a list with query parameters, setting the name and value pairs in set
+func listURL(path string, params url.Values, set ...string) string {
+	v := listValues(params, set...)
+	if len(v) == 0 {
+		return path
+	}
+	return path + "?" + v.Encode()
+}
+
+// startExport checks the format asked for in a request and starts a download of a table in it. It writes an
+// error response and returns false for a format that cannot be exported.
+func startExport(w http.ResponseWriter, r *http.Request, name, sheet string) (export.Writer, bool) {
+	format := r.URL.Query().Get("format")
+
+	xw, err := export.New(w, format, sheet)
+	if errors.Is(err, export.ErrUnknownFormat) {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return nil, false
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return nil, false
+	}
+
+	w.Header().Set("Content-Type", export.ContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", export.Filename(name, format, time.Now())))
+	return xw, true
+}
+
+// finishExport completes a download. Rows are streamed as they are read, so an error part way through
+// cannot change the response; it is logged and the download is left incomplete.
+func (m *Repository) finishExport(xw export.Writer, err error) {
+	if err == nil {
+		err = xw.Close()
+	}
+	if err != nil {
+		m.App.ErrorLog.Printf("export failed: %s", err)
+	}
+}
+
+// money returns an amount in cents as a number of dollars for a spreadsheet to add up
+func money(cents int) float64 {
+	return float64(cents) / 100
+}
+
+// exportReservations streams every page of a reservation list, searched, filtered and sorted as the list is
+func (m *Repository) exportReservations(w http.ResponseWriter, r *http.Request, newOnly bool, name string) {
+	q, err := reservationQuery(r, newOnly)
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	xw, ok := startExport(w, r, name, "Reservations")
+	if !ok {
+		return
+	}
+
+	err = xw.Write("ID", "First Name", "Last Name", "Email", "Phone", "Room", "Arrival", "Departure", "Nights",
+		"Status", "Processed", "Nightly Rate", "Cancellation Fee", "No-show Fee", "Channel Booking", "Tags", "Booked")
+	if err == nil {
+		err = m.DB.EachReservation(q, func(res models.Reservation) error {
+			return xw.Write(
+				res.ID,
+				res.FirstName,
+				res.LastName,
+				res.Email,
+				res.Phone,
+				res.Room.RoomName,
+				res.StartDate,
+				res.EndDate,
+				int(res.EndDate.Sub(res.StartDate).Hours()/24),
+				res.Status,
+				res.Processed == 1,
+				money(res.Room.NightlyRate),
+				money(res.CancellationFee),
+				money(res.NoShowFee),
+				res.ChannelBookingID,
+				strings.Join(res.Tags, ", "),
+				res.CreatedAt,
+			)
+		})
+	}
+	m.finishExport(xw, err)
+}
+
+// AdminExportNewReservations downloads the new reservations list as CSV or XLSX, filtered like the page
+func (m *Repository) AdminExportNewReservations(w http.ResponseWriter, r *http.Request) {
+	m.exportReservations(w, r, true, "new-reservations")
+}
+
+// AdminExportAllReservations downloads the list of all reservations as CSV or XLSX, filtered like the page
+func (m *Repository) AdminExportAllReservations(w http.ResponseWriter, r *http.Request) {
+	m.exportReservations(w, r, false, "reservations")
+}
+
+// AdminReservationsCalendar handles GET requests to display the reservations calendar in the admin interface.
+// It retrieves the current month and year from the URL query parameters, or uses the current month and year if not provided.
+// It then retrieves all rooms and their restrictions for the current month, and creates maps to display the reservations and blocks for each room.
+// Finally, it renders the admin-reservations-calendar page template with the necessary data.
+func (m *Repository) AdminReservationsCalendar(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	if r.URL.Query().Get("y") != "" {
+		year, err := strconv.Atoi(r.URL.Query().Get("y"))
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		month, err := strconv.Atoi(r.URL.Query().Get("m"))
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		now = time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	data := make(map[string]interface{})
+	data["now"] = now
+
+	next := now.AddDate(0, 1, 0)
+	last := now.AddDate(0, -1, 0)
+
+	nextMonth := next.Format("01")
+	nextMonthYear := next.Format("2006")
+	lastMonth := last.Format("01")
+	lastMonthYear := last.Format("2006")
+
+	stringMap := make(map[string]string)
+	stringMap["next_month"] = nextMonth
+	stringMap["next_month_year"] = nextMonthYear
+	stringMap["last_month"] = lastMonth
+	stringMap["last_month_year"] = lastMonthYear
+
+	stringMap["this_month"] = now.Format("01")
+	stringMap["this_month_year"] = now.Format("2006")
+
+	// get the first and last days of the month
+	currentYear, currentMonth, _ := now.Date()
+	currentLocation := now.Location()
+	firstOfMonth := time.Date(currentYear, currentMonth, 1, 0, 0, 0, 0, currentLocation)
+	lastOfMonth := firstOfMonth.AddDate(0, 1, -1)
+
+	intMap := make(map[string]int)
+	intMap["days_in_month"] = lastOfMonth.Day()
+
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data["rooms"] = rooms
+
+	restrictions, err := m.DB.GetRestrictionsByDate(firstOfMonth, lastOfMonth.AddDate(0, 0, 1))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	byRoom := make(map[int][]models.RoomRestriction)
+	for _, y := range restrictions {
+		byRoom[y.RoomID] = append(byRoom[y.RoomID], y)
+	}
+
+	for _, x := range rooms {
+		// create maps
+		reservationMap := make(map[string]int)
+		blockMap := make(map[string]int)
+		tagMap := make(map[string][]string)
+		moveMap := make(map[string]string)
+
+		for d := firstOfMonth; !d.After(lastOfMonth); d = d.AddDate(0, 0, 1) {
+			reservationMap[d.Format("2006-01-2")] = 0
+			blockMap[d.Format("2006-01-2")] = 0
+		}
+
+		for _, y := range byRoom[x.ID] {
+			if y.ReservationID > 0 {
+				// it's a reservation
+				for d := y.StartDate; !d.After(y.EndDate); d = d.AddDate(0, 0, 1) {
+					reservationMap[d.Format("2006-01-2")] = y.ReservationID
+				}
+				// show tag badges on the first day of the reservation visible this month
+				first := y.StartDate
+				if first.Before(firstOfMonth) {
+					first = firstOfMonth
+				}
+				tagMap[first.Format("2006-01-2")] = y.Reservation.Tags
+				// mark the days a guest on a split stay moves into or out of the room
+				if y.MovesIn() {
+					moveMap[y.StartDate.Format("2006-01-2")] = "in"
+				}
+				if y.MovesOut() {
+					moveMap[y.EndDate.Format("2006-01-2")] = "out"
+				}
+			} else {
+				// it's a block, which covers every night up to its end date
+				for d := y.StartDate; d.Before(y.EndDate); d = d.AddDate(0, 0, 1) {
+					blockMap[d.Format("2006-01-2")] = y.ID
+				}
+			}
+		}
+		data[fmt.Sprintf("reservation_map_%d", x.ID)] = reservationMap
+		data[fmt.Sprintf("block_map_%d", x.ID)] = blockMap
+		data[fmt.Sprintf("tag_map_%d", x.ID)] = tagMap
+		data[fmt.Sprintf("move_map_%d", x.ID)] = moveMap
+
+		m.App.Session.Put(r.Context(), fmt.Sprintf("block_map_%d", x.ID), blockMap)
+	}
+
+	render.Template(w, r, "admin-reservations-calendar.page.tmpl", &models.TemplateData{
+		StringMap: stringMap,
 		Data:      data,
 		IntMap:    intMap,
 	})
 }
 
+// AdminReservationsTimeline shows the reservations and blocks on every room as bars across a range of 7, 14,
+// 30 or 90 days starting on the start date asked for, or today. All the rooms' restrictions for the range are
+// read with a single query.
+func (m *Repository) AdminReservationsTimeline(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	start := today
+	if sd := r.URL.Query().Get("start"); sd != "" {
+		var err error
+		start, err = time.Parse("2006-01-02", sd)
+		if err != nil {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+	}
+
+	days := timeline.DefaultRange
+	if d := r.URL.Query().Get("days"); d != "" {
+		var err error
+		days, err = strconv.Atoi(d)
+		if err != nil || !timeline.ValidRange(days) {
+			helpers.ClientError(w, http.StatusBadRequest)
+			return
+		}
+	}
+
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	restrictions, err := m.DB.GetRestrictionsByDate(start, start.AddDate(0, 0, days))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	link := func(d time.Time) string {
+		return fmt.Sprintf("/admin/reservations-timeline?start=%s&days=%d", d.Format("2006-01-02"), days)
+	}
+
+	stringMap := make(map[string]string)
+	stringMap["start"] = start.Format("2006-01-02")
+	stringMap["previous"] = link(start.AddDate(0, 0, -days))
+	stringMap["next"] = link(start.AddDate(0, 0, days))
+	stringMap["today"] = link(today)
+
+	intMap := make(map[string]int)
+	intMap["days"] = days
+
+	data := make(map[string]interface{})
+	data["timeline"] = timeline.Build(start, days, today, rooms, restrictions)
+	data["ranges"] = timeline.Ranges
+
+	render.Template(w, r, "admin-reservations-timeline.page.tmpl", &models.TemplateData{
+		StringMap: stringMap,
+		IntMap:    intMap,
+		Data:      data,
+	})
+}
+
 // AdminPostReservationsCalendar handles the POST request for the admin reservations calendar page.
 // It parses the form data, processes blocks, handles new blocks, and redirects to the reservations calendar page.
 // If there is an error, it returns a server error.
@@ -654,6 +1394,7 @@ func (m *Repository) AdminPostReservationsCalendar(w http.ResponseWriter, r *htt
 	}
 
 	form := forms.New(r.PostForm)
+	deleted := make(map[int]bool)
 	for _, x := range rooms {
 		// Get the block map from the session.
 		// Loop through map, if entry is in map that is not in posted data, then it is a block that needs to be removed
@@ -663,13 +1404,19 @@ func (m *Repository) AdminPostReservationsCalendar(w http.ResponseWriter, r *htt
 			// ok will be false if the value is not in the map
 			if val, ok := curMap[name]; ok {
 				// only pay attention to values > 0
-				if val > 0 {
+				// a block covering several nights is listed once for each night, but deleted only once
+				if val > 0 && !deleted[value] {
 					if !form.Has(fmt.Sprintf("remove_block_%d_%s", x.ID, name)) {
 						// delete restrictions by ID
 						err := m.DB.DeleteBlockByID(value)
 						if err != nil {
 							log.Println(err)
+							continue
 						}
+						deleted[value] = true
+						block := models.RoomRestriction{ID: value, RoomID: x.ID}
+						m.publishWebhook(webhooks.BlockDeleted, webhooks.NewBlock(block))
+						m.publishBlockEvent(block)
 					}
 				}
 			}
@@ -683,10 +1430,19 @@ func (m *Repository) AdminPostReservationsCalendar(w http.ResponseWriter, r *htt
 			roomID, _ := strconv.Atoi(exploded[2])
 			t, _ := time.Parse("2006-01-2", exploded[3])
 			// insert a new block
-			err := m.DB.InsertBlockForRoom(roomID, t)
+			blockID, err := m.DB.InsertBlockForRoom(roomID, t)
 			if err != nil {
 				log.Println(err)
+				continue
 			}
+			block := models.RoomRestriction{
+				ID:        blockID,
+				RoomID:    roomID,
+				StartDate: t,
+				EndDate:   t.AddDate(0, 0, 1),
+			}
+			m.publishWebhook(webhooks.BlockCreated, webhooks.NewBlock(block))
+			m.publishBlockEvent(block)
 		}
 	}
 
@@ -718,30 +1474,59 @@ func (m *Repository) AdminShowReservation(w http.ResponseWriter, r *http.Request
 		helpers.ServerError(w, err)
 		return
 	}
-	data := make(map[string]interface{})
-	data["reservation"] = res
 
-	render.Template(w, r, "admin-reservations-show.page.tmpl", &models.TemplateData{
-		StringMap: stringMap,
-		Data:      data,
-		Form:      forms.New(nil),
-	})
+	res.Tags, err = m.DB.GetTagsForReservation(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.showReservation(w, r, http.StatusOK, res, stringMap, make(map[string]interface{}))
 }
 
-func (m *Repository) AdminPostShowReservation(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseForm()
+// showReservation renders a reservation with its notes and booking answers. The tags are shown as res holds
+// them, so that a form shown again after a conflict keeps what was typed.
+func (m *Repository) showReservation(w http.ResponseWriter, r *http.Request, status int, res models.Reservation,
+	stringMap map[string]string, data map[string]interface{}) {
+	notes, err := m.DB.GetNotesForReservation(res.ID)
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
 
-	explodedURL := strings.Split(r.RequestURI, "/")
-	id, err := strconv.Atoi(explodedURL[4])
+	res.Answers, err = m.DB.GetAnswersForReservation(res.ID)
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
-	src := explodedURL[3]
+
+	stringMap["tags"] = strings.Join(res.Tags, ", ")
+
+	data["reservation"] = res
+	data["notes"] = notes
+
+	w.WriteHeader(status)
+	render.Template(w, r, "admin-reservations-show.page.tmpl", &models.TemplateData{
+		StringMap: stringMap,
+		Data:      data,
+		Form:      forms.New(nil),
+	})
+}
+
+func (m *Repository) AdminPostShowReservation(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	explodedURL := strings.Split(r.RequestURI, "/")
+	id, err := strconv.Atoi(explodedURL[4])
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	src := explodedURL[3]
 	stringMap := make(map[string]string)
 	stringMap["src"] = src
 
@@ -750,16 +1535,39 @@ func (m *Repository) AdminPostShowReservation(w http.ResponseWriter, r *http.Req
 		helpers.ServerError(w, err)
 		return
 	}
+
+	// the version the form was loaded at, so that changes saved by someone else since are not overwritten
+	res.Version, err = strconv.Atoi(r.Form.Get("version"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
 	res.FirstName = r.Form.Get("first_name")
 	res.LastName = r.Form.Get("last_name")
 	res.Email = r.Form.Get("email")
 	res.Phone = r.Form.Get("phone")
 
 	err = m.DB.UpdateReservation(res)
+	var conflict *repository.ConflictError
+	if errors.As(err, &conflict) {
+		m.showConflict(w, r, res, conflict.Current, stringMap)
+		return
+	}
 	if err != nil {
 		helpers.ServerError(w, err)
 		return
 	}
+	m.publishWebhook(webhooks.ReservationUpdated, webhooks.NewReservation(res))
+	m.publishReservationEvent(res)
+
+	if _, ok := r.PostForm["tags"]; ok {
+		err = m.DB.SetReservationTags(res.ID, parseTags(r.Form.Get("tags")))
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
 
 	month := r.Form.Get("month")
 	year := r.Form.Get("year")
@@ -772,6 +1580,214 @@ func (m *Repository) AdminPostShowReservation(w http.ResponseWriter, r *http.Req
 	}
 }
 
+// showConflict shows the reservation form again when someone else saved the reservation after it was loaded.
+// The form keeps the values that were posted, with the other person's saved values alongside any that differ,
+// and takes the version they saved so that saving again keeps the posted values.
+func (m *Repository) showConflict(w http.ResponseWriter, r *http.Request, posted, current models.Reservation, stringMap map[string]string) {
+	yours := current
+	yours.FirstName = posted.FirstName
+	yours.LastName = posted.LastName
+	yours.Email = posted.Email
+	yours.Phone = posted.Phone
+	if _, ok := r.PostForm["tags"]; ok {
+		yours.Tags = parseTags(r.Form.Get("tags"))
+	}
+
+	stringMap["year"] = r.Form.Get("year")
+	stringMap["month"] = r.Form.Get("month")
+	stringMap["conflict_tags"] = strings.Join(current.Tags, ", ")
+
+	data := make(map[string]interface{})
+	data["conflict"] = current
+
+	m.showReservation(w, r, http.StatusConflict, yours, stringMap, data)
+}
+
+// stayResponse is the JSON reply to a change of a reservation's room or dates
+type stayResponse struct {
+	OK            bool   `json:"ok"`
+	Message       string `json:"message"`
+	ReservationID int    `json:"reservation_id"`
+	RoomID        int    `json:"room_id"`
+	StartDate     string `json:"start_date"`
+	EndDate       string `json:"end_date"`
+}
+
+// writeStayResponse sends a stayResponse with the given status code
+func writeStayResponse(w http.ResponseWriter, status int, resp stayResponse) {
+	out, err := json.MarshalIndent(resp, "", "    ")
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(out)
+}
+
+// stayChange works out a reservation's new room, arrival and departure from the posted form
+type stayChange func(res models.Reservation, form url.Values) (roomID int, start, end time.Time, err error)
+
+// changeStay loads the reservation named in the URL and moves it to the room and dates worked out by change,
+// replying with JSON so that the calendar can drag and drop stays. Only confirmed and checked in reservations
+// in a single room can be changed, and a guest who has checked in keeps their arrival date. The room is checked
+// to be free for the new dates, ignoring the reservation's own restriction, and the guest is sent an updated
+// invite.
+func (m *Repository) changeStay(w http.ResponseWriter, r *http.Request, change stayChange) {
+	fail := func(status int, message string) {
+		writeStayResponse(w, status, stayResponse{Message: message})
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		fail(http.StatusBadRequest, "Invalid form")
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		fail(http.StatusBadRequest, "Invalid reservation")
+		return
+	}
+
+	res, err := m.DB.GetReservationByID(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		fail(http.StatusNotFound, fmt.Sprintf("Reservation %d does not exist", id))
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if res.Status != models.ReservationStatusConfirmed && res.Status != models.ReservationStatusCheckedIn {
+		fail(http.StatusConflict, fmt.Sprintf("Reservation %d cannot be changed because it is %s", res.ID, res.Status))
+		return
+	}
+	if res.Split() {
+		fail(http.StatusConflict, fmt.Sprintf("Reservation %d is split across %d rooms, so it cannot be moved as a single stay", res.ID, len(res.Segments)))
+		return
+	}
+
+	roomID, start, end, err := change(res, r.Form)
+	if err != nil {
+		fail(http.StatusBadRequest, err.Error())
+		return
+	}
+	if !end.After(start) {
+		fail(http.StatusBadRequest, "Departure must be after arrival")
+		return
+	}
+	if res.Status == models.ReservationStatusCheckedIn && !start.Equal(res.StartDate) {
+		fail(http.StatusConflict, fmt.Sprintf("%s %s has checked in, so the arrival date cannot change", res.FirstName, res.LastName))
+		return
+	}
+
+	room, err := m.DB.GetRoomByID(roomID)
+	if errors.Is(err, sql.ErrNoRows) {
+		fail(http.StatusBadRequest, fmt.Sprintf("Room %d does not exist", roomID))
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	resp := stayResponse{
+		OK:            true,
+		ReservationID: res.ID,
+		RoomID:        roomID,
+		StartDate:     start.Format("2006-01-02"),
+		EndDate:       end.Format("2006-01-02"),
+	}
+
+	if roomID == res.RoomID && start.Equal(res.StartDate) && end.Equal(res.EndDate) {
+		resp.Message = "Nothing to change"
+		writeStayResponse(w, http.StatusOK, resp)
+		return
+	}
+
+	updated := res
+	updated.RoomID = roomID
+	updated.Room = room
+	updated.StartDate = start
+	updated.EndDate = end
+
+	err = m.DB.ChangeReservationStay(res.ID, roomID, start, end, func(sequence int) ([]models.MailData, error) {
+		updated.ICalSequence = sequence
+		return m.reservationChangedNotices(updated)
+	})
+	if errors.Is(err, repository.ErrRoomUnavailable) {
+		fail(http.StatusConflict, fmt.Sprintf("%s is not available from %s to %s", roomName(room), resp.StartDate, resp.EndDate))
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	m.publishWebhook(webhooks.ReservationUpdated, webhooks.NewReservation(updated))
+	m.publishReservationEvent(updated)
+	// the nights the stay used to hold are free again
+	m.publishReservationEvent(res)
+
+	resp.Message = fmt.Sprintf("%s %s now stays in %s from %s to %s", res.FirstName, res.LastName, roomName(room), resp.StartDate, resp.EndDate)
+	writeStayResponse(w, http.StatusOK, resp)
+}
+
+// roomName returns a room's name, or its number when the name is not known
+func roomName(room models.Room) string {
+	if room.RoomName != "" {
+		return room.RoomName
+	}
+	return fmt.Sprintf("Room %d", room.ID)
+}
+
+// AdminPostReservationDates changes the arrival and departure of a reservation, keeping its room
+func (m *Repository) AdminPostReservationDates(w http.ResponseWriter, r *http.Request) {
+	m.changeStay(w, r, func(res models.Reservation, form url.Values) (int, time.Time, time.Time, error) {
+		start, err := time.Parse("2006-01-02", form.Get("start"))
+		if err != nil {
+			return 0, start, start, errors.New("Invalid arrival date")
+		}
+		end, err := time.Parse("2006-01-02", form.Get("end"))
+		if err != nil {
+			return 0, start, end, errors.New("Invalid departure date")
+		}
+		return res.RoomID, start, end, nil
+	})
+}
+
+// AdminPostExtendReservation extends a stay by a number of nights, or shortens it when the number is negative
+func (m *Repository) AdminPostExtendReservation(w http.ResponseWriter, r *http.Request) {
+	m.changeStay(w, r, func(res models.Reservation, form url.Values) (int, time.Time, time.Time, error) {
+		nights, err := strconv.Atoi(form.Get("nights"))
+		if err != nil || nights == 0 {
+			return 0, res.StartDate, res.EndDate, errors.New("Invalid number of nights")
+		}
+		return res.RoomID, res.StartDate, res.EndDate.AddDate(0, 0, nights), nil
+	})
+}
+
+// AdminPostMoveReservation moves a reservation to another room. When an arrival date is given the stay moves
+// to it as well, keeping its length.
+func (m *Repository) AdminPostMoveReservation(w http.ResponseWriter, r *http.Request) {
+	m.changeStay(w, r, func(res models.Reservation, form url.Values) (int, time.Time, time.Time, error) {
+		roomID, err := strconv.Atoi(form.Get("room_id"))
+		if err != nil {
+			return 0, res.StartDate, res.EndDate, errors.New("Invalid room")
+		}
+		if form.Get("start") == "" {
+			return roomID, res.StartDate, res.EndDate, nil
+		}
+		start, err := time.Parse("2006-01-02", form.Get("start"))
+		if err != nil {
+			return 0, res.StartDate, res.EndDate, errors.New("Invalid arrival date")
+		}
+		return roomID, start, start.Add(res.EndDate.Sub(res.StartDate)), nil
+	})
+}
+
 // AdminProcessReservation updates the reservation status to processed and redirects the user to the appropriate page.
 // It takes in a ResponseWriter and a pointer to a Request as parameters.
 // It returns nothing.
@@ -781,6 +1797,8 @@ func (m *Repository) AdminProcessReservation(w http.ResponseWriter, r *http.Requ
 	err := m.DB.UpdateProcessedReservation(id, 1)
 	if err != nil {
 		log.Println(err)
+	} else {
+		m.publishReservationWebhook(webhooks.ReservationUpdated, id)
 	}
 
 	year := r.URL.Query().Get("y")
@@ -801,7 +1819,13 @@ func (m *Repository) AdminProcessReservation(w http.ResponseWriter, r *http.Requ
 func (m *Repository) AdminDeleteReservation(w http.ResponseWriter, r *http.Request) {
 	id, _ := strconv.Atoi(chi.URLParam(r, "id"))
 	src := chi.URLParam(r, "src")
-	_ = m.DB.DeleteReservation(id)
+
+	// the reservation is loaded first so that webhook endpoints are told what was deleted
+	res, err := m.DB.GetReservationByID(id)
+	if err == nil && m.DB.DeleteReservation(id) == nil {
+		m.publishWebhook(webhooks.ReservationDeleted, webhooks.NewReservation(res))
+		m.publishReservationEvent(res)
+	}
 
 	year := r.URL.Query().Get("y")
 	month := r.URL.Query().Get("m")
@@ -814,3 +1838,2826 @@ func (m *Repository) AdminDeleteReservation(w http.ResponseWriter, r *http.Reque
 		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-calendar?y=%s&m=%s", year, month), http.StatusSeeOther)
 	}
 }
+
+// guestCancelURL returns the link a guest follows to cancel their own reservation.
+func (m *Repository) guestCancelURL(res models.Reservation) string {
+	return fmt.Sprintf("%s/reservations/%d/cancel?t=%s", m.App.BaseURL, res.ID, res.CancelToken)
+}
+
+// cancellationFee looks up the cancellation policy attached to the reservation's room and
+// returns it along with the fee that would be charged if the reservation were cancelled now.
+func (m *Repository) cancellationFee(res models.Reservation) (models.CancellationPolicy, int, error) {
+	policy, err := m.roomCancellationPolicy(res.Room)
+	if err != nil {
+		return policy, 0, err
+	}
+
+	return policy, cancellation.Fee(policy, res, res.Room.NightlyRate, time.Now()), nil
+}
+
+// roomCancellationPolicy returns the cancellation policy attached to a room, or an empty policy if it has none
+func (m *Repository) roomCancellationPolicy(room models.Room) (models.CancellationPolicy, error) {
+	if room.CancellationPolicyID == 0 {
+		return models.CancellationPolicy{}, nil
+	}
+	return m.DB.GetCancellationPolicyByID(room.CancellationPolicyID)
+}
+
+// cancellationNotices builds the emails to the guest and the property owner about a cancelled reservation.
+func (m *Repository) cancellationNotices(res models.Reservation, fee int) ([]models.MailData, error) {
+	guest, err := composeMail(res.Email, emails.Cancellation{Reservation: res, Fee: fee})
+	if err != nil {
+		return nil, err
+	}
+	// cancelling increases the reservation's iCal sequence, which the cancelled event must carry
+	cancelled := res
+	cancelled.ICalSequence++
+	guest.Attachments = append(guest.Attachments, m.calendarInvite(cancelled, ical.MethodCancel))
+
+	owner, err := composeMail("me@here.com", emails.OwnerNotification{Reservation: res, Cancelled: true, Fee: fee})
+	if err != nil {
+		return nil, err
+	}
+
+	return []models.MailData{guest, owner}, nil
+}
+
+// GuestCancelReservation shows a guest the fee that applies before they confirm cancelling their reservation.
+// The reservation is identified by ID and the secret token sent in the confirmation email.
+func (m *Repository) GuestCancelReservation(w http.ResponseWriter, r *http.Request) {
+	res, ok := m.guestReservationFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	policy, fee, err := m.cancellationFee(res)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["reservation"] = res
+	data["policy"] = policy
+
+	intMap := make(map[string]int)
+	intMap["fee"] = fee
+
+	stringMap := make(map[string]string)
+	stringMap["token"] = r.URL.Query().Get("t")
+
+	render.Template(w, r, "cancel-reservation.page.tmpl", &models.TemplateData{
+		Data:      data,
+		IntMap:    intMap,
+		StringMap: stringMap,
+	})
+}
+
+// PostGuestCancelReservation cancels a reservation on behalf of the guest, recording the fee due under the room's policy.
+func (m *Repository) PostGuestCancelReservation(w http.ResponseWriter, r *http.Request) {
+	res, ok := m.guestReservationFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	_, fee, err := m.cancellationFee(res)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	notices, err := m.cancellationNotices(res, fee)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = m.DB.CancelReservation(res.ID, fee, "guest", notices)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	m.publishReservationWebhook(webhooks.ReservationCancelled, res.ID)
+	m.publishReservationEvent(res)
+
+	m.App.Session.Put(r.Context(), "flash", "Your reservation has been cancelled")
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// guestReservationFromRequest loads the reservation named in the URL and checks the guest's token against it.
+// Guests can only cancel confirmed reservations before their arrival date. It writes an error response and
+// returns false if the reservation cannot be cancelled by this request.
+func (m *Repository) guestReservationFromRequest(w http.ResponseWriter, r *http.Request) (models.Reservation, bool) {
+	var res models.Reservation
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return res, false
+	}
+
+	token := r.URL.Query().Get("t")
+	if r.Method == http.MethodPost {
+		_ = r.ParseForm()
+		token = r.Form.Get("t")
+	}
+
+	res, err = m.DB.GetReservationByID(id)
+	if err != nil || res.CancelToken == "" || subtle.ConstantTimeCompare([]byte(res.CancelToken), []byte(token)) != 1 {
+		helpers.ClientError(w, http.StatusNotFound)
+		return res, false
+	}
+
+	if res.Status == models.ReservationStatusCancelled {
+		m.App.Session.Put(r.Context(), "warning", "This reservation has already been cancelled")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return res, false
+	}
+
+	// once the guest is due to arrive, the stay can only be changed by staff
+	if res.Status != models.ReservationStatusConfirmed || !time.Now().Before(res.StartDate) {
+		m.App.Session.Put(r.Context(), "error", "This reservation can no longer be cancelled online. Please contact us to change it")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return res, false
+	}
+
+	return res, true
+}
+
+// AdminCancelReservation shows staff the fee that applies before they confirm cancelling a reservation.
+func (m *Repository) AdminCancelReservation(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	res, err := m.DB.GetReservationByID(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	policy, fee, err := m.cancellationFee(res)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["reservation"] = res
+	data["policy"] = policy
+
+	intMap := make(map[string]int)
+	intMap["fee"] = fee
+
+	stringMap := make(map[string]string)
+	stringMap["src"] = chi.URLParam(r, "src")
+	stringMap["year"] = r.URL.Query().Get("y")
+	stringMap["month"] = r.URL.Query().Get("m")
+
+	render.Template(w, r, "admin-reservations-cancel.page.tmpl", &models.TemplateData{
+		Data:      data,
+		IntMap:    intMap,
+		StringMap: stringMap,
+	})
+}
+
+// AdminPostCancelReservation cancels a reservation on behalf of staff. The fee is recalculated rather than
+// taken from the form so that it reflects the policy at the moment of cancellation.
+func (m *Repository) AdminPostCancelReservation(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	src := chi.URLParam(r, "src")
+
+	res, err := m.DB.GetReservationByID(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if res.Status != models.ReservationStatusCancelled {
+		_, fee, err := m.cancellationFee(res)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		if r.Form.Get("waive_fee") != "" {
+			fee = 0
+		}
+
+		notices, err := m.cancellationNotices(res, fee)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		err = m.DB.CancelReservation(res.ID, fee, "staff", notices)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		m.publishReservationWebhook(webhooks.ReservationCancelled, res.ID)
+		m.publishReservationEvent(res)
+	}
+
+	year := r.Form.Get("year")
+	month := r.Form.Get("month")
+
+	m.App.Session.Put(r.Context(), "flash", "Reservation cancelled")
+
+	if year == "" {
+		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-%s", src), http.StatusSeeOther)
+	} else {
+		http.Redirect(w, r, fmt.Sprintf("/admin/reservations-calendar?y=%s&m=%s", year, month), http.StatusSeeOther)
+	}
+}
+
+// AdminCancellationPolicies lists the cancellation policies and the policy and nightly rate assigned to each room.
+func (m *Repository) AdminCancellationPolicies(w http.ResponseWriter, r *http.Request) {
+	policies, err := m.DB.AllCancellationPolicies()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["policies"] = policies
+	data["rooms"] = rooms
+
+	render.Template(w, r, "admin-cancellation-policies.page.tmpl", &models.TemplateData{
+		Data: data,
+		Form: forms.New(nil),
+	})
+}
+
+// AdminPostCancellationPolicy creates a new cancellation policy, or updates an existing one when an ID is posted.
+func (m *Repository) AdminPostCancellationPolicy(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("policy_name")
+	form.IsInt("free_cancellation_hours", 0)
+	form.IsInt("fee_nights", 0)
+	form.IsInt("fee_percent", 0)
+	form.IsInt("no_show_fee_nights", 0)
+
+	if !form.Valid() {
+		m.App.Session.Put(r.Context(), "error", "Please check the policy details and try again")
+		http.Redirect(w, r, "/admin/cancellation-policies", http.StatusSeeOther)
+		return
+	}
+
+	p := models.CancellationPolicy{
+		PolicyName:  r.Form.Get("policy_name"),
+		Description: r.Form.Get("description"),
+	}
+	p.ID, _ = strconv.Atoi(r.Form.Get("id"))
+	p.FreeCancellationHours, _ = strconv.Atoi(r.Form.Get("free_cancellation_hours"))
+	p.FeeNights, _ = strconv.Atoi(r.Form.Get("fee_nights"))
+	p.FeePercent, _ = strconv.Atoi(r.Form.Get("fee_percent"))
+	if p.FeePercent > 100 {
+		p.FeePercent = 100
+	}
+	p.NoShowFeeNights, _ = strconv.Atoi(r.Form.Get("no_show_fee_nights"))
+	p.ReleaseNoShows = form.Has("release_no_shows")
+
+	if p.ID > 0 {
+		err = m.DB.UpdateCancellationPolicy(p)
+	} else {
+		_, err = m.DB.InsertCancellationPolicy(p)
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Cancellation policy saved")
+	http.Redirect(w, r, "/admin/cancellation-policies", http.StatusSeeOther)
+}
+
+// AdminPostRoomCancellationPolicy assigns a cancellation policy and nightly rate to a room.
+func (m *Repository) AdminPostRoomCancellationPolicy(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	roomID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	policyID, _ := strconv.Atoi(r.Form.Get("cancellation_policy_id"))
+	rate, err := helpers.ParseCurrency(r.Form.Get("nightly_rate"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Invalid nightly rate")
+		http.Redirect(w, r, "/admin/cancellation-policies", http.StatusSeeOther)
+		return
+	}
+
+	err = m.DB.UpdateRoomCancellationPolicy(roomID, policyID, rate)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Room updated")
+	http.Redirect(w, r, "/admin/cancellation-policies", http.StatusSeeOther)
+}
+
+// guestFromReservation builds a guest profile from the contact details entered on a reservation.
+func guestFromReservation(res models.Reservation) models.Guest {
+	return models.Guest{
+		FirstName: res.FirstName,
+		LastName:  res.LastName,
+		Email:     res.Email,
+		Phone:     res.Phone,
+	}
+}
+
+// AdminGuests handles GET requests on the admin/guests route
+func (m *Repository) AdminGuests(w http.ResponseWriter, r *http.Request) {
+	guests, err := m.DB.AllGuests()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["guests"] = guests
+	render.Template(w, r, "admin-guests.page.tmpl", &models.TemplateData{
+		Data: data,
+	})
+}
+
+// AdminExportGuests downloads the guest list as CSV or XLSX
+func (m *Repository) AdminExportGuests(w http.ResponseWriter, r *http.Request) {
+	xw, ok := startExport(w, r, "guests", "Guests")
+	if !ok {
+		return
+	}
+
+	err := xw.Write("ID", "First Name", "Last Name", "Email", "Phone", "Stays", "Nights", "Last Stay", "Preferences", "Notes")
+	if err == nil {
+		err = m.DB.EachGuest(func(g models.Guest) error {
+			return xw.Write(g.ID, g.FirstName, g.LastName, g.Email, g.Phone, g.Stays, g.TotalNights, g.LastStay, g.Preferences, g.Notes)
+		})
+	}
+	m.finishExport(xw, err)
+}
+
+// AdminShowGuest shows a guest's profile, stay history and possible duplicate profiles in the admin tool
+func (m *Repository) AdminShowGuest(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	guest, err := m.DB.GetGuestByID(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.renderGuest(w, r, guest, forms.New(nil))
+}
+
+// renderGuest renders the admin guest page for the given guest and form
+func (m *Repository) renderGuest(w http.ResponseWriter, r *http.Request, guest models.Guest, form *forms.Form) {
+	reservations, err := m.DB.GetReservationsForGuest(guest.ID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	duplicates, err := m.DB.PossibleDuplicateGuests(guest.ID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["guest"] = guest
+	data["reservations"] = reservations
+	data["duplicates"] = duplicates
+
+	render.Template(w, r, "admin-guests-show.page.tmpl", &models.TemplateData{
+		Data: data,
+		Form: form,
+	})
+}
+
+// AdminPostShowGuest updates a guest's contact details, notes and preferences
+func (m *Repository) AdminPostShowGuest(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	guest, err := m.DB.GetGuestByID(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	guest.FirstName = r.Form.Get("first_name")
+	guest.LastName = r.Form.Get("last_name")
+	guest.Email = r.Form.Get("email")
+	guest.Phone = r.Form.Get("phone")
+	guest.Notes = r.Form.Get("notes")
+	guest.Preferences = r.Form.Get("preferences")
+
+	form := forms.New(r.PostForm)
+	form.Required("first_name", "last_name", "email")
+	form.IsEmail("email")
+	if !form.Valid() {
+		m.renderGuest(w, r, guest, form)
+		return
+	}
+
+	err = m.DB.UpdateGuest(guest)
+	if errors.Is(err, repository.ErrDuplicateEmail) {
+		form.Errors.Add("email", "Another guest already has this email address; merge the two guests instead")
+		m.renderGuest(w, r, guest, form)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Changes saved")
+	http.Redirect(w, r, fmt.Sprintf("/admin/guests/%d", id), http.StatusSeeOther)
+}
+
+// AdminMergeGuest merges a duplicate guest profile into the guest shown, moving all of their reservations across
+func (m *Repository) AdminMergeGuest(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	duplicateID, err := strconv.Atoi(r.Form.Get("duplicate_id"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Choose a guest to merge")
+		http.Redirect(w, r, fmt.Sprintf("/admin/guests/%d", id), http.StatusSeeOther)
+		return
+	}
+
+	err = m.DB.MergeGuests(id, duplicateID)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+		m.App.Session.Put(r.Context(), "error", "Guests could not be merged")
+		http.Redirect(w, r, fmt.Sprintf("/admin/guests/%d", id), http.StatusSeeOther)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Guests merged")
+	http.Redirect(w, r, fmt.Sprintf("/admin/guests/%d", id), http.StatusSeeOther)
+}
+
+// parseTags splits a comma separated list of tags, trimming whitespace and dropping blanks and
+// case-insensitive duplicates.
+func parseTags(s string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+
+	for _, tag := range strings.Split(s, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[strings.ToLower(tag)] {
+			continue
+		}
+		seen[strings.ToLower(tag)] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// AdminPostReservationNote adds an internal note, attributed to the logged in user, to a reservation
+func (m *Repository) AdminPostReservationNote(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	src := chi.URLParam(r, "src")
+	redirect := fmt.Sprintf("/admin/reservations/%s/%d/show?y=%s&m=%s", src, id, r.Form.Get("year"), r.Form.Get("month"))
+
+	form := forms.New(r.PostForm)
+	form.Required("body")
+	if !form.Valid() {
+		m.App.Session.Put(r.Context(), "error", "A note cannot be blank")
+		http.Redirect(w, r, redirect, http.StatusSeeOther)
+		return
+	}
+
+	note := models.ReservationNote{
+		ReservationID: id,
+		UserID:        m.App.Session.GetInt(r.Context(), "user_id"),
+		Body:          strings.TrimSpace(r.Form.Get("body")),
+	}
+	err = m.DB.InsertReservationNote(note)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Note added")
+	http.Redirect(w, r, redirect, http.StatusSeeOther)
+}
+
+// AdminBookingQuestions lists the custom questions asked on the reservation form
+func (m *Repository) AdminBookingQuestions(w http.ResponseWriter, r *http.Request) {
+	questions, err := m.DB.AllBookingQuestions()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["questions"] = questions
+	data["rooms"] = rooms
+
+	render.Template(w, r, "admin-booking-questions.page.tmpl", &models.TemplateData{
+		Data: data,
+		Form: forms.New(nil),
+	})
+}
+
+// AdminPostBookingQuestion creates a new booking question, or updates an existing one when an ID is posted.
+// A room ID of 0 asks the question for every room.
+func (m *Repository) AdminPostBookingQuestion(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("label", "kind")
+	form.In("kind", models.QuestionKindText, models.QuestionKindChoice, models.QuestionKindCheckbox)
+	form.IsInt("room_id", 0)
+	form.IsInt("sort_order", 0)
+
+	q := models.BookingQuestion{
+		Label:    strings.TrimSpace(r.Form.Get("label")),
+		Kind:     r.Form.Get("kind"),
+		Required: form.Has("required"),
+		Active:   form.Has("active"),
+	}
+	for _, c := range strings.Split(r.Form.Get("choices"), "\n") {
+		if c = strings.TrimSpace(c); c != "" {
+			q.Choices = append(q.Choices, c)
+		}
+	}
+	if q.Kind == models.QuestionKindChoice && len(q.Choices) == 0 {
+		form.Errors.Add("choices", "A choice question needs at least one choice")
+	}
+
+	if !form.Valid() {
+		m.App.Session.Put(r.Context(), "error", "Please check the question details and try again")
+		http.Redirect(w, r, "/admin/booking-questions", http.StatusSeeOther)
+		return
+	}
+
+	q.ID, _ = strconv.Atoi(r.Form.Get("id"))
+	q.RoomID, _ = strconv.Atoi(r.Form.Get("room_id"))
+	q.SortOrder, _ = strconv.Atoi(r.Form.Get("sort_order"))
+
+	if q.ID > 0 {
+		err = m.DB.UpdateBookingQuestion(q)
+	} else {
+		_, err = m.DB.InsertBookingQuestion(q)
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Booking question saved")
+	http.Redirect(w, r, "/admin/booking-questions", http.StatusSeeOther)
+}
+
+// boardDate returns the date shown on a daily board such as the front desk, taken from the d query parameter
+// and defaulting to today
+func boardDate(r *http.Request) (time.Time, error) {
+	if d := r.URL.Query().Get("d"); d != "" {
+		return time.Parse("2006-01-02", d)
+	}
+	now := time.Now()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC), nil
+}
+
+// parseFrontDeskTime parses a datetime-local form value, defaulting to the current time when it is blank
+func parseFrontDeskTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Now(), nil
+	}
+	return time.ParseInLocation("2006-01-02T15:04", value, time.Local)
+}
+
+// AdminFrontDesk shows the arrivals and departures board for a date
+func (m *Repository) AdminFrontDesk(w http.ResponseWriter, r *http.Request) {
+	date, err := boardDate(r)
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	arrivals, err := m.DB.GetArrivalsByDate(date)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	departures, err := m.DB.GetDeparturesByDate(date)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	stringMap := make(map[string]string)
+	stringMap["date"] = date.Format("2006-01-02")
+	stringMap["previous_date"] = date.AddDate(0, 0, -1).Format("2006-01-02")
+	stringMap["next_date"] = date.AddDate(0, 0, 1).Format("2006-01-02")
+	stringMap["now"] = time.Now().Format("2006-01-02T15:04")
+
+	data := make(map[string]interface{})
+	data["date"] = date
+	data["arrivals"] = arrivals
+	data["departures"] = departures
+
+	render.Template(w, r, "admin-front-desk.page.tmpl", &models.TemplateData{
+		StringMap: stringMap,
+		Data:      data,
+		Form:      forms.New(nil),
+	})
+}
+
+// AdminPostCheckIn records a guest's arrival from the front desk board
+func (m *Repository) AdminPostCheckIn(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	redirectURL := fmt.Sprintf("/admin/front-desk?d=%s", r.Form.Get("d"))
+
+	res, err := m.DB.GetReservationByID(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if res.Status != models.ReservationStatusConfirmed {
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("Reservation %d cannot be checked in because it is %s", res.ID, res.Status))
+		http.Redirect(w, r, redirectURL, http.StatusSeeOther)
+		return
+	}
+
+	arrivedAt, err := parseFrontDeskTime(r.Form.Get("arrived_at"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Invalid arrival time")
+		http.Redirect(w, r, redirectURL, http.StatusSeeOther)
+		return
+	}
+
+	err = m.DB.CheckInReservation(res.ID, arrivedAt, r.Form.Get("id_verified") != "")
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	m.publishReservationWebhook(webhooks.ReservationUpdated, res.ID)
+	m.publishReservationEvent(res)
+
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("%s %s checked in", res.FirstName, res.LastName))
+	http.Redirect(w, r, redirectURL, http.StatusSeeOther)
+}
+
+// AdminPostCheckOut records a guest's departure from the front desk board. When the guest leaves on a day
+// other than the booked departure date, the room is held only up to the day they actually left.
+func (m *Repository) AdminPostCheckOut(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	redirectURL := fmt.Sprintf("/admin/front-desk?d=%s", r.Form.Get("d"))
+
+	res, err := m.DB.GetReservationByID(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if res.Status != models.ReservationStatusCheckedIn {
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("Reservation %d cannot be checked out because it is %s", res.ID, res.Status))
+		http.Redirect(w, r, redirectURL, http.StatusSeeOther)
+		return
+	}
+
+	departedAt, err := parseFrontDeskTime(r.Form.Get("departed_at"))
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", "Invalid departure time")
+		http.Redirect(w, r, redirectURL, http.StatusSeeOther)
+		return
+	}
+
+	departureDate := time.Date(departedAt.Year(), departedAt.Month(), departedAt.Day(), 0, 0, 0, 0, time.UTC)
+	if departureDate.Before(res.StartDate) {
+		m.App.Session.Put(r.Context(), "error", "Departure cannot be before the arrival date")
+		http.Redirect(w, r, redirectURL, http.StatusSeeOther)
+		return
+	}
+
+	// a guest on a split stay leaves from the room of the last segment
+	lastRoomID := res.RoomID
+	if res.Split() {
+		lastRoomID = res.Segments[len(res.Segments)-1].RoomID
+	}
+
+	if departureDate.After(res.EndDate) {
+		available, err := m.DB.SearchAvailabilityByDatesByRoomID(res.EndDate, departureDate, lastRoomID)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		if !available {
+			m.App.Session.Put(r.Context(), "error", "The room is booked for the extra nights, so the stay cannot be extended to this departure date")
+			http.Redirect(w, r, redirectURL, http.StatusSeeOther)
+			return
+		}
+	}
+
+	err = m.DB.CheckOutReservation(res.ID, departedAt)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	m.publishReservationWebhook(webhooks.ReservationUpdated, res.ID)
+	m.publishReservationEvent(res)
+	if departureDate.After(res.EndDate) {
+		// the extra nights of a late checkout
+		m.publishEvent(events.New(events.ReservationChanged, lastRoomID, res.EndDate, departureDate))
+	}
+
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("%s %s checked out", res.FirstName, res.LastName))
+	http.Redirect(w, r, redirectURL, http.StatusSeeOther)
+}
+
+// GenerateHousekeepingTasks creates the cleaning tasks for a date from the departures and stay-overs in each room.
+// Rooms that are out of service, or that already have a task for the date, are left alone.
+func (m *Repository) GenerateHousekeepingTasks(date time.Time) error {
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		return err
+	}
+
+	var tasks []models.HousekeepingTask
+	for _, room := range rooms {
+		if room.HousekeepingStatus == models.HousekeepingOutOfService {
+			continue
+		}
+
+		restrictions, err := m.DB.GetRestrictionsForRoomByDate(room.ID, date.AddDate(0, 0, -1), date)
+		if err != nil {
+			return err
+		}
+
+		if task, ok := housekeeping.TaskForRoom(room.ID, date, restrictions); ok {
+			tasks = append(tasks, task)
+		}
+	}
+
+	return m.DB.InsertHousekeepingTasks(tasks)
+}
+
+// AdminHousekeeping shows the housekeeping status of every room and the cleaning tasks for a date
+func (m *Repository) AdminHousekeeping(w http.ResponseWriter, r *http.Request) {
+	date, err := boardDate(r)
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	tasks, err := m.DB.GetHousekeepingTasksByDate(date)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	stringMap := make(map[string]string)
+	stringMap["date"] = date.Format("2006-01-02")
+	stringMap["previous_date"] = date.AddDate(0, 0, -1).Format("2006-01-02")
+	stringMap["next_date"] = date.AddDate(0, 0, 1).Format("2006-01-02")
+
+	data := make(map[string]interface{})
+	data["date"] = date
+	data["rooms"] = rooms
+	data["tasks"] = tasks
+	data["statuses"] = housekeeping.Statuses
+
+	render.Template(w, r, "admin-housekeeping.page.tmpl", &models.TemplateData{
+		StringMap: stringMap,
+		Data:      data,
+		Form:      forms.New(nil),
+	})
+}
+
+// AdminPostGenerateHousekeepingTasks creates the cleaning tasks for the posted date
+func (m *Repository) AdminPostGenerateHousekeepingTasks(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	date, err := time.Parse("2006-01-02", r.Form.Get("d"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err = m.GenerateHousekeepingTasks(date)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Cleaning tasks generated")
+	http.Redirect(w, r, fmt.Sprintf("/admin/housekeeping?d=%s", r.Form.Get("d")), http.StatusSeeOther)
+}
+
+// AdminPostCompleteHousekeepingTask marks a cleaning task as done by the logged in user
+func (m *Repository) AdminPostCompleteHousekeepingTask(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = m.DB.CompleteHousekeepingTask(id, m.App.Session.GetInt(r.Context(), "user_id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Task done")
+	http.Redirect(w, r, fmt.Sprintf("/admin/housekeeping?d=%s", r.Form.Get("d")), http.StatusSeeOther)
+}
+
+// AdminPostRoomHousekeepingStatus sets the housekeeping status of a room
+func (m *Repository) AdminPostRoomHousekeepingStatus(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	roomID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	redirectURL := fmt.Sprintf("/admin/housekeeping?d=%s", r.Form.Get("d"))
+
+	form := forms.New(r.PostForm)
+	if !form.In("housekeeping_status", housekeeping.Statuses...) {
+		m.App.Session.Put(r.Context(), "error", "Unknown housekeeping status")
+		http.Redirect(w, r, redirectURL, http.StatusSeeOther)
+		return
+	}
+
+	err = m.DB.UpdateRoomHousekeepingStatus(roomID, r.Form.Get("housekeeping_status"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Room status updated")
+	http.Redirect(w, r, redirectURL, http.StatusSeeOther)
+}
+
+// SweepNoShows flags confirmed reservations whose guests never checked in by the no-show cutoff. Each no-show
+// is charged the fee set by its room's cancellation policy, and its remaining nights are released when the
+// policy allows. It returns the reservations flagged.
+func (m *Repository) SweepNoShows(now time.Time) ([]models.Reservation, error) {
+	candidates, err := m.DB.GetNoShowCandidates(now.Add(-m.App.NoShowCutoff))
+	if err != nil {
+		return nil, err
+	}
+
+	var flagged []models.Reservation
+	for _, res := range candidates {
+		policy, err := m.roomCancellationPolicy(res.Room)
+		if err != nil {
+			return flagged, err
+		}
+
+		res.NoShowFee = cancellation.NoShowFee(policy, res, res.Room.NightlyRate)
+		err = m.DB.MarkNoShow(res.ID, res.NoShowFee, cancellation.ReleasesNoShow(policy), now)
+		if err != nil {
+			return flagged, err
+		}
+
+		res.Status = models.ReservationStatusNoShow
+		res.NoShowAt = now
+		flagged = append(flagged, res)
+		m.publishWebhook(webhooks.ReservationUpdated, webhooks.NewReservation(res))
+		m.publishReservationEvent(res)
+	}
+
+	return flagged, nil
+}
+
+// SendNoShowSummary emails the property owner a summary of the reservations flagged as no-shows since a time.
+// Nothing is sent when there were none.
+func (m *Repository) SendNoShowSummary(since time.Time) error {
+	noShows, err := m.DB.GetNoShowsSince(since)
+	if err != nil {
+		return err
+	}
+	if len(noShows) == 0 {
+		return nil
+	}
+
+	msg, err := composeMail("me@here.com", emails.NoShowSummary{Since: since, Reservations: noShows})
+	if err != nil {
+		return err
+	}
+
+	return m.DB.QueueMail(msg)
+}
+
+// reminderDays is how many days before their arrival guests are sent a reminder
+const reminderDays = 2
+
+// SendArrivalReminders queues a reminder to each guest with a confirmed reservation arriving reminderDays
+// after today, returning how many were queued. A reservation is marked as reminded in the same transaction
+// that queues its reminder, so retrying a failed run or running the job again never reminds a guest twice.
+func (m *Repository) SendArrivalReminders(today time.Time) (int, error) {
+	ids, err := m.DB.GetArrivalsToRemind(today.AddDate(0, 0, reminderDays))
+	if err != nil {
+		return 0, err
+	}
+
+	queued := 0
+	var errs []error
+	for _, id := range ids {
+		// the full reservation has the cancel token and the rooms of a split stay
+		res, err := m.DB.GetReservationByID(id)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("reservation %d: %w", id, err))
+			continue
+		}
+
+		msg, err := composeMail(res.Email, emails.Reminder{Reservation: res, CancelURL: m.guestCancelURL(res)})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("reservation %d: %w", id, err))
+			continue
+		}
+
+		sent, err := m.DB.QueueArrivalReminder(id, msg)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("reservation %d: %w", id, err))
+			continue
+		}
+		if sent {
+			queued++
+		}
+	}
+
+	return queued, errors.Join(errs...)
+}
+
+// AdminJobs shows the background jobs with their schedules and the most recent runs
+func (m *Repository) AdminJobs(w http.ResponseWriter, r *http.Request) {
+	jobs, err := m.DB.AllJobs()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	runs, err := m.DB.GetRecentJobRuns(50)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["jobs"] = jobs
+	data["runs"] = runs
+
+	render.Template(w, r, "admin-jobs.page.tmpl", &models.TemplateData{
+		Data: data,
+		Form: forms.New(nil),
+	})
+}
+
+// AdminPostRunJob queues a background job to run on the scheduler's next check
+func (m *Repository) AdminPostRunJob(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	err := m.DB.RunJobNow(name)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("%s will run within a minute", name))
+	http.Redirect(w, r, "/admin/jobs", http.StatusSeeOther)
+}
+
+// AdminOutbox shows the emails in the outbox, optionally filtered by status, so that staff can see what
+// has been sent and what is waiting or has failed
+func (m *Repository) AdminOutbox(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+
+	messages, err := m.DB.GetOutboxMessages(status)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["messages"] = messages
+
+	stringMap := make(map[string]string)
+	stringMap["status"] = status
+
+	render.Template(w, r, "admin-outbox.page.tmpl", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+		Form:      forms.New(nil),
+	})
+}
+
+// AdminPostResendOutboxMessage puts an email back in the outbox to be sent again, such as one that
+// failed too many times while the mail server was down
+func (m *Repository) AdminPostResendOutboxMessage(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = m.DB.ResendOutboxMessage(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Email queued to be sent again")
+	http.Redirect(w, r, fmt.Sprintf("/admin/outbox?status=%s", r.Form.Get("status")), http.StatusSeeOther)
+}
+
+// MailMaxAttempts is how many times an email is tried before it is moved to the dead letter state
+const MailMaxAttempts = 8
+
+// mailLockFor is how long claimed emails are locked before another instance may assume this one crashed
+const mailLockFor = 5 * time.Minute
+
+// SendPendingMail claims up to limit emails that are due in the outbox and delivers each of them once with
+// the configured mailer. Emails that fail are retried with backoff until they reach MailMaxAttempts.
+// It returns how many were sent.
+func (m *Repository) SendPendingMail(now time.Time, limit int) (int, error) {
+	messages, err := m.DB.ClaimOutboxMessages(limit, now, now.Add(mailLockFor))
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, msg := range messages {
+		err := m.deliver(msg.MailData)
+		if err == nil {
+			sent++
+			err = m.DB.MarkOutboxSent(msg.ID)
+			if err != nil {
+				return sent, err
+			}
+			continue
+		}
+
+		attempt := msg.Attempts + 1
+		dead := attempt >= MailMaxAttempts
+		m.App.ErrorLog.Printf("cannot send email %d to %s (attempt %d): %s", msg.ID, msg.To, attempt, err)
+
+		err = m.DB.MarkOutboxFailed(msg.ID, err.Error(), now.Add(jobs.Backoff(attempt)), dead)
+		if err != nil {
+			return sent, err
+		}
+	}
+
+	return sent, nil
+}
+
+// deliver sends an email with the configured mailer. Messages queued before the email templates name the
+// layout file they were to be sent in and hold only its body, so they are sent in the shared layout instead.
+func (m *Repository) deliver(data models.MailData) error {
+	msg := mailer.Message{
+		From:    data.From,
+		To:      data.To,
+		Subject: data.Subject,
+		HTML:    data.Content,
+		Text:    data.Text,
+	}
+
+	if strings.HasSuffix(data.Template, ".html") {
+		html, _, err := emailTemplates.Render(emails.NewLegacy(data.Subject, data.Content))
+		if err != nil {
+			return err
+		}
+		msg.HTML = html
+	}
+
+	for _, a := range data.Attachments {
+		msg.Attachments = append(msg.Attachments, mailer.Attachment{
+			Filename:    a.Filename,
+			ContentType: a.ContentType,
+			Data:        a.Data,
+		})
+	}
+
+	return m.App.Mailer.Send(msg)
+}
+
+// AdminEmailTemplates lists the email templates and previews the one named in the URL, if any, with example data
+func (m *Repository) AdminEmailTemplates(w http.ResponseWriter, r *http.Request) {
+	data := make(map[string]interface{})
+	data["templates"] = emails.Names
+
+	stringMap := make(map[string]string)
+
+	if name := chi.URLParam(r, "name"); name != "" {
+		e, ok := emails.Sample(name)
+		if !ok {
+			helpers.ClientError(w, http.StatusNotFound)
+			return
+		}
+
+		html, text, err := emailTemplates.Render(e)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+
+		stringMap["name"] = name
+		stringMap["subject"] = e.Subject()
+		stringMap["html"] = html
+		stringMap["text"] = text
+	}
+
+	render.Template(w, r, "admin-email-templates.page.tmpl", &models.TemplateData{
+		Data:      data,
+		StringMap: stringMap,
+	})
+}
+
+// calendarFeedHistory is how far back the room calendar feeds go
+const calendarFeedHistory = 30 * 24 * time.Hour
+
+// RoomCalendarFeed serves a room's reservations and blocks as an iCalendar feed for external booking sites to
+// import. The feed is only served with the room's secret token, and shows guest names only if the room allows it.
+func (m *Repository) RoomCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
+
+	token := r.URL.Query().Get("t")
+	room, err := m.DB.GetRoomByID(id)
+	if err != nil || room.ICalToken == "" || subtle.ConstantTimeCompare([]byte(room.ICalToken), []byte(token)) != 1 {
+		helpers.ClientError(w, http.StatusNotFound)
+		return
+	}
+
+	restrictions, err := m.DB.GetCalendarFeedRestrictions(room.ID, time.Now().Add(-calendarFeedHistory))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	cal := ical.Calendar{
+		Name:   strings.TrimSpace(fmt.Sprintf("%s %s", m.App.Property.Name, room.RoomName)),
+		Method: ical.MethodPublish,
+	}
+	for _, rr := range restrictions {
+		cal.Events = append(cal.Events, m.feedEvent(room, rr))
+	}
+
+	w.Header().Set("Content-Type", ical.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="room-%d.ics"`, room.ID))
+	w.Header().Set("Cache-Control", "no-cache")
+	err = cal.Encode(w)
+	if err != nil {
+		m.App.ErrorLog.Println(err)
+	}
+}
+
+// feedEvent returns the all-day event for a reservation or block in a room's calendar feed. Guest names
+// are redacted unless the room's feed is set to show them.
+func (m *Repository) feedEvent(room models.Room, rr models.RoomRestriction) ical.Event {
+	event := ical.Event{
+		UID:    fmt.Sprintf("room-restriction-%d@%s", rr.ID, m.calendarDomain()),
+		Stamp:  rr.UpdatedAt,
+		Start:  rr.StartDate,
+		End:    rr.EndDate,
+		AllDay: true,
+		Status: ical.StatusConfirmed,
+	}
+	if event.Stamp.IsZero() {
+		event.Stamp = time.Now()
+	}
+
+	switch {
+	case rr.ReservationID == 0:
+		event.Summary = "Not available"
+	case room.ICalShowGuests:
+		event.Summary = strings.TrimSpace(rr.Reservation.FirstName + " " + rr.Reservation.LastName)
+		event.Sequence = rr.Reservation.ICalSequence
+	default:
+		event.Summary = "Reserved"
+		event.Sequence = rr.Reservation.ICalSequence
+	}
+
+	return event
+}
+
+// roomCalendarFeedURL returns the address external sites use to import a room's calendar, or nothing if its feed is off
+func (m *Repository) roomCalendarFeedURL(room models.Room) string {
+	if room.ICalToken == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/ical/rooms/%d.ics?t=%s", m.App.BaseURL, room.ID, room.ICalToken)
+}
+
+// AdminCalendarSync shows each room's calendar feed settings and the external calendars imported to block rooms
+func (m *Repository) AdminCalendarSync(w http.ResponseWriter, r *http.Request) {
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	imports, err := m.DB.AllCalendarImports()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	feeds := make(map[int]string)
+	for _, room := range rooms {
+		feeds[room.ID] = m.roomCalendarFeedURL(room)
+	}
+
+	data := make(map[string]interface{})
+	data["rooms"] = rooms
+	data["feeds"] = feeds
+	data["imports"] = imports
+
+	render.Template(w, r, "admin-calendar-sync.page.tmpl", &models.TemplateData{
+		Data: data,
+		Form: forms.New(nil),
+	})
+}
+
+// AdminPostRoomCalendarFeed changes a room's calendar feed. Turning the feed on, or asking for a new link,
+// generates a new secret token, so any old link stops working.
+func (m *Repository) AdminPostRoomCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	roomID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	room, err := m.DB.GetRoomByID(roomID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	token := room.ICalToken
+	flash := "Calendar feed updated"
+	switch {
+	case r.Form.Get("disable") != "":
+		token = ""
+		flash = "Calendar feed turned off"
+	case r.Form.Get("regenerate") != "" || token == "":
+		token, err = helpers.GenerateToken(16)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		flash = "New calendar feed link created; update it on every site that imports this room's calendar"
+	}
+
+	err = m.DB.UpdateRoomCalendarFeed(roomID, token, r.Form.Get("show_guests") != "")
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", flash)
+	http.Redirect(w, r, "/admin/calendar-sync", http.StatusSeeOther)
+}
+
+// calendarClient fetches the external calendars that are imported from a URL
+var calendarClient = &http.Client{Timeout: 30 * time.Second}
+
+// maxCalendarSize is the largest calendar that is fetched or uploaded for import
+const maxCalendarSize = 5 << 20
+
+// errCalendarTooLarge is returned for a calendar over maxCalendarSize, rather than reading only part of it
+var errCalendarTooLarge = fmt.Errorf("the calendar is larger than %d MB", maxCalendarSize>>20)
+
+// readCalendarImport returns the events of an imported calendar, fetching it if it was added by URL
+func readCalendarImport(imp models.CalendarImport) ([]ical.Event, error) {
+	if imp.URL == "" {
+		return ical.Decode(strings.NewReader(imp.Content))
+	}
+
+	// webcal links are served over https
+	link := imp.URL
+	if strings.HasPrefix(strings.ToLower(link), "webcal://") {
+		link = "https://" + link[len("webcal://"):]
+	}
+
+	resp, err := calendarClient.Get(link)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching calendar: %s", resp.Status)
+	}
+
+	content, err := io.ReadAll(io.LimitReader(resp.Body, maxCalendarSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(content) > maxCalendarSize {
+		return nil, errCalendarTooLarge
+	}
+	return ical.Decode(bytes.NewReader(content))
+}
+
+// SyncCalendarImport reads an imported calendar and brings the room's blocks in line with it, recording any
+// reservations its events overlap. If the calendar cannot be read the blocks are left as they were and the
+// error is recorded against the import.
+func (m *Repository) SyncCalendarImport(imp models.CalendarImport, now time.Time) (models.CalendarImportSync, error) {
+	sync, err := m.syncCalendarImport(imp, now)
+	if err != nil {
+		markErr := m.DB.MarkCalendarImportFailed(imp.ID, err.Error())
+		if markErr != nil {
+			m.App.ErrorLog.Println(markErr)
+		}
+		return sync, err
+	}
+	return sync, nil
+}
+
+func (m *Repository) syncCalendarImport(imp models.CalendarImport, now time.Time) (models.CalendarImportSync, error) {
+	events, err := readCalendarImport(imp)
+	if err != nil {
+		return models.CalendarImportSync{}, err
+	}
+
+	existing, err := m.DB.GetImportedBlocks(imp.ID)
+	if err != nil {
+		return models.CalendarImportSync{}, err
+	}
+
+	// the room's reservations are only needed over the dates the calendar covers
+	from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	until := from
+	for _, ev := range events {
+		if _, end := calimport.Nights(ev); end.After(until) {
+			until = end
+		}
+	}
+
+	var restrictions []models.RoomRestriction
+	if until.After(from) {
+		restrictions, err = m.DB.GetRestrictionsForRoomByDate(imp.RoomID, from, until)
+		if err != nil {
+			return models.CalendarImportSync{}, err
+		}
+	}
+
+	sync := calimport.Diff(imp, events, existing, restrictions, from)
+	sync.SyncedAt = now
+
+	ids, err := m.DB.ApplyCalendarImport(sync)
+	if err != nil {
+		return models.CalendarImportSync{}, err
+	}
+
+	for i, id := range ids {
+		sync.Create[i].ID = id
+		m.publishWebhook(webhooks.BlockCreated, webhooks.NewBlock(sync.Create[i]))
+		m.publishBlockEvent(sync.Create[i])
+	}
+	for _, b := range sync.Update {
+		m.publishWebhook(webhooks.BlockUpdated, webhooks.NewBlock(b))
+		m.publishBlockEvent(b)
+	}
+	for _, id := range sync.Delete {
+		block := models.RoomRestriction{ID: id, RoomID: imp.RoomID, ImportID: imp.ID}
+		m.publishWebhook(webhooks.BlockDeleted, webhooks.NewBlock(block))
+		m.publishBlockEvent(block)
+	}
+
+	return sync, nil
+}
+
+// SyncCalendarImports syncs every imported calendar, returning how many of their events overlap reservations.
+// A calendar that fails to sync does not stop the others.
+func (m *Repository) SyncCalendarImports(now time.Time) (int, error) {
+	imports, err := m.DB.AllCalendarImports()
+	if err != nil {
+		return 0, err
+	}
+
+	conflicts := 0
+	var errs []error
+	for _, imp := range imports {
+		sync, err := m.SyncCalendarImport(imp, now)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s (%s): %w", imp.Name, imp.Room.RoomName, err))
+			continue
+		}
+		conflicts += len(sync.Conflicts)
+	}
+
+	return conflicts, errors.Join(errs...)
+}
+
+// calendarSyncSummary describes the outcome of syncing a calendar import for staff
+func calendarSyncSummary(sync models.CalendarImportSync) string {
+	summary := fmt.Sprintf("%d block(s) added, %d moved and %d removed", len(sync.Create), len(sync.Update), len(sync.Delete))
+	if len(sync.Conflicts) > 0 {
+		summary += fmt.Sprintf("; %d event(s) overlap existing reservations", len(sync.Conflicts))
+	}
+	return summary
+}
+
+// AdminPostCalendarImport adds an external calendar to block a room, either from a link or an uploaded
+// .ics file, and syncs it straight away
+func (m *Repository) AdminPostCalendarImport(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseMultipartForm(maxCalendarSize)
+	if err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("room_id", "name")
+	form.IsInt("room_id", 1)
+
+	imp := models.CalendarImport{
+		Name: strings.TrimSpace(r.Form.Get("name")),
+		URL:  strings.TrimSpace(r.Form.Get("url")),
+	}
+	imp.RoomID, _ = strconv.Atoi(r.Form.Get("room_id"))
+
+	file, _, err := r.FormFile("calendar")
+	switch {
+	case err == nil:
+		defer file.Close()
+		content, err := io.ReadAll(io.LimitReader(file, maxCalendarSize+1))
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		if len(content) > maxCalendarSize {
+			form.Errors.Add("calendar", "The file is too large to import")
+			break
+		}
+		_, err = ical.Decode(bytes.NewReader(content))
+		if err != nil {
+			form.Errors.Add("calendar", "The file is not a calendar")
+		}
+		imp.Content = string(content)
+		imp.URL = ""
+	case imp.URL == "":
+		form.Errors.Add("url", "Enter a calendar link or upload a file")
+	default:
+		u, err := url.Parse(imp.URL)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "webcal") {
+			form.Errors.Add("url", "Enter a valid calendar link")
+		}
+	}
+
+	if !form.Valid() {
+		m.App.Session.Put(r.Context(), "error", "Please check the calendar details and try again")
+		http.Redirect(w, r, "/admin/calendar-sync", http.StatusSeeOther)
+		return
+	}
+
+	imp.ID, err = m.DB.InsertCalendarImport(imp)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	sync, err := m.SyncCalendarImport(imp, time.Now())
+	if err != nil {
+		m.App.Session.Put(r.Context(), "warning", fmt.Sprintf("Calendar added, but it could not be synced: %s", err))
+	} else {
+		m.App.Session.Put(r.Context(), "flash", "Calendar added: "+calendarSyncSummary(sync))
+	}
+	http.Redirect(w, r, "/admin/calendar-sync", http.StatusSeeOther)
+}
+
+// AdminPostSyncCalendarImport syncs an imported calendar without waiting for the next scheduled sync
+func (m *Repository) AdminPostSyncCalendarImport(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	imp, err := m.DB.GetCalendarImportByID(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	sync, err := m.SyncCalendarImport(imp, time.Now())
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("Could not sync %s: %s", imp.Name, err))
+	} else {
+		m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("%s synced: %s", imp.Name, calendarSyncSummary(sync)))
+	}
+	http.Redirect(w, r, "/admin/calendar-sync", http.StatusSeeOther)
+}
+
+// AdminPostDeleteCalendarImport stops importing a calendar and removes the blocks it created
+func (m *Repository) AdminPostDeleteCalendarImport(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	blocks, err := m.DB.GetImportedBlocks(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = m.DB.DeleteCalendarImport(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	for _, b := range blocks {
+		m.publishWebhook(webhooks.BlockDeleted, webhooks.NewBlock(models.RoomRestriction{ID: b.ID, RoomID: b.RoomID, ImportID: b.ImportID}))
+		m.publishBlockEvent(b)
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Calendar removed along with its blocks")
+	http.Redirect(w, r, "/admin/calendar-sync", http.StatusSeeOther)
+}
+
+// publishWebhook queues an event for every webhook endpoint subscribed to it. The change the event describes
+// has already been saved, so a failure to queue it is logged rather than failing the request.
+func (m *Repository) publishWebhook(event string, data interface{}) {
+	payload, err := webhooks.NewPayload(event, data, time.Now())
+	if err == nil {
+		err = m.DB.QueueWebhookEvent(event, payload)
+	}
+	if err != nil {
+		m.App.ErrorLog.Printf("cannot queue webhook event %s: %s", event, err)
+	}
+}
+
+// publishReservationEvent tells the pages open on the calendar and availability that the nights of a
+// reservation changed, once for each room of a split stay
+func (m *Repository) publishReservationEvent(res models.Reservation) {
+	if !res.Split() {
+		m.publishEvent(events.New(events.ReservationChanged, res.RoomID, res.StartDate, res.EndDate))
+		return
+	}
+	for _, seg := range res.Segments {
+		m.publishEvent(events.New(events.ReservationChanged, seg.RoomID, seg.StartDate, seg.EndDate))
+	}
+}
+
+// publishBlockEvent tells the pages open on the calendar and availability that the nights of a block changed
+func (m *Repository) publishBlockEvent(b models.RoomRestriction) {
+	m.publishEvent(events.New(events.BlockChanged, b.RoomID, b.StartDate, b.EndDate))
+}
+
+// publishEvent sends a live update to the pages open on every instance. Pages read what they show from the
+// database, so a failure to relay the update is logged rather than failing the request.
+func (m *Repository) publishEvent(e events.Event) {
+	err := m.App.Events.Publish(e)
+	if err != nil {
+		m.App.ErrorLog.Printf("cannot relay %s event: %s", e.Kind, err)
+	}
+}
+
+// eventHeartbeat is how often an idle event stream sends a comment, so that proxies do not close it
+const eventHeartbeat = 25 * time.Second
+
+// streamEvents sends the live updates matching keep to the page as server-sent events until it goes away.
+// Each event is named by its kind and carries its JSON as data.
+func (m *Repository) streamEvents(w http.ResponseWriter, r *http.Request, keep func(events.Event) bool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		helpers.ServerError(w, errors.New("streaming is not supported"))
+		return
+	}
+
+	sub := m.App.Events.Subscribe()
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 5000\n\n")
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case e, ok := <-sub.Events:
+			if !ok {
+				return
+			}
+			if !keep(e) {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Kind, e.Encode())
+		}
+		flusher.Flush()
+	}
+}
+
+// AdminEvents streams every change to reservations and blocks to the admin calendars
+func (m *Repository) AdminEvents(w http.ResponseWriter, r *http.Request) {
+	m.streamEvents(w, r, func(events.Event) bool { return true })
+}
+
+// AvailabilityEvents streams changes to the availability of a room to the public availability widgets.
+// A room_id parameter limits the stream to one room, and start and end to the nights between them.
+func (m *Repository) AvailabilityEvents(w http.ResponseWriter, r *http.Request) {
+	roomID, _ := strconv.Atoi(r.URL.Query().Get("room_id"))
+	start, _ := time.Parse("2006-01-02", r.URL.Query().Get("start"))
+	end, err := time.Parse("2006-01-02", r.URL.Query().Get("end"))
+	if err != nil || !end.After(start) {
+		end = time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+
+	m.streamEvents(w, r, func(e events.Event) bool {
+		return e.Affects(roomID, start, end)
+	})
+}
+
+// publishReservationWebhook loads a reservation as it now stands and queues an event about it
+func (m *Repository) publishReservationWebhook(event string, id int) {
+	res, err := m.DB.GetReservationByID(id)
+	if err != nil {
+		m.App.ErrorLog.Printf("cannot queue webhook event %s: %s", event, err)
+		return
+	}
+	m.publishWebhook(event, webhooks.NewReservation(res))
+}
+
+// WebhookMaxAttempts is how many times a delivery is tried before it is moved to the dead letter state
+const WebhookMaxAttempts = 10
+
+// webhookLockFor is how long claimed deliveries are locked before another instance may assume this one crashed
+const webhookLockFor = 5 * time.Minute
+
+// webhookClient posts webhook deliveries
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// DeliverPendingWebhooks claims up to limit deliveries that are due and posts them to their endpoints.
+// Failed deliveries are retried with an increasing delay, and given up on after WebhookMaxAttempts.
+// It returns how many were accepted.
+func (m *Repository) DeliverPendingWebhooks(now time.Time, limit int) (int, error) {
+	deliveries, err := m.DB.ClaimWebhookDeliveries(limit, now, now.Add(webhookLockFor))
+	if err != nil {
+		return 0, err
+	}
+
+	delivered := 0
+	for _, d := range deliveries {
+		code, err := webhooks.Send(webhookClient, d, time.Now())
+		if err == nil {
+			delivered++
+			err = m.DB.MarkWebhookDelivered(d.ID, code)
+			if err != nil {
+				return delivered, err
+			}
+			continue
+		}
+
+		attempt := d.Attempts + 1
+		dead := attempt >= WebhookMaxAttempts
+		m.App.ErrorLog.Printf("cannot deliver webhook %d to %s (attempt %d): %s", d.ID, d.Endpoint.URL, attempt, err)
+
+		err = m.DB.MarkWebhookFailed(d.ID, code, err.Error(), now.Add(jobs.Backoff(attempt)), dead)
+		if err != nil {
+			return delivered, err
+		}
+	}
+
+	return delivered, nil
+}
+
+// AdminWebhooks lists the webhook endpoints and offers a form to add one
+func (m *Repository) AdminWebhooks(w http.ResponseWriter, r *http.Request) {
+	endpoints, err := m.DB.AllWebhookEndpoints()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["endpoints"] = endpoints
+	data["events"] = webhooks.Events
+
+	render.Template(w, r, "admin-webhooks.page.tmpl", &models.TemplateData{
+		Data: data,
+		Form: forms.New(nil),
+	})
+}
+
+// AdminShowWebhookEndpoint shows a webhook endpoint's settings and signing secret, and its delivery log
+func (m *Repository) AdminShowWebhookEndpoint(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	endpoint, err := m.DB.GetWebhookEndpointByID(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	deliveries, err := m.DB.GetWebhookDeliveries(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["endpoint"] = endpoint
+	data["deliveries"] = deliveries
+	data["events"] = webhooks.Events
+
+	render.Template(w, r, "admin-webhooks-show.page.tmpl", &models.TemplateData{
+		Data: data,
+		Form: forms.New(nil),
+	})
+}
+
+// AdminPostWebhookEndpoint adds a webhook endpoint, or updates one when an id is posted. New endpoints are
+// given a random secret to verify the signatures of their deliveries with.
+func (m *Repository) AdminPostWebhookEndpoint(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("url")
+
+	e := models.WebhookEndpoint{
+		URL:         strings.TrimSpace(r.Form.Get("url")),
+		Description: strings.TrimSpace(r.Form.Get("description")),
+		Active:      form.Has("active"),
+	}
+	e.ID, _ = strconv.Atoi(r.Form.Get("id"))
+
+	if u, err := url.Parse(e.URL); err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		form.Errors.Add("url", "Enter a valid http or https address")
+	}
+
+	for _, event := range webhooks.Events {
+		if form.Has("event_" + event) {
+			e.Events = append(e.Events, event)
+		}
+	}
+	if len(e.Events) == 0 {
+		form.Errors.Add("events", "Choose at least one event")
+	}
+
+	redirectURL := "/admin/webhooks"
+	if e.ID > 0 {
+		redirectURL = fmt.Sprintf("/admin/webhooks/%d", e.ID)
+	}
+
+	if !form.Valid() {
+		m.App.Session.Put(r.Context(), "error", "Please check the webhook details and try again")
+		http.Redirect(w, r, redirectURL, http.StatusSeeOther)
+		return
+	}
+
+	if e.ID > 0 {
+		err = m.DB.UpdateWebhookEndpoint(e)
+	} else {
+		e.Secret, err = helpers.GenerateToken(24)
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		e.ID, err = m.DB.InsertWebhookEndpoint(e)
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Webhook saved")
+	http.Redirect(w, r, fmt.Sprintf("/admin/webhooks/%d", e.ID), http.StatusSeeOther)
+}
+
+// AdminPostDeleteWebhookEndpoint deletes a webhook endpoint and its delivery log
+func (m *Repository) AdminPostDeleteWebhookEndpoint(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = m.DB.DeleteWebhookEndpoint(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Webhook deleted")
+	http.Redirect(w, r, "/admin/webhooks", http.StatusSeeOther)
+}
+
+// AdminPostReplayWebhookDelivery sends a delivery to its endpoint again, for example once a receiver
+// that was failing has been fixed
+func (m *Repository) AdminPostReplayWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	deliveryID, err := strconv.Atoi(chi.URLParam(r, "deliveryID"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = m.DB.ReplayWebhookDelivery(id, deliveryID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Delivery queued to be sent again")
+	http.Redirect(w, r, fmt.Sprintf("/admin/webhooks/%d", id), http.StatusSeeOther)
+}
+
+// channelInventory works out what to push to a channel for the days from a date: the availability, rates
+// and restrictions of every room mapped to it
+func (m *Repository) channelInventory(ch models.Channel, from time.Time) ([]channels.AvailabilityUpdate, []channels.RateUpdate, []channels.RestrictionUpdate, error) {
+	var availability []channels.AvailabilityUpdate
+	var rates []channels.RateUpdate
+	var closures []channels.RestrictionUpdate
+
+	until := from.AddDate(0, 0, channels.Horizon)
+	for _, mapping := range ch.Mappings {
+		restrictions, err := m.DB.GetRestrictionsForRoomByDate(mapping.RoomID, from, until)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		a, rt, c := channels.Inventory(mapping.RoomCode, mapping.Room, restrictions, from, channels.Horizon)
+		availability = append(availability, a...)
+		rates = append(rates, rt...)
+		closures = append(closures, c...)
+	}
+
+	return availability, rates, closures, nil
+}
+
+// queueChannelPushes queues a push of a channel's availability, rates and restrictions from today
+func (m *Repository) queueChannelPushes(ch models.Channel, now time.Time) error {
+	from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	availability, rates, closures, err := m.channelInventory(ch, from)
+	if err != nil {
+		return err
+	}
+
+	pushes := []struct {
+		operation string
+		updates   interface{}
+		n         int
+	}{
+		{models.ChannelPushAvailability, availability, len(availability)},
+		{models.ChannelPushRates, rates, len(rates)},
+		{models.ChannelPushRestrictions, closures, len(closures)},
+	}
+	for _, p := range pushes {
+		if p.n == 0 {
+			continue
+		}
+		payload, err := json.Marshal(p.updates)
+		if err != nil {
+			return err
+		}
+		err = m.DB.QueueChannelSync(ch.ID, p.operation, string(payload))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// QueueChannelPushes queues a push of availability, rates and restrictions to every active channel,
+// returning how many channels were queued. A channel that cannot be queued does not stop the others.
+func (m *Repository) QueueChannelPushes(now time.Time) (int, error) {
+	all, err := m.DB.AllChannels()
+	if err != nil {
+		return 0, err
+	}
+
+	queued := 0
+	var errs []error
+	for _, ch := range all {
+		if !ch.Active || len(ch.Mappings) == 0 {
+			continue
+		}
+		err := m.queueChannelPushes(ch, now)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", ch.Name, err))
+			continue
+		}
+		queued++
+	}
+
+	return queued, errors.Join(errs...)
+}
+
+// ChannelSyncMaxAttempts is how many times a push is tried before it is given up on
+const ChannelSyncMaxAttempts = 8
+
+// channelSyncLockFor is how long claimed pushes are locked before another instance may assume this one crashed
+const channelSyncLockFor = 5 * time.Minute
+
+// pushChannelSync sends a queued push to its channel, returning how many updates it carried
+func pushChannelSync(ctx context.Context, conn channels.ChannelConnector, s models.ChannelSync) (int, error) {
+	switch s.Operation {
+	case models.ChannelPushAvailability:
+		var updates []channels.AvailabilityUpdate
+		if err := json.Unmarshal([]byte(s.Payload), &updates); err != nil {
+			return 0, err
+		}
+		return len(updates), conn.PushAvailability(ctx, updates)
+	case models.ChannelPushRates:
+		var updates []channels.RateUpdate
+		if err := json.Unmarshal([]byte(s.Payload), &updates); err != nil {
+			return 0, err
+		}
+		return len(updates), conn.PushRates(ctx, updates)
+	case models.ChannelPushRestrictions:
+		var updates []channels.RestrictionUpdate
+		if err := json.Unmarshal([]byte(s.Payload), &updates); err != nil {
+			return 0, err
+		}
+		return len(updates), conn.PushRestrictions(ctx, updates)
+	default:
+		return 0, fmt.Errorf("unknown channel operation %q", s.Operation)
+	}
+}
+
+// ProcessChannelSyncs claims up to limit queued pushes that are due and sends them to their channels.
+// Failed pushes are retried with an increasing delay, and given up on after ChannelSyncMaxAttempts.
+// It returns how many were accepted.
+func (m *Repository) ProcessChannelSyncs(now time.Time, limit int) (int, error) {
+	syncs, err := m.DB.ClaimChannelSyncs(limit, now, now.Add(channelSyncLockFor))
+	if err != nil {
+		return 0, err
+	}
+
+	pushed := 0
+	for _, s := range syncs {
+		var n int
+		conn, err := channels.New(s.Channel)
+		if err == nil {
+			n, err = pushChannelSync(context.Background(), conn, s)
+		}
+		if err == nil {
+			pushed++
+			err = m.DB.MarkChannelSyncSucceeded(s.ID, fmt.Sprintf("%d update(s) sent", n))
+			if err != nil {
+				return pushed, err
+			}
+			continue
+		}
+
+		attempt := s.Attempts + 1
+		dead := attempt >= ChannelSyncMaxAttempts
+		m.App.ErrorLog.Printf("cannot push %s to channel %s (attempt %d): %s", s.Operation, s.Channel.Name, attempt, err)
+
+		err = m.DB.MarkChannelSyncFailed(s.ID, err.Error(), now.Add(jobs.Backoff(attempt)), dead)
+		if err != nil {
+			return pushed, err
+		}
+	}
+
+	return pushed, nil
+}
+
+// PullChannelBookings fetches the bookings made, changed or cancelled on a channel since the last pull and
+// brings them in as reservations. New bookings are reserved if the room is free, and cancellations cancel
+// the reservation. A booking for a room that is already taken, or whose dates changed, is left for staff
+// and reported in the summary, which is also recorded in the channel's sync log. Such bookings are pulled
+// and reported again on every pull until they can be applied, such as once staff free the room.
+func (m *Repository) PullChannelBookings(ch models.Channel) (string, error) {
+	summary, err := m.pullChannelBookings(ch)
+	s := models.ChannelSync{
+		ChannelID: ch.ID,
+		Operation: models.ChannelPullBookings,
+		Status:    models.ChannelSyncSucceeded,
+		Summary:   summary,
+	}
+	if err != nil {
+		s.Status = models.ChannelSyncFailed
+		s.LastError = err.Error()
+	}
+
+	logErr := m.DB.LogChannelSync(s)
+	if logErr != nil {
+		m.App.ErrorLog.Println(logErr)
+	}
+	return summary, err
+}
+
+func (m *Repository) pullChannelBookings(ch models.Channel) (string, error) {
+	conn, err := channels.New(ch)
+	if err != nil {
+		return "", err
+	}
+
+	bookings, err := conn.PullBookings(context.Background(), ch.LastPulledAt)
+	if err != nil {
+		return "", err
+	}
+
+	created, cancelled := 0, 0
+	var problems []string
+	var unresolved []channels.Booking
+	for _, b := range bookings {
+		res, found, err := m.DB.GetReservationByChannelBooking(ch.ID, b.ID)
+		if err != nil {
+			return "", err
+		}
+
+		if found {
+			start, end, _ := b.Dates()
+			switch {
+			case b.Status == channels.BookingCancelled && res.Status != models.ReservationStatusCancelled:
+				err = m.cancelChannelReservation(res.ID)
+				if err != nil {
+					return "", err
+				}
+				cancelled++
+			case b.Status != channels.BookingCancelled && (!start.Equal(res.StartDate) || !end.Equal(res.EndDate)):
+				problems = append(problems, fmt.Sprintf("booking %s changed dates, check reservation %d", b.ID, res.ID))
+				unresolved = append(unresolved, b)
+			}
+			continue
+		}
+
+		if b.Status == channels.BookingCancelled {
+			continue
+		}
+
+		problem, err := m.reserveChannelBooking(ch, b)
+		if err != nil {
+			return "", err
+		}
+		if problem != "" {
+			problems = append(problems, problem)
+			unresolved = append(unresolved, b)
+			continue
+		}
+		created++
+	}
+
+	pulledAt := pullCursor(ch.LastPulledAt, bookings, unresolved)
+	if pulledAt.After(ch.LastPulledAt) {
+		err = m.DB.UpdateChannelPulledAt(ch.ID, pulledAt)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	summary := fmt.Sprintf("%d booking(s) pulled, %d reserved and %d cancelled", len(bookings), created, cancelled)
+	if len(problems) > 0 {
+		summary += "; " + strings.Join(problems, "; ")
+	}
+	return summary, nil
+}
+
+// pullCursor returns the time to pull a channel's bookings from next, which is the latest change among the
+// bookings pulled that comes before every booking that could not be applied. Bookings already reserved or
+// cancelled are skipped when they are pulled again.
+func pullCursor(since time.Time, bookings, unresolved []channels.Booking) time.Time {
+	var hold time.Time
+	for _, b := range unresolved {
+		if hold.IsZero() || b.UpdatedAt.Before(hold) {
+			hold = b.UpdatedAt
+		}
+	}
+
+	cursor := since
+	for _, b := range bookings {
+		if b.UpdatedAt.After(cursor) && (hold.IsZero() || b.UpdatedAt.Before(hold)) {
+			cursor = b.UpdatedAt
+		}
+	}
+	return cursor
+}
+
+// reserveChannelBooking makes a reservation for a new booking on a channel, returning why it could not when
+// the booking cannot be taken as it stands. The channel confirms the booking to the guest itself, so only
+// the property owner is notified.
+func (m *Repository) reserveChannelBooking(ch models.Channel, b channels.Booking) (string, error) {
+	roomID := 0
+	for _, mapping := range ch.Mappings {
+		if mapping.RoomCode == b.RoomCode {
+			roomID = mapping.RoomID
+		}
+	}
+	if roomID == 0 {
+		return fmt.Sprintf("booking %s is for unknown room code %q", b.ID, b.RoomCode), nil
+	}
+
+	start, end, err := b.Dates()
+	if err != nil {
+		return err.Error(), nil
+	}
+
+	available, err := m.DB.SearchAvailabilityByDatesByRoomID(start, end, roomID)
+	if err != nil {
+		return "", err
+	}
+	if !available {
+		return fmt.Sprintf("booking %s is for a room that is already taken, it was overbooked", b.ID), nil
+	}
+
+	res := models.Reservation{
+		FirstName:        b.FirstName,
+		LastName:         b.LastName,
+		Email:            b.Email,
+		Phone:            b.Phone,
+		StartDate:        start,
+		EndDate:          end,
+		RoomID:           roomID,
+		ChannelID:        ch.ID,
+		ChannelBookingID: b.ID,
+	}
+
+	res.CancelToken, err = helpers.GenerateToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	if res.Email != "" {
+		res.GuestID, err = m.DB.FindOrCreateGuest(guestFromReservation(res))
+		if err != nil {
+			return "", err
+		}
+	}
+
+	res.ID, err = m.DB.CreateReservation(res, nil, func(id int) ([]models.MailData, error) {
+		saved := res
+		saved.ID = id
+		owner, err := composeMail("me@here.com", emails.OwnerNotification{Reservation: saved})
+		if err != nil {
+			return nil, err
+		}
+		return []models.MailData{owner}, nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	m.publishWebhook(webhooks.ReservationCreated, webhooks.NewReservation(res))
+	m.publishReservationEvent(res)
+	return "", nil
+}
+
+// cancelChannelReservation cancels a reservation that was cancelled on the channel it was booked on. Any
+// fee is the channel's to charge, and the owner is told of the cancellation.
+func (m *Repository) cancelChannelReservation(id int) error {
+	res, err := m.DB.GetReservationByID(id)
+	if err != nil {
+		return err
+	}
+
+	owner, err := composeMail("me@here.com", emails.OwnerNotification{Reservation: res, Cancelled: true})
+	if err != nil {
+		return err
+	}
+
+	err = m.DB.CancelReservation(res.ID, 0, "channel", []models.MailData{owner})
+	if err != nil {
+		return err
+	}
+
+	m.publishReservationWebhook(webhooks.ReservationCancelled, res.ID)
+	m.publishReservationEvent(res)
+	return nil
+}
+
+// PullAllChannelBookings pulls the bookings of every active channel, returning how many channels were pulled.
+// A channel that cannot be pulled does not stop the others.
+func (m *Repository) PullAllChannelBookings() (int, error) {
+	all, err := m.DB.AllChannels()
+	if err != nil {
+		return 0, err
+	}
+
+	pulled := 0
+	var errs []error
+	for _, ch := range all {
+		if !ch.Active {
+			continue
+		}
+		_, err := m.PullChannelBookings(ch)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", ch.Name, err))
+			continue
+		}
+		pulled++
+	}
+
+	return pulled, errors.Join(errs...)
+}
+
+// AdminChannels lists the distribution channels and offers a form to add one
+func (m *Repository) AdminChannels(w http.ResponseWriter, r *http.Request) {
+	all, err := m.DB.AllChannels()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["channels"] = all
+	data["kinds"] = channels.Kinds
+
+	render.Template(w, r, "admin-channels.page.tmpl", &models.TemplateData{
+		Data: data,
+		Form: forms.New(nil),
+	})
+}
+
+// AdminShowChannel shows a channel's settings, the codes its rooms are sold under and its sync log
+func (m *Repository) AdminShowChannel(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	ch, err := m.DB.GetChannelByID(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	syncs, err := m.DB.GetChannelSyncLog(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	codes := make(map[string]string)
+	for _, room := range rooms {
+		codes[strconv.Itoa(room.ID)] = ch.RoomCode(room.ID)
+	}
+
+	data := make(map[string]interface{})
+	data["channel"] = ch
+	data["rooms"] = rooms
+	data["syncs"] = syncs
+	data["kinds"] = channels.Kinds
+
+	render.Template(w, r, "admin-channels-show.page.tmpl", &models.TemplateData{
+		StringMap: codes,
+		Data:      data,
+		Form:      forms.New(nil),
+	})
+}
+
+// AdminPostChannel adds a channel, or updates one when an id is posted. The API key is kept when an
+// existing channel is saved without one.
+func (m *Repository) AdminPostChannel(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("name", "base_url")
+
+	ch := models.Channel{
+		Name:    strings.TrimSpace(r.Form.Get("name")),
+		Kind:    r.Form.Get("kind"),
+		BaseURL: strings.TrimRight(strings.TrimSpace(r.Form.Get("base_url")), "/"),
+		APIKey:  strings.TrimSpace(r.Form.Get("api_key")),
+		Active:  form.Has("active"),
+	}
+	ch.ID, _ = strconv.Atoi(r.Form.Get("id"))
+
+	if _, err := channels.New(ch); err != nil {
+		form.Errors.Add("kind", err.Error())
+	}
+	if u, err := url.Parse(ch.BaseURL); err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		form.Errors.Add("base_url", "Enter a valid http or https address")
+	}
+
+	redirectURL := "/admin/channels"
+	if ch.ID > 0 {
+		redirectURL = fmt.Sprintf("/admin/channels/%d", ch.ID)
+	}
+
+	if !form.Valid() {
+		m.App.Session.Put(r.Context(), "error", "Please check the channel details and try again")
+		http.Redirect(w, r, redirectURL, http.StatusSeeOther)
+		return
+	}
+
+	if ch.ID > 0 {
+		err = m.DB.UpdateChannel(ch)
+	} else {
+		ch.ID, err = m.DB.InsertChannel(ch)
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Channel saved")
+	http.Redirect(w, r, fmt.Sprintf("/admin/channels/%d", ch.ID), http.StatusSeeOther)
+}
+
+// AdminPostChannelMappings sets the codes the channel knows each room by. Rooms left without a code are not
+// sold on the channel.
+func (m *Repository) AdminPostChannelMappings(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	codes := make(map[int]string)
+	seen := make(map[string]bool)
+	for _, room := range rooms {
+		code := strings.TrimSpace(r.Form.Get(fmt.Sprintf("room_%d", room.ID)))
+		if code != "" && seen[code] {
+			m.App.Session.Put(r.Context(), "error", fmt.Sprintf("Room code %s is used for more than one room", code))
+			http.Redirect(w, r, fmt.Sprintf("/admin/channels/%d", id), http.StatusSeeOther)
+			return
+		}
+		seen[code] = true
+		codes[room.ID] = code
+	}
+
+	for _, room := range rooms {
+		err = m.DB.SetChannelRoomMapping(id, room.ID, codes[room.ID])
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Room codes saved")
+	http.Redirect(w, r, fmt.Sprintf("/admin/channels/%d", id), http.StatusSeeOther)
+}
+
+// AdminPostChannelPush queues a push of the channel's availability, rates and restrictions without waiting
+// for the next scheduled push
+func (m *Repository) AdminPostChannelPush(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	ch, err := m.DB.GetChannelByID(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	if len(ch.Mappings) == 0 {
+		m.App.Session.Put(r.Context(), "warning", "Give at least one room a code before pushing to this channel")
+		http.Redirect(w, r, fmt.Sprintf("/admin/channels/%d", id), http.StatusSeeOther)
+		return
+	}
+
+	err = m.queueChannelPushes(ch, time.Now())
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Push queued")
+	http.Redirect(w, r, fmt.Sprintf("/admin/channels/%d", id), http.StatusSeeOther)
+}
+
+// AdminPostChannelPull pulls the channel's bookings without waiting for the next scheduled pull
+func (m *Repository) AdminPostChannelPull(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	ch, err := m.DB.GetChannelByID(id)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	summary, err := m.PullChannelBookings(ch)
+	if err != nil {
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("Cannot pull bookings: %s", err))
+	} else {
+		m.App.Session.Put(r.Context(), "flash", summary)
+	}
+	http.Redirect(w, r, fmt.Sprintf("/admin/channels/%d", id), http.StatusSeeOther)
+}
+
+// AdminPostRetryChannelSync queues a push that was given up on to be sent again, for example once the
+// channel is back up
+func (m *Repository) AdminPostRetryChannelSync(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	syncID, err := strconv.Atoi(chi.URLParam(r, "syncID"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	err = m.DB.RetryChannelSync(id, syncID)
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.App.Session.Put(r.Context(), "flash", "Push queued to be sent again")
+	http.Redirect(w, r, fmt.Sprintf("/admin/channels/%d", id), http.StatusSeeOther)
+}
+
+// maxImportSize is the largest file of reservations that is accepted for import
+const maxImportSize = 5 << 20
+
+// AdminImport shows the form for importing reservations from a spreadsheet, and the imports made so far
+func (m *Repository) AdminImport(w http.ResponseWriter, r *http.Request) {
+	batches, err := m.DB.AllImportBatches()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	data := make(map[string]interface{})
+	data["batches"] = batches
+	data["fields"] = resimport.Fields
+
+	render.Template(w, r, "admin-import.page.tmpl", &models.TemplateData{
+		Data: data,
+		Form: forms.New(nil),
+	})
+}
+
+// importMapping reads the column chosen for each field from the form. Fields left on "not imported" are
+// missing from the mapping.
+func importMapping(r *http.Request) resimport.Mapping {
+	mapping := make(resimport.Mapping)
+	for _, f := range resimport.Fields {
+		i, err := strconv.Atoi(r.Form.Get("col_" + f.Name))
+		if err == nil {
+			mapping[f.Name] = i
+		}
+	}
+	return mapping
+}
+
+// importPreview reads a file of reservations with a mapping and checks each stay against the restrictions
+// already held on its room, without importing anything
+func (m *Repository) importPreview(content string, mapping resimport.Mapping) (resimport.Preview, error) {
+	header, records, err := resimport.Read(strings.NewReader(content))
+	if err != nil {
+		return resimport.Preview{}, err
+	}
+
+	rooms, err := m.DB.AllRooms()
+	if err != nil {
+		return resimport.Preview{}, err
+	}
+
+	if mapping == nil {
+		mapping = resimport.Guess(header)
+	}
+	preview := resimport.Parse(header, records, mapping, rooms, time.Now())
+
+	var restrictions []models.RoomRestriction
+	for roomID, span := range preview.Span() {
+		held, err := m.DB.GetRestrictionsForRoomByDate(roomID, span[0], span[1])
+		if err != nil {
+			return resimport.Preview{}, err
+		}
+		restrictions = append(restrictions, held...)
+	}
+	preview.Check(restrictions)
+
+	return preview, nil
+}
+
+// renderImportPreview shows what importing a file would do, with the file carried along in the form so it
+// can be checked again with other columns or imported
+func renderImportPreview(w http.ResponseWriter, r *http.Request, fileName, content string, preview resimport.Preview) {
+	stringMap := make(map[string]string)
+	stringMap["file_name"] = fileName
+	stringMap["content"] = content
+	for field, i := range preview.Mapping {
+		stringMap["col_"+field] = strconv.Itoa(i)
+	}
+
+	data := make(map[string]interface{})
+	data["preview"] = preview
+	data["fields"] = resimport.Fields
+
+	render.Template(w, r, "admin-import-preview.page.tmpl", &models.TemplateData{
+		StringMap: stringMap,
+		Data:      data,
+		Form:      forms.New(nil),
+	})
+}
+
+// AdminPostImportPreview is the dry run of an import. It reads an uploaded CSV file, guessing which column
+// holds each field from the headings, or the file sent back from an earlier preview with the columns
+// chosen there, and reports the rows that cannot be imported. Nothing is saved.
+func (m *Repository) AdminPostImportPreview(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseMultipartForm(maxImportSize)
+	if err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	fileName := r.Form.Get("file_name")
+	content := r.Form.Get("content")
+	mapping := importMapping(r)
+
+	file, header, err := r.FormFile("file")
+	if err == nil {
+		defer file.Close()
+		b, err := io.ReadAll(io.LimitReader(file, maxImportSize+1))
+		if err != nil {
+			helpers.ServerError(w, err)
+			return
+		}
+		if len(b) > maxImportSize {
+			m.App.Session.Put(r.Context(), "error", "The file is too large to import; split it into smaller files")
+			http.Redirect(w, r, "/admin/import", http.StatusSeeOther)
+			return
+		}
+		fileName = header.Filename
+		content = string(b)
+		mapping = nil
+	}
+
+	if content == "" {
+		m.App.Session.Put(r.Context(), "error", "Choose a CSV file to import")
+		http.Redirect(w, r, "/admin/import", http.StatusSeeOther)
+		return
+	}
+
+	preview, err := m.importPreview(content, mapping)
+	if errors.Is(err, resimport.ErrEmptyFile) || errors.Is(err, resimport.ErrTooManyRows) || isCSVError(err) {
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("%s could not be read: %s", fileName, err))
+		http.Redirect(w, r, "/admin/import", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	renderImportPreview(w, r, fileName, content, preview)
+}
+
+// isCSVError reports whether err is a problem with the layout of a CSV file
+func isCSVError(err error) bool {
+	var parseErr *csv.ParseError
+	return errors.As(err, &parseErr)
+}
+
+// AdminPostImport imports the reservations in a file, with the columns chosen in its preview, as a single
+// batch that can be undone. The file is checked again first, and nothing is imported unless every row can
+// be, so the preview is shown again if anything has changed since it was made. Imported reservations are
+// history, so no emails or webhooks are sent for them; channels pick up any future stays on their next push.
+func (m *Repository) AdminPostImport(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	fileName := r.Form.Get("file_name")
+	content := r.Form.Get("content")
+	if content == "" {
+		m.App.Session.Put(r.Context(), "error", "Choose a CSV file to import")
+		http.Redirect(w, r, "/admin/import", http.StatusSeeOther)
+		return
+	}
+
+	preview, err := m.importPreview(content, importMapping(r))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	if !preview.Valid() {
+		m.App.Session.Put(r.Context(), "error", "Nothing was imported; fix the rows marked below and try again")
+		renderImportPreview(w, r, fileName, content, preview)
+		return
+	}
+
+	batch := models.ImportBatch{
+		FileName: fileName,
+		UserID:   m.App.Session.GetInt(r.Context(), "user_id"),
+	}
+	_, err = m.DB.ImportReservations(batch, preview.Reservations())
+	if errors.Is(err, repository.ErrRoomUnavailable) {
+		m.App.Session.Put(r.Context(), "error", fmt.Sprintf("Nothing was imported; a room was taken while importing: %s", err))
+		renderImportPreview(w, r, fileName, content, preview)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+	for roomID, span := range preview.Span() {
+		m.publishEvent(events.New(events.ReservationChanged, roomID, span[0], span[1]))
+	}
+
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Imported %d reservation(s) from %s", len(preview.Rows), fileName))
+	http.Redirect(w, r, "/admin/import", http.StatusSeeOther)
+}
+
+// AdminPostRevertImport undoes an import, removing every reservation it added
+func (m *Repository) AdminPostRevertImport(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	removed, err := m.DB.RevertImportBatch(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		m.App.Session.Put(r.Context(), "warning", "That import has already been undone")
+		http.Redirect(w, r, "/admin/import", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		helpers.ServerError(w, err)
+		return
+	}
+
+	m.publishEvent(events.New(events.ReservationChanged, 0, time.Time{}, time.Time{}))
+
+	m.App.Session.Put(r.Context(), "flash", fmt.Sprintf("Import undone: %d reservation(s) removed", removed))
+	http.Redirect(w, r, "/admin/import", http.StatusSeeOther)
+}
@@ -1,19 +1,29 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"reflect"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/Poojasadgir/room-reservation/internal/channels"
+	"github.com/Poojasadgir/room-reservation/internal/channels/mockota"
 	"github.com/Poojasadgir/room-reservation/internal/driver"
+	"github.com/Poojasadgir/room-reservation/internal/events"
+	"github.com/Poojasadgir/room-reservation/internal/forms"
+	"github.com/Poojasadgir/room-reservation/internal/ical"
 	"github.com/Poojasadgir/room-reservation/internal/models"
 )
 
@@ -42,7 +52,41 @@ var theTests = []struct {
 	{"all res", "/admin/reservations-all", "GET", http.StatusOK},
 	{"show res", "/admin/reservations/new/1/show", "GET", http.StatusOK},
 	{"show res cal", "/admin/reservations-calendar", "GET", http.StatusOK},
+	{"timeline", "/admin/reservations-timeline", "GET", http.StatusOK},
 	{"show res cal with params", "/admin/reservations-calendar?y=2020&m=1", "GET", http.StatusOK},
+	{"cancel res", "/admin/cancel-reservation/all/1", "GET", http.StatusOK},
+	{"cancellation policies", "/admin/cancellation-policies", "GET", http.StatusOK},
+	{"guest cancel bad token", "/reservations/1/cancel?t=wrong", "GET", http.StatusNotFound},
+	{"guest cancel", "/reservations/1/cancel?t=secret", "GET", http.StatusOK},
+	{"guests", "/admin/guests", "GET", http.StatusOK},
+	{"show guest", "/admin/guests/1", "GET", http.StatusOK},
+	{"show missing guest", "/admin/guests/99", "GET", http.StatusInternalServerError},
+	{"all res by tag", "/admin/reservations-all?tag=VIP", "GET", http.StatusOK},
+	{"new res by tag", "/admin/reservations-new?tag=VIP", "GET", http.StatusOK},
+	{"booking questions", "/admin/booking-questions", "GET", http.StatusOK},
+	{"front desk", "/admin/front-desk", "GET", http.StatusOK},
+	{"front desk by date", "/admin/front-desk?d=2050-01-10", "GET", http.StatusOK},
+	{"front desk bad date", "/admin/front-desk?d=tomorrow", "GET", http.StatusBadRequest},
+	{"housekeeping", "/admin/housekeeping", "GET", http.StatusOK},
+	{"housekeeping by date", "/admin/housekeeping?d=2050-01-10", "GET", http.StatusOK},
+	{"jobs", "/admin/jobs", "GET", http.StatusOK},
+	{"outbox", "/admin/outbox", "GET", http.StatusOK},
+	{"outbox-dead", "/admin/outbox?status=dead", "GET", http.StatusOK},
+	{"email-templates", "/admin/email-templates", "GET", http.StatusOK},
+	{"email-template-preview", "/admin/email-templates/confirmation", "GET", http.StatusOK},
+	{"email-template-missing", "/admin/email-templates/missing", "GET", http.StatusNotFound},
+	{"calendar-sync", "/admin/calendar-sync", "GET", http.StatusOK},
+	{"calendar-feed", "/ical/rooms/1.ics?t=feed-token", "GET", http.StatusOK},
+	{"calendar-feed-wrong-token", "/ical/rooms/1.ics?t=guess", "GET", http.StatusNotFound},
+	{"calendar-feed-off", "/ical/rooms/2.ics?t=", "GET", http.StatusNotFound},
+	{"calendar-feed-missing-room", "/ical/rooms/3.ics?t=feed-token", "GET", http.StatusNotFound},
+	{"webhooks", "/admin/webhooks", "GET", http.StatusOK},
+	{"webhook", "/admin/webhooks/1", "GET", http.StatusOK},
+	{"webhook-missing", "/admin/webhooks/3", "GET", http.StatusInternalServerError},
+	{"channels", "/admin/channels", "GET", http.StatusOK},
+	{"channel", "/admin/channels/1", "GET", http.StatusOK},
+	{"channel-missing", "/admin/channels/3", "GET", http.StatusInternalServerError},
+	{"import", "/admin/import", "GET", http.StatusOK},
 }
 
 // TestHandlers tests all routes that don't require extra tests (gets)
@@ -469,6 +513,54 @@ func TestPostAvailability(t *testing.T) {
 	}
 }
 
+func TestChooseSplit(t *testing.T) {
+	start := time.Date(2040, 1, 10, 0, 0, 0, 0, time.UTC)
+	res := models.Reservation{StartDate: start, EndDate: start.AddDate(0, 0, 4)}
+
+	tests := []struct {
+		name               string
+		inSession          bool
+		segments           string
+		expectedStatusCode int
+		expectedLocation   string
+	}{
+		{"split", true, "1:2040-01-10:2040-01-12,2:2040-01-12:2040-01-14", http.StatusSeeOther, "/make-reservation"},
+		{"other-dates", true, "1:2040-01-10:2040-01-12,2:2040-01-12:2040-01-15", http.StatusSeeOther, "/search-availability"},
+		{"invalid", true, "1:2040-01-10", http.StatusSeeOther, "/search-availability"},
+		{"no-session", false, "1:2040-01-10:2040-01-12,2:2040-01-12:2040-01-14", http.StatusInternalServerError, ""},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", "/choose-split?segments="+url.QueryEscape(e.segments), nil)
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+
+		rr := httptest.NewRecorder()
+		if e.inSession {
+			session.Put(ctx, "reservation", res)
+		}
+
+		handler := http.HandlerFunc(Repo.ChooseSplit)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedStatusCode {
+			t.Errorf("%s returned wrong response code: got %d, wanted %d", e.name, rr.Code, e.expectedStatusCode)
+		}
+		if e.expectedLocation != "" {
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc.String() != e.expectedLocation {
+				t.Errorf("%s: expected location %s, but got %s", e.name, e.expectedLocation, actualLoc.String())
+			}
+		}
+		if e.name == "split" {
+			chosen, _ := session.Get(ctx, "reservation").(models.Reservation)
+			if !chosen.Split() || chosen.RoomID != 1 || chosen.Segments[1].RoomID != 2 {
+				t.Errorf("%s: expected the stay to be split between rooms 1 and 2 but got %+v", e.name, chosen)
+			}
+		}
+	}
+}
+
 // reservationSummaryTests is the data to test ReservationSummary handler
 var reservationSummaryTests = []struct {
 	name               string
@@ -731,6 +823,7 @@ var adminPostShowReservationTests = []struct {
 			"last_name":  {"Smith"},
 			"email":      {"john@smith.com"},
 			"phone":      {"555-555-5555"},
+			"version":    {"1"},
 		},
 		expectedResponseCode: http.StatusSeeOther,
 		expectedLocation:     "/admin/reservations-new",
@@ -744,6 +837,7 @@ var adminPostShowReservationTests = []struct {
 			"last_name":  {"Smith"},
 			"email":      {"john@smith.com"},
 			"phone":      {"555-555-5555"},
+			"version":    {"1"},
 		},
 		expectedResponseCode: http.StatusSeeOther,
 		expectedLocation:     "/admin/reservations-all",
@@ -759,11 +853,51 @@ var adminPostShowReservationTests = []struct {
 			"phone":      {"555-555-5555"},
 			"year":       {"2022"},
 			"month":      {"01"},
+			"version":    {"1"},
 		},
 		expectedResponseCode: http.StatusSeeOther,
 		expectedLocation:     "/admin/reservations-calendar?y=2022&m=01",
 		expectedHTML:         "",
 	},
+	{
+		name: "missing-version",
+		url:  "/admin/reservations/all/1/show",
+		postedData: url.Values{
+			"first_name": {"John"},
+			"last_name":  {"Smith"},
+			"email":      {"john@smith.com"},
+			"phone":      {"555-555-5555"},
+		},
+		expectedResponseCode: http.StatusBadRequest,
+		expectedLocation:     "",
+		expectedHTML:         "",
+	},
+	{
+		name: "changed-by-someone-else",
+		url:  "/admin/reservations/all/1/show",
+		postedData: url.Values{
+			"first_name": {"John"},
+			"last_name":  {"Smith"},
+			"email":      {"john@smith.com"},
+			"phone":      {"555-555-5555"},
+			"tags":       {"late arrival"},
+			"version":    {"0"},
+		},
+		expectedResponseCode: http.StatusConflict,
+		expectedLocation:     "",
+		expectedHTML:         `Saved by someone else: Jane`,
+	},
+	{
+		name: "invalid-version",
+		url:  "/admin/reservations/all/1/show",
+		postedData: url.Values{
+			"first_name": {"John"},
+			"version":    {"latest"},
+		},
+		expectedResponseCode: http.StatusBadRequest,
+		expectedLocation:     "",
+		expectedHTML:         "",
+	},
 }
 
 // TestAdminPostShowReservation tests the AdminPostReservation handler
@@ -968,6 +1102,1558 @@ func TestAdminDeleteReservation(t *testing.T) {
 	}
 }
 
+var adminPostShowGuestTests = []struct {
+	name                 string
+	url                  string
+	postedData           url.Values
+	expectedResponseCode int
+	expectedLocation     string
+	expectedHTML         string
+}{
+	{
+		name: "valid-data",
+		url:  "/admin/guests/1",
+		postedData: url.Values{
+			"first_name": {"John"},
+			"last_name":  {"Smith"},
+			"email":      {"john@smith.com"},
+			"notes":      {"Prefers a quiet room"},
+		},
+		expectedResponseCode: http.StatusSeeOther,
+		expectedLocation:     "/admin/guests/1",
+	},
+	{
+		name: "invalid-email",
+		url:  "/admin/guests/1",
+		postedData: url.Values{
+			"first_name": {"John"},
+			"last_name":  {"Smith"},
+			"email":      {"john"},
+		},
+		expectedResponseCode: http.StatusOK,
+		expectedHTML:         `action="/admin/guests/1"`,
+	},
+	{
+		name: "email-of-another-guest",
+		url:  "/admin/guests/1",
+		postedData: url.Values{
+			"first_name": {"John"},
+			"last_name":  {"Smith"},
+			"email":      {"taken@example.com"},
+		},
+		expectedResponseCode: http.StatusOK,
+		expectedHTML:         `Another guest already has this email address`,
+	},
+	{
+		name: "merge",
+		url:  "/admin/guests/1/merge",
+		postedData: url.Values{
+			"duplicate_id": {"2"},
+		},
+		expectedResponseCode: http.StatusSeeOther,
+		expectedLocation:     "/admin/guests/1",
+	},
+}
+
+// TestAdminPostShowGuest tests the guest update and merge handlers
+func TestAdminPostShowGuest(t *testing.T) {
+	routes := getRoutes()
+
+	for _, e := range adminPostShowGuestTests {
+		req, _ := http.NewRequest("POST", e.url, strings.NewReader(e.postedData.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedResponseCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedResponseCode, rr.Code)
+		}
+
+		if e.expectedLocation != "" {
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc.String() != e.expectedLocation {
+				t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc.String())
+			}
+		}
+
+		if e.expectedHTML != "" {
+			html := rr.Body.String()
+			if !strings.Contains(html, e.expectedHTML) {
+				t.Errorf("failed %s: expected to find %s but did not", e.name, e.expectedHTML)
+			}
+		}
+	}
+}
+
+var parseTagsTests = []struct {
+	name     string
+	input    string
+	expected []string
+}{
+	{"empty", "", nil},
+	{"single", "VIP", []string{"VIP"}},
+	{"trims-and-drops-blanks", " VIP , ,late arrival ", []string{"VIP", "late arrival"}},
+	{"case-insensitive-duplicates", "VIP, vip, Late, LATE", []string{"VIP", "Late"}},
+}
+
+// TestParseTags tests splitting of the tags field on the reservation form
+func TestParseTags(t *testing.T) {
+	for _, e := range parseTagsTests {
+		tags := parseTags(e.input)
+		if !reflect.DeepEqual(tags, e.expected) {
+			t.Errorf("%s: expected %v but got %v", e.name, e.expected, tags)
+		}
+	}
+}
+
+var adminPostReservationNoteTests = []struct {
+	name                 string
+	postedData           url.Values
+	expectedResponseCode int
+	expectedLocation     string
+	expectedFlash        string
+}{
+	{
+		name:                 "valid-note",
+		postedData:           url.Values{"body": {"Guest arriving after midnight"}},
+		expectedResponseCode: http.StatusSeeOther,
+		expectedLocation:     "/admin/reservations/all/1/show?y=&m=",
+	},
+	{
+		name:                 "blank-note",
+		postedData:           url.Values{"body": {"  "}},
+		expectedResponseCode: http.StatusSeeOther,
+		expectedLocation:     "/admin/reservations/all/1/show?y=&m=",
+	},
+}
+
+// TestAdminPostReservationNote tests the AdminPostReservationNote handler
+func TestAdminPostReservationNote(t *testing.T) {
+	routes := getRoutes()
+
+	for _, e := range adminPostReservationNoteTests {
+		req, _ := http.NewRequest("POST", "/admin/reservations/all/1/notes", strings.NewReader(e.postedData.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedResponseCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedResponseCode, rr.Code)
+		}
+
+		actualLoc, _ := rr.Result().Location()
+		if actualLoc.String() != e.expectedLocation {
+			t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc.String())
+		}
+	}
+}
+
+var validateBookingQuestionsTests = []struct {
+	name            string
+	postedData      url.Values
+	expectedValid   bool
+	expectedAnswers int
+}{
+	{"valid", url.Values{"question_1": {"Twin"}, "question_2": {"1"}, "question_3": {"Gluten free"}}, true, 3},
+	{"optional-blank", url.Values{"question_1": {"Queen"}}, true, 2},
+	{"missing-required", url.Values{}, false, 1},
+	{"unlisted-choice", url.Values{"question_1": {"King"}}, false, 2},
+}
+
+// TestValidateBookingQuestions tests validation of the custom booking questions
+func TestValidateBookingQuestions(t *testing.T) {
+	questions := []models.BookingQuestion{
+		{ID: 1, Label: "Bed type", Kind: models.QuestionKindChoice, Choices: []string{"Queen", "Twin"}, Required: true},
+		{ID: 2, Label: "Travelling with a pet", Kind: models.QuestionKindCheckbox},
+		{ID: 3, Label: "Dietary requirements", Kind: models.QuestionKindText},
+	}
+
+	for _, e := range validateBookingQuestionsTests {
+		form := forms.New(e.postedData)
+		answers := validateBookingQuestions(form, questions)
+
+		if form.Valid() != e.expectedValid {
+			t.Errorf("%s: expected valid to be %t but got %t", e.name, e.expectedValid, form.Valid())
+		}
+		if len(answers) != e.expectedAnswers {
+			t.Errorf("%s: expected %d answers but got %d", e.name, e.expectedAnswers, len(answers))
+		}
+	}
+}
+
+var adminPostBookingQuestionTests = []struct {
+	name          string
+	postedData    url.Values
+	expectedFlash bool
+}{
+	{"valid-text", url.Values{"label": {"Estimated arrival time"}, "kind": {"text"}, "room_id": {"0"}, "sort_order": {"1"}, "active": {"1"}}, true},
+	{"valid-choice", url.Values{"id": {"1"}, "label": {"Bed type"}, "kind": {"choice"}, "choices": {"Queen\nTwin"}, "room_id": {"1"}, "sort_order": {"0"}}, true},
+	{"choice-without-choices", url.Values{"label": {"Bed type"}, "kind": {"choice"}, "room_id": {"1"}, "sort_order": {"0"}}, false},
+	{"unknown-kind", url.Values{"label": {"Bed type"}, "kind": {"radio"}, "room_id": {"1"}, "sort_order": {"0"}}, false},
+}
+
+// TestAdminPostBookingQuestion tests the AdminPostBookingQuestion handler
+func TestAdminPostBookingQuestion(t *testing.T) {
+	for _, e := range adminPostBookingQuestionTests {
+		req, _ := http.NewRequest("POST", "/admin/booking-questions", strings.NewReader(e.postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(Repo.AdminPostBookingQuestion)
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, http.StatusSeeOther, rr.Code)
+		}
+
+		if session.Exists(ctx, "flash") != e.expectedFlash {
+			t.Errorf("failed %s: expected flash to be %t", e.name, e.expectedFlash)
+		}
+	}
+}
+
+var adminFrontDeskTests = []struct {
+	name                 string
+	url                  string
+	postedData           url.Values
+	expectedResponseCode int
+	expectedFlash        string
+	expectedError        string
+}{
+	{"check-in", "/admin/front-desk/1/check-in", url.Values{"d": {"2050-01-10"}, "arrived_at": {"2050-01-10T15:30"}, "id_verified": {"1"}}, http.StatusSeeOther, "checked in", ""},
+	{"check-in-already-checked-in", "/admin/front-desk/2/check-in", url.Values{"d": {"2050-01-10"}}, http.StatusSeeOther, "", "cannot be checked in"},
+	{"check-in-bad-time", "/admin/front-desk/1/check-in", url.Values{"arrived_at": {"3pm"}}, http.StatusSeeOther, "", "Invalid arrival time"},
+	{"check-in-missing-reservation", "/admin/front-desk/3/check-in", url.Values{}, http.StatusInternalServerError, "", ""},
+	{"check-out-early", "/admin/front-desk/2/check-out", url.Values{"d": {"2050-01-11"}, "departed_at": {"2050-01-11T09:00"}}, http.StatusSeeOther, "checked out", ""},
+	{"check-out-late", "/admin/front-desk/2/check-out", url.Values{"departed_at": {"2050-01-14T11:00"}}, http.StatusSeeOther, "", "booked for the extra nights"},
+	{"check-out-late-split-stay", "/admin/front-desk/6/check-out", url.Values{"departed_at": {"2050-01-13T11:00"}}, http.StatusSeeOther, "checked out", ""},
+	{"check-out-before-arrival", "/admin/front-desk/2/check-out", url.Values{"departed_at": {"2050-01-09T11:00"}}, http.StatusSeeOther, "", "before the arrival date"},
+	{"check-out-not-checked-in", "/admin/front-desk/1/check-out", url.Values{}, http.StatusSeeOther, "", "cannot be checked out"},
+}
+
+// TestAdminFrontDesk tests the check-in and check-out handlers
+func TestAdminFrontDesk(t *testing.T) {
+	routes := getRoutes()
+
+	for _, e := range adminFrontDeskTests {
+		req, _ := http.NewRequest("POST", e.url, strings.NewReader(e.postedData.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedResponseCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedResponseCode, rr.Code)
+		}
+
+		if flash := sessionString(rr, "flash"); !strings.Contains(flash, e.expectedFlash) {
+			t.Errorf("failed %s: expected flash %q, but got %q", e.name, e.expectedFlash, flash)
+		}
+		if msg := sessionString(rr, "error"); !strings.Contains(msg, e.expectedError) {
+			t.Errorf("failed %s: expected error %q, but got %q", e.name, e.expectedError, msg)
+		}
+	}
+}
+
+var cancellationPostTests = []struct {
+	name                 string
+	url                  string
+	postedData           url.Values
+	expectedResponseCode int
+	expectedLocation     string
+	expectedError        string
+}{
+	{"guest-cancel", "/reservations/1/cancel", url.Values{"t": {"secret"}}, http.StatusSeeOther, "/", ""},
+	{"guest-cancel-bad-token", "/reservations/1/cancel", url.Values{"t": {"wrong"}}, http.StatusNotFound, "", ""},
+	{"guest-cancel-no-token", "/reservations/1/cancel", url.Values{}, http.StatusNotFound, "", ""},
+	{"guest-cancel-missing-reservation", "/reservations/3/cancel", url.Values{"t": {"secret"}}, http.StatusNotFound, "", ""},
+	{"guest-cancel-already-cancelled", "/reservations/4/cancel", url.Values{"t": {"secret"}}, http.StatusSeeOther, "/", ""},
+	{"guest-cancel-inside-deadline", "/reservations/5/cancel", url.Values{"t": {"secret"}}, http.StatusSeeOther, "/", ""},
+	{"guest-cancel-checked-in", "/reservations/2/cancel", url.Values{"t": {"secret"}}, http.StatusSeeOther, "/", "can no longer be cancelled"},
+	{"guest-cancel-after-arrival", "/reservations/7/cancel", url.Values{"t": {"secret"}}, http.StatusSeeOther, "/", "can no longer be cancelled"},
+	{"admin-cancel", "/admin/cancel-reservation/new/1", url.Values{}, http.StatusSeeOther, "/admin/reservations-new", ""},
+	{"admin-cancel-from-calendar", "/admin/cancel-reservation/cal/1", url.Values{"year": {"2050"}, "month": {"01"}}, http.StatusSeeOther, "/admin/reservations-calendar?y=2050&m=01", ""},
+	{"admin-cancel-already-cancelled", "/admin/cancel-reservation/all/4", url.Values{}, http.StatusSeeOther, "/admin/reservations-all", ""},
+	{"admin-cancel-inside-deadline", "/admin/cancel-reservation/all/5", url.Values{}, http.StatusSeeOther, "/admin/reservations-all", ""},
+	{"admin-cancel-fee-waived", "/admin/cancel-reservation/all/5", url.Values{"waive_fee": {"1"}}, http.StatusInternalServerError, "", ""},
+	{"admin-cancel-missing-reservation", "/admin/cancel-reservation/all/3", url.Values{}, http.StatusInternalServerError, "", ""},
+	{"policy-create", "/admin/cancellation-policies", url.Values{"policy_name": {"Strict"}, "free_cancellation_hours": {"168"}, "fee_nights": {"1"}, "fee_percent": {"50"}, "no_show_fee_nights": {"2"}}, http.StatusSeeOther, "/admin/cancellation-policies", ""},
+	{"policy-update", "/admin/cancellation-policies", url.Values{"id": {"1"}, "policy_name": {"Flexible"}, "free_cancellation_hours": {"48"}, "fee_nights": {"1"}, "fee_percent": {"0"}, "no_show_fee_nights": {"1"}, "release_no_shows": {"1"}}, http.StatusSeeOther, "/admin/cancellation-policies", ""},
+	{"policy-missing-name", "/admin/cancellation-policies", url.Values{"free_cancellation_hours": {"48"}, "fee_nights": {"1"}, "fee_percent": {"0"}, "no_show_fee_nights": {"1"}}, http.StatusSeeOther, "/admin/cancellation-policies", "check the policy details"},
+	{"policy-bad-hours", "/admin/cancellation-policies", url.Values{"policy_name": {"Strict"}, "free_cancellation_hours": {"a week"}, "fee_nights": {"1"}, "fee_percent": {"0"}, "no_show_fee_nights": {"1"}}, http.StatusSeeOther, "/admin/cancellation-policies", "check the policy details"},
+	{"room-policy", "/admin/rooms/1/cancellation-policy", url.Values{"cancellation_policy_id": {"1"}, "nightly_rate": {"100.00"}}, http.StatusSeeOther, "/admin/cancellation-policies", ""},
+	{"room-policy-bad-rate", "/admin/rooms/1/cancellation-policy", url.Values{"cancellation_policy_id": {"1"}, "nightly_rate": {"lots"}}, http.StatusSeeOther, "/admin/cancellation-policies", "Invalid nightly rate"},
+	{"room-policy-bad-room", "/admin/rooms/one/cancellation-policy", url.Values{"cancellation_policy_id": {"1"}, "nightly_rate": {"100.00"}}, http.StatusInternalServerError, "", ""},
+}
+
+// TestCancellationPosts tests the guest and staff cancellation handlers and the cancellation policy forms.
+// Reservation 5 arrives inside its policy's free cancellation window, and the test repository rejects
+// cancelling it without the one night fee.
+func TestCancellationPosts(t *testing.T) {
+	routes := getRoutes()
+
+	for _, e := range cancellationPostTests {
+		req, _ := http.NewRequest("POST", e.url, strings.NewReader(e.postedData.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedResponseCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedResponseCode, rr.Code)
+		}
+
+		if e.expectedLocation != "" {
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc.String() != e.expectedLocation {
+				t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc.String())
+			}
+		}
+		if msg := sessionString(rr, "error"); (e.expectedError == "") != (msg == "") || !strings.Contains(msg, e.expectedError) {
+			t.Errorf("failed %s: expected error %q, but got %q", e.name, e.expectedError, msg)
+		}
+	}
+}
+
+// TestGuestCancelReservationFee tests that the cancellation page shows the fee due inside the deadline
+func TestGuestCancelReservationFee(t *testing.T) {
+	routes := getRoutes()
+
+	tests := []struct {
+		name         string
+		url          string
+		expectedHTML string
+	}{
+		{"outside-deadline", "/reservations/1/cancel?t=secret", "$0.00"},
+		{"inside-deadline", "/reservations/5/cancel?t=secret", "$100.00"},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", e.url, nil)
+		rr := httptest.NewRecorder()
+
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, http.StatusOK, rr.Code)
+		}
+		if !strings.Contains(rr.Body.String(), e.expectedHTML) {
+			t.Errorf("failed %s: expected to find %s in the page", e.name, e.expectedHTML)
+		}
+	}
+}
+
+var adminHousekeepingTests = []struct {
+	name                 string
+	url                  string
+	postedData           url.Values
+	expectedResponseCode int
+	expectedLocation     string
+}{
+	{"generate", "/admin/housekeeping/generate", url.Values{"d": {"2050-01-10"}}, http.StatusSeeOther, "/admin/housekeeping?d=2050-01-10"},
+	{"generate-bad-date", "/admin/housekeeping/generate", url.Values{"d": {"soon"}}, http.StatusBadRequest, ""},
+	{"task-done", "/admin/housekeeping/tasks/1/done", url.Values{"d": {"2050-01-10"}}, http.StatusSeeOther, "/admin/housekeeping?d=2050-01-10"},
+	{"missing-task-done", "/admin/housekeeping/tasks/3/done", url.Values{}, http.StatusInternalServerError, ""},
+	{"room-status", "/admin/rooms/1/housekeeping-status", url.Values{"housekeeping_status": {"inspected"}}, http.StatusSeeOther, "/admin/housekeeping?d="},
+	{"room-unknown-status", "/admin/rooms/1/housekeeping-status", url.Values{"housekeeping_status": {"sparkling"}}, http.StatusSeeOther, "/admin/housekeeping?d="},
+	{"missing-room-status", "/admin/rooms/3/housekeeping-status", url.Values{"housekeeping_status": {"dirty"}}, http.StatusInternalServerError, ""},
+}
+
+// TestAdminHousekeeping tests the housekeeping handlers
+func TestAdminHousekeeping(t *testing.T) {
+	routes := getRoutes()
+
+	for _, e := range adminHousekeepingTests {
+		req, _ := http.NewRequest("POST", e.url, strings.NewReader(e.postedData.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedResponseCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedResponseCode, rr.Code)
+		}
+
+		if e.expectedLocation != "" {
+			actualLoc, _ := rr.Result().Location()
+			if actualLoc.String() != e.expectedLocation {
+				t.Errorf("failed %s: expected location %s, but got location %s", e.name, e.expectedLocation, actualLoc.String())
+			}
+		}
+	}
+}
+
+var sweepNoShowsTests = []struct {
+	name            string
+	now             time.Time
+	expectedFlagged int
+	expectedFee     int
+}{
+	{"before-cutoff", time.Date(2050, 1, 11, 5, 0, 0, 0, time.UTC), 0, 0},
+	{"after-cutoff", time.Date(2050, 1, 11, 7, 0, 0, 0, time.UTC), 1, 10000},
+}
+
+// TestSweepNoShows tests flagging reservations as no-shows
+func TestSweepNoShows(t *testing.T) {
+	app.NoShowCutoff = 30 * time.Hour
+	defer func() { app.NoShowCutoff = 0 }()
+
+	for _, e := range sweepNoShowsTests {
+		flagged, err := Repo.SweepNoShows(e.now)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", e.name, err)
+			continue
+		}
+
+		if len(flagged) != e.expectedFlagged {
+			t.Errorf("%s: expected %d no-shows but got %d", e.name, e.expectedFlagged, len(flagged))
+			continue
+		}
+
+		for _, res := range flagged {
+			if res.Status != models.ReservationStatusNoShow {
+				t.Errorf("%s: expected status %s but got %s", e.name, models.ReservationStatusNoShow, res.Status)
+			}
+			if res.NoShowFee != e.expectedFee {
+				t.Errorf("%s: expected fee %d but got %d", e.name, e.expectedFee, res.NoShowFee)
+			}
+		}
+	}
+}
+
+// TestAdminPostRunJob tests the AdminPostRunJob handler
+func TestAdminPostRunJob(t *testing.T) {
+	routes := getRoutes()
+
+	tests := []struct {
+		name                 string
+		url                  string
+		expectedResponseCode int
+	}{
+		{"run-job", "/admin/jobs/no-show-sweep/run", http.StatusSeeOther},
+		{"missing-job", "/admin/jobs/missing/run", http.StatusInternalServerError},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", e.url, nil)
+		rr := httptest.NewRecorder()
+
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedResponseCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedResponseCode, rr.Code)
+		}
+	}
+}
+
+// TestAdminPostResendOutboxMessage tests the AdminPostResendOutboxMessage handler
+func TestAdminPostResendOutboxMessage(t *testing.T) {
+	routes := getRoutes()
+
+	tests := []struct {
+		name                 string
+		url                  string
+		expectedResponseCode int
+	}{
+		{"resend", "/admin/outbox/1/resend", http.StatusSeeOther},
+		{"missing-message", "/admin/outbox/3/resend", http.StatusInternalServerError},
+		{"invalid-id", "/admin/outbox/x/resend", http.StatusInternalServerError},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", e.url, strings.NewReader("status=dead"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedResponseCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedResponseCode, rr.Code)
+		}
+	}
+}
+
+// TestSendPendingMail tests that emails claimed from the outbox are delivered with the configured mailer
+func TestSendPendingMail(t *testing.T) {
+	mailTransport.Reset()
+
+	sent, err := Repo.SendPendingMail(time.Now(), 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent != 2 {
+		t.Errorf("expected 2 emails to be sent but got %d", sent)
+	}
+
+	messages := mailTransport.Messages()
+	if len(messages) != 2 {
+		t.Fatalf("expected 2 emails in the mailer but got %d", len(messages))
+	}
+
+	msg := messages[0]
+	if msg.To != "john@smith.com" || msg.Subject != "Reservation Confirmation" {
+		t.Errorf("unexpected email to %s with subject %q", msg.To, msg.Subject)
+	}
+	if msg.HTML != "<strong>Reservation Confirmation</strong>" || msg.Text != "Reservation Confirmation" {
+		t.Error("expected both the HTML and the plain-text parts to be sent")
+	}
+
+	// queued before the email templates, with only the body of basic.html
+	legacy := messages[1]
+	if !strings.Contains(legacy.HTML, "<title>Reservation Notification</title>") || !strings.Contains(legacy.HTML, "<strong>Reservation Notification</strong>") {
+		t.Errorf("expected the old message to be sent in the layout but got %q", legacy.HTML)
+	}
+}
+
+// TestSendArrivalReminders tests that guests are reminded of confirmed reservations arriving soon
+func TestSendArrivalReminders(t *testing.T) {
+	// reservation 1 arrives on 2050-01-10
+	queued, err := Repo.SendArrivalReminders(time.Date(2050, 1, 8, 0, 0, 0, 0, time.UTC))
+	if err != nil || queued != 1 {
+		t.Errorf("expected 1 reminder to be queued but got %d, %v", queued, err)
+	}
+
+	// the guest of reservation 2 has already been reminded
+	queued, err = Repo.SendArrivalReminders(time.Date(2050, 1, 9, 0, 0, 0, 0, time.UTC))
+	if err != nil || queued != 0 {
+		t.Errorf("expected no reminder to be queued twice but got %d, %v", queued, err)
+	}
+
+	queued, err = Repo.SendArrivalReminders(time.Date(2050, 1, 7, 0, 0, 0, 0, time.UTC))
+	if err != nil || queued != 0 {
+		t.Errorf("expected no reminders for another day but got %d, %v", queued, err)
+	}
+}
+
+// TestCalendarInvites tests the calendar invites attached to the emails sent to guests
+func TestCalendarInvites(t *testing.T) {
+	res := models.Reservation{
+		ID:           7,
+		FirstName:    "John",
+		LastName:     "Smith",
+		Email:        "john@smith.com",
+		StartDate:    time.Date(2050, 1, 10, 0, 0, 0, 0, time.UTC),
+		EndDate:      time.Date(2050, 1, 13, 0, 0, 0, 0, time.UTC),
+		CancelToken:  "abc",
+		ICalSequence: 2,
+		Room:         models.Room{ID: 1, RoomName: "General's Quarters"},
+	}
+
+	tests := []struct {
+		name     string
+		notices  func() ([]models.MailData, error)
+		expected []string
+	}{
+		{"confirmation", func() ([]models.MailData, error) { return Repo.reservationNotices(res) }, []string{"METHOD:REQUEST", "SEQUENCE:2", "STATUS:CONFIRMED"}},
+		{"modification", func() ([]models.MailData, error) { return Repo.reservationChangedNotices(res) }, []string{"METHOD:REQUEST", "SEQUENCE:2"}},
+		{"cancellation", func() ([]models.MailData, error) { return Repo.cancellationNotices(res, 0) }, []string{"METHOD:CANCEL", "SEQUENCE:3", "STATUS:CANCELLED"}},
+	}
+
+	for _, e := range tests {
+		notices, err := e.notices()
+		if err != nil {
+			t.Errorf("%s: %s", e.name, err)
+			continue
+		}
+
+		guest := notices[0]
+		if guest.To != res.Email || len(guest.Attachments) != 1 {
+			t.Errorf("%s: expected one calendar invite for the guest", e.name)
+			continue
+		}
+
+		invite := string(guest.Attachments[0].Data)
+		for _, want := range append(e.expected, "UID:reservation-7@", "DTSTART:20500110T", "DTEND:20500113T") {
+			if !strings.Contains(invite, want) {
+				t.Errorf("%s: expected %q in the invite", e.name, want)
+			}
+		}
+
+		for _, owner := range notices[1:] {
+			if len(owner.Attachments) != 0 {
+				t.Errorf("%s: expected no invite for the property owner", e.name)
+			}
+		}
+	}
+}
+
+// TestRoomCalendarFeed tests that the calendar feed lists reservations and blocks with guest names redacted
+func TestRoomCalendarFeed(t *testing.T) {
+	routes := getRoutes()
+
+	req, _ := http.NewRequest("GET", "/ical/rooms/1.ics?t=feed-token", nil)
+	rr := httptest.NewRecorder()
+	routes.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected code %d but got %d", http.StatusOK, rr.Code)
+	}
+	if !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/calendar") {
+		t.Errorf("expected a calendar but got %s", rr.Header().Get("Content-Type"))
+	}
+
+	feed := rr.Body.String()
+	for _, want := range []string{
+		"METHOD:PUBLISH",
+		"DTSTART;VALUE=DATE:20500110",
+		"DTEND;VALUE=DATE:20500113",
+		"SUMMARY:Reserved",
+		"SUMMARY:Not available",
+		"UID:room-restriction-1@",
+		"UID:room-restriction-2@",
+	} {
+		if !strings.Contains(feed, want) {
+			t.Errorf("expected %q in the feed", want)
+		}
+	}
+	if strings.Contains(feed, "John") || strings.Contains(feed, "Smith") {
+		t.Error("expected the guest's name to be redacted")
+	}
+}
+
+// TestAdminPostRoomCalendarFeed tests the AdminPostRoomCalendarFeed handler
+func TestAdminPostRoomCalendarFeed(t *testing.T) {
+	routes := getRoutes()
+
+	tests := []struct {
+		name                 string
+		url                  string
+		body                 string
+		expectedResponseCode int
+	}{
+		{"show-guests", "/admin/rooms/1/calendar-feed", "show_guests=1", http.StatusSeeOther},
+		{"regenerate", "/admin/rooms/1/calendar-feed", "regenerate=1", http.StatusSeeOther},
+		{"turn-on", "/admin/rooms/2/calendar-feed", "", http.StatusSeeOther},
+		{"disable", "/admin/rooms/1/calendar-feed", "disable=1", http.StatusSeeOther},
+		{"missing-room", "/admin/rooms/3/calendar-feed", "", http.StatusInternalServerError},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", e.url, strings.NewReader(e.body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedResponseCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedResponseCode, rr.Code)
+		}
+	}
+}
+
+// TestSyncCalendarImport tests syncing uploaded and linked calendars
+func TestSyncCalendarImport(t *testing.T) {
+	now := time.Date(2050, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	imp, _ := Repo.DB.GetCalendarImportByID(1)
+	sync, err := Repo.SyncCalendarImport(imp, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sync.Create) != 1 || sync.Create[0].ExternalUID != "ext-1@example.com" || sync.Create[0].RoomID != 1 {
+		t.Errorf("expected a block for the uploaded event but got %+v", sync.Create)
+	}
+	if !sync.SyncedAt.Equal(now) {
+		t.Errorf("expected the sync time to be recorded but got %s", sync.SyncedAt)
+	}
+
+	// import 2 links to an address that cannot be reached
+	imp, _ = Repo.DB.GetCalendarImportByID(2)
+	_, err = Repo.SyncCalendarImport(imp, now)
+	if err == nil {
+		t.Error("expected an error for an unreachable calendar")
+	}
+
+	conflicts, err := Repo.SyncCalendarImports(now)
+	if err != nil || conflicts != 0 {
+		t.Errorf("expected every import to sync without conflicts but got %d, %v", conflicts, err)
+	}
+}
+
+// TestSyncCalendarImportCutOff tests that a calendar which is cut off or too large leaves the blocks
+// already imported from it alone, rather than removing those of the events it seems to have lost
+func TestSyncCalendarImportCutOff(t *testing.T) {
+	first := "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:ext-1@example.com\r\nDTSTART;VALUE=DATE:20500110\r\nEND:VEVENT\r\n"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/cut.ics":
+			fmt.Fprint(w, first+"BEGIN:VEVENT\r\nUID:ext-2@exa")
+		case "/large.ics":
+			fmt.Fprint(w, first+strings.Repeat("X-PADDING:"+strings.Repeat("x", 1000)+"\r\n", maxCalendarSize/1000)+"END:VCALENDAR\r\n")
+		}
+	}))
+	defer srv.Close()
+
+	now := time.Date(2050, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		path string
+		err  error
+	}{
+		{"/cut.ics", ical.ErrTruncated},
+		{"/large.ics", errCalendarTooLarge},
+	}
+
+	for _, e := range tests {
+		imp := models.CalendarImport{ID: 4, RoomID: 1, Name: "Booking site", URL: srv.URL + e.path}
+		sync, err := Repo.SyncCalendarImport(imp, now)
+		if !errors.Is(err, e.err) {
+			t.Errorf("failed %s: expected %v but got %v", e.path, e.err, err)
+		}
+		if len(sync.Delete) > 0 || len(sync.Create) > 0 {
+			t.Errorf("failed %s: expected the blocks to be left alone but got %+v", e.path, sync)
+		}
+	}
+}
+
+// TestReadCalendarImport tests fetching a calendar from a link
+func TestReadCalendarImport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/calendar.ics" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:1\r\nDTSTART;VALUE=DATE:20500110\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n")
+	}))
+	defer srv.Close()
+
+	events, err := readCalendarImport(models.CalendarImport{URL: srv.URL + "/calendar.ics"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].UID != "1" {
+		t.Errorf("expected the one event but got %+v", events)
+	}
+
+	_, err = readCalendarImport(models.CalendarImport{URL: srv.URL + "/missing.ics"})
+	if err == nil {
+		t.Error("expected an error for a missing calendar")
+	}
+}
+
+// TestAdminPostCalendarImport tests the AdminPostCalendarImport handler
+func TestAdminPostCalendarImport(t *testing.T) {
+	routes := getRoutes()
+
+	tests := []struct {
+		name                 string
+		body                 string
+		expectedResponseCode int
+		expectedLocation     string
+	}{
+		{"link", "room_id=1&name=Booking+site&url=webcal%3A%2F%2F127.0.0.1%3A1%2Fcalendar.ics", http.StatusSeeOther, "/admin/calendar-sync"},
+		{"missing-link", "room_id=1&name=Booking+site", http.StatusSeeOther, "/admin/calendar-sync"},
+		{"bad-link", "room_id=1&name=Booking+site&url=ftp%3A%2F%2Fexample.com", http.StatusSeeOther, "/admin/calendar-sync"},
+		{"missing-name", "room_id=1&url=https%3A%2F%2Fexample.com%2Fcalendar.ics", http.StatusSeeOther, "/admin/calendar-sync"},
+		{"insert-fails", "room_id=3&name=Booking+site&url=https%3A%2F%2F127.0.0.1%3A1%2Fcalendar.ics", http.StatusInternalServerError, ""},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", "/admin/calendar-imports", strings.NewReader(e.body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedResponseCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedResponseCode, rr.Code)
+		}
+		if e.expectedLocation != "" && rr.Header().Get("Location") != e.expectedLocation {
+			t.Errorf("failed %s: expected location %s, but got %s", e.name, e.expectedLocation, rr.Header().Get("Location"))
+		}
+	}
+
+	// upload a file
+	for _, content := range []string{"BEGIN:VCALENDAR\r\nEND:VCALENDAR\r\n", "not a calendar"} {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		_ = mw.WriteField("room_id", "1")
+		_ = mw.WriteField("name", "Booking site")
+		fw, _ := mw.CreateFormFile("calendar", "calendar.ics")
+		_, _ = fw.Write([]byte(content))
+		_ = mw.Close()
+
+		req, _ := http.NewRequest("POST", "/admin/calendar-imports", &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		rr := httptest.NewRecorder()
+
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusSeeOther {
+			t.Errorf("failed upload of %q: expected code %d, but got %d", content, http.StatusSeeOther, rr.Code)
+		}
+	}
+}
+
+// TestAdminPostSyncCalendarImport tests the AdminPostSyncCalendarImport and AdminPostDeleteCalendarImport handlers
+func TestAdminPostSyncCalendarImport(t *testing.T) {
+	routes := getRoutes()
+
+	tests := []struct {
+		name                 string
+		url                  string
+		expectedResponseCode int
+	}{
+		{"sync", "/admin/calendar-imports/1/sync", http.StatusSeeOther},
+		{"sync-fails", "/admin/calendar-imports/2/sync", http.StatusSeeOther},
+		{"sync-missing", "/admin/calendar-imports/3/sync", http.StatusInternalServerError},
+		{"delete", "/admin/calendar-imports/1/delete", http.StatusSeeOther},
+		{"delete-fails", "/admin/calendar-imports/3/delete", http.StatusInternalServerError},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", e.url, nil)
+		rr := httptest.NewRecorder()
+
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedResponseCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedResponseCode, rr.Code)
+		}
+	}
+}
+
+// TestDeliverPendingWebhooks tests that failed deliveries are retried rather than lost
+func TestDeliverPendingWebhooks(t *testing.T) {
+	// the test repository hands out one delivery to an endpoint that cannot be reached and one to an invalid address
+	delivered, err := Repo.DeliverPendingWebhooks(time.Now(), 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delivered != 0 {
+		t.Errorf("expected no deliveries to succeed but got %d", delivered)
+	}
+}
+
+// TestAdminPostWebhookEndpoint tests the AdminPostWebhookEndpoint handler
+func TestAdminPostWebhookEndpoint(t *testing.T) {
+	routes := getRoutes()
+
+	tests := []struct {
+		name                 string
+		body                 string
+		expectedResponseCode int
+		expectedLocation     string
+	}{
+		{"add", "url=https%3A%2F%2Fexample.com%2Fhooks&active=1&event_reservation.created=1", http.StatusSeeOther, "/admin/webhooks/1"},
+		{"update", "id=2&url=https%3A%2F%2Fexample.com%2Fhooks&event_block.deleted=1", http.StatusSeeOther, "/admin/webhooks/2"},
+		{"no-events", "url=https%3A%2F%2Fexample.com%2Fhooks", http.StatusSeeOther, "/admin/webhooks"},
+		{"bad-url", "id=2&url=example.com&event_block.deleted=1", http.StatusSeeOther, "/admin/webhooks/2"},
+		{"update-fails", "id=3&url=https%3A%2F%2Fexample.com%2Fhooks&event_block.deleted=1", http.StatusInternalServerError, ""},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", "/admin/webhooks", strings.NewReader(e.body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedResponseCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedResponseCode, rr.Code)
+		}
+		if e.expectedLocation != "" && rr.Header().Get("Location") != e.expectedLocation {
+			t.Errorf("failed %s: expected location %s, but got %s", e.name, e.expectedLocation, rr.Header().Get("Location"))
+		}
+	}
+}
+
+// TestAdminPostReplayWebhookDelivery tests the AdminPostReplayWebhookDelivery and AdminPostDeleteWebhookEndpoint handlers
+func TestAdminPostReplayWebhookDelivery(t *testing.T) {
+	routes := getRoutes()
+
+	tests := []struct {
+		name                 string
+		url                  string
+		expectedResponseCode int
+	}{
+		{"replay", "/admin/webhooks/1/deliveries/2/replay", http.StatusSeeOther},
+		{"replay-missing", "/admin/webhooks/1/deliveries/3/replay", http.StatusInternalServerError},
+		{"delete", "/admin/webhooks/1/delete", http.StatusSeeOther},
+		{"delete-fails", "/admin/webhooks/3/delete", http.StatusInternalServerError},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", e.url, nil)
+		rr := httptest.NewRecorder()
+
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedResponseCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedResponseCode, rr.Code)
+		}
+	}
+}
+
+// TestPullChannelBookings tests pulling bookings from a mock OTA
+func TestPullChannelBookings(t *testing.T) {
+	ota := mockota.New("test-key")
+	srv := httptest.NewServer(ota)
+	defer srv.Close()
+
+	ch, _ := Repo.DB.GetChannelByID(1)
+	ch.BaseURL = srv.URL
+
+	// a new booking for a free room, and one for a room the test repository reports as taken after 2049
+	ota.AddBooking(channels.Booking{ID: "bk-new", RoomCode: "GQ", FirstName: "Jane", LastName: "Smith", Email: "jane@example.com", StartDate: "2049-06-01", EndDate: "2049-06-03"})
+	ota.AddBooking(channels.Booking{ID: "bk-taken", RoomCode: "GQ", FirstName: "John", LastName: "Smith", StartDate: "2050-02-01", EndDate: "2050-02-03"})
+	// bookings the test repository already has reservations for
+	ota.AddBooking(channels.Booking{ID: "bk-cancel", RoomCode: "GQ", StartDate: "2049-04-01", EndDate: "2049-04-03", Status: channels.BookingCancelled})
+	ota.AddBooking(channels.Booking{ID: "bk-moved", RoomCode: "GQ", StartDate: "2049-03-02", EndDate: "2049-03-04"})
+	// a booking for a room that is not mapped, and a cancelled booking that was never reserved
+	ota.AddBooking(channels.Booking{ID: "bk-unknown", RoomCode: "XX", StartDate: "2049-05-01", EndDate: "2049-05-02"})
+	ota.AddBooking(channels.Booking{ID: "bk-gone", RoomCode: "GQ", StartDate: "2049-05-01", EndDate: "2049-05-02", Status: channels.BookingCancelled})
+
+	summary, err := Repo.PullChannelBookings(ch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(summary, "6 booking(s) pulled, 1 reserved and 1 cancelled") {
+		t.Errorf("unexpected summary %q", summary)
+	}
+	for _, id := range []string{"bk-taken", "bk-moved", "bk-unknown"} {
+		if !strings.Contains(summary, id) {
+			t.Errorf("expected booking %s to be reported but got %q", id, summary)
+		}
+	}
+
+	ota.AddBooking(channels.Booking{ID: "bk-error", RoomCode: "GQ", StartDate: "2049-05-01", EndDate: "2049-05-02"})
+	_, err = Repo.PullChannelBookings(ch)
+	if err == nil {
+		t.Error("expected an error when the reservation cannot be looked up")
+	}
+
+	ch.BaseURL = "http://127.0.0.1:1"
+	_, err = Repo.PullChannelBookings(ch)
+	if err == nil {
+		t.Error("expected an error for a channel that cannot be reached")
+	}
+}
+
+// TestPullChannelCursor tests that the pull cursor stops before the first booking that could not be applied
+func TestPullChannelCursor(t *testing.T) {
+	since := time.Date(2049, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return since.Add(time.Duration(minutes) * time.Minute) }
+
+	bookings := []channels.Booking{
+		{ID: "bk-1", UpdatedAt: at(1)},
+		{ID: "bk-2", UpdatedAt: at(2)},
+		{ID: "bk-3", UpdatedAt: at(3)},
+		{ID: "bk-4", UpdatedAt: at(4)},
+	}
+
+	tests := []struct {
+		name       string
+		unresolved []channels.Booking
+		expected   time.Time
+	}{
+		{"all-applied", nil, at(4)},
+		{"one-unresolved", []channels.Booking{bookings[2]}, at(2)},
+		{"earliest-unresolved", []channels.Booking{bookings[3], bookings[1]}, at(1)},
+		{"first-unresolved", []channels.Booking{bookings[0]}, since},
+	}
+
+	for _, e := range tests {
+		cursor := pullCursor(since, bookings, e.unresolved)
+		if !cursor.Equal(e.expected) {
+			t.Errorf("failed %s: expected %s but got %s", e.name, e.expected, cursor)
+		}
+	}
+}
+
+// TestProcessChannelSyncs tests sending queued pushes
+func TestProcessChannelSyncs(t *testing.T) {
+	queued, err := Repo.QueueChannelPushes(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if queued != 1 {
+		t.Errorf("expected pushes to be queued for 1 channel but got %d", queued)
+	}
+
+	// the test repository hands out one push to a channel that cannot be reached and one to an unknown kind of channel
+	pushed, err := Repo.ProcessChannelSyncs(time.Now(), 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pushed != 0 {
+		t.Errorf("expected no pushes to succeed but got %d", pushed)
+	}
+}
+
+// TestAdminPostChannel tests the AdminPostChannel handler
+func TestAdminPostChannel(t *testing.T) {
+	routes := getRoutes()
+
+	tests := []struct {
+		name                 string
+		body                 string
+		expectedResponseCode int
+		expectedLocation     string
+	}{
+		{"add", "name=OTA&kind=http&base_url=https%3A%2F%2Fota.example.com&api_key=k&active=1", http.StatusSeeOther, "/admin/channels/1"},
+		{"update", "id=2&name=OTA&kind=http&base_url=https%3A%2F%2Fota.example.com", http.StatusSeeOther, "/admin/channels/2"},
+		{"missing-name", "base_url=https%3A%2F%2Fota.example.com", http.StatusSeeOther, "/admin/channels"},
+		{"bad-url", "id=2&name=OTA&base_url=ota.example.com", http.StatusSeeOther, "/admin/channels/2"},
+		{"bad-kind", "id=2&name=OTA&kind=carrier-pigeon&base_url=https%3A%2F%2Fota.example.com", http.StatusSeeOther, "/admin/channels/2"},
+		{"update-fails", "id=3&name=OTA&base_url=https%3A%2F%2Fota.example.com", http.StatusInternalServerError, ""},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", "/admin/channels", strings.NewReader(e.body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedResponseCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedResponseCode, rr.Code)
+		}
+		if e.expectedLocation != "" && rr.Header().Get("Location") != e.expectedLocation {
+			t.Errorf("failed %s: expected location %s, but got %s", e.name, e.expectedLocation, rr.Header().Get("Location"))
+		}
+	}
+}
+
+// TestAdminPostChannelMappings tests the AdminPostChannelMappings handler
+func TestAdminPostChannelMappings(t *testing.T) {
+	req, _ := http.NewRequest("POST", "/admin/channels/1/mappings", strings.NewReader("room_1=GQ&room_2="))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+
+	getRoutes().ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/admin/channels/1" {
+		t.Errorf("expected a redirect to the channel but got %d %s", rr.Code, rr.Header().Get("Location"))
+	}
+}
+
+// TestAdminPostChannelActions tests pushing to, pulling from and retrying syncs with a channel
+func TestAdminPostChannelActions(t *testing.T) {
+	routes := getRoutes()
+
+	tests := []struct {
+		name                 string
+		url                  string
+		expectedResponseCode int
+	}{
+		{"push", "/admin/channels/1/push", http.StatusSeeOther},
+		{"push-missing", "/admin/channels/3/push", http.StatusInternalServerError},
+		{"pull", "/admin/channels/1/pull", http.StatusSeeOther},
+		{"pull-missing", "/admin/channels/3/pull", http.StatusInternalServerError},
+		{"retry", "/admin/channels/1/syncs/2/retry", http.StatusSeeOther},
+		{"retry-missing", "/admin/channels/1/syncs/3/retry", http.StatusInternalServerError},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", e.url, nil)
+		rr := httptest.NewRecorder()
+
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedResponseCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedResponseCode, rr.Code)
+		}
+	}
+}
+
+// TestAdminDashboard tests the dashboard and its JSON metrics
+func TestAdminDashboard(t *testing.T) {
+	routes := getRoutes()
+
+	tests := []struct {
+		name                 string
+		url                  string
+		expectedResponseCode int
+	}{
+		{"this-month", "/admin/dashboard", http.StatusOK},
+		{"range", "/admin/dashboard?start=2050-01-01&end=2050-01-31", http.StatusOK},
+		{"json", "/admin/dashboard.json?start=2050-01-01&end=2050-01-10", http.StatusOK},
+		{"bad-date", "/admin/dashboard?start=01/01/2050", http.StatusBadRequest},
+		{"reversed", "/admin/dashboard.json?start=2050-01-10&end=2050-01-01", http.StatusBadRequest},
+		{"too-long", "/admin/dashboard.json?start=2050-01-01&end=2055-01-01", http.StatusBadRequest},
+		{"query-fails", "/admin/dashboard.json?start=2060-01-01&end=2060-01-10", http.StatusInternalServerError},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", e.url, nil)
+		rr := httptest.NewRecorder()
+
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedResponseCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedResponseCode, rr.Code)
+		}
+	}
+
+	req, _ := http.NewRequest("GET", "/admin/dashboard.json?start=2050-01-01&end=2050-01-10", nil)
+	rr := httptest.NewRecorder()
+	routes.ServeHTTP(rr, req)
+
+	var metrics struct {
+		Nights    int     `json:"nights"`
+		Occupancy float64 `json:"occupancy"`
+		Daily     []struct {
+			Date string `json:"date"`
+		} `json:"daily"`
+	}
+	err := json.Unmarshal(rr.Body.Bytes(), &metrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metrics.Nights != 10 || len(metrics.Daily) != 10 || metrics.Daily[9].Date != "2050-01-10" {
+		t.Errorf("expected the 10 nights up to and including the end date but got %+v", metrics)
+	}
+}
+
+func TestAdminReservationLists(t *testing.T) {
+	routes := getRoutes()
+
+	tests := []struct {
+		name                 string
+		url                  string
+		expectedResponseCode int
+	}{
+		{"search", "/admin/reservations-all?q=smith", http.StatusOK},
+		{"filters", "/admin/reservations-new?room=1&status=confirmed&from=2050-01-01&to=2050-01-31&tag=VIP", http.StatusOK},
+		{"sorted", "/admin/reservations-all?sort=name&dir=desc", http.StatusOK},
+		{"unknown-sort", "/admin/reservations-all?sort=password", http.StatusOK},
+		{"past-the-end", "/admin/reservations-all?page=9", http.StatusOK},
+		{"bad-room", "/admin/reservations-all?room=gq", http.StatusBadRequest},
+		{"bad-status", "/admin/reservations-all?status=lost", http.StatusBadRequest},
+		{"bad-date", "/admin/reservations-new?from=01/01/2050", http.StatusBadRequest},
+		{"bad-page", "/admin/reservations-all?page=0", http.StatusBadRequest},
+		{"too-many", "/admin/reservations-all?per_page=1000", http.StatusBadRequest},
+		{"query-fails", "/admin/reservations-all?tag=fail", http.StatusInternalServerError},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", e.url, nil)
+		rr := httptest.NewRecorder()
+
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedResponseCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedResponseCode, rr.Code)
+		}
+	}
+
+	// links keep the search and sort order of the page they are on
+	req, _ := http.NewRequest("GET", "/admin/reservations-all?q=smith&sort=name&per_page=1", nil)
+	rr := httptest.NewRecorder()
+	routes.ServeHTTP(rr, req)
+
+	body := rr.Body.String()
+	for _, expected := range []string{
+		"Page 1 of 2",
+		`href="/admin/reservations-all?dir=asc&amp;page=2&amp;per_page=1&amp;q=smith&amp;sort=name"`,
+		`href="/admin/reservations-all?dir=desc&amp;q=smith&amp;sort=name"`,
+		`href="/admin/reservations-all/export?dir=asc&amp;format=csv&amp;per_page=1&amp;q=smith&amp;sort=name"`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("expected the page to contain %s", expected)
+		}
+	}
+}
+
+func TestAdminReservationsTimeline(t *testing.T) {
+	routes := getRoutes()
+
+	tests := []struct {
+		name                 string
+		url                  string
+		expectedResponseCode int
+	}{
+		{"week", "/admin/reservations-timeline?start=2050-01-01&days=7", http.StatusOK},
+		{"quarter", "/admin/reservations-timeline?start=2050-01-01&days=90", http.StatusOK},
+		{"bad-start", "/admin/reservations-timeline?start=01/01/2050", http.StatusBadRequest},
+		{"bad-range", "/admin/reservations-timeline?days=365", http.StatusBadRequest},
+		{"query-fails", "/admin/reservations-timeline?start=2060-01-01", http.StatusInternalServerError},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", e.url, nil)
+		rr := httptest.NewRecorder()
+
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedResponseCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedResponseCode, rr.Code)
+		}
+	}
+
+	req, _ := http.NewRequest("GET", "/admin/reservations-timeline?start=2050-01-01&days=7", nil)
+	rr := httptest.NewRecorder()
+	routes.ServeHTTP(rr, req)
+
+	body := rr.Body.String()
+	for _, expected := range []string{
+		`href="/admin/reservations-timeline?start=2049-12-25&amp;days=7"`,
+		`href="/admin/reservations-timeline?start=2050-01-08&amp;days=7"`,
+		`href="/admin/reservations/timeline/1/show"`,
+		`style="left: 28.57%; width: 28.57%; top: calc(1 * 30px)"`,
+		`data-id="1"`,
+		`split across rooms"`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("expected the timeline to contain %s", expected)
+		}
+	}
+	if strings.Contains(body, `data-id="3"`) {
+		t.Error("expected the segment of a split stay not to be draggable")
+	}
+}
+
+func TestAdminExports(t *testing.T) {
+	routes := getRoutes()
+
+	tests := []struct {
+		name                 string
+		url                  string
+		expectedResponseCode int
+		expectedContentType  string
+		expectedFirstLine    string
+	}{
+		{"new-csv", "/admin/reservations-new/export?format=csv", http.StatusOK, "text/csv", "ID,First Name,Last Name"},
+		{"all-xlsx", "/admin/reservations-all/export?format=xlsx&tag=vip", http.StatusOK, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", ""},
+		{"query-fails", "/admin/reservations-all/export?format=csv&tag=fail", http.StatusOK, "text/csv", ""},
+		{"guests-csv", "/admin/guests/export?format=csv", http.StatusOK, "text/csv", "ID,First Name,Last Name"},
+		{"rooms-csv", "/admin/dashboard/export?format=csv&start=2050-01-01&end=2050-01-10", http.StatusOK, "text/csv", "Room,"},
+		{"daily-csv", "/admin/dashboard/export?table=daily&format=csv&start=2050-01-01&end=2050-01-10", http.StatusOK, "text/csv", "Night,"},
+		{"filtered-csv", "/admin/reservations-all/export?format=csv&q=smith&status=confirmed&sort=name&dir=desc", http.StatusOK, "text/csv", "ID,First Name,Last Name"},
+		{"bad-filter", "/admin/reservations-all/export?format=csv&from=tomorrow", http.StatusBadRequest, "", ""},
+		{"unknown-format", "/admin/guests/export?format=pdf", http.StatusBadRequest, "", ""},
+		{"unknown-table", "/admin/dashboard/export?table=guests&format=csv", http.StatusBadRequest, "", ""},
+		{"bad-range", "/admin/dashboard/export?format=csv&start=2050-01-10&end=2050-01-01", http.StatusBadRequest, "", ""},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("GET", e.url, nil)
+		rr := httptest.NewRecorder()
+
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedResponseCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedResponseCode, rr.Code)
+		}
+		if e.expectedContentType == "" {
+			continue
+		}
+		if !strings.HasPrefix(rr.Header().Get("Content-Type"), e.expectedContentType) {
+			t.Errorf("failed %s: expected content type %s, but got %s", e.name, e.expectedContentType, rr.Header().Get("Content-Type"))
+		}
+		if !strings.HasPrefix(rr.Header().Get("Content-Disposition"), "attachment; filename=") {
+			t.Errorf("failed %s: expected an attachment, but got %q", e.name, rr.Header().Get("Content-Disposition"))
+		}
+		if !strings.HasPrefix(rr.Body.String(), e.expectedFirstLine) {
+			t.Errorf("failed %s: expected body to start with %q, but got %q", e.name, e.expectedFirstLine, rr.Body.String())
+		}
+	}
+}
+
+func TestAdminPostImportPreview(t *testing.T) {
+	routes := getRoutes()
+
+	tests := []struct {
+		name                 string
+		fileName             string
+		content              string
+		expectedResponseCode int
+	}{
+		{"valid", "2049.csv", "First Name,Last Name,Email,Room,Arrival,Departure\nJohn,Smith,john@example.com,General's Quarters,2049-01-10,2049-01-12\n", http.StatusOK},
+		{"invalid-rows", "2049.csv", "First Name,Last Name,Email,Room,Arrival,Departure\nJohn,Smith,john,Penthouse,2049-01-10,2049-01-01\n", http.StatusOK},
+		{"unmapped", "2049.csv", "Guest,Stay\nJohn Smith,January\n", http.StatusOK},
+		{"empty", "empty.csv", "", http.StatusSeeOther},
+		{"unreadable", "bad.csv", "First Name\n\"John\n", http.StatusSeeOther},
+	}
+
+	for _, e := range tests {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		fw, _ := mw.CreateFormFile("file", e.fileName)
+		_, _ = fw.Write([]byte(e.content))
+		_ = mw.Close()
+
+		req, _ := http.NewRequest("POST", "/admin/import/preview", &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		rr := httptest.NewRecorder()
+
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedResponseCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedResponseCode, rr.Code)
+		}
+	}
+
+	// check the file again with the columns chosen on the preview
+	postedData := url.Values{}
+	postedData.Add("file_name", "2049.csv")
+	postedData.Add("content", "Guest,Surname,Email,Room,In,Out\nJohn,Smith,john@example.com,1,2049-01-10,2049-01-12\n")
+	for i, field := range []string{"first_name", "last_name", "email", "room", "arrival", "departure"} {
+		postedData.Add("col_"+field, strconv.Itoa(i))
+	}
+
+	req, _ := http.NewRequest("POST", "/admin/import/preview", strings.NewReader(postedData.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+
+	routes.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("failed remap: expected code %d, but got %d", http.StatusOK, rr.Code)
+	}
+	if !strings.Contains(rr.Body.String(), "Import 1 Reservation(s)\" >") {
+		t.Error("expected the import button to be enabled for a valid file")
+	}
+}
+
+func TestAdminPostImport(t *testing.T) {
+	routes := getRoutes()
+
+	header := "First Name,Last Name,Email,Room,Arrival,Departure\n"
+	tests := []struct {
+		name                 string
+		fileName             string
+		content              string
+		expectedResponseCode int
+		expectedLocation     string
+	}{
+		{"valid", "2049.csv", header + "John,Smith,john@example.com,General's Quarters,2049-01-10,2049-01-12\n", http.StatusSeeOther, "/admin/import"},
+		{"invalid-rows", "2049.csv", header + "John,Smith,john@example.com,Penthouse,2049-01-10,2049-01-12\n", http.StatusOK, ""},
+		{"room-taken", "2060.csv", header + "John,Smith,john@example.com,General's Quarters,2060-01-10,2060-01-12\n", http.StatusOK, ""},
+		{"no-file", "", "", http.StatusSeeOther, "/admin/import"},
+		{"import-fails", "fail.csv", header + "John,Smith,john@example.com,General's Quarters,2049-01-10,2049-01-12\n", http.StatusInternalServerError, ""},
+	}
+
+	for _, e := range tests {
+		postedData := url.Values{}
+		postedData.Add("file_name", e.fileName)
+		postedData.Add("content", e.content)
+		for i, field := range []string{"first_name", "last_name", "email", "room", "arrival", "departure"} {
+			postedData.Add("col_"+field, strconv.Itoa(i))
+		}
+
+		req, _ := http.NewRequest("POST", "/admin/import", strings.NewReader(postedData.Encode()))
+		ctx := getCtx(req)
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedResponseCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedResponseCode, rr.Code)
+		}
+		if e.expectedLocation != "" && rr.Header().Get("Location") != e.expectedLocation {
+			t.Errorf("failed %s: expected location %s, but got %s", e.name, e.expectedLocation, rr.Header().Get("Location"))
+		}
+	}
+}
+
+func TestAdminPostRevertImport(t *testing.T) {
+	routes := getRoutes()
+
+	tests := []struct {
+		name                 string
+		url                  string
+		expectedResponseCode int
+	}{
+		{"undo", "/admin/import/1/undo", http.StatusSeeOther},
+		{"already-undone", "/admin/import/2/undo", http.StatusSeeOther},
+		{"undo-fails", "/admin/import/3/undo", http.StatusInternalServerError},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", e.url, nil)
+		rr := httptest.NewRecorder()
+
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedResponseCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedResponseCode, rr.Code)
+		}
+	}
+}
+
+func TestAdminChangeStay(t *testing.T) {
+	routes := getRoutes()
+
+	tests := []struct {
+		name                 string
+		url                  string
+		postedData           url.Values
+		expectedResponseCode int
+		expectedMessage      string
+	}{
+		{"dates", "/admin/reservations/timeline/1/dates", url.Values{"start": {"2050-02-01"}, "end": {"2050-02-03"}}, http.StatusOK, "now stays in"},
+		{"dates-invalid", "/admin/reservations/timeline/1/dates", url.Values{"start": {"soon"}, "end": {"2050-02-03"}}, http.StatusBadRequest, "Invalid arrival date"},
+		{"dates-reversed", "/admin/reservations/timeline/1/dates", url.Values{"start": {"2050-02-03"}, "end": {"2050-02-01"}}, http.StatusBadRequest, "Departure must be after arrival"},
+		{"dates-taken", "/admin/reservations/timeline/1/dates", url.Values{"start": {"2060-02-01"}, "end": {"2060-02-03"}}, http.StatusConflict, "is not available"},
+		{"dates-fail", "/admin/reservations/timeline/1/dates", url.Values{"start": {"2061-02-01"}, "end": {"2061-02-03"}}, http.StatusInternalServerError, ""},
+		{"dates-checked-in", "/admin/reservations/timeline/2/dates", url.Values{"start": {"2050-01-11"}, "end": {"2050-01-13"}}, http.StatusConflict, "has checked in"},
+		{"extend-checked-in", "/admin/reservations/timeline/2/extend", url.Values{"nights": {"2"}}, http.StatusOK, "to 2050-01-15"},
+		{"shorten-too-far", "/admin/reservations/timeline/1/extend", url.Values{"nights": {"-3"}}, http.StatusBadRequest, "Departure must be after arrival"},
+		{"extend-invalid", "/admin/reservations/timeline/1/extend", url.Values{"nights": {"0"}}, http.StatusBadRequest, "Invalid number of nights"},
+		{"move", "/admin/reservations/timeline/1/move", url.Values{"room_id": {"2"}}, http.StatusOK, "from 2050-01-10 to 2050-01-13"},
+		{"move-and-dates", "/admin/reservations/timeline/1/move", url.Values{"room_id": {"2"}, "start": {"2050-03-01"}}, http.StatusOK, "from 2050-03-01 to 2050-03-04"},
+		{"move-same-room", "/admin/reservations/timeline/1/move", url.Values{"room_id": {"1"}}, http.StatusOK, "Nothing to change"},
+		{"move-invalid-room", "/admin/reservations/timeline/1/move", url.Values{"room_id": {"x"}}, http.StatusBadRequest, "Invalid room"},
+		{"reservation-fails", "/admin/reservations/timeline/3/move", url.Values{"room_id": {"2"}}, http.StatusInternalServerError, ""},
+	}
+
+	for _, e := range tests {
+		req, _ := http.NewRequest("POST", e.url, strings.NewReader(e.postedData.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+
+		routes.ServeHTTP(rr, req)
+
+		if rr.Code != e.expectedResponseCode {
+			t.Errorf("failed %s: expected code %d, but got %d", e.name, e.expectedResponseCode, rr.Code)
+			continue
+		}
+		if e.expectedMessage == "" {
+			continue
+		}
+
+		var resp stayResponse
+		err := json.Unmarshal(rr.Body.Bytes(), &resp)
+		if err != nil {
+			t.Errorf("failed %s: could not parse json: %v", e.name, err)
+			continue
+		}
+		if resp.OK != (rr.Code == http.StatusOK) || !strings.Contains(resp.Message, e.expectedMessage) {
+			t.Errorf("failed %s: expected ok to be %t and the message to contain %q but got %+v", e.name, rr.Code == http.StatusOK, e.expectedMessage, resp)
+		}
+	}
+}
+
+// lockedRecorder is a ResponseRecorder that can be read while a handler is still streaming to it
+type lockedRecorder struct {
+	mu sync.Mutex
+	*httptest.ResponseRecorder
+}
+
+func (l *lockedRecorder) Write(b []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.ResponseRecorder.Write(b)
+}
+
+func (l *lockedRecorder) Flush() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.ResponseRecorder.Flush()
+}
+
+func (l *lockedRecorder) body() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.Body.String()
+}
+
+// waitFor polls until ok returns true, giving up after a second
+func waitFor(ok func() bool) bool {
+	for i := 0; i < 100; i++ {
+		if ok() {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func TestAvailabilityEvents(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, "GET", "/availability/events?room_id=1&start=2050-01-10&end=2050-01-12", nil)
+	rr := &lockedRecorder{ResponseRecorder: httptest.NewRecorder()}
+
+	done := make(chan struct{})
+	go func() {
+		http.HandlerFunc(Repo.AvailabilityEvents).ServeHTTP(rr, req)
+		close(done)
+	}()
+
+	if !waitFor(func() bool { return app.Events.Subscribers() == 1 }) {
+		t.Fatal("expected the stream to subscribe to events")
+	}
+
+	start := time.Date(2050, 1, 11, 0, 0, 0, 0, time.UTC)
+	app.Events.Publish(events.New(events.ReservationChanged, 2, start, start.AddDate(0, 0, 1)))
+	app.Events.Publish(events.New(events.BlockChanged, 1, start.AddDate(0, 0, 5), start.AddDate(0, 0, 6)))
+	app.Events.Publish(events.New(events.ReservationChanged, 1, start, start.AddDate(0, 0, 1)))
+
+	expected := "event: reservation\ndata: {\"kind\":\"reservation\",\"room_id\":1,\"start\":\"2050-01-11\",\"end\":\"2050-01-12\"}\n\n"
+	if !waitFor(func() bool { return strings.Contains(rr.body(), expected) }) {
+		t.Errorf("expected the change to room 1 to be streamed but got %q", rr.body())
+	}
+
+	cancel()
+	<-done
+
+	if rr.Header().Get("Content-Type") != "text/event-stream" {
+		t.Errorf("expected an event stream but got %s", rr.Header().Get("Content-Type"))
+	}
+	if body := rr.body(); strings.Contains(body, `"room_id":2`) || strings.Contains(body, "2050-01-16") {
+		t.Errorf("expected changes to other rooms and nights to be left out but got %q", body)
+	}
+	if app.Events.Subscribers() != 0 {
+		t.Error("expected the stream to unsubscribe when the page goes away")
+	}
+}
+
+// TestCheckOutEvents tests that checking out tells the open pages about every room a split stay held,
+// and about the extra nights of a late checkout
+func TestCheckOutEvents(t *testing.T) {
+	sub := app.Events.Subscribe()
+	defer sub.Close()
+
+	postedData := url.Values{"departed_at": {"2050-01-13T11:00"}}
+	req, _ := http.NewRequest("POST", "/admin/front-desk/6/check-out", strings.NewReader(postedData.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := httptest.NewRecorder()
+
+	getRoutes().ServeHTTP(rr, req)
+
+	var published []events.Event
+	for len(sub.Events) > 0 {
+		published = append(published, <-sub.Events)
+	}
+
+	expected := []events.Event{
+		{Kind: events.ReservationChanged, RoomID: 1, Start: "2050-01-10", End: "2050-01-11"},
+		{Kind: events.ReservationChanged, RoomID: 2, Start: "2050-01-11", End: "2050-01-12"},
+		{Kind: events.ReservationChanged, RoomID: 2, Start: "2050-01-12", End: "2050-01-13"},
+	}
+	if len(published) != len(expected) {
+		t.Fatalf("expected %d events but got %v", len(expected), published)
+	}
+	for i, e := range expected {
+		if published[i] != e {
+			t.Errorf("expected event %d to be %v but got %v", i, e, published[i])
+		}
+	}
+}
+
+// sessionString returns a string a handler put in the session it saved with the response
+func sessionString(rr *httptest.ResponseRecorder, key string) string {
+	for _, c := range rr.Result().Cookies() {
+		if c.Name == session.Cookie.Name {
+			ctx, err := session.Load(context.Background(), c.Value)
+			if err != nil {
+				return ""
+			}
+			return session.GetString(ctx, key)
+		}
+	}
+	return ""
+}
+
 // gets the context
 func getCtx(req *http.Request) context.Context {
 	ctx, err := session.Load(req.Context(), req.Header.Get("X-Session"))
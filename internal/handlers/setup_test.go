@@ -12,6 +12,9 @@ import (
 	"time"
 
 	"github.com/Poojasadgir/room-reservation/internal/config"
+	"github.com/Poojasadgir/room-reservation/internal/events"
+	"github.com/Poojasadgir/room-reservation/internal/helpers"
+	"github.com/Poojasadgir/room-reservation/internal/mailer"
 	"github.com/Poojasadgir/room-reservation/internal/models"
 	"github.com/Poojasadgir/room-reservation/internal/render"
 	"github.com/alexedwards/scs/v2"
@@ -23,12 +26,14 @@ import (
 var app config.AppConfig
 var session *scs.SessionManager
 var pathToTemplates = "./../../templates"
+var mailTransport *mailer.Memory
 
 var functions = template.FuncMap{
 	"humanDate":  render.HumanDate,
 	"formatDate": render.FormatDate,
 	"iterate":    render.Iterate,
 	"add":        render.Add,
+	"currency":   render.FormatCurrency,
 }
 
 func TestMain(m *testing.M) {
@@ -55,11 +60,11 @@ func TestMain(m *testing.M) {
 
 	app.Session = session
 
-	MailChannel := make(chan models.MailData)
-	app.MailChannel = MailChannel
-	defer close(MailChannel)
-
-	listenForMail()
+	// sent email is kept in memory so that tests can check it
+	mailTransport = mailer.NewMemory()
+	app.Mailer = mailTransport
+	app.Events = events.NewBus(nil)
+	pathToEmailTemplates = "./../../email-templates"
 
 	tc, err := CreateTestTemplateCache()
 	if err != nil {
@@ -72,18 +77,11 @@ func TestMain(m *testing.M) {
 	repo := NewTestRepo(&app)
 	NewHandlers(repo)
 	render.NewRenderer(&app)
+	helpers.NewHelpers(&app)
 
 	os.Exit(m.Run())
 }
 
-func listenForMail() {
-	go func() {
-		for {
-			_ = <-app.MailChannel
-		}
-	}()
-}
-
 func getRoutes() http.Handler {
 	mux := chi.NewRouter()
 
@@ -99,28 +97,97 @@ func getRoutes() http.Handler {
 	mux.Get("/search-availability", Repo.Availability)
 	mux.Post("/search-availability", Repo.PostAvailability)
 	mux.Post("/search-availability-json", Repo.AvailabilityJSON)
+	mux.Get("/availability/events", Repo.AvailabilityEvents)
 
 	mux.Get("/contact", Repo.Contact)
 
+	mux.Get("/choose-split", Repo.ChooseSplit)
 	mux.Get("/make-reservation", Repo.Reservation)
 	mux.Post("/make-reservation", Repo.PostReservation)
 	mux.Get("/reservation-summary", Repo.ReservationSummary)
+	mux.Get("/reservations/{id}/cancel", Repo.GuestCancelReservation)
+	mux.Post("/reservations/{id}/cancel", Repo.PostGuestCancelReservation)
+	mux.Get("/ical/rooms/{id}.ics", Repo.RoomCalendarFeed)
 
 	mux.Get("/user/login", Repo.ShowLogin)
 	mux.Post("/user/login", Repo.PostShowLogin)
 	mux.Get("/user/logout", Repo.Logout)
 
 	mux.Get("/admin/dashboard", Repo.AdminDashboard)
+	mux.Get("/admin/events", Repo.AdminEvents)
+	mux.Get("/admin/dashboard.json", Repo.AdminDashboardJSON)
+	mux.Get("/admin/dashboard/export", Repo.AdminExportDashboard)
 
 	mux.Get("/admin/reservations-new", Repo.AdminNewReservations)
 	mux.Get("/admin/reservations-all", Repo.AdminAllReservations)
+	mux.Get("/admin/reservations-new/export", Repo.AdminExportNewReservations)
+	mux.Get("/admin/reservations-all/export", Repo.AdminExportAllReservations)
 	mux.Get("/admin/reservations-calendar", Repo.AdminReservationsCalendar)
+	mux.Get("/admin/reservations-timeline", Repo.AdminReservationsTimeline)
 	mux.Post("/admin/reservations-calendar", Repo.AdminPostReservationsCalendar)
 	mux.Get("/admin/process-reservation/{src}/{id}/do", Repo.AdminProcessReservation)
 	mux.Get("/admin/delete-reservation/{src}/{id}/do", Repo.AdminDeleteReservation)
 
 	mux.Get("/admin/reservations/{src}/{id}/show", Repo.AdminShowReservation)
 	mux.Post("/admin/reservations/{src}/{id}", Repo.AdminPostShowReservation)
+	mux.Post("/admin/reservations/{src}/{id}/notes", Repo.AdminPostReservationNote)
+	mux.Post("/admin/reservations/{src}/{id}/dates", Repo.AdminPostReservationDates)
+	mux.Post("/admin/reservations/{src}/{id}/extend", Repo.AdminPostExtendReservation)
+	mux.Post("/admin/reservations/{src}/{id}/move", Repo.AdminPostMoveReservation)
+	mux.Get("/admin/cancel-reservation/{src}/{id}", Repo.AdminCancelReservation)
+	mux.Post("/admin/cancel-reservation/{src}/{id}", Repo.AdminPostCancelReservation)
+
+	mux.Get("/admin/guests", Repo.AdminGuests)
+	mux.Get("/admin/guests/export", Repo.AdminExportGuests)
+	mux.Get("/admin/guests/{id}", Repo.AdminShowGuest)
+	mux.Post("/admin/guests/{id}", Repo.AdminPostShowGuest)
+	mux.Post("/admin/guests/{id}/merge", Repo.AdminMergeGuest)
+
+	mux.Get("/admin/cancellation-policies", Repo.AdminCancellationPolicies)
+	mux.Post("/admin/cancellation-policies", Repo.AdminPostCancellationPolicy)
+	mux.Post("/admin/rooms/{id}/cancellation-policy", Repo.AdminPostRoomCancellationPolicy)
+
+	mux.Get("/admin/booking-questions", Repo.AdminBookingQuestions)
+	mux.Post("/admin/booking-questions", Repo.AdminPostBookingQuestion)
+
+	mux.Get("/admin/front-desk", Repo.AdminFrontDesk)
+	mux.Post("/admin/front-desk/{id}/check-in", Repo.AdminPostCheckIn)
+	mux.Post("/admin/front-desk/{id}/check-out", Repo.AdminPostCheckOut)
+
+	mux.Get("/admin/housekeeping", Repo.AdminHousekeeping)
+	mux.Post("/admin/housekeeping/generate", Repo.AdminPostGenerateHousekeepingTasks)
+	mux.Post("/admin/housekeeping/tasks/{id}/done", Repo.AdminPostCompleteHousekeepingTask)
+	mux.Post("/admin/rooms/{id}/housekeeping-status", Repo.AdminPostRoomHousekeepingStatus)
+
+	mux.Get("/admin/jobs", Repo.AdminJobs)
+	mux.Post("/admin/jobs/{name}/run", Repo.AdminPostRunJob)
+	mux.Get("/admin/outbox", Repo.AdminOutbox)
+	mux.Post("/admin/outbox/{id}/resend", Repo.AdminPostResendOutboxMessage)
+	mux.Get("/admin/email-templates", Repo.AdminEmailTemplates)
+	mux.Get("/admin/email-templates/{name}", Repo.AdminEmailTemplates)
+	mux.Get("/admin/calendar-sync", Repo.AdminCalendarSync)
+	mux.Post("/admin/rooms/{id}/calendar-feed", Repo.AdminPostRoomCalendarFeed)
+	mux.Post("/admin/calendar-imports", Repo.AdminPostCalendarImport)
+	mux.Post("/admin/calendar-imports/{id}/sync", Repo.AdminPostSyncCalendarImport)
+	mux.Post("/admin/calendar-imports/{id}/delete", Repo.AdminPostDeleteCalendarImport)
+	mux.Get("/admin/webhooks", Repo.AdminWebhooks)
+	mux.Post("/admin/webhooks", Repo.AdminPostWebhookEndpoint)
+	mux.Get("/admin/webhooks/{id}", Repo.AdminShowWebhookEndpoint)
+	mux.Post("/admin/webhooks/{id}/delete", Repo.AdminPostDeleteWebhookEndpoint)
+	mux.Post("/admin/webhooks/{id}/deliveries/{deliveryID}/replay", Repo.AdminPostReplayWebhookDelivery)
+
+	mux.Get("/admin/channels", Repo.AdminChannels)
+	mux.Post("/admin/channels", Repo.AdminPostChannel)
+	mux.Get("/admin/channels/{id}", Repo.AdminShowChannel)
+	mux.Post("/admin/channels/{id}/mappings", Repo.AdminPostChannelMappings)
+	mux.Post("/admin/channels/{id}/push", Repo.AdminPostChannelPush)
+	mux.Post("/admin/channels/{id}/pull", Repo.AdminPostChannelPull)
+	mux.Post("/admin/channels/{id}/syncs/{syncID}/retry", Repo.AdminPostRetryChannelSync)
+
+	mux.Get("/admin/import", Repo.AdminImport)
+	mux.Post("/admin/import", Repo.AdminPostImport)
+	mux.Post("/admin/import/preview", Repo.AdminPostImportPreview)
+	mux.Post("/admin/import/{id}/undo", Repo.AdminPostRevertImport)
 
 	fileServer := http.FileServer(http.Dir("./static/"))
 	mux.Handle("/static/*", http.StripPrefix("/static", fileServer))
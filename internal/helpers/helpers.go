@@ -1,9 +1,15 @@
 package helpers
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
 	"runtime/debug"
+	"strconv"
+	"strings"
 
 	"github.com/Poojasadgir/room-reservation/internal/config"
 )
@@ -38,3 +44,28 @@ func IsAuthenticated(r *http.Request) bool {
 	exists := app.Session.Exists(r.Context(), "user_id")
 	return exists
 }
+
+// GenerateToken returns a random hex encoded token built from n random bytes.
+func GenerateToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// ParseCurrency converts an amount entered as dollars, such as "125" or "89.50", into cents.
+func ParseCurrency(s string) (int, error) {
+	s = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(s), "$"))
+	if s == "" {
+		return 0, nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	if f < 0 {
+		return 0, errors.New("amount cannot be negative")
+	}
+	return int(math.Round(f * 100)), nil
+}
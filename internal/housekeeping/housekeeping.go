@@ -0,0 +1,46 @@
+package housekeeping
+
+import (
+	"time"
+
+	"github.com/Poojasadgir/room-reservation/internal/models"
+)
+
+// Statuses lists the housekeeping statuses a room can be in, in the order they are offered to staff.
+var Statuses = []string{
+	models.HousekeepingClean,
+	models.HousekeepingDirty,
+	models.HousekeepingInspected,
+	models.HousekeepingOutOfService,
+}
+
+// TaskForRoom works out the cleaning a room needs on a date from the restrictions covering the
+// night before and the date itself. A reservation ending on the date needs a departure clean, and
+// one running through the date needs a stay-over tidy. Blocks never generate a task. It returns
+// false when the room needs no cleaning.
+func TaskForRoom(roomID int, date time.Time, restrictions []models.RoomRestriction) (models.HousekeepingTask, bool) {
+	task := models.HousekeepingTask{
+		RoomID:   roomID,
+		TaskDate: date,
+		Status:   models.TaskStatusOpen,
+	}
+
+	for _, r := range restrictions {
+		if r.ReservationID == 0 || !r.StartDate.Before(date) {
+			continue
+		}
+
+		switch {
+		case r.EndDate.Equal(date):
+			// a departure always needs the full clean, even if another guest stayed over
+			task.Kind = models.TaskKindDeparture
+			task.ReservationID = r.ReservationID
+			return task, true
+		case r.EndDate.After(date):
+			task.Kind = models.TaskKindStayOver
+			task.ReservationID = r.ReservationID
+		}
+	}
+
+	return task, task.Kind != ""
+}
@@ -0,0 +1,64 @@
+package housekeeping
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Poojasadgir/room-reservation/internal/models"
+)
+
+var date = time.Date(2050, 1, 10, 0, 0, 0, 0, time.UTC)
+
+var taskForRoomTests = []struct {
+	name          string
+	restrictions  []models.RoomRestriction
+	expectedTask  bool
+	expectedKind  string
+	expectedResID int
+}{
+	{"empty", nil, false, "", 0},
+	{
+		"departure",
+		[]models.RoomRestriction{{ReservationID: 1, StartDate: date.AddDate(0, 0, -2), EndDate: date}},
+		true, models.TaskKindDeparture, 1,
+	},
+	{
+		"stay-over",
+		[]models.RoomRestriction{{ReservationID: 1, StartDate: date.AddDate(0, 0, -2), EndDate: date.AddDate(0, 0, 2)}},
+		true, models.TaskKindStayOver, 1,
+	},
+	{
+		"arrival-only",
+		[]models.RoomRestriction{{ReservationID: 1, StartDate: date, EndDate: date.AddDate(0, 0, 2)}},
+		false, "", 0,
+	},
+	{
+		"block",
+		[]models.RoomRestriction{{RestrictionID: 2, StartDate: date.AddDate(0, 0, -1), EndDate: date}},
+		false, "", 0,
+	},
+	{
+		"turnover",
+		[]models.RoomRestriction{
+			{ReservationID: 2, StartDate: date, EndDate: date.AddDate(0, 0, 3)},
+			{ReservationID: 1, StartDate: date.AddDate(0, 0, -3), EndDate: date},
+		},
+		true, models.TaskKindDeparture, 1,
+	},
+}
+
+func TestTaskForRoom(t *testing.T) {
+	for _, e := range taskForRoomTests {
+		task, ok := TaskForRoom(1, date, e.restrictions)
+		if ok != e.expectedTask {
+			t.Errorf("%s: expected task to be %t but got %t", e.name, e.expectedTask, ok)
+			continue
+		}
+		if task.Kind != e.expectedKind {
+			t.Errorf("%s: expected kind %q but got %q", e.name, e.expectedKind, task.Kind)
+		}
+		if task.ReservationID != e.expectedResID {
+			t.Errorf("%s: expected reservation %d but got %d", e.name, e.expectedResID, task.ReservationID)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNotCalendar is returned by Decode for input that is not an iCalendar file
+var ErrNotCalendar = errors.New("not an iCalendar file")
+
+// ErrTruncated is returned by Decode for a calendar that ends before END:VCALENDAR, which is how a file cut
+// off in transfer looks. Its events cannot be trusted to be all of them.
+var ErrTruncated = errors.New("the calendar ends before END:VCALENDAR")
+
+// Decode reads the events from an iCalendar file. Only the properties used to block rooms are read:
+// UID, DTSTART, DTEND or DURATION, SUMMARY, DESCRIPTION, LOCATION, STATUS and SEQUENCE. Recurring events
+// are read as their first occurrence. A calendar without END:VCALENDAR is rejected with ErrTruncated.
+func Decode(r io.Reader) ([]Event, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []Event
+	var ev *Event
+	var duration time.Duration
+	seenCalendar := false
+	seenEnd := false
+
+	for n, line := range lines {
+		name, params, value, ok := parseLine(line)
+		if !ok {
+			continue
+		}
+
+		switch {
+		case name == "BEGIN" && strings.EqualFold(value, "VCALENDAR"):
+			seenCalendar = true
+		case name == "END" && strings.EqualFold(value, "VCALENDAR"):
+			seenEnd = true
+		case name == "BEGIN" && strings.EqualFold(value, "VEVENT"):
+			ev = &Event{}
+			duration = 0
+		case name == "END" && strings.EqualFold(value, "VEVENT"):
+			if ev == nil {
+				continue
+			}
+			if ev.End.IsZero() {
+				switch {
+				case duration > 0:
+					ev.End = ev.Start.Add(duration)
+				case ev.AllDay:
+					// an all-day event without an end lasts the one day
+					ev.End = ev.Start.AddDate(0, 0, 1)
+				default:
+					ev.End = ev.Start
+				}
+			}
+			if ev.UID != "" && !ev.Start.IsZero() {
+				events = append(events, *ev)
+			}
+			ev = nil
+		case ev == nil:
+			// properties of the calendar itself, or of components other than events
+		case name == "UID":
+			ev.UID = value
+		case name == "SUMMARY":
+			ev.Summary = unescape(value)
+		case name == "DESCRIPTION":
+			ev.Description = unescape(value)
+		case name == "LOCATION":
+			ev.Location = unescape(value)
+		case name == "STATUS":
+			ev.Status = strings.ToUpper(value)
+		case name == "SEQUENCE":
+			ev.Sequence, _ = strconv.Atoi(value)
+		case name == "DTSTAMP":
+			ev.Stamp, _, _ = parseTime(value, params)
+		case name == "DTSTART":
+			ev.Start, ev.AllDay, err = parseTime(value, params)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n+1, err)
+			}
+		case name == "DTEND":
+			ev.End, _, err = parseTime(value, params)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n+1, err)
+			}
+		case name == "DURATION":
+			duration, err = parseDuration(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n+1, err)
+			}
+		}
+	}
+
+	if !seenCalendar {
+		return nil, ErrNotCalendar
+	}
+	if !seenEnd {
+		return nil, ErrTruncated
+	}
+	return events, nil
+}
+
+// unfold reads the content lines of a file, joining folded lines back together
+func unfold(r io.Reader) ([]string, error) {
+	var lines []string
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	return lines, scanner.Err()
+}
+
+// parseLine splits a content line into its upper-cased name, its parameters and its value
+func parseLine(line string) (string, map[string]string, string, bool) {
+	// the value starts at the first colon that is not inside a quoted parameter value
+	quoted := false
+	colon := -1
+	for i, c := range line {
+		if c == '"' {
+			quoted = !quoted
+		} else if c == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return "", nil, "", false
+	}
+
+	parts := strings.Split(line[:colon], ";")
+	params := make(map[string]string)
+	for _, p := range parts[1:] {
+		if k, v, ok := strings.Cut(p, "="); ok {
+			params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+		}
+	}
+
+	return strings.ToUpper(parts[0]), params, line[colon+1:], true
+}
+
+// parseTime reads a DATE or DATE-TIME value, reporting whether it was a date. Times with a TZID are read in
+// that zone, falling back to UTC for zones that are not known. Times without a zone are read as UTC.
+func parseTime(value string, params map[string]string) (time.Time, bool, error) {
+	if params["VALUE"] == "DATE" || len(value) == 8 {
+		t, err := time.Parse("20060102", value)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("invalid date %q", value)
+		}
+		return t, true, nil
+	}
+
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("invalid time %q", value)
+		}
+		return t, false, nil
+	}
+
+	loc := time.UTC
+	if tzid := params["TZID"]; tzid != "" {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			loc = l
+		}
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, loc)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid time %q", value)
+	}
+	return t, false, nil
+}
+
+var durationPattern = regexp.MustCompile(`^\+?P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// parseDuration reads a DURATION value such as P1D or PT2H30M
+func parseDuration(value string) (time.Duration, error) {
+	m := durationPattern.FindStringSubmatch(value)
+	if m == nil || value == "P" || value == "PT" {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+
+	units := []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second}
+	var d time.Duration
+	for i, unit := range units {
+		if m[i+1] == "" {
+			continue
+		}
+		n, _ := strconv.Atoi(m[i+1])
+		d += time.Duration(n) * unit
+	}
+	return d, nil
+}
+
+// unescape reverses Escape
+func unescape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i == len(s)-1 {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n', 'N':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
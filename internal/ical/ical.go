@@ -0,0 +1,181 @@
+package ical
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Methods of an iTIP calendar message (RFC 5546)
+const (
+	MethodPublish = "PUBLISH"
+	MethodRequest = "REQUEST"
+	MethodCancel  = "CANCEL"
+)
+
+// Statuses of an event
+const (
+	StatusConfirmed = "CONFIRMED"
+	StatusCancelled = "CANCELLED"
+)
+
+// ContentType is the MIME type of an iCalendar file
+const ContentType = "text/calendar; charset=utf-8"
+
+// ProdID identifies this application as the producer of a calendar
+const ProdID = "-//Fort Oak Bed and Breakfast//Room Reservations//EN"
+
+// Calendar is an iCalendar object (RFC 5545) holding events
+type Calendar struct {
+	// Name is shown by calendar apps that subscribe to the calendar, if set
+	Name string
+	// Method is set for calendars sent as invitations, such as MethodRequest or MethodCancel
+	Method string
+	Events []Event
+}
+
+// Event is a VEVENT. Times are written in UTC, or as dates when AllDay is set.
+type Event struct {
+	// UID identifies the event across updates and must stay the same for the life of the event
+	UID string
+	// Sequence is increased each time the event is changed in a way the attendee should know about
+	Sequence    int
+	Stamp       time.Time
+	Start       time.Time
+	End         time.Time
+	AllDay      bool
+	Summary     string
+	Description string
+	Location    string
+	Status      string
+	// Organizer and Attendee are email addresses, required when the calendar is sent as an invitation
+	Organizer     string
+	OrganizerName string
+	Attendee      string
+	AttendeeName  string
+}
+
+// Bytes returns the calendar encoded as an iCalendar file
+func (c Calendar) Bytes() []byte {
+	var buf bytes.Buffer
+	c.Encode(&buf)
+	return buf.Bytes()
+}
+
+// Encode writes the calendar as an iCalendar file, with CRLF line endings and long lines folded
+func (c Calendar) Encode(w io.Writer) error {
+	e := &encoder{w: w}
+
+	e.line("BEGIN", "VCALENDAR")
+	e.line("VERSION", "2.0")
+	e.line("PRODID", ProdID)
+	e.line("CALSCALE", "GREGORIAN")
+	if c.Method != "" {
+		e.line("METHOD", c.Method)
+	}
+	if c.Name != "" {
+		e.line("X-WR-CALNAME", Escape(c.Name))
+	}
+
+	for _, ev := range c.Events {
+		e.line("BEGIN", "VEVENT")
+		e.line("UID", Escape(ev.UID))
+		e.line("SEQUENCE", fmt.Sprint(ev.Sequence))
+		e.line("DTSTAMP", formatTime(ev.Stamp))
+		if ev.AllDay {
+			e.line("DTSTART;VALUE=DATE", formatDate(ev.Start))
+			e.line("DTEND;VALUE=DATE", formatDate(ev.End))
+		} else {
+			e.line("DTSTART", formatTime(ev.Start))
+			e.line("DTEND", formatTime(ev.End))
+		}
+		e.line("SUMMARY", Escape(ev.Summary))
+		if ev.Description != "" {
+			e.line("DESCRIPTION", Escape(ev.Description))
+		}
+		if ev.Location != "" {
+			e.line("LOCATION", Escape(ev.Location))
+		}
+		if ev.Status != "" {
+			e.line("STATUS", ev.Status)
+		}
+		if ev.Organizer != "" {
+			e.line("ORGANIZER"+commonName(ev.OrganizerName), "mailto:"+ev.Organizer)
+		}
+		if ev.Attendee != "" {
+			e.line("ATTENDEE"+commonName(ev.AttendeeName)+";ROLE=REQ-PARTICIPANT;RSVP=FALSE", "mailto:"+ev.Attendee)
+		}
+		e.line("TRANSP", "OPAQUE")
+		e.line("END", "VEVENT")
+	}
+
+	e.line("END", "VCALENDAR")
+	return e.err
+}
+
+// encoder writes content lines, remembering the first error
+type encoder struct {
+	w   io.Writer
+	err error
+}
+
+// line writes a content line, folding it so that no line is longer than 75 octets
+func (e *encoder) line(name, value string) {
+	if e.err != nil {
+		return
+	}
+	_, e.err = io.WriteString(e.w, fold(name+":"+value)+"\r\n")
+}
+
+// fold splits a content line into lines of at most 75 octets, continuing each on the next line after a
+// space as RFC 5545 requires. It never splits a UTF-8 character.
+func fold(line string) string {
+	const max = 75
+	if len(line) <= max {
+		return line
+	}
+
+	var b strings.Builder
+	width := max
+	for len(line) > width {
+		cut := width
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		// continuation lines start with a space, which counts towards their length
+		width = max - 1
+	}
+	b.WriteString(line)
+	return b.String()
+}
+
+// Escape escapes a TEXT value
+func Escape(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`).Replace(s)
+}
+
+// commonName returns the CN parameter for a name, or nothing if the name is empty
+func commonName(name string) string {
+	if name == "" {
+		return ""
+	}
+	// parameter values are quoted, so they cannot themselves contain quotes
+	return `;CN="` + strings.ReplaceAll(name, `"`, "'") + `"`
+}
+
+// formatTime formats a time as a UTC DATE-TIME
+func formatTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// formatDate formats a time as a DATE
+func formatDate(t time.Time) string {
+	return t.Format("20060102")
+}
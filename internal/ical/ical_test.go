@@ -0,0 +1,172 @@
+package ical
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncode(t *testing.T) {
+	start := time.Date(2050, 1, 10, 15, 0, 0, 0, time.UTC)
+	cal := Calendar{
+		Method: MethodRequest,
+		Events: []Event{{
+			UID:           "reservation-1@example.com",
+			Sequence:      2,
+			Stamp:         start.AddDate(0, 0, -10),
+			Start:         start,
+			End:           start.AddDate(0, 0, 3).Add(-4 * time.Hour),
+			Summary:       "Stay at General's Quarters",
+			Description:   "Line one\nLine two; with, punctuation",
+			Location:      "1 Main St, Fort Oak",
+			Status:        StatusConfirmed,
+			Organizer:     "me@here.com",
+			OrganizerName: "Fort Oak",
+			Attendee:      "jane@example.com",
+			AttendeeName:  `Jane "JJ" Smith`,
+		}},
+	}
+
+	// unfold long lines before looking for content lines
+	out := strings.ReplaceAll(string(cal.Bytes()), "\r\n ", "")
+
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"METHOD:REQUEST\r\n",
+		"UID:reservation-1@example.com\r\n",
+		"SEQUENCE:2\r\n",
+		"DTSTART:20500110T150000Z\r\n",
+		"DTEND:20500113T110000Z\r\n",
+		`DESCRIPTION:Line one\nLine two\; with\, punctuation` + "\r\n",
+		`LOCATION:1 Main St\, Fort Oak` + "\r\n",
+		`ATTENDEE;CN="Jane 'JJ' Smith";ROLE=REQ-PARTICIPANT;RSVP=FALSE:mailto:jane@example.com` + "\r\n",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in\n%s", want, out)
+		}
+	}
+}
+
+func TestEncodeAllDay(t *testing.T) {
+	cal := Calendar{Events: []Event{{
+		UID:    "block-1@example.com",
+		Start:  time.Date(2050, 1, 10, 0, 0, 0, 0, time.UTC),
+		End:    time.Date(2050, 1, 11, 0, 0, 0, 0, time.UTC),
+		AllDay: true,
+	}}}
+
+	out := string(cal.Bytes())
+	if !strings.Contains(out, "DTSTART;VALUE=DATE:20500110\r\n") || !strings.Contains(out, "DTEND;VALUE=DATE:20500111\r\n") {
+		t.Errorf("expected date values in\n%s", out)
+	}
+}
+
+func TestFold(t *testing.T) {
+	line := "DESCRIPTION:" + strings.Repeat("é", 100)
+	folded := fold(line)
+
+	for _, l := range strings.Split(folded, "\r\n") {
+		if len(l) > 75 {
+			t.Errorf("line is %d octets long", len(l))
+		}
+		if !strings.HasPrefix(l, "DESCRIPTION") && !strings.HasPrefix(l, " ") {
+			t.Errorf("continuation line %q does not start with a space", l)
+		}
+	}
+
+	if strings.ReplaceAll(folded, "\r\n ", "") != line {
+		t.Error("expected unfolding to give back the original line")
+	}
+}
+
+func TestDecode(t *testing.T) {
+	in := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"PRODID:-//Example//Bookings//EN",
+		"BEGIN:VEVENT",
+		"UID:abc-1@example.com",
+		"DTSTART;VALUE=DATE:20500110",
+		"DTEND;VALUE=DATE:20500113",
+		"SUMMARY:Reserved\\, by a",
+		"  guest",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:abc-2@example.com",
+		"DTSTART;TZID=\"America/New_York\":20500120T150000",
+		"DURATION:P2DT20H",
+		"STATUS:cancelled",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:abc-3@example.com",
+		"DTSTART:20500201",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"SUMMARY:No UID",
+		"DTSTART:20500201T100000Z",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+
+	events, err := Decode(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events but got %d", len(events))
+	}
+
+	if !events[0].AllDay || events[0].Summary != "Reserved, by a guest" {
+		t.Errorf("unexpected first event %+v", events[0])
+	}
+	if !events[0].End.Equal(time.Date(2050, 1, 13, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the first event to end on 2050-01-13 but got %s", events[0].End)
+	}
+
+	ny, _ := time.LoadLocation("America/New_York")
+	if !events[1].Start.Equal(time.Date(2050, 1, 20, 15, 0, 0, 0, ny)) {
+		t.Errorf("expected the second event to start in New York time but got %s", events[1].Start)
+	}
+	if !events[1].End.Equal(events[1].Start.Add(68*time.Hour)) || events[1].Status != StatusCancelled {
+		t.Errorf("unexpected second event %+v", events[1])
+	}
+
+	if !events[2].AllDay || !events[2].End.Equal(time.Date(2050, 2, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the third event to last one day but got %+v", events[2])
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	_, err := Decode(strings.NewReader("<html>not found</html>"))
+	if err != ErrNotCalendar {
+		t.Errorf("expected ErrNotCalendar but got %v", err)
+	}
+
+	_, err = Decode(strings.NewReader("BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:1\r\nDTSTART:tomorrow\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"))
+	if err == nil {
+		t.Error("expected an error for an invalid start")
+	}
+
+	_, err = Decode(strings.NewReader("BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:1\r\nDTSTART:20500110\r\nEND:VEVENT\r\nBEGIN:VEV"))
+	if err != ErrTruncated {
+		t.Errorf("expected ErrTruncated for a calendar that is cut off but got %v", err)
+	}
+}
+
+func TestDecodeRoundTrip(t *testing.T) {
+	cal := Calendar{Events: []Event{{
+		UID:     "block-1@example.com",
+		Start:   time.Date(2050, 1, 10, 0, 0, 0, 0, time.UTC),
+		End:     time.Date(2050, 1, 12, 0, 0, 0, 0, time.UTC),
+		AllDay:  true,
+		Summary: strings.Repeat("Not available; ", 10),
+	}}}
+
+	events, err := Decode(strings.NewReader(string(cal.Bytes())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Summary != cal.Events[0].Summary || !events[0].End.Equal(cal.Events[0].End) {
+		t.Errorf("expected the encoded event back but got %+v", events)
+	}
+}
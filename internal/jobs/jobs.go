@@ -0,0 +1,216 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Poojasadgir/room-reservation/internal/models"
+)
+
+// Store persists jobs so that their schedules survive restarts and each run is claimed by a single
+// app instance. The Postgres repository implements it.
+type Store interface {
+	// RegisterJob records a job, keeping its next run time unless its schedule changed
+	RegisterJob(name, schedule string, nextRunAt time.Time) error
+	// ClaimJob locks a job that is due at now for instance until lockedUntil. It returns false if the
+	// job is not due or another instance holds the lock.
+	ClaimJob(name, instance string, now, lockedUntil time.Time) (models.Job, bool, error)
+	// FinishJob records a run, releases the lock and sets when the job runs next
+	FinishJob(run models.JobRun, nextRunAt time.Time, attempts int) error
+}
+
+// Func is the work done by a job. It is passed the time the job was started.
+type Func func(now time.Time) error
+
+// DefaultMaxAttempts is how many times a failing run is tried before waiting for the next scheduled time
+const DefaultMaxAttempts = 3
+
+// DefaultLockFor is how long a claimed job is locked before another instance may assume it crashed and retry it
+const DefaultLockFor = 10 * time.Minute
+
+// Job is a unit of background work registered with a scheduler
+type Job struct {
+	Name        string
+	Spec        string
+	Schedule    Schedule
+	Run         Func
+	MaxAttempts int
+	LockFor     time.Duration
+}
+
+// Scheduler runs registered jobs when they fall due
+type Scheduler struct {
+	store    Store
+	instance string
+	tick     time.Duration
+	infoLog  *log.Logger
+	errorLog *log.Logger
+
+	mu   sync.Mutex
+	jobs []*Job
+	stop chan struct{}
+	done chan struct{}
+}
+
+// New creates a scheduler that persists its jobs in store. The instance name identifies this app
+// instance in job locks and run history.
+func New(store Store, instance string, infoLog, errorLog *log.Logger) *Scheduler {
+	return &Scheduler{
+		store:    store,
+		instance: instance,
+		tick:     time.Minute,
+		infoLog:  infoLog,
+		errorLog: errorLog,
+	}
+}
+
+// Register adds a job that runs fn on the schedule given by spec (see Parse), using the default retry settings
+func (s *Scheduler) Register(name, spec string, fn Func) error {
+	schedule, err := Parse(spec)
+	if err != nil {
+		return err
+	}
+
+	return s.Add(&Job{
+		Name:     name,
+		Spec:     spec,
+		Schedule: schedule,
+		Run:      fn,
+	})
+}
+
+// Add registers a job, recording it in the store so that it is scheduled from its next run time
+func (s *Scheduler) Add(job *Job) error {
+	if job.Name == "" || job.Schedule == nil || job.Run == nil {
+		return errors.New("a job needs a name, a schedule and a function to run")
+	}
+	if job.MaxAttempts < 1 {
+		job.MaxAttempts = DefaultMaxAttempts
+	}
+	if job.LockFor <= 0 {
+		job.LockFor = DefaultLockFor
+	}
+
+	err := s.store.RegisterJob(job.Name, job.Spec, job.Schedule.Next(time.Now()))
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.jobs = append(s.jobs, job)
+	s.mu.Unlock()
+	return nil
+}
+
+// Start checks for due jobs every minute until Stop is called
+func (s *Scheduler) Start() {
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+
+	go func() {
+		defer close(s.done)
+
+		ticker := time.NewTicker(s.tick)
+		defer ticker.Stop()
+
+		s.RunDue(time.Now())
+		for {
+			select {
+			case now := <-ticker.C:
+				s.RunDue(now)
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops checking for due jobs and waits for any running job to finish
+func (s *Scheduler) Stop() {
+	if s.stop == nil {
+		return
+	}
+	close(s.stop)
+	<-s.done
+}
+
+// RunDue runs every job that is due at now and not already claimed by another instance
+func (s *Scheduler) RunDue(now time.Time) {
+	s.mu.Lock()
+	jobs := make([]*Job, len(s.jobs))
+	copy(jobs, s.jobs)
+	s.mu.Unlock()
+
+	for _, job := range jobs {
+		claimed, ok, err := s.store.ClaimJob(job.Name, s.instance, now, now.Add(job.LockFor))
+		if err != nil {
+			s.errorLog.Printf("cannot claim job %s: %s", job.Name, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		s.runJob(job, claimed.Attempts+1, now)
+	}
+}
+
+// runJob runs one attempt at a claimed job and records the outcome. A failed attempt is retried with
+// backoff until the job's maximum attempts are used, after which the job waits for its next scheduled time.
+func (s *Scheduler) runJob(job *Job, attempt int, now time.Time) {
+	run := models.JobRun{
+		JobName:   job.Name,
+		Instance:  s.instance,
+		Attempt:   attempt,
+		StartedAt: time.Now(),
+		Status:    models.JobStatusSucceeded,
+	}
+
+	err := safeRun(job.Run, now)
+	run.FinishedAt = time.Now()
+
+	next := job.Schedule.Next(now)
+	attempts := 0
+	if err != nil {
+		run.Error = err.Error()
+		if attempt < job.MaxAttempts {
+			run.Status = models.JobStatusRetrying
+			next = now.Add(Backoff(attempt))
+			attempts = attempt
+		} else {
+			run.Status = models.JobStatusFailed
+		}
+		s.errorLog.Printf("job %s attempt %d %s: %s", job.Name, attempt, run.Status, err)
+	}
+
+	err = s.store.FinishJob(run, next, attempts)
+	if err != nil {
+		s.errorLog.Printf("cannot record run of job %s: %s", job.Name, err)
+	}
+}
+
+// safeRun runs a job function, turning a panic into an error so that one bad job cannot stop the scheduler
+func safeRun(fn Func, now time.Time) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn(now)
+}
+
+// Backoff returns how long to wait before retrying a job after the given failed attempt: a minute after
+// the first failure, doubling each time, up to an hour.
+func Backoff(attempt int) time.Duration {
+	d := time.Minute
+	for i := 1; i < attempt && d < time.Hour; i++ {
+		d *= 2
+	}
+	if d > time.Hour {
+		d = time.Hour
+	}
+	return d
+}
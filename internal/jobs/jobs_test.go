@@ -0,0 +1,182 @@
+package jobs
+
+import (
+	"errors"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/Poojasadgir/room-reservation/internal/models"
+)
+
+// memStore is an in-memory Store
+type memStore struct {
+	jobs map[string]*models.Job
+	runs []models.JobRun
+}
+
+func newMemStore() *memStore {
+	return &memStore{jobs: make(map[string]*models.Job)}
+}
+
+func (s *memStore) RegisterJob(name, schedule string, nextRunAt time.Time) error {
+	if j, ok := s.jobs[name]; ok && j.Schedule == schedule {
+		return nil
+	}
+	s.jobs[name] = &models.Job{Name: name, Schedule: schedule, NextRunAt: nextRunAt}
+	return nil
+}
+
+func (s *memStore) ClaimJob(name, instance string, now, lockedUntil time.Time) (models.Job, bool, error) {
+	j, ok := s.jobs[name]
+	if !ok || j.NextRunAt.After(now) || j.LockedUntil.After(now) {
+		return models.Job{}, false, nil
+	}
+	j.LockedBy = instance
+	j.LockedUntil = lockedUntil
+	return *j, true, nil
+}
+
+func (s *memStore) FinishJob(run models.JobRun, nextRunAt time.Time, attempts int) error {
+	j := s.jobs[run.JobName]
+	j.NextRunAt = nextRunAt
+	j.Attempts = attempts
+	j.LastStatus = run.Status
+	j.LastError = run.Error
+	j.LockedBy = ""
+	j.LockedUntil = time.Time{}
+	s.runs = append(s.runs, run)
+	return nil
+}
+
+func newTestScheduler(store Store, instance string) *Scheduler {
+	logger := log.New(io.Discard, "", 0)
+	return New(store, instance, logger, logger)
+}
+
+func TestRunDue(t *testing.T) {
+	store := newMemStore()
+	s := newTestScheduler(store, "a")
+
+	var runs int
+	err := s.Register("count", "@hourly", func(now time.Time) error {
+		runs++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	due := store.jobs["count"].NextRunAt
+	s.RunDue(due.Add(-time.Second))
+	if runs != 0 {
+		t.Errorf("expected job not to run before it is due, ran %d times", runs)
+	}
+
+	s.RunDue(due)
+	if runs != 1 {
+		t.Errorf("expected job to run once when due, ran %d times", runs)
+	}
+	if !store.jobs["count"].NextRunAt.Equal(due.Add(time.Hour)) {
+		t.Errorf("expected next run an hour later but got %s", store.jobs["count"].NextRunAt)
+	}
+	if store.jobs["count"].LastStatus != models.JobStatusSucceeded {
+		t.Errorf("expected status %s but got %s", models.JobStatusSucceeded, store.jobs["count"].LastStatus)
+	}
+}
+
+func TestRunDueOnce(t *testing.T) {
+	store := newMemStore()
+	a := newTestScheduler(store, "a")
+	b := newTestScheduler(store, "b")
+
+	var runs int
+	fn := func(now time.Time) error {
+		runs++
+		// while a is running, b finds the job locked
+		b.RunDue(now)
+		return nil
+	}
+	if err := a.Register("once", "@hourly", fn); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Register("once", "@hourly", fn); err != nil {
+		t.Fatal(err)
+	}
+
+	a.RunDue(store.jobs["once"].NextRunAt)
+	if runs != 1 {
+		t.Errorf("expected the job to run once across instances, ran %d times", runs)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	store := newMemStore()
+	s := newTestScheduler(store, "a")
+
+	var runs int
+	err := s.Register("flaky", "@daily", func(now time.Time) error {
+		runs++
+		if runs == 3 {
+			panic("boom")
+		}
+		return errors.New("failed")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := store.jobs["flaky"].NextRunAt
+	s.RunDue(now)
+	job := store.jobs["flaky"]
+	if job.LastStatus != models.JobStatusRetrying || job.Attempts != 1 {
+		t.Errorf("expected a retry after the first failure, got status %s attempts %d", job.LastStatus, job.Attempts)
+	}
+	if !job.NextRunAt.Equal(now.Add(time.Minute)) {
+		t.Errorf("expected a retry in a minute but got %s", job.NextRunAt)
+	}
+
+	now = job.NextRunAt
+	s.RunDue(now)
+	if !job.NextRunAt.Equal(now.Add(2 * time.Minute)) {
+		t.Errorf("expected a retry in two minutes but got %s", job.NextRunAt)
+	}
+
+	now = job.NextRunAt
+	s.RunDue(now)
+	if job.LastStatus != models.JobStatusFailed || job.Attempts != 0 {
+		t.Errorf("expected the job to fail after three attempts, got status %s attempts %d", job.LastStatus, job.Attempts)
+	}
+	if job.LastError != "panic: boom" {
+		t.Errorf("expected the panic to be recorded but got %q", job.LastError)
+	}
+	if job.NextRunAt.Sub(now) < 23*time.Hour {
+		t.Errorf("expected the job to wait for its next scheduled run but got %s", job.NextRunAt)
+	}
+	if len(store.runs) != 3 {
+		t.Errorf("expected 3 recorded runs but got %d", len(store.runs))
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	expected := []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute}
+	for i, d := range expected {
+		if Backoff(i+1) != d {
+			t.Errorf("attempt %d: expected %s but got %s", i+1, d, Backoff(i+1))
+		}
+	}
+	if Backoff(20) != time.Hour {
+		t.Errorf("expected backoff capped at an hour but got %s", Backoff(20))
+	}
+}
+
+func TestRegisterInvalid(t *testing.T) {
+	s := newTestScheduler(newMemStore(), "a")
+	if err := s.Register("bad", "not a schedule", func(time.Time) error { return nil }); err == nil {
+		t.Error("expected an error for an invalid schedule")
+	}
+	if err := s.Register("nil", "@daily", nil); err == nil {
+		t.Error("expected an error for a missing function")
+	}
+}
@@ -0,0 +1,79 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+)
+
+var from = time.Date(2050, 1, 10, 10, 30, 15, 0, time.UTC) // a Monday
+
+var nextTests = []struct {
+	name     string
+	spec     string
+	expected time.Time
+}{
+	{"every-minute", "* * * * *", time.Date(2050, 1, 10, 10, 31, 0, 0, time.UTC)},
+	{"hourly", "@hourly", time.Date(2050, 1, 10, 11, 0, 0, 0, time.UTC)},
+	{"daily", "@daily", time.Date(2050, 1, 11, 0, 0, 0, 0, time.UTC)},
+	{"later-today", "45 10 * * *", time.Date(2050, 1, 10, 10, 45, 0, 0, time.UTC)},
+	{"tomorrow-morning", "0 7 * * *", time.Date(2050, 1, 11, 7, 0, 0, 0, time.UTC)},
+	{"every-quarter-hour", "*/15 * * * *", time.Date(2050, 1, 10, 10, 45, 0, 0, time.UTC)},
+	{"list", "5,35 * * * *", time.Date(2050, 1, 10, 10, 35, 0, 0, time.UTC)},
+	{"range", "0 9-17 * * *", time.Date(2050, 1, 10, 11, 0, 0, 0, time.UTC)},
+	{"weekday", "0 9 * * 5", time.Date(2050, 1, 14, 9, 0, 0, 0, time.UTC)},
+	{"sunday-as-seven", "0 9 * * 7", time.Date(2050, 1, 16, 9, 0, 0, 0, time.UTC)},
+	{"day-of-month", "0 0 1 * *", time.Date(2050, 2, 1, 0, 0, 0, 0, time.UTC)},
+	{"month", "0 0 1 6 *", time.Date(2050, 6, 1, 0, 0, 0, 0, time.UTC)},
+	{"day-of-month-or-week", "0 0 20 * 2", time.Date(2050, 1, 11, 0, 0, 0, 0, time.UTC)},
+	{"leap-day", "0 0 29 2 *", time.Date(2052, 2, 29, 0, 0, 0, 0, time.UTC)},
+	{"interval", "@every 90m", time.Date(2050, 1, 10, 12, 0, 15, 0, time.UTC)},
+}
+
+func TestNext(t *testing.T) {
+	for _, e := range nextTests {
+		schedule, err := Parse(e.spec)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", e.name, err)
+			continue
+		}
+
+		next := schedule.Next(from)
+		if !next.Equal(e.expected) {
+			t.Errorf("%s: expected %s but got %s", e.name, e.expected, next)
+		}
+	}
+}
+
+var invalidSpecs = []string{
+	"",
+	"* * * *",
+	"60 * * * *",
+	"* 24 * * *",
+	"* * 0 * *",
+	"* * * 13 *",
+	"* * * * 8",
+	"*/0 * * * *",
+	"5-1 * * * *",
+	"a * * * *",
+	"@every soon",
+	"@every 10s",
+	"@fortnightly",
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, spec := range invalidSpecs {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("expected an error parsing %q", spec)
+		}
+	}
+}
+
+func TestNeverMatches(t *testing.T) {
+	schedule, err := Parse("0 0 31 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !schedule.Next(from).IsZero() {
+		t.Error("expected no next run for the 31st of February")
+	}
+}
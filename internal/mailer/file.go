@@ -0,0 +1,59 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// File writes each email to a maildir instead of sending it, so that development machines need no mail
+// server. The directory can be opened with any maildir-aware mail client, and each file is a complete
+// RFC 5322 message.
+type File struct {
+	dir      string
+	hostname string
+	count    uint64
+}
+
+// NewFile creates a file transport writing to the maildir at dir, creating its tmp, new and cur
+// subdirectories if needed
+func NewFile(dir string) (*File, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("the file mail transport needs a directory")
+	}
+
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		err := os.MkdirAll(filepath.Join(dir, sub), 0o755)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+
+	return &File{dir: dir, hostname: hostname}, nil
+}
+
+// Send writes a message into the maildir's new directory. It is written to tmp first and then moved,
+// as the maildir format requires, so a reader never sees a partly written message.
+func (f *File) Send(msg Message) error {
+	email, err := compose(msg)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%d.%d_%d.%s", time.Now().UnixNano(), os.Getpid(), atomic.AddUint64(&f.count, 1), f.hostname)
+	tmp := filepath.Join(f.dir, "tmp", name)
+
+	err = os.WriteFile(tmp, []byte(email.GetMessage()), 0o644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, filepath.Join(f.dir, "new", name))
+}
@@ -0,0 +1,100 @@
+package mailer
+
+import (
+	"fmt"
+	"time"
+
+	mail "github.com/xhit/go-simple-mail/v2"
+)
+
+// Mailer delivers an email. The transport used is chosen by configuration, see New.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// Message is a fully rendered email ready to be delivered
+type Message struct {
+	From    string
+	To      string
+	Subject string
+	// HTML is the HTML body
+	HTML string
+	// Text is the plain-text alternative to the HTML body, if any
+	Text        string
+	Attachments []Attachment
+}
+
+// Attachment is a file attached to an email
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// Transports that can be selected in Config
+const (
+	TransportSMTP   = "smtp"
+	TransportFile   = "file"
+	TransportMemory = "memory"
+)
+
+// Encryption settings for the SMTP transport
+const (
+	EncryptionNone     = "none"
+	EncryptionSTARTTLS = "starttls"
+	EncryptionTLS      = "tls"
+)
+
+// Config selects and configures a mail transport
+type Config struct {
+	Transport string
+
+	// SMTP settings
+	Host       string
+	Port       int
+	Username   string
+	Password   string
+	Encryption string
+	KeepAlive  bool
+	Timeout    time.Duration
+
+	// Dir is the maildir the file transport writes to
+	Dir string
+}
+
+// New returns the Mailer for the transport named in cfg
+func New(cfg Config) (Mailer, error) {
+	switch cfg.Transport {
+	case TransportSMTP, "":
+		return NewSMTP(cfg)
+	case TransportFile:
+		return NewFile(cfg.Dir)
+	case TransportMemory:
+		return NewMemory(), nil
+	default:
+		return nil, fmt.Errorf("unknown mail transport %q", cfg.Transport)
+	}
+}
+
+// compose builds the MIME email for a message. When the message has a plain-text body it is sent
+// as a multipart/alternative email with the HTML as the preferred part.
+func compose(msg Message) (*mail.Email, error) {
+	email := mail.NewMSG()
+	email.SetFrom(msg.From).AddTo(msg.To).SetSubject(msg.Subject)
+
+	if msg.Text == "" {
+		email.SetBody(mail.TextHTML, msg.HTML)
+	} else {
+		email.SetBody(mail.TextPlain, msg.Text)
+		email.AddAlternative(mail.TextHTML, msg.HTML)
+	}
+
+	for _, a := range msg.Attachments {
+		email.Attach(&mail.File{Name: a.Filename, MimeType: a.ContentType, Data: a.Data})
+	}
+
+	if email.Error != nil {
+		return nil, email.Error
+	}
+	return email, nil
+}
@@ -0,0 +1,108 @@
+package mailer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var testMessage = Message{
+	From:    "me@here.com",
+	To:      "guest@example.com",
+	Subject: "Reservation Confirmation",
+	HTML:    "<strong>Hello</strong>",
+	Text:    "Hello",
+	Attachments: []Attachment{
+		{Filename: "invite.ics", ContentType: "text/calendar; charset=utf-8; method=REQUEST", Data: []byte("BEGIN:VCALENDAR")},
+	},
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       Config
+		expectErr bool
+	}{
+		{"default-smtp", Config{Host: "localhost", Port: 1025}, false},
+		{"starttls", Config{Transport: TransportSMTP, Host: "localhost", Port: 587, Encryption: EncryptionSTARTTLS}, false},
+		{"bad-encryption", Config{Transport: TransportSMTP, Encryption: "ssl3"}, true},
+		{"file", Config{Transport: TransportFile, Dir: t.TempDir()}, false},
+		{"file-without-dir", Config{Transport: TransportFile}, true},
+		{"memory", Config{Transport: TransportMemory}, false},
+		{"unknown", Config{Transport: "pigeon"}, true},
+	}
+
+	for _, e := range tests {
+		_, err := New(e.cfg)
+		if e.expectErr && err == nil {
+			t.Errorf("%s: expected an error but got none", e.name)
+		}
+		if !e.expectErr && err != nil {
+			t.Errorf("%s: unexpected error %s", e.name, err)
+		}
+	}
+}
+
+func TestMemory(t *testing.T) {
+	m := NewMemory()
+
+	err := m.Send(testMessage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.Send(Message{From: "me@here.com", To: "not an address"})
+	if err == nil {
+		t.Error("expected an error sending to an invalid address")
+	}
+
+	messages := m.Messages()
+	if len(messages) != 1 || messages[0].Subject != testMessage.Subject {
+		t.Errorf("expected the one valid message to be recorded but got %v", messages)
+	}
+
+	m.Reset()
+	if len(m.Messages()) != 0 {
+		t.Error("expected no messages after reset")
+	}
+}
+
+func TestFile(t *testing.T) {
+	dir := t.TempDir()
+
+	f, err := NewFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = f.Send(testMessage)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "new", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("expected one message in the maildir but found %d", len(files))
+	}
+
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := string(data)
+
+	for _, want := range []string{"Subject: Reservation Confirmation", "multipart/alternative", "text/plain", "text/html", "<strong>Hello</strong>", "multipart/mixed", `filename="invite.ics"`} {
+		if !strings.Contains(raw, want) {
+			t.Errorf("expected the message to contain %q", want)
+		}
+	}
+
+	leftover, _ := filepath.Glob(filepath.Join(dir, "tmp", "*"))
+	if len(leftover) != 0 {
+		t.Errorf("expected tmp to be empty but found %d files", len(leftover))
+	}
+}
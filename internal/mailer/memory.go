@@ -0,0 +1,44 @@
+package mailer
+
+import "sync"
+
+// Memory keeps sent emails in memory so that tests can check what would have been sent
+type Memory struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+// NewMemory creates an empty in-memory transport
+func NewMemory() *Memory {
+	return &Memory{}
+}
+
+// Send records a message
+func (m *Memory) Send(msg Message) error {
+	_, err := compose(msg)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// Messages returns the messages sent so far, oldest first
+func (m *Memory) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	messages := make([]Message, len(m.messages))
+	copy(messages, m.messages)
+	return messages
+}
+
+// Reset forgets the messages sent so far
+func (m *Memory) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = nil
+}
@@ -0,0 +1,104 @@
+package mailer
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	mail "github.com/xhit/go-simple-mail/v2"
+)
+
+// DefaultTimeout is used for connecting and sending when the config does not set a timeout
+const DefaultTimeout = 10 * time.Second
+
+// SMTP delivers email through an SMTP server. With keep-alive on, one connection is opened and
+// reused for every message, and reopened if the server drops it.
+type SMTP struct {
+	server *mail.SMTPServer
+
+	mu     sync.Mutex
+	client *mail.SMTPClient
+}
+
+// NewSMTP creates an SMTP transport from the SMTP settings in cfg
+func NewSMTP(cfg Config) (*SMTP, error) {
+	server := mail.NewSMTPClient()
+	server.Host = cfg.Host
+	server.Port = cfg.Port
+	server.Username = cfg.Username
+	server.Password = cfg.Password
+	server.KeepAlive = cfg.KeepAlive
+
+	switch cfg.Encryption {
+	case EncryptionNone, "":
+		server.Encryption = mail.EncryptionNone
+	case EncryptionSTARTTLS:
+		server.Encryption = mail.EncryptionSTARTTLS
+	case EncryptionTLS:
+		server.Encryption = mail.EncryptionSSLTLS
+	default:
+		return nil, fmt.Errorf("unknown SMTP encryption %q", cfg.Encryption)
+	}
+
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	server.ConnectTimeout = timeout
+	server.SendTimeout = timeout
+
+	return &SMTP{server: server}, nil
+}
+
+// Send delivers a message through the SMTP server
+func (s *SMTP) Send(msg Message) error {
+	email, err := compose(msg)
+	if err != nil {
+		return err
+	}
+
+	if !s.server.KeepAlive {
+		client, err := s.server.Connect()
+		if err != nil {
+			return err
+		}
+		return email.Send(client)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.client != nil && s.client.Noop() != nil {
+		s.client.Close()
+		s.client = nil
+	}
+	if s.client == nil {
+		s.client, err = s.server.Connect()
+		if err != nil {
+			return err
+		}
+	}
+
+	err = email.Send(s.client)
+	if err != nil {
+		// start again with a fresh connection next time rather than reuse one in an unknown state
+		s.client.Close()
+		s.client = nil
+		return err
+	}
+	return nil
+}
+
+// Close closes the connection kept open between messages, if any
+func (s *SMTP) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.client == nil {
+		return nil
+	}
+	s.client.Quit()
+	err := s.client.Close()
+	s.client = nil
+	return err
+}
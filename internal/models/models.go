@@ -1,6 +1,7 @@
 package models
 
 import (
+	"fmt"
 	"time"
 )
 
@@ -18,10 +19,15 @@ type User struct {
 
 // Room is the room model
 type Room struct {
-	ID        int
-	RoomName  string
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID                   int
+	RoomName             string
+	NightlyRate          int
+	CancellationPolicyID int
+	HousekeepingStatus   string
+	ICalToken            string
+	ICalShowGuests       bool
+	CreatedAt            time.Time
+	UpdatedAt            time.Time
 }
 
 // Restriction is the restriction model
@@ -32,22 +38,75 @@ type Restriction struct {
 	UpdatedAt       time.Time
 }
 
+// Reservation statuses
+const (
+	ReservationStatusConfirmed  = "confirmed"
+	ReservationStatusCheckedIn  = "checked_in"
+	ReservationStatusCheckedOut = "checked_out"
+	ReservationStatusNoShow     = "no_show"
+	ReservationStatusCancelled  = "cancelled"
+)
+
 // Reservation is the reservation model
 type Reservation struct {
-	ID        int
-	FirstName string
-	LastName  string
-	Email     string
-	Phone     string
+	ID               int
+	FirstName        string
+	LastName         string
+	Email            string
+	Phone            string
+	StartDate        time.Time
+	EndDate          time.Time
+	RoomID           int
+	GuestID          int
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	Processed        int
+	Status           string
+	CancelToken      string
+	CancelledAt      time.Time
+	CancelledBy      string
+	CancellationFee  int
+	CheckedInAt      time.Time
+	CheckedOutAt     time.Time
+	IDVerified       bool
+	NoShowAt         time.Time
+	NoShowFee        int
+	ICalSequence     int
+	ChannelID        int
+	ChannelBookingID string
+	ImportBatchID    int
+	Version          int
+	Tags             []string
+	Answers          []ReservationAnswer
+	Room             Room
+	Segments         []StaySegment
+}
+
+// Split reports whether the stay is split across rooms
+func (r Reservation) Split() bool {
+	return len(r.Segments) > 1
+}
+
+// StaySegment is the part of a split stay spent in one room. Each segment is held by its own room
+// restriction, and the guest moves to the next segment's room on the day the segment ends.
+type StaySegment struct {
+	RoomID    int
 	StartDate time.Time
 	EndDate   time.Time
-	RoomID    int
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	Processed int
 	Room      Room
 }
 
+// ReservationNote is an internal staff note on a reservation
+type ReservationNote struct {
+	ID            int
+	ReservationID int
+	UserID        int
+	AuthorName    string
+	Body          string
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
 // RoomRestriction is the room restriction model
 type RoomRestriction struct {
 	ID            int
@@ -56,6 +115,8 @@ type RoomRestriction struct {
 	RoomID        int
 	ReservationID int
 	RestrictionID int
+	ImportID      int
+	ExternalUID   string
 	CreatedAt     time.Time
 	UpdatedAt     time.Time
 	Room          Room
@@ -63,11 +124,457 @@ type RoomRestriction struct {
 	Restriction   Restriction
 }
 
+// MovesIn reports whether the restriction is a segment of a split stay that the guest moves into from
+// another room. It relies on the reservation's dates having been loaded with the restriction.
+func (r RoomRestriction) MovesIn() bool {
+	return r.ReservationID > 0 && !r.Reservation.StartDate.IsZero() && r.StartDate.After(r.Reservation.StartDate)
+}
+
+// MovesOut reports whether the restriction is a segment of a split stay that the guest leaves for another
+// room. The restrictions of guests who left early also end before their reservation, so only stays that
+// are still to come or under way are counted.
+func (r RoomRestriction) MovesOut() bool {
+	return r.ReservationID > 0 && r.EndDate.Before(r.Reservation.EndDate) &&
+		(r.Reservation.Status == ReservationStatusConfirmed || r.Reservation.Status == ReservationStatusCheckedIn)
+}
+
+// Guest is the guest profile model. Reservations are linked to a guest by email address.
+type Guest struct {
+	ID          int
+	FirstName   string
+	LastName    string
+	Email       string
+	Phone       string
+	Notes       string
+	Preferences string
+	Stays       int
+	TotalNights int
+	LastStay    time.Time
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// Booking question kinds
+const (
+	QuestionKindText     = "text"
+	QuestionKindChoice   = "choice"
+	QuestionKindCheckbox = "checkbox"
+)
+
+// BookingQuestion is an extra question asked on the reservation form. A question without a
+// room ID is asked for every room.
+type BookingQuestion struct {
+	ID        int
+	RoomID    int
+	Label     string
+	Kind      string
+	Choices   []string
+	Required  bool
+	SortOrder int
+	Active    bool
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// FieldName returns the name of the form field used for the question on the reservation form
+func (q BookingQuestion) FieldName() string {
+	return fmt.Sprintf("question_%d", q.ID)
+}
+
+// ReservationAnswer is a guest's answer to a booking question. The question label is copied so
+// answers still read correctly after a question is edited or removed.
+type ReservationAnswer struct {
+	ID            int
+	ReservationID int
+	QuestionID    int
+	Label         string
+	Answer        string
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// CancellationPolicy is the cancellation policy model. Fees are charged once
+// the free cancellation window before arrival has passed.
+type CancellationPolicy struct {
+	ID                    int
+	PolicyName            string
+	Description           string
+	FreeCancellationHours int
+	FeeNights             int
+	FeePercent            int
+	NoShowFeeNights       int
+	ReleaseNoShows        bool
+	CreatedAt             time.Time
+	UpdatedAt             time.Time
+}
+
 // MailData holds an email and msg
 type MailData struct {
-	To       string
-	From     string
-	Subject  string
-	Content  string
-	Template string
+	To      string
+	From    string
+	Subject string
+	// Content is the HTML body
+	Content string
+	// Text is the plain-text alternative to the HTML body
+	Text string
+	// Template is the name of the email template the message was rendered from
+	Template    string
+	Attachments []MailAttachment
+}
+
+// MailAttachment is a file attached to an email
+type MailAttachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// Housekeeping statuses of a room
+const (
+	HousekeepingClean        = "clean"
+	HousekeepingDirty        = "dirty"
+	HousekeepingInspected    = "inspected"
+	HousekeepingOutOfService = "out_of_service"
+)
+
+// Housekeeping task kinds and statuses
+const (
+	TaskKindDeparture = "departure"
+	TaskKindStayOver  = "stay_over"
+	TaskStatusOpen    = "open"
+	TaskStatusDone    = "done"
+)
+
+// HousekeepingTask is a room to be cleaned on a given day
+type HousekeepingTask struct {
+	ID              int
+	RoomID          int
+	ReservationID   int
+	TaskDate        time.Time
+	Kind            string
+	Status          string
+	CompletedAt     time.Time
+	CompletedBy     int
+	CompletedByName string
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	Room            Room
+}
+
+// Outcomes of a background job run
+const (
+	JobStatusSucceeded = "succeeded"
+	JobStatusRetrying  = "retrying"
+	JobStatusFailed    = "failed"
+)
+
+// Job is a scheduled background job and the state of its last run
+type Job struct {
+	ID          int
+	Name        string
+	Schedule    string
+	NextRunAt   time.Time
+	LockedBy    string
+	LockedUntil time.Time
+	Attempts    int
+	LastRunAt   time.Time
+	LastStatus  string
+	LastError   string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// JobRun records one attempt at running a background job
+type JobRun struct {
+	ID         int
+	JobName    string
+	Instance   string
+	Attempt    int
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Status     string
+	Error      string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// Outbox message statuses
+const (
+	OutboxPending = "pending"
+	OutboxSent    = "sent"
+	OutboxDead    = "dead"
+)
+
+// OutboxMessage is an email waiting in, or delivered from, the outbound mail queue
+type OutboxMessage struct {
+	ID int
+	MailData
+	Status        string
+	Attempts      int
+	NextAttemptAt time.Time
+	LastError     string
+	SentAt        time.Time
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// CalendarImport is an external calendar, fetched from a URL or uploaded as a file, whose events block a room
+type CalendarImport struct {
+	ID           int
+	RoomID       int
+	Name         string
+	URL          string
+	Content      string
+	LastSyncedAt time.Time
+	LastError    string
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Room         Room
+	Conflicts    []CalendarImportConflict
+}
+
+// CalendarImportConflict is an imported event that overlaps a reservation already made for the room
+type CalendarImportConflict struct {
+	ID            int
+	ImportID      int
+	ExternalUID   string
+	Summary       string
+	StartDate     time.Time
+	EndDate       time.Time
+	ReservationID int
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	Reservation   Reservation
+}
+
+// CalendarImportSync is the set of changes that brings the blocks imported from a calendar in line with it
+type CalendarImportSync struct {
+	ImportID int
+	Create   []RoomRestriction
+	Update   []RoomRestriction
+	// Delete holds the IDs of the room restrictions to remove
+	Delete    []int
+	Conflicts []CalendarImportConflict
+	SyncedAt  time.Time
+}
+
+// Webhook delivery statuses
+const (
+	WebhookPending   = "pending"
+	WebhookDelivered = "delivered"
+	WebhookDead      = "dead"
+)
+
+// WebhookEndpoint is an external URL that is sent the events it subscribes to
+type WebhookEndpoint struct {
+	ID          int
+	URL         string
+	Description string
+	Secret      string
+	Events      []string
+	Active      bool
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// Subscribes reports whether the endpoint is sent an event
+func (e WebhookEndpoint) Subscribes(event string) bool {
+	for _, ev := range e.Events {
+		if ev == event {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery is one event queued for, or delivered to, a webhook endpoint
+type WebhookDelivery struct {
+	ID            int
+	EndpointID    int
+	Event         string
+	Payload       string
+	Status        string
+	Attempts      int
+	NextAttemptAt time.Time
+	ResponseCode  int
+	LastError     string
+	DeliveredAt   time.Time
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	Endpoint      WebhookEndpoint
+}
+
+// Channel sync operations
+const (
+	ChannelPushAvailability = "push_availability"
+	ChannelPushRates        = "push_rates"
+	ChannelPushRestrictions = "push_restrictions"
+	ChannelPullBookings     = "pull_bookings"
+)
+
+// Channel sync statuses. A pending push is superseded when a newer push of the same kind is queued.
+const (
+	ChannelSyncPending    = "pending"
+	ChannelSyncSucceeded  = "succeeded"
+	ChannelSyncFailed     = "failed"
+	ChannelSyncSuperseded = "superseded"
+)
+
+// Channel is an external distribution channel, such as an online travel agency, that rooms are sold on
+type Channel struct {
+	ID           int
+	Name         string
+	Kind         string
+	BaseURL      string
+	APIKey       string
+	Active       bool
+	LastPulledAt time.Time
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Mappings     []ChannelRoomMapping
+}
+
+// RoomCode returns the channel's code for a room, or nothing if the room is not sold on the channel
+func (c Channel) RoomCode(roomID int) string {
+	for _, m := range c.Mappings {
+		if m.RoomID == roomID {
+			return m.RoomCode
+		}
+	}
+	return ""
+}
+
+// ChannelRoomMapping links one of our rooms to the code a channel knows it by
+type ChannelRoomMapping struct {
+	ID        int
+	ChannelID int
+	RoomID    int
+	RoomCode  string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Room      Room
+}
+
+// ChannelSync is a push queued for, or made to, a channel, or a record of bookings pulled from it
+type ChannelSync struct {
+	ID            int
+	ChannelID     int
+	Operation     string
+	Payload       string
+	Status        string
+	Attempts      int
+	NextAttemptAt time.Time
+	Summary       string
+	LastError     string
+	FinishedAt    time.Time
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	Channel       Channel
+}
+
+// RoomOccupancy is how a room's nights over a date range were used
+type RoomOccupancy struct {
+	RoomID        int
+	RoomName      string
+	NightlyRate   int
+	NightsSold    int
+	NightsBlocked int
+}
+
+// DailyOccupancy is how many rooms were reserved and blocked on a night
+type DailyOccupancy struct {
+	Date         time.Time
+	RoomsSold    int
+	RoomsBlocked int
+}
+
+// StayStatistics summarises the reservations arriving over a date range. Nights and lead days are totals
+// over the reservations that were not cancelled.
+type StayStatistics struct {
+	Reservations  int
+	Cancellations int
+	StayNights    int
+	LeadDays      int
+}
+
+// OccupancyReport is what the rooms were used for over the nights from Start up to, but not including, End
+type OccupancyReport struct {
+	Start time.Time
+	End   time.Time
+	Rooms []RoomOccupancy
+	Daily []DailyOccupancy
+	Stays StayStatistics
+}
+
+// ImportBatch is a file of reservations imported together, so they can be removed again together
+type ImportBatch struct {
+	ID           int
+	FileName     string
+	UserID       int
+	Reservations int
+	RevertedAt   time.Time
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	User         User
+}
+
+// The columns a reservation list can be sorted by
+const (
+	ReservationSortArrival   = "arrival"
+	ReservationSortDeparture = "departure"
+	ReservationSortID        = "id"
+	ReservationSortName      = "name"
+	ReservationSortRoom      = "room"
+	ReservationSortStatus    = "status"
+	ReservationSortBooked    = "booked"
+)
+
+// ReservationQuery selects, orders and pages a list of reservations. Zero values do not filter: Search
+// matches any part of a guest's name, email address or phone number, or a reservation id, and the stay
+// must overlap the nights from From up to, but not including, To when they are set. Sort is one of the
+// ReservationSort columns and defaults to arrival. Page counts from 1; PerPage of 0 returns every row.
+type ReservationQuery struct {
+	NewOnly bool
+	Search  string
+	Tag     string
+	RoomID  int
+	Status  string
+	From    time.Time
+	To      time.Time
+	Sort    string
+	Desc    bool
+	Page    int
+	PerPage int
+}
+
+// ReservationPage is a page of a reservation list, with the number of reservations on every page
+type ReservationPage struct {
+	Reservations []Reservation
+	Total        int
+	Page         int
+	PerPage      int
+}
+
+// Pages returns the number of pages in the list, which is always at least one
+func (p ReservationPage) Pages() int {
+	if p.PerPage == 0 || p.Total == 0 {
+		return 1
+	}
+	return (p.Total + p.PerPage - 1) / p.PerPage
+}
+
+// First returns the position in the list of the first reservation on the page, counting from 1
+func (p ReservationPage) First() int {
+	if len(p.Reservations) == 0 {
+		return 0
+	}
+	return (p.Page-1)*p.PerPage + 1
+}
+
+// Last returns the position in the list of the last reservation on the page
+func (p ReservationPage) Last() int {
+	if len(p.Reservations) == 0 {
+		return 0
+	}
+	return p.First() + len(p.Reservations) - 1
 }
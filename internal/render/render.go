@@ -22,6 +22,7 @@ var functions = template.FuncMap{
 	"formatDate": FormatDate,
 	"iterate":    Iterate,
 	"add":        Add,
+	"currency":   FormatCurrency,
 }
 
 // NewRenderer creates a new renderer with the given AppConfig.
@@ -141,3 +142,13 @@ func Iterate(count int) []int {
 func Add(a, b int) int {
 	return a + b
 }
+
+// FormatCurrency formats an amount in cents as dollars, e.g. 12550 becomes "$125.50".
+func FormatCurrency(cents int) string {
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s$%d.%02d", sign, cents/100, cents%100)
+}
@@ -0,0 +1,153 @@
+package reports
+
+import (
+	"math"
+
+	"github.com/Poojasadgir/room-reservation/internal/models"
+)
+
+// Metrics are the occupancy and revenue figures for a date range, as shown on the dashboard and served as
+// JSON. Percentages run from 0 to 100, and money is in cents. Revenue is worked out from each room's
+// nightly rate, so ADR and RevPAR are only given when at least one room has a rate.
+type Metrics struct {
+	Start            string        `json:"start"`
+	End              string        `json:"end"`
+	Nights           int           `json:"nights"`
+	NightsAvailable  int           `json:"nights_available"`
+	NightsSold       int           `json:"nights_sold"`
+	NightsBlocked    int           `json:"nights_blocked"`
+	Occupancy        float64       `json:"occupancy"`
+	Reservations     int           `json:"reservations"`
+	Cancellations    int           `json:"cancellations"`
+	CancellationRate float64       `json:"cancellation_rate"`
+	AverageStay      float64       `json:"average_stay"`
+	AverageLeadTime  float64       `json:"average_lead_time"`
+	Priced           bool          `json:"priced"`
+	Revenue          int           `json:"revenue,omitempty"`
+	ADR              int           `json:"adr,omitempty"`
+	RevPAR           int           `json:"revpar,omitempty"`
+	Rooms            []RoomMetrics `json:"rooms"`
+	Daily            []DayMetrics  `json:"daily"`
+}
+
+// RoomMetrics are the figures for one room
+type RoomMetrics struct {
+	RoomID          int     `json:"room_id"`
+	RoomName        string  `json:"room_name"`
+	NightsAvailable int     `json:"nights_available"`
+	NightsSold      int     `json:"nights_sold"`
+	NightsBlocked   int     `json:"nights_blocked"`
+	Occupancy       float64 `json:"occupancy"`
+	Revenue         int     `json:"revenue,omitempty"`
+	ADR             int     `json:"adr,omitempty"`
+	RevPAR          int     `json:"revpar,omitempty"`
+}
+
+// DayMetrics are the figures for one night
+type DayMetrics struct {
+	Date         string  `json:"date"`
+	RoomsSold    int     `json:"rooms_sold"`
+	RoomsBlocked int     `json:"rooms_blocked"`
+	Occupancy    float64 `json:"occupancy"`
+}
+
+// Summarize works out the metrics for an occupancy report. A blocked night takes the room off sale, so it
+// is not counted as available; the rest of the room's nights in the range are. A night that is both sold
+// and blocked, such as a block imported over a reservation, counts only as sold. Stay length and lead time
+// are averaged over the reservations arriving in the range that were not cancelled, and the cancellation
+// rate is the share of those arrivals that were.
+func Summarize(report models.OccupancyReport) Metrics {
+	nights := int(report.End.Sub(report.Start).Hours() / 24)
+
+	m := Metrics{
+		Start:         report.Start.Format("2006-01-02"),
+		End:           report.End.Format("2006-01-02"),
+		Nights:        nights,
+		Reservations:  report.Stays.Reservations,
+		Cancellations: report.Stays.Cancellations,
+		Rooms:         []RoomMetrics{},
+		Daily:         []DayMetrics{},
+	}
+
+	for _, ro := range report.Rooms {
+		blocked := clamp(ro.NightsBlocked, nights-ro.NightsSold)
+
+		rm := RoomMetrics{
+			RoomID:          ro.RoomID,
+			RoomName:        ro.RoomName,
+			NightsAvailable: nights - blocked,
+			NightsSold:      ro.NightsSold,
+			NightsBlocked:   blocked,
+			Revenue:         ro.NightsSold * ro.NightlyRate,
+		}
+		rm.Occupancy = percent(rm.NightsSold, rm.NightsAvailable)
+		rm.ADR = divide(rm.Revenue, rm.NightsSold)
+		rm.RevPAR = divide(rm.Revenue, rm.NightsAvailable)
+
+		m.NightsAvailable += rm.NightsAvailable
+		m.NightsSold += rm.NightsSold
+		m.NightsBlocked += rm.NightsBlocked
+		m.Revenue += rm.Revenue
+		if ro.NightlyRate > 0 {
+			m.Priced = true
+		}
+		m.Rooms = append(m.Rooms, rm)
+	}
+
+	m.Occupancy = percent(m.NightsSold, m.NightsAvailable)
+	if m.Priced {
+		m.ADR = divide(m.Revenue, m.NightsSold)
+		m.RevPAR = divide(m.Revenue, m.NightsAvailable)
+	}
+
+	stays := report.Stays.Reservations - report.Stays.Cancellations
+	m.CancellationRate = percent(report.Stays.Cancellations, report.Stays.Reservations)
+	if stays > 0 {
+		m.AverageStay = round(float64(report.Stays.StayNights) / float64(stays))
+		m.AverageLeadTime = round(float64(report.Stays.LeadDays) / float64(stays))
+	}
+
+	for _, d := range report.Daily {
+		blocked := clamp(d.RoomsBlocked, len(report.Rooms)-d.RoomsSold)
+		m.Daily = append(m.Daily, DayMetrics{
+			Date:         d.Date.Format("2006-01-02"),
+			RoomsSold:    d.RoomsSold,
+			RoomsBlocked: blocked,
+			Occupancy:    percent(d.RoomsSold, len(report.Rooms)-blocked),
+		})
+	}
+
+	return m
+}
+
+// clamp returns n, kept between 0 and max
+func clamp(n, max int) int {
+	if n > max {
+		n = max
+	}
+	if n < 0 {
+		n = 0
+	}
+	return n
+}
+
+// percent returns n as a percentage of total, to one decimal place
+func percent(n, total int) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return round(float64(n) * 100 / float64(total))
+}
+
+// divide returns n divided by d to the nearest whole number, or 0 when d is 0
+func divide(n, d int) int {
+	if d <= 0 {
+		return 0
+	}
+	return int(math.Round(float64(n) / float64(d)))
+}
+
+// round rounds to one decimal place
+func round(f float64) float64 {
+	return math.Round(f*10) / 10
+}
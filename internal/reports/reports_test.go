@@ -0,0 +1,120 @@
+package reports
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Poojasadgir/room-reservation/internal/models"
+)
+
+func date(s string) time.Time {
+	t, _ := time.Parse("2006-01-02", s)
+	return t
+}
+
+func TestSummarize(t *testing.T) {
+	report := models.OccupancyReport{
+		Start: date("2050-01-01"),
+		End:   date("2050-01-11"),
+		Rooms: []models.RoomOccupancy{
+			{RoomID: 1, RoomName: "A", NightlyRate: 10000, NightsSold: 6, NightsBlocked: 2},
+			{RoomID: 2, RoomName: "B", NightlyRate: 20000, NightsSold: 3},
+		},
+		Daily: []models.DailyOccupancy{
+			{Date: date("2050-01-01"), RoomsSold: 1, RoomsBlocked: 1},
+			{Date: date("2050-01-02"), RoomsSold: 2},
+			{Date: date("2050-01-03")},
+		},
+		Stays: models.StayStatistics{Reservations: 4, Cancellations: 1, StayNights: 9, LeadDays: 20},
+	}
+
+	m := Summarize(report)
+
+	if m.Start != "2050-01-01" || m.End != "2050-01-11" || m.Nights != 10 {
+		t.Errorf("unexpected range %s to %s, %d nights", m.Start, m.End, m.Nights)
+	}
+	if m.NightsAvailable != 18 || m.NightsSold != 9 || m.NightsBlocked != 2 {
+		t.Errorf("expected 18 nights available, 9 sold and 2 blocked but got %d, %d and %d", m.NightsAvailable, m.NightsSold, m.NightsBlocked)
+	}
+	if m.Occupancy != 50 {
+		t.Errorf("expected 50%% occupancy but got %v", m.Occupancy)
+	}
+	if !m.Priced || m.Revenue != 120000 || m.ADR != 13333 || m.RevPAR != 6667 {
+		t.Errorf("expected revenue 120000, ADR 13333 and RevPAR 6667 but got %d, %d and %d", m.Revenue, m.ADR, m.RevPAR)
+	}
+	if m.CancellationRate != 25 || m.AverageStay != 3 || m.AverageLeadTime != 6.7 {
+		t.Errorf("expected 25%% cancelled, 3 night stays and 6.7 days lead time but got %v, %v and %v", m.CancellationRate, m.AverageStay, m.AverageLeadTime)
+	}
+
+	if len(m.Rooms) != 2 {
+		t.Fatalf("expected 2 rooms but got %d", len(m.Rooms))
+	}
+	if a := m.Rooms[0]; a.NightsAvailable != 8 || a.Occupancy != 75 || a.Revenue != 60000 || a.ADR != 10000 || a.RevPAR != 7500 {
+		t.Errorf("unexpected figures for room A %+v", a)
+	}
+	if b := m.Rooms[1]; b.NightsAvailable != 10 || b.Occupancy != 30 {
+		t.Errorf("unexpected figures for room B %+v", b)
+	}
+
+	wantDaily := []float64{100, 100, 0}
+	for i, d := range m.Daily {
+		if d.Occupancy != wantDaily[i] {
+			t.Errorf("day %s: expected %v%% occupancy but got %v", d.Date, wantDaily[i], d.Occupancy)
+		}
+	}
+}
+
+func TestSummarizeWithoutPricesOrStays(t *testing.T) {
+	report := models.OccupancyReport{
+		Start: date("2050-01-01"),
+		End:   date("2050-01-03"),
+		Rooms: []models.RoomOccupancy{{RoomID: 1, RoomName: "A", NightsBlocked: 5}},
+	}
+
+	m := Summarize(report)
+
+	if m.Priced || m.ADR != 0 || m.RevPAR != 0 {
+		t.Errorf("expected no prices but got %+v", m)
+	}
+	if m.Rooms[0].NightsAvailable != 0 || m.Occupancy != 0 {
+		t.Errorf("expected a fully blocked room to have no nights available but got %+v", m.Rooms[0])
+	}
+	if m.AverageStay != 0 || m.AverageLeadTime != 0 || m.CancellationRate != 0 {
+		t.Errorf("expected no stay figures without reservations but got %+v", m)
+	}
+}
+
+func TestSummarizeBlockOverReservation(t *testing.T) {
+	// room A has a block imported over its 4 night reservation, and room B a 2 night block besides its sale
+	report := models.OccupancyReport{
+		Start: date("2050-01-01"),
+		End:   date("2050-01-05"),
+		Rooms: []models.RoomOccupancy{
+			{RoomID: 1, RoomName: "A", NightlyRate: 10000, NightsSold: 4, NightsBlocked: 4},
+			{RoomID: 2, RoomName: "B", NightlyRate: 10000, NightsSold: 1, NightsBlocked: 2},
+		},
+		Daily: []models.DailyOccupancy{
+			{Date: date("2050-01-01"), RoomsSold: 2, RoomsBlocked: 2},
+			{Date: date("2050-01-02"), RoomsSold: 1, RoomsBlocked: 2},
+		},
+	}
+
+	m := Summarize(report)
+
+	if a := m.Rooms[0]; a.NightsBlocked != 0 || a.NightsAvailable != 4 || a.Occupancy != 100 {
+		t.Errorf("expected room A to be sold every night rather than blocked but got %+v", a)
+	}
+	if b := m.Rooms[1]; b.NightsBlocked != 2 || b.NightsAvailable != 2 || b.Occupancy != 50 {
+		t.Errorf("expected room B to have 2 of its nights blocked but got %+v", b)
+	}
+	if m.Occupancy != 83.3 {
+		t.Errorf("expected 83.3%% occupancy but got %v", m.Occupancy)
+	}
+
+	wantDaily := []float64{100, 100}
+	for i, d := range m.Daily {
+		if d.Occupancy != wantDaily[i] {
+			t.Errorf("day %s: expected %v%% occupancy but got %v", d.Date, wantDaily[i], d.Occupancy)
+		}
+	}
+}
@@ -2,11 +2,18 @@ package dbrepo
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Poojasadgir/room-reservation/internal/models"
+	"github.com/Poojasadgir/room-reservation/internal/repository"
+	"github.com/jackc/pgconn"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -14,17 +21,36 @@ func (m *postgresDBRepo) AllUsers() bool {
 	return true
 }
 
+// nullableID converts a zero foreign key into NULL so optional references can be stored
+func nullableID(id int) interface{} {
+	if id > 0 {
+		return id
+	}
+	return nil
+}
+
 // InsertReservation inserts a new reservation into the database and returns the ID of the new reservation.
 // It takes a Reservation struct as input and returns an integer ID and an error if any.
 func (m *postgresDBRepo) InsertReservation(res models.Reservation) (int, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
+	return insertReservation(ctx, m.DB, res)
+}
+
+// insertReservation inserts a reservation using q, which may be the database or a transaction
+func insertReservation(ctx context.Context, q queryer, res models.Reservation) (int, error) {
 	var newID int
-	query := `INSERT INTO reservations (first_name, last_name, email, phone, start_date, end_date, room_id, created_at, updated_at)
-	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id`
+	status := res.Status
+	if status == "" {
+		status = models.ReservationStatusConfirmed
+	}
 
-	err := m.DB.QueryRowContext(ctx, query,
+	query := `INSERT INTO reservations (first_name, last_name, email, phone, start_date, end_date, room_id, status, cancel_token, guest_id,
+	channel_id, channel_booking_id, processed, import_batch_id, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16) RETURNING id`
+
+	err := q.QueryRowContext(ctx, query,
 		res.FirstName,
 		res.LastName,
 		res.Email,
@@ -32,6 +58,13 @@ func (m *postgresDBRepo) InsertReservation(res models.Reservation) (int, error)
 		res.StartDate,
 		res.EndDate,
 		res.RoomID,
+		status,
+		res.CancelToken,
+		nullableID(res.GuestID),
+		nullableID(res.ChannelID),
+		res.ChannelBookingID,
+		res.Processed,
+		nullableID(res.ImportBatchID),
 		time.Now(),
 		time.Now(),
 	).Scan(&newID)
@@ -47,9 +80,14 @@ func (m *postgresDBRepo) InsertRoomRestriction(rest models.RoomRestriction) erro
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
+	return insertRoomRestriction(ctx, m.DB, rest)
+}
+
+// insertRoomRestriction inserts a room restriction using q, which may be the database or a transaction
+func insertRoomRestriction(ctx context.Context, q queryer, rest models.RoomRestriction) error {
 	query := `INSERT INTO room_restrictions (start_date, end_date, room_id, reservation_id, restriction_id, created_at, updated_at)
 	VALUES ($1, $2, $3, $4, $5, $6, $7)`
-	_, err := m.DB.ExecContext(ctx, query,
+	_, err := q.ExecContext(ctx, query,
 		rest.StartDate,
 		rest.EndDate,
 		rest.RoomID,
@@ -122,11 +160,17 @@ func (m *postgresDBRepo) GetRoomByID(id int) (models.Room, error) {
 
 	var room models.Room
 
-	query := `SELECT id, room_name, created_at, updated_at FROM rooms WHERE id = $1`
+	query := `SELECT id, room_name, nightly_rate, COALESCE(cancellation_policy_id, 0), housekeeping_status, ical_token, ical_show_guests, created_at, updated_at
+	FROM rooms WHERE id = $1`
 	row := m.DB.QueryRowContext(ctx, query, id)
 	err := row.Scan(
 		&room.ID,
 		&room.RoomName,
+		&room.NightlyRate,
+		&room.CancellationPolicyID,
+		&room.HousekeepingStatus,
+		&room.ICalToken,
+		&room.ICalShowGuests,
 		&room.CreatedAt,
 		&room.UpdatedAt,
 	)
@@ -206,67 +250,133 @@ func (m *postgresDBRepo) Authenticate(email, testPassword string) (int, string,
 	return id, hashedPassword, nil
 }
 
-// AllReservations returns a slice of all reservations
-func (m *postgresDBRepo) AllReservations() ([]models.Reservation, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+// reservationTagsColumn selects a reservation's tags as a comma separated list
+const reservationTagsColumn = `COALESCE((SELECT string_agg(t.tag, ',' ORDER BY t.tag) FROM reservation_tags t WHERE t.reservation_id = r.id), '')`
 
-	var reservations []models.Reservation
+// reservationTagFilter limits a reservation query to reservations carrying the tag in $1, unless it is empty
+const reservationTagFilter = `($1 = '' OR EXISTS (SELECT 1 FROM reservation_tags t WHERE t.reservation_id = r.id AND lower(t.tag) = lower($1)))`
 
-	query := `SELECT r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date, r.room_id, r.created_at, r.updated_at, r.processed, rm.id, rm.room_name FROM reservations r 
-	LEFT JOIN rooms rm ON (r.room_id = rm.id) 
-	ORDER BY r.start_date ASC`
+// splitTags splits a comma separated list of tags
+func splitTags(tags string) []string {
+	if tags == "" {
+		return nil
+	}
+	return strings.Split(tags, ",")
+}
 
-	rows, err := m.DB.QueryContext(ctx, query)
+// reservationSortColumns maps the columns a reservation list can be sorted by to what it is ordered by
+var reservationSortColumns = map[string]string{
+	models.ReservationSortArrival:   "r.start_date",
+	models.ReservationSortDeparture: "r.end_date",
+	models.ReservationSortID:        "r.id",
+	models.ReservationSortName:      "lower(r.last_name), lower(r.first_name)",
+	models.ReservationSortRoom:      "rm.room_name",
+	models.ReservationSortStatus:    "r.status",
+	models.ReservationSortBooked:    "r.created_at",
+}
+
+// reservationListFrom selects the reservations of a list along with their rooms
+const reservationListFrom = ` FROM reservations r
+	LEFT JOIN rooms rm ON (r.room_id = rm.id)
+	WHERE ($2 = false OR (r.processed = 0 AND r.status <> 'cancelled')) AND ` + reservationTagFilter + `
+	AND ($3 = '' OR r.first_name || ' ' || r.last_name ILIKE $3 OR r.email ILIKE $3 OR r.phone ILIKE $3 OR r.id = $4)
+	AND ($5 = 0 OR r.room_id = $5)
+	AND ($6 = '' OR r.status = $6)
+	AND ($7::date IS NULL OR r.end_date > $7)
+	AND ($8::date IS NULL OR r.start_date < $8)`
+
+// reservationListArgs returns the arguments of reservationListFrom for a query
+func reservationListArgs(q models.ReservationQuery) []interface{} {
+	search := strings.TrimSpace(q.Search)
+	id, _ := strconv.Atoi(strings.TrimPrefix(search, "#"))
+	if search != "" {
+		search = "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(search) + "%"
+	}
+	return []interface{}{q.Tag, q.NewOnly, search, id, q.RoomID, q.Status, nullableDate(q.From), nullableDate(q.To)}
+}
+
+// nullableDate converts a zero date into NULL
+func nullableDate(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
+
+// reservationListOrder orders a reservation list by one of the columns it can be sorted by, then by id so
+// that pages do not overlap
+func reservationListOrder(q models.ReservationQuery) string {
+	column, ok := reservationSortColumns[q.Sort]
+	if !ok {
+		column = reservationSortColumns[models.ReservationSortArrival]
+	}
+	dir := " ASC"
+	if q.Desc {
+		dir = " DESC"
+	}
+	return " ORDER BY " + strings.ReplaceAll(column, ",", dir+",") + dir + ", r.id" + dir
+}
+
+// FindReservations returns the page of the reservations selected by q that it asks for, along with how many
+// reservations there are on every page. A page past the end returns the last page.
+func (m *postgresDBRepo) FindReservations(q models.ReservationQuery) (models.ReservationPage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	page := models.ReservationPage{PerPage: q.PerPage}
+	args := reservationListArgs(q)
+
+	err := m.DB.QueryRowContext(ctx, `SELECT COUNT(r.id)`+reservationListFrom, args...).Scan(&page.Total)
 	if err != nil {
-		return reservations, err
+		return page, err
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		var i models.Reservation
-		err := rows.Scan(
-			&i.ID,
-			&i.FirstName,
-			&i.LastName,
-			&i.Email,
-			&i.Phone,
-			&i.StartDate,
-			&i.EndDate,
-			&i.RoomID,
-			&i.CreatedAt,
-			&i.UpdatedAt,
-			&i.Processed,
-			&i.Room.ID,
-			&i.Room.RoomName,
-		)
-		if err != nil {
-			return reservations, err
-		}
-		reservations = append(reservations, i)
+	page.Page = q.Page
+	if page.Page > page.Pages() {
+		page.Page = page.Pages()
 	}
-	if err = rows.Err(); err != nil {
-		return reservations, err
+	if page.Page < 1 {
+		page.Page = 1
 	}
 
-	return reservations, nil
+	limit := "NULL"
+	if q.PerPage > 0 {
+		limit = strconv.Itoa(q.PerPage)
+	}
+	offset := strconv.Itoa((page.Page - 1) * q.PerPage)
+
+	err = eachReservation(ctx, m.DB, q, " LIMIT "+limit+" OFFSET "+offset, func(res models.Reservation) error {
+		page.Reservations = append(page.Reservations, res)
+		return nil
+	})
+	if err != nil {
+		return page, err
+	}
+
+	return page, nil
 }
 
-// AllNewReservations returns a slice of all new reservations
-func (m *postgresDBRepo) AllNewReservations() ([]models.Reservation, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// EachReservation calls fn with every reservation selected by q, in its order, as it is read, so that long
+// lists can be streamed without holding them in memory. The page asked for is ignored. An error from fn stops
+// the iteration and is returned.
+func (m *postgresDBRepo) EachReservation(q models.ReservationQuery, fn func(models.Reservation) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
 	defer cancel()
 
-	var reservations []models.Reservation
+	return eachReservation(ctx, m.DB, q, "", fn)
+}
 
-	query := `SELECT r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date, r.room_id, r.created_at, r.updated_at, rm.id, rm.room_name FROM reservations r 
-	LEFT JOIN rooms rm ON (r.room_id = rm.id)
-	WHERE processed = 0 
-	ORDER BY r.start_date ASC`
+// eachReservation runs a reservation list query, with page limiting which of its rows are read
+func eachReservation(ctx context.Context, db *sql.DB, rq models.ReservationQuery, page string, fn func(models.Reservation) error) error {
+	var tags string
 
-	rows, err := m.DB.QueryContext(ctx, query)
+	query := `SELECT r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date, r.room_id, r.created_at, r.updated_at, r.processed,
+	r.status, r.cancellation_fee, r.no_show_fee, r.channel_booking_id, rm.id, rm.room_name, rm.nightly_rate, ` + reservationTagsColumn +
+		reservationListFrom + reservationListOrder(rq) + page
+
+	rows, err := db.QueryContext(ctx, query, reservationListArgs(rq)...)
 	if err != nil {
-		return reservations, err
+		return err
 	}
 	defer rows.Close()
 
@@ -283,30 +393,43 @@ func (m *postgresDBRepo) AllNewReservations() ([]models.Reservation, error) {
 			&i.RoomID,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.Processed,
+			&i.Status,
+			&i.CancellationFee,
+			&i.NoShowFee,
+			&i.ChannelBookingID,
 			&i.Room.ID,
 			&i.Room.RoomName,
+			&i.Room.NightlyRate,
+			&tags,
 		)
 		if err != nil {
-			return reservations, err
+			return err
+		}
+		i.Tags = splitTags(tags)
+
+		err = fn(i)
+		if err != nil {
+			return err
 		}
-		reservations = append(reservations, i)
-	}
-	if err = rows.Err(); err != nil {
-		return reservations, err
 	}
 
-	return reservations, nil
+	return rows.Err()
 }
 
-// GetReservationByID returns one reservation by ID
+// GetReservationByID returns one reservation by ID, with the rooms of its stay when it is split across rooms
 func (m *postgresDBRepo) GetReservationByID(id int) (models.Reservation, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
 	var res models.Reservation
+	var cancelledAt, checkedInAt, checkedOutAt, noShowAt sql.NullTime
 
 	query := `SELECT r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date, r.room_id, r.created_at, r.updated_at, r.processed, 
-	rm.id, rm.room_name FROM reservations r 
+	r.status, r.cancel_token, r.cancelled_at, r.cancelled_by, r.cancellation_fee, COALESCE(r.guest_id, 0),
+	r.checked_in_at, r.checked_out_at, r.id_verified, r.no_show_at, r.no_show_fee, r.ical_sequence,
+	COALESCE(r.channel_id, 0), r.channel_booking_id, r.version,
+	rm.id, rm.room_name, rm.nightly_rate, COALESCE(rm.cancellation_policy_id, 0) FROM reservations r 
 	LEFT JOIN rooms rm ON (r.room_id = rm.id)
 	WHERE r.id = $1`
 
@@ -323,34 +446,140 @@ func (m *postgresDBRepo) GetReservationByID(id int) (models.Reservation, error)
 		&res.CreatedAt,
 		&res.UpdatedAt,
 		&res.Processed,
+		&res.Status,
+		&res.CancelToken,
+		&cancelledAt,
+		&res.CancelledBy,
+		&res.CancellationFee,
+		&res.GuestID,
+		&checkedInAt,
+		&checkedOutAt,
+		&res.IDVerified,
+		&noShowAt,
+		&res.NoShowFee,
+		&res.ICalSequence,
+		&res.ChannelID,
+		&res.ChannelBookingID,
+		&res.Version,
 		&res.Room.ID,
 		&res.Room.RoomName,
+		&res.Room.NightlyRate,
+		&res.Room.CancellationPolicyID,
 	)
 	if err != nil {
 		return res, err
 	}
+	res.CancelledAt = cancelledAt.Time
+	res.CheckedInAt = checkedInAt.Time
+	res.CheckedOutAt = checkedOutAt.Time
+	res.NoShowAt = noShowAt.Time
+
+	res.Segments, err = staySegments(ctx, m.DB, id)
+	if err != nil {
+		return res, err
+	}
 
 	return res, nil
 }
 
-// UpdateReservation updates a reservation in the database
+// staySegments returns the rooms of a reservation's stay in date order when it is split across rooms, or
+// nothing when the whole stay is in one room
+func staySegments(ctx context.Context, db *sql.DB, reservationID int) ([]models.StaySegment, error) {
+	query := `SELECT rr.room_id, rr.start_date, rr.end_date, rm.room_name, rm.nightly_rate
+	FROM room_restrictions rr
+	LEFT JOIN rooms rm ON (rm.id = rr.room_id)
+	WHERE rr.reservation_id = $1
+	ORDER BY rr.start_date`
+
+	rows, err := db.QueryContext(ctx, query, reservationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var segments []models.StaySegment
+	for rows.Next() {
+		var s models.StaySegment
+		err = rows.Scan(&s.RoomID, &s.StartDate, &s.EndDate, &s.Room.RoomName, &s.Room.NightlyRate)
+		if err != nil {
+			return nil, err
+		}
+		s.Room.ID = s.RoomID
+		segments = append(segments, s)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(segments) < 2 {
+		return nil, nil
+	}
+	return segments, nil
+}
+
+// UpdateReservation updates a reservation's guest details in the database and links it to the guest with its
+// email address, as long as no one else has saved it since it was loaded with res.Version. Otherwise nothing
+// is written and it returns a *repository.ConflictError holding the reservation and its tags as they now stand.
 func (m *postgresDBRepo) UpdateReservation(res models.Reservation) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	query := `UPDATE reservations SET first_name = $1, last_name = $2, email = $3, phone = $4, updated_at = $5 WHERE id = $6`
-	_, err := m.DB.ExecContext(ctx, query,
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE reservations SET first_name = $1, last_name = $2, email = $3, phone = $4, updated_at = $5,
+	version = version + 1 WHERE id = $6 AND version = $7`
+	result, err := tx.ExecContext(ctx, query,
 		res.FirstName,
 		res.LastName,
 		res.Email,
 		res.Phone,
 		time.Now(),
 		res.ID,
+		res.Version,
 	)
 	if err != nil {
 		return err
 	}
-	return nil
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		tx.Rollback()
+		current, err := m.GetReservationByID(res.ID)
+		if err != nil {
+			return err
+		}
+		current.Tags, err = m.GetTagsForReservation(res.ID)
+		if err != nil {
+			return err
+		}
+		return &repository.ConflictError{Current: current}
+	}
+
+	if res.Email != "" {
+		guestID, err := findOrCreateGuest(ctx, tx, models.Guest{
+			FirstName: res.FirstName,
+			LastName:  res.LastName,
+			Email:     res.Email,
+			Phone:     res.Phone,
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE reservations SET guest_id = $1 WHERE id = $2`, guestID, res.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
 }
 
 // DeleteReservation deletes one reservation by id
@@ -389,7 +618,8 @@ func (m *postgresDBRepo) AllRooms() ([]models.Room, error) {
 
 	var rooms []models.Room
 
-	query := `select id, room_name, created_at, updated_at from rooms order by room_name`
+	query := `select id, room_name, nightly_rate, COALESCE(cancellation_policy_id, 0), housekeeping_status, ical_token, ical_show_guests, created_at, updated_at
+	from rooms order by room_name`
 
 	rows, err := m.DB.QueryContext(ctx, query)
 	if err != nil {
@@ -402,6 +632,11 @@ func (m *postgresDBRepo) AllRooms() ([]models.Room, error) {
 		err := rows.Scan(
 			&rm.ID,
 			&rm.RoomName,
+			&rm.NightlyRate,
+			&rm.CancellationPolicyID,
+			&rm.HousekeepingStatus,
+			&rm.ICalToken,
+			&rm.ICalShowGuests,
 			&rm.CreatedAt,
 			&rm.UpdatedAt,
 		)
@@ -456,19 +691,21 @@ func (m *postgresDBRepo) GetRestrictionsForRoomByDate(roomID int, start, end tim
 	return restrictions, nil
 }
 
-// InsertBlockForRoom inserts a room restriction
-func (m *postgresDBRepo) InsertBlockForRoom(id int, startDate time.Time) error {
+// InsertBlockForRoom inserts a room restriction, returning its id
+func (m *postgresDBRepo) InsertBlockForRoom(id int, startDate time.Time) (int, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	query := `INSERT INTO room_restrictions (start_date, end_date, room_id, restriction_id, created_at, updated_at) values ($1, $2, $3, $4, $5, $6)`
+	var newID int
+
+	query := `INSERT INTO room_restrictions (start_date, end_date, room_id, restriction_id, created_at, updated_at) values ($1, $2, $3, $4, $5, $6) RETURNING id`
 
-	_, err := m.DB.ExecContext(ctx, query, startDate, startDate.AddDate(0, 0, 1), id, 2, time.Now(), time.Now())
+	err := m.DB.QueryRowContext(ctx, query, startDate, startDate.AddDate(0, 0, 1), id, 2, time.Now(), time.Now()).Scan(&newID)
 	if err != nil {
 		log.Println(err)
-		return err
+		return 0, err
 	}
-	return nil
+	return newID, nil
 }
 
 // DeleteBlockByID deletes a room restriction
@@ -485,3 +722,3144 @@ func (m *postgresDBRepo) DeleteBlockByID(id int) error {
 	}
 	return nil
 }
+
+// AllCancellationPolicies returns a slice of all cancellation policies
+func (m *postgresDBRepo) AllCancellationPolicies() ([]models.CancellationPolicy, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var policies []models.CancellationPolicy
+
+	query := `SELECT id, policy_name, description, free_cancellation_hours, fee_nights, fee_percent, no_show_fee_nights, release_no_shows, created_at, updated_at
+	FROM cancellation_policies ORDER BY policy_name`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return policies, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p models.CancellationPolicy
+		err := rows.Scan(
+			&p.ID,
+			&p.PolicyName,
+			&p.Description,
+			&p.FreeCancellationHours,
+			&p.FeeNights,
+			&p.FeePercent,
+			&p.NoShowFeeNights,
+			&p.ReleaseNoShows,
+			&p.CreatedAt,
+			&p.UpdatedAt,
+		)
+		if err != nil {
+			return policies, err
+		}
+		policies = append(policies, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return policies, err
+	}
+
+	return policies, nil
+}
+
+// GetCancellationPolicyByID returns one cancellation policy by ID
+func (m *postgresDBRepo) GetCancellationPolicyByID(id int) (models.CancellationPolicy, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var p models.CancellationPolicy
+
+	query := `SELECT id, policy_name, description, free_cancellation_hours, fee_nights, fee_percent, no_show_fee_nights, release_no_shows, created_at, updated_at
+	FROM cancellation_policies WHERE id = $1`
+
+	row := m.DB.QueryRowContext(ctx, query, id)
+	err := row.Scan(
+		&p.ID,
+		&p.PolicyName,
+		&p.Description,
+		&p.FreeCancellationHours,
+		&p.FeeNights,
+		&p.FeePercent,
+		&p.NoShowFeeNights,
+		&p.ReleaseNoShows,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+	)
+	if err != nil {
+		return p, err
+	}
+
+	return p, nil
+}
+
+// InsertCancellationPolicy inserts a new cancellation policy and returns its ID
+func (m *postgresDBRepo) InsertCancellationPolicy(p models.CancellationPolicy) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var newID int
+	query := `INSERT INTO cancellation_policies (policy_name, description, free_cancellation_hours, fee_nights, fee_percent, no_show_fee_nights, release_no_shows, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id`
+
+	err := m.DB.QueryRowContext(ctx, query,
+		p.PolicyName,
+		p.Description,
+		p.FreeCancellationHours,
+		p.FeeNights,
+		p.FeePercent,
+		p.NoShowFeeNights,
+		p.ReleaseNoShows,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+	return newID, nil
+}
+
+// UpdateCancellationPolicy updates a cancellation policy in the database
+func (m *postgresDBRepo) UpdateCancellationPolicy(p models.CancellationPolicy) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `UPDATE cancellation_policies SET policy_name = $1, description = $2, free_cancellation_hours = $3, fee_nights = $4, fee_percent = $5,
+	no_show_fee_nights = $6, release_no_shows = $7, updated_at = $8
+	WHERE id = $9`
+	_, err := m.DB.ExecContext(ctx, query,
+		p.PolicyName,
+		p.Description,
+		p.FreeCancellationHours,
+		p.FeeNights,
+		p.FeePercent,
+		p.NoShowFeeNights,
+		p.ReleaseNoShows,
+		time.Now(),
+		p.ID,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// UpdateRoomCancellationPolicy sets the nightly rate and cancellation policy for a room.
+// A policyID of 0 detaches the room from any policy.
+func (m *postgresDBRepo) UpdateRoomCancellationPolicy(roomID, policyID, nightlyRate int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `UPDATE rooms SET cancellation_policy_id = $1, nightly_rate = $2, updated_at = $3 WHERE id = $4`
+	_, err := m.DB.ExecContext(ctx, query, nullableID(policyID), nightlyRate, time.Now(), roomID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// CancelReservation marks a reservation as cancelled, records the fee charged and who cancelled it,
+// releases the room restrictions held by the reservation and queues the cancellation notices, all in one transaction
+func (m *postgresDBRepo) CancelReservation(id, fee int, cancelledBy string, notices []models.MailData) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE reservations SET status = $1, cancelled_at = $2, cancelled_by = $3, cancellation_fee = $4,
+	ical_sequence = ical_sequence + 1, updated_at = $5 WHERE id = $6`
+	_, err = tx.ExecContext(ctx, query,
+		models.ReservationStatusCancelled,
+		time.Now(),
+		cancelledBy,
+		fee,
+		time.Now(),
+		id,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM room_restrictions WHERE reservation_id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	for _, msg := range notices {
+		err = insertOutbox(ctx, tx, msg)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// guestColumns selects a guest along with their lifetime stay totals, excluding cancelled reservations
+const guestColumns = `SELECT g.id, g.first_name, g.last_name, g.email, g.phone, g.notes, g.preferences, g.created_at, g.updated_at,
+	COUNT(r.id), COALESCE(SUM(r.end_date - r.start_date), 0), MAX(r.start_date)
+	FROM guests g
+	LEFT JOIN reservations r ON (r.guest_id = g.id AND r.status <> 'cancelled')`
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx, so that inserts can run inside or outside a transaction
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// scanGuest scans a row selected with guestColumns into a guest
+func scanGuest(scanner rowScanner) (models.Guest, error) {
+	var g models.Guest
+	var lastStay sql.NullTime
+
+	err := scanner.Scan(
+		&g.ID,
+		&g.FirstName,
+		&g.LastName,
+		&g.Email,
+		&g.Phone,
+		&g.Notes,
+		&g.Preferences,
+		&g.CreatedAt,
+		&g.UpdatedAt,
+		&g.Stays,
+		&g.TotalNights,
+		&lastStay,
+	)
+	g.LastStay = lastStay.Time
+	return g, err
+}
+
+// FindOrCreateGuest returns the ID of the guest with the given email address, creating the guest if
+// they are new. The details of an existing guest are left alone, since anyone can book with an email
+// address; staff change them through the guest's profile.
+func (m *postgresDBRepo) FindOrCreateGuest(g models.Guest) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return findOrCreateGuest(ctx, m.DB, g)
+}
+
+// findOrCreateGuest returns the ID of the guest with the given email address, creating the guest if they are new
+func findOrCreateGuest(ctx context.Context, q queryer, g models.Guest) (int, error) {
+	var id int
+	query := `INSERT INTO guests (first_name, last_name, email, phone, created_at, updated_at)
+	VALUES ($1, $2, lower(trim($3)), $4, $5, $6)
+	ON CONFLICT (email) DO NOTHING
+	RETURNING id`
+
+	err := q.QueryRowContext(ctx, query,
+		g.FirstName,
+		g.LastName,
+		g.Email,
+		g.Phone,
+		time.Now(),
+		time.Now(),
+	).Scan(&id)
+	if err == sql.ErrNoRows {
+		err = q.QueryRowContext(ctx, `SELECT id FROM guests WHERE email = lower(trim($1))`, g.Email).Scan(&id)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// AllGuests returns a slice of all guests with their lifetime stay totals
+func (m *postgresDBRepo) AllGuests() ([]models.Guest, error) {
+	var guests []models.Guest
+
+	err := m.EachGuest(func(g models.Guest) error {
+		guests = append(guests, g)
+		return nil
+	})
+	if err != nil {
+		return guests, err
+	}
+
+	return guests, nil
+}
+
+// EachGuest calls fn with each guest and their lifetime stay totals, in order of name, as it is read. An
+// error from fn stops the iteration and is returned.
+func (m *postgresDBRepo) EachGuest(fn func(models.Guest) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	query := guestColumns + ` GROUP BY g.id ORDER BY g.last_name, g.first_name`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		g, err := scanGuest(rows)
+		if err != nil {
+			return err
+		}
+
+		err = fn(g)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// GetGuestByID returns one guest by ID with their lifetime stay totals
+func (m *postgresDBRepo) GetGuestByID(id int) (models.Guest, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := guestColumns + ` WHERE g.id = $1 GROUP BY g.id`
+
+	return scanGuest(m.DB.QueryRowContext(ctx, query, id))
+}
+
+// PossibleDuplicateGuests returns other guests sharing a name or phone number with the given guest
+func (m *postgresDBRepo) PossibleDuplicateGuests(id int) ([]models.Guest, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var guests []models.Guest
+
+	query := guestColumns + `
+	JOIN guests o ON (o.id = $1)
+	WHERE g.id <> o.id
+	AND ((lower(g.first_name) = lower(o.first_name) AND lower(g.last_name) = lower(o.last_name))
+		OR (o.phone <> '' AND g.phone = o.phone))
+	GROUP BY g.id ORDER BY g.last_name, g.first_name`
+
+	rows, err := m.DB.QueryContext(ctx, query, id)
+	if err != nil {
+		return guests, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		g, err := scanGuest(rows)
+		if err != nil {
+			return guests, err
+		}
+		guests = append(guests, g)
+	}
+
+	if err = rows.Err(); err != nil {
+		return guests, err
+	}
+
+	return guests, nil
+}
+
+// GetReservationsForGuest returns the stay history of a guest, most recent first
+func (m *postgresDBRepo) GetReservationsForGuest(guestID int) ([]models.Reservation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var reservations []models.Reservation
+
+	query := `SELECT r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date, r.room_id, r.created_at, r.updated_at, r.processed, r.status, rm.id, rm.room_name FROM reservations r 
+	LEFT JOIN rooms rm ON (r.room_id = rm.id)
+	WHERE r.guest_id = $1
+	ORDER BY r.start_date DESC`
+
+	rows, err := m.DB.QueryContext(ctx, query, guestID)
+	if err != nil {
+		return reservations, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var i models.Reservation
+		err := rows.Scan(
+			&i.ID,
+			&i.FirstName,
+			&i.LastName,
+			&i.Email,
+			&i.Phone,
+			&i.StartDate,
+			&i.EndDate,
+			&i.RoomID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Processed,
+			&i.Status,
+			&i.Room.ID,
+			&i.Room.RoomName,
+		)
+		if err != nil {
+			return reservations, err
+		}
+		i.GuestID = guestID
+		reservations = append(reservations, i)
+	}
+	if err = rows.Err(); err != nil {
+		return reservations, err
+	}
+
+	return reservations, nil
+}
+
+// uniqueViolation is the Postgres error code for a row that breaks a unique index
+const uniqueViolation = "23505"
+
+// UpdateGuest updates a guest's contact details, notes and preferences. It returns
+// repository.ErrDuplicateEmail when another guest already has the email address.
+func (m *postgresDBRepo) UpdateGuest(g models.Guest) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `UPDATE guests SET first_name = $1, last_name = $2, email = lower(trim($3)), phone = $4, notes = $5, preferences = $6, updated_at = $7
+	WHERE id = $8`
+	_, err := m.DB.ExecContext(ctx, query,
+		g.FirstName,
+		g.LastName,
+		g.Email,
+		g.Phone,
+		g.Notes,
+		g.Preferences,
+		time.Now(),
+		g.ID,
+	)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return repository.ErrDuplicateEmail
+	}
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// MergeGuests moves every reservation of the duplicate guest onto the guest being kept, appends the
+// duplicate's notes and preferences, and then deletes the duplicate
+func (m *postgresDBRepo) MergeGuests(keepID, duplicateID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if keepID == duplicateID {
+		return errors.New("cannot merge a guest into themselves")
+	}
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `UPDATE reservations SET guest_id = $1, updated_at = $2 WHERE guest_id = $3`, keepID, time.Now(), duplicateID)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE guests k SET
+		notes = concat_ws(E'\n', NULLIF(k.notes, ''), NULLIF(d.notes, '')),
+		preferences = concat_ws(E'\n', NULLIF(k.preferences, ''), NULLIF(d.preferences, '')),
+		phone = COALESCE(NULLIF(k.phone, ''), d.phone),
+		updated_at = $1
+	FROM guests d
+	WHERE k.id = $2 AND d.id = $3`
+	_, err = tx.ExecContext(ctx, query, time.Now(), keepID, duplicateID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM guests WHERE id = $1`, duplicateID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetNotesForReservation returns the internal notes on a reservation, oldest first
+func (m *postgresDBRepo) GetNotesForReservation(reservationID int) ([]models.ReservationNote, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var notes []models.ReservationNote
+
+	query := `SELECT n.id, n.reservation_id, COALESCE(n.user_id, 0), COALESCE(u.first_name || ' ' || u.last_name, 'Unknown'), n.body, n.created_at, n.updated_at
+	FROM reservation_notes n
+	LEFT JOIN users u ON (n.user_id = u.id)
+	WHERE n.reservation_id = $1
+	ORDER BY n.created_at ASC`
+
+	rows, err := m.DB.QueryContext(ctx, query, reservationID)
+	if err != nil {
+		return notes, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var n models.ReservationNote
+		err := rows.Scan(
+			&n.ID,
+			&n.ReservationID,
+			&n.UserID,
+			&n.AuthorName,
+			&n.Body,
+			&n.CreatedAt,
+			&n.UpdatedAt,
+		)
+		if err != nil {
+			return notes, err
+		}
+		notes = append(notes, n)
+	}
+
+	if err = rows.Err(); err != nil {
+		return notes, err
+	}
+
+	return notes, nil
+}
+
+// InsertReservationNote adds an internal note to a reservation
+func (m *postgresDBRepo) InsertReservationNote(n models.ReservationNote) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `INSERT INTO reservation_notes (reservation_id, user_id, body, created_at, updated_at) VALUES ($1, $2, $3, $4, $5)`
+	_, err := m.DB.ExecContext(ctx, query,
+		n.ReservationID,
+		nullableID(n.UserID),
+		n.Body,
+		time.Now(),
+		time.Now(),
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetTagsForReservation returns the tags on a reservation in alphabetical order
+func (m *postgresDBRepo) GetTagsForReservation(reservationID int) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var tags []string
+
+	rows, err := m.DB.QueryContext(ctx, `SELECT tag FROM reservation_tags WHERE reservation_id = $1 ORDER BY tag`, reservationID)
+	if err != nil {
+		return tags, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return tags, err
+		}
+		tags = append(tags, tag)
+	}
+
+	if err = rows.Err(); err != nil {
+		return tags, err
+	}
+
+	return tags, nil
+}
+
+// SetReservationTags replaces the tags on a reservation
+func (m *postgresDBRepo) SetReservationTags(reservationID int, tags []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM reservation_tags WHERE reservation_id = $1`, reservationID)
+	if err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		_, err = tx.ExecContext(ctx, `INSERT INTO reservation_tags (reservation_id, tag, created_at, updated_at) VALUES ($1, $2, $3, $4)`,
+			reservationID, tag, time.Now(), time.Now())
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// AllTags returns every tag in use, in alphabetical order
+func (m *postgresDBRepo) AllTags() ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var tags []string
+
+	rows, err := m.DB.QueryContext(ctx, `SELECT DISTINCT tag FROM reservation_tags ORDER BY tag`)
+	if err != nil {
+		return tags, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return tags, err
+		}
+		tags = append(tags, tag)
+	}
+
+	if err = rows.Err(); err != nil {
+		return tags, err
+	}
+
+	return tags, nil
+}
+
+// splitChoices splits the choices of a booking question, stored one per line
+func splitChoices(choices string) []string {
+	var out []string
+	for _, c := range strings.Split(choices, "\n") {
+		if c = strings.TrimSpace(c); c != "" {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// queryBookingQuestions runs a query selecting booking questions and scans the results
+func (m *postgresDBRepo) queryBookingQuestions(ctx context.Context, query string, args ...interface{}) ([]models.BookingQuestion, error) {
+	var questions []models.BookingQuestion
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return questions, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var q models.BookingQuestion
+		var choices string
+		err := rows.Scan(
+			&q.ID,
+			&q.RoomID,
+			&q.Label,
+			&q.Kind,
+			&choices,
+			&q.Required,
+			&q.SortOrder,
+			&q.Active,
+			&q.CreatedAt,
+			&q.UpdatedAt,
+		)
+		if err != nil {
+			return questions, err
+		}
+		q.Choices = splitChoices(choices)
+		questions = append(questions, q)
+	}
+
+	if err = rows.Err(); err != nil {
+		return questions, err
+	}
+
+	return questions, nil
+}
+
+// AllBookingQuestions returns every booking question, active or not
+func (m *postgresDBRepo) AllBookingQuestions() ([]models.BookingQuestion, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT id, COALESCE(room_id, 0), label, kind, choices, required, sort_order, active, created_at, updated_at
+	FROM booking_questions ORDER BY sort_order, id`
+
+	return m.queryBookingQuestions(ctx, query)
+}
+
+// GetBookingQuestionsForRoom returns the active booking questions asked when booking a room,
+// including the questions asked for every room
+func (m *postgresDBRepo) GetBookingQuestionsForRoom(roomID int) ([]models.BookingQuestion, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT id, COALESCE(room_id, 0), label, kind, choices, required, sort_order, active, created_at, updated_at
+	FROM booking_questions WHERE active AND (room_id IS NULL OR room_id = $1) ORDER BY sort_order, id`
+
+	return m.queryBookingQuestions(ctx, query, roomID)
+}
+
+// InsertBookingQuestion inserts a new booking question and returns its ID
+func (m *postgresDBRepo) InsertBookingQuestion(q models.BookingQuestion) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var newID int
+	query := `INSERT INTO booking_questions (room_id, label, kind, choices, required, sort_order, active, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id`
+
+	err := m.DB.QueryRowContext(ctx, query,
+		nullableID(q.RoomID),
+		q.Label,
+		q.Kind,
+		strings.Join(q.Choices, "\n"),
+		q.Required,
+		q.SortOrder,
+		q.Active,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+	return newID, nil
+}
+
+// UpdateBookingQuestion updates a booking question in the database
+func (m *postgresDBRepo) UpdateBookingQuestion(q models.BookingQuestion) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `UPDATE booking_questions SET room_id = $1, label = $2, kind = $3, choices = $4, required = $5, sort_order = $6, active = $7, updated_at = $8
+	WHERE id = $9`
+	_, err := m.DB.ExecContext(ctx, query,
+		nullableID(q.RoomID),
+		q.Label,
+		q.Kind,
+		strings.Join(q.Choices, "\n"),
+		q.Required,
+		q.SortOrder,
+		q.Active,
+		time.Now(),
+		q.ID,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// InsertReservationAnswers stores a guest's answers to the booking questions for a reservation
+func (m *postgresDBRepo) InsertReservationAnswers(reservationID int, answers []models.ReservationAnswer) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return insertReservationAnswers(ctx, m.DB, reservationID, answers)
+}
+
+// insertReservationAnswers inserts booking question answers using q, which may be the database or a transaction
+func insertReservationAnswers(ctx context.Context, q queryer, reservationID int, answers []models.ReservationAnswer) error {
+	query := `INSERT INTO reservation_answers (reservation_id, question_id, label, answer, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6)`
+	for _, a := range answers {
+		_, err := q.ExecContext(ctx, query,
+			reservationID,
+			nullableID(a.QuestionID),
+			a.Label,
+			a.Answer,
+			time.Now(),
+			time.Now(),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetAnswersForReservation returns the answers given to booking questions for a reservation
+func (m *postgresDBRepo) GetAnswersForReservation(reservationID int) ([]models.ReservationAnswer, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var answers []models.ReservationAnswer
+
+	query := `SELECT id, reservation_id, COALESCE(question_id, 0), label, answer, created_at, updated_at
+	FROM reservation_answers WHERE reservation_id = $1 ORDER BY id`
+
+	rows, err := m.DB.QueryContext(ctx, query, reservationID)
+	if err != nil {
+		return answers, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a models.ReservationAnswer
+		err := rows.Scan(
+			&a.ID,
+			&a.ReservationID,
+			&a.QuestionID,
+			&a.Label,
+			&a.Answer,
+			&a.CreatedAt,
+			&a.UpdatedAt,
+		)
+		if err != nil {
+			return answers, err
+		}
+		answers = append(answers, a)
+	}
+
+	if err = rows.Err(); err != nil {
+		return answers, err
+	}
+
+	return answers, nil
+}
+
+// frontDeskReservations runs a query selecting reservations for the front desk board and scans the results
+func (m *postgresDBRepo) frontDeskReservations(ctx context.Context, query string, args ...interface{}) ([]models.Reservation, error) {
+	var reservations []models.Reservation
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return reservations, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var i models.Reservation
+		var checkedInAt, checkedOutAt sql.NullTime
+		err := rows.Scan(
+			&i.ID,
+			&i.FirstName,
+			&i.LastName,
+			&i.Email,
+			&i.Phone,
+			&i.StartDate,
+			&i.EndDate,
+			&i.RoomID,
+			&i.Status,
+			&checkedInAt,
+			&checkedOutAt,
+			&i.IDVerified,
+			&i.Room.ID,
+			&i.Room.RoomName,
+		)
+		if err != nil {
+			return reservations, err
+		}
+		i.CheckedInAt = checkedInAt.Time
+		i.CheckedOutAt = checkedOutAt.Time
+		reservations = append(reservations, i)
+	}
+
+	if err = rows.Err(); err != nil {
+		return reservations, err
+	}
+
+	return reservations, nil
+}
+
+// frontDeskColumns selects the reservation details shown on the front desk board
+const frontDeskColumns = `SELECT r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date, r.room_id, r.status,
+	r.checked_in_at, r.checked_out_at, r.id_verified, rm.id, rm.room_name
+	FROM reservations r
+	LEFT JOIN rooms rm ON (r.room_id = rm.id)`
+
+// GetArrivalsByDate returns the reservations due to arrive on a date
+func (m *postgresDBRepo) GetArrivalsByDate(date time.Time) ([]models.Reservation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := frontDeskColumns + `
+	WHERE r.start_date = $1 AND r.status <> 'cancelled'
+	ORDER BY rm.room_name, r.last_name`
+
+	return m.frontDeskReservations(ctx, query, date)
+}
+
+// GetDeparturesByDate returns the reservations due to depart on a date, along with any
+// checked in guests who were due to depart earlier and are still in house
+func (m *postgresDBRepo) GetDeparturesByDate(date time.Time) ([]models.Reservation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := frontDeskColumns + `
+	WHERE r.status <> 'cancelled' AND (r.end_date = $1 OR (r.status = $2 AND r.end_date < $1))
+	ORDER BY rm.room_name, r.last_name`
+
+	return m.frontDeskReservations(ctx, query, date, models.ReservationStatusCheckedIn)
+}
+
+// CheckInReservation records a guest's arrival time and whether their ID was verified
+func (m *postgresDBRepo) CheckInReservation(id int, arrivedAt time.Time, idVerified bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `UPDATE reservations SET status = $1, checked_in_at = $2, id_verified = $3, updated_at = $4 WHERE id = $5`
+	_, err := m.DB.ExecContext(ctx, query,
+		models.ReservationStatusCheckedIn,
+		arrivedAt,
+		idVerified,
+		time.Now(),
+		id,
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// CheckOutReservation records a guest's departure time and moves the end of the room restrictions
+// held by the reservation to the departure date, so that nights freed by an early departure become
+// bookable again and nights taken by a late departure are held. The room is marked dirty.
+func (m *postgresDBRepo) CheckOutReservation(id int, departedAt time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE reservations SET status = $1, checked_out_at = $2, updated_at = $3 WHERE id = $4`
+	_, err = tx.ExecContext(ctx, query,
+		models.ReservationStatusCheckedOut,
+		departedAt,
+		time.Now(),
+		id,
+	)
+	if err != nil {
+		return err
+	}
+
+	departureDate := time.Date(departedAt.Year(), departedAt.Month(), departedAt.Day(), 0, 0, 0, 0, time.UTC)
+	err = releaseNightsFrom(ctx, tx, id, departureDate)
+	if err != nil {
+		return err
+	}
+
+	query = `UPDATE room_restrictions SET end_date = $1, updated_at = $2
+	WHERE reservation_id = $3 AND end_date < $1 AND end_date = (SELECT end_date FROM reservations WHERE id = $3)`
+	_, err = tx.ExecContext(ctx, query, departureDate, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	// a guest on a split stay leaves from the room of the last segment
+	query = `UPDATE rooms SET housekeeping_status = $1, updated_at = $2
+	WHERE id = COALESCE((SELECT room_id FROM room_restrictions WHERE reservation_id = $3 ORDER BY end_date DESC LIMIT 1),
+		(SELECT room_id FROM reservations WHERE id = $3)) AND housekeeping_status <> $4`
+	_, err = tx.ExecContext(ctx, query, models.HousekeepingDirty, time.Now(), id, models.HousekeepingOutOfService)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdateRoomHousekeepingStatus sets the housekeeping status of a room
+func (m *postgresDBRepo) UpdateRoomHousekeepingStatus(roomID int, status string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `UPDATE rooms SET housekeeping_status = $1, updated_at = $2 WHERE id = $3`
+	_, err := m.DB.ExecContext(ctx, query, status, time.Now(), roomID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// InsertHousekeepingTasks inserts cleaning tasks, skipping rooms that already have a task on the same day
+func (m *postgresDBRepo) InsertHousekeepingTasks(tasks []models.HousekeepingTask) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `INSERT INTO housekeeping_tasks (room_id, reservation_id, task_date, kind, status, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	ON CONFLICT (room_id, task_date) DO NOTHING`
+	for _, t := range tasks {
+		_, err := m.DB.ExecContext(ctx, query,
+			t.RoomID,
+			nullableID(t.ReservationID),
+			t.TaskDate,
+			t.Kind,
+			t.Status,
+			time.Now(),
+			time.Now(),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetHousekeepingTasksByDate returns the cleaning tasks for a date, with the room each task is for
+func (m *postgresDBRepo) GetHousekeepingTasksByDate(date time.Time) ([]models.HousekeepingTask, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var tasks []models.HousekeepingTask
+
+	query := `SELECT t.id, t.room_id, COALESCE(t.reservation_id, 0), t.task_date, t.kind, t.status, t.completed_at,
+	COALESCE(t.completed_by, 0), COALESCE(u.first_name || ' ' || u.last_name, ''), t.created_at, t.updated_at,
+	rm.id, rm.room_name, rm.housekeeping_status
+	FROM housekeeping_tasks t
+	LEFT JOIN rooms rm ON (t.room_id = rm.id)
+	LEFT JOIN users u ON (t.completed_by = u.id)
+	WHERE t.task_date = $1
+	ORDER BY t.status DESC, rm.room_name`
+
+	rows, err := m.DB.QueryContext(ctx, query, date)
+	if err != nil {
+		return tasks, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t models.HousekeepingTask
+		var completedAt sql.NullTime
+		err := rows.Scan(
+			&t.ID,
+			&t.RoomID,
+			&t.ReservationID,
+			&t.TaskDate,
+			&t.Kind,
+			&t.Status,
+			&completedAt,
+			&t.CompletedBy,
+			&t.CompletedByName,
+			&t.CreatedAt,
+			&t.UpdatedAt,
+			&t.Room.ID,
+			&t.Room.RoomName,
+			&t.Room.HousekeepingStatus,
+		)
+		if err != nil {
+			return tasks, err
+		}
+		t.CompletedAt = completedAt.Time
+		tasks = append(tasks, t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return tasks, err
+	}
+
+	return tasks, nil
+}
+
+// CompleteHousekeepingTask marks a cleaning task as done. Finishing a departure clean marks the room clean,
+// unless it has been taken out of service.
+func (m *postgresDBRepo) CompleteHousekeepingTask(id, userID int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var roomID int
+	var kind string
+	query := `UPDATE housekeeping_tasks SET status = $1, completed_at = $2, completed_by = $3, updated_at = $4
+	WHERE id = $5 RETURNING room_id, kind`
+	err = tx.QueryRowContext(ctx, query,
+		models.TaskStatusDone,
+		time.Now(),
+		nullableID(userID),
+		time.Now(),
+		id,
+	).Scan(&roomID, &kind)
+	if err != nil {
+		return err
+	}
+
+	if kind == models.TaskKindDeparture {
+		query = `UPDATE rooms SET housekeeping_status = $1, updated_at = $2 WHERE id = $3 AND housekeeping_status <> $4`
+		_, err = tx.ExecContext(ctx, query, models.HousekeepingClean, time.Now(), roomID, models.HousekeepingOutOfService)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// releaseNightsFrom frees the nights held by a reservation from date onwards, removing restrictions that
+// start on or after date and ending the others on date
+func releaseNightsFrom(ctx context.Context, tx *sql.Tx, reservationID int, date time.Time) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM room_restrictions WHERE reservation_id = $1 AND start_date >= $2`, reservationID, date)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE room_restrictions SET end_date = $1, updated_at = $2 WHERE reservation_id = $3 AND end_date > $1`
+	_, err = tx.ExecContext(ctx, query, date, time.Now(), reservationID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetNoShowCandidates returns the confirmed reservations arriving on or before arrivedBy that were never checked in,
+// with the rate and cancellation policy of the room
+func (m *postgresDBRepo) GetNoShowCandidates(arrivedBy time.Time) ([]models.Reservation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var reservations []models.Reservation
+
+	query := `SELECT r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date, r.room_id, r.status,
+	rm.id, rm.room_name, rm.nightly_rate, COALESCE(rm.cancellation_policy_id, 0)
+	FROM reservations r
+	LEFT JOIN rooms rm ON (r.room_id = rm.id)
+	WHERE r.status = $1 AND r.start_date <= $2
+	ORDER BY r.start_date`
+
+	rows, err := m.DB.QueryContext(ctx, query, models.ReservationStatusConfirmed, arrivedBy)
+	if err != nil {
+		return reservations, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var i models.Reservation
+		err := rows.Scan(
+			&i.ID,
+			&i.FirstName,
+			&i.LastName,
+			&i.Email,
+			&i.Phone,
+			&i.StartDate,
+			&i.EndDate,
+			&i.RoomID,
+			&i.Status,
+			&i.Room.ID,
+			&i.Room.RoomName,
+			&i.Room.NightlyRate,
+			&i.Room.CancellationPolicyID,
+		)
+		if err != nil {
+			return reservations, err
+		}
+		reservations = append(reservations, i)
+	}
+
+	if err = rows.Err(); err != nil {
+		return reservations, err
+	}
+
+	return reservations, nil
+}
+
+// MarkNoShow flags a reservation as a no-show and records the fee charged. When release is true, the nights
+// from the date of the no-show onwards are freed so the room can be booked again.
+func (m *postgresDBRepo) MarkNoShow(id, fee int, release bool, at time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE reservations SET status = $1, no_show_at = $2, no_show_fee = $3, updated_at = $4 WHERE id = $5 AND status = $6`
+	_, err = tx.ExecContext(ctx, query,
+		models.ReservationStatusNoShow,
+		at,
+		fee,
+		time.Now(),
+		id,
+		models.ReservationStatusConfirmed,
+	)
+	if err != nil {
+		return err
+	}
+
+	if release {
+		err = releaseNightsFrom(ctx, tx, id, time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, time.UTC))
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetArrivalsToRemind returns the IDs of the confirmed reservations arriving on a date whose guest has not
+// been sent an arrival reminder
+func (m *postgresDBRepo) GetArrivalsToRemind(arrival time.Time) ([]int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var ids []int
+
+	query := `SELECT id FROM reservations
+	WHERE status = $1 AND start_date = $2 AND reminder_sent_at IS NULL AND email <> ''
+	ORDER BY id`
+
+	rows, err := m.DB.QueryContext(ctx, query, models.ReservationStatusConfirmed, arrival)
+	if err != nil {
+		return ids, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return ids, err
+		}
+		ids = append(ids, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return ids, err
+	}
+
+	return ids, nil
+}
+
+// QueueArrivalReminder marks a reservation's guest as reminded and queues the reminder in one transaction.
+// It returns false without queueing anything if the guest has already been reminded.
+func (m *postgresDBRepo) QueueArrivalReminder(id int, msg models.MailData) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `UPDATE reservations SET reminder_sent_at = $1 WHERE id = $2 AND reminder_sent_at IS NULL`, time.Now(), id)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if n == 0 {
+		return false, nil
+	}
+
+	err = insertOutbox(ctx, tx, msg)
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// GetNoShowsSince returns the reservations flagged as no-shows since a time
+func (m *postgresDBRepo) GetNoShowsSince(since time.Time) ([]models.Reservation, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var reservations []models.Reservation
+
+	query := `SELECT r.id, r.first_name, r.last_name, r.email, r.phone, r.start_date, r.end_date, r.room_id, r.no_show_at, r.no_show_fee,
+	rm.id, rm.room_name
+	FROM reservations r
+	LEFT JOIN rooms rm ON (r.room_id = rm.id)
+	WHERE r.status = $1 AND r.no_show_at >= $2
+	ORDER BY r.no_show_at`
+
+	rows, err := m.DB.QueryContext(ctx, query, models.ReservationStatusNoShow, since)
+	if err != nil {
+		return reservations, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var i models.Reservation
+		err := rows.Scan(
+			&i.ID,
+			&i.FirstName,
+			&i.LastName,
+			&i.Email,
+			&i.Phone,
+			&i.StartDate,
+			&i.EndDate,
+			&i.RoomID,
+			&i.NoShowAt,
+			&i.NoShowFee,
+			&i.Room.ID,
+			&i.Room.RoomName,
+		)
+		if err != nil {
+			return reservations, err
+		}
+		i.Status = models.ReservationStatusNoShow
+		reservations = append(reservations, i)
+	}
+
+	if err = rows.Err(); err != nil {
+		return reservations, err
+	}
+
+	return reservations, nil
+}
+
+// RegisterJob records a background job. An existing job keeps its next run time unless its schedule changed.
+func (m *postgresDBRepo) RegisterJob(name, schedule string, nextRunAt time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `INSERT INTO jobs (name, schedule, next_run_at, created_at, updated_at) VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT (name) DO UPDATE SET schedule = EXCLUDED.schedule, next_run_at = EXCLUDED.next_run_at, attempts = 0, updated_at = EXCLUDED.updated_at
+	WHERE jobs.schedule <> EXCLUDED.schedule`
+
+	_, err := m.DB.ExecContext(ctx, query, name, schedule, nextRunAt, time.Now(), time.Now())
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// ClaimJob locks a due job for one app instance. The update only matches a job that is due and not locked
+// by another instance, so when several instances race for the same run exactly one of them gets it.
+func (m *postgresDBRepo) ClaimJob(name, instance string, now, lockedUntil time.Time) (models.Job, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var job models.Job
+
+	query := `UPDATE jobs SET locked_by = $1, locked_until = $2, updated_at = $3
+	WHERE name = $4 AND next_run_at <= $3 AND (locked_until IS NULL OR locked_until < $3)
+	RETURNING id, name, schedule, next_run_at, attempts`
+
+	err := m.DB.QueryRowContext(ctx, query, instance, lockedUntil, now, name).Scan(
+		&job.ID,
+		&job.Name,
+		&job.Schedule,
+		&job.NextRunAt,
+		&job.Attempts,
+	)
+	if err == sql.ErrNoRows {
+		return job, false, nil
+	}
+	if err != nil {
+		return job, false, err
+	}
+
+	job.LockedBy = instance
+	job.LockedUntil = lockedUntil
+	return job, true, nil
+}
+
+// FinishJob records a run of a job, releases its lock and sets when it runs next
+func (m *postgresDBRepo) FinishJob(run models.JobRun, nextRunAt time.Time, attempts int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO job_runs (job_name, instance, attempt, started_at, finished_at, status, error, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+	_, err = tx.ExecContext(ctx, query,
+		run.JobName,
+		run.Instance,
+		run.Attempt,
+		run.StartedAt,
+		run.FinishedAt,
+		run.Status,
+		run.Error,
+		time.Now(),
+		time.Now(),
+	)
+	if err != nil {
+		return err
+	}
+
+	query = `UPDATE jobs SET next_run_at = $1, attempts = $2, last_run_at = $3, last_status = $4, last_error = $5,
+	locked_by = '', locked_until = NULL, updated_at = $6
+	WHERE name = $7`
+	_, err = tx.ExecContext(ctx, query,
+		nextRunAt,
+		attempts,
+		run.StartedAt,
+		run.Status,
+		run.Error,
+		time.Now(),
+		run.JobName,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// AllJobs returns every registered background job
+func (m *postgresDBRepo) AllJobs() ([]models.Job, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var jobs []models.Job
+
+	query := `SELECT id, name, schedule, next_run_at, locked_by, locked_until, attempts, last_run_at, last_status, last_error, created_at, updated_at
+	FROM jobs ORDER BY name`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return jobs, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var j models.Job
+		var lockedUntil, lastRunAt sql.NullTime
+		err := rows.Scan(
+			&j.ID,
+			&j.Name,
+			&j.Schedule,
+			&j.NextRunAt,
+			&j.LockedBy,
+			&lockedUntil,
+			&j.Attempts,
+			&lastRunAt,
+			&j.LastStatus,
+			&j.LastError,
+			&j.CreatedAt,
+			&j.UpdatedAt,
+		)
+		if err != nil {
+			return jobs, err
+		}
+		j.LockedUntil = lockedUntil.Time
+		j.LastRunAt = lastRunAt.Time
+		jobs = append(jobs, j)
+	}
+
+	if err = rows.Err(); err != nil {
+		return jobs, err
+	}
+
+	return jobs, nil
+}
+
+// GetRecentJobRuns returns the most recent job runs, newest first
+func (m *postgresDBRepo) GetRecentJobRuns(limit int) ([]models.JobRun, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var runs []models.JobRun
+
+	query := `SELECT id, job_name, instance, attempt, started_at, finished_at, status, error, created_at, updated_at
+	FROM job_runs ORDER BY started_at DESC LIMIT $1`
+
+	rows, err := m.DB.QueryContext(ctx, query, limit)
+	if err != nil {
+		return runs, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r models.JobRun
+		err := rows.Scan(
+			&r.ID,
+			&r.JobName,
+			&r.Instance,
+			&r.Attempt,
+			&r.StartedAt,
+			&r.FinishedAt,
+			&r.Status,
+			&r.Error,
+			&r.CreatedAt,
+			&r.UpdatedAt,
+		)
+		if err != nil {
+			return runs, err
+		}
+		runs = append(runs, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return runs, err
+	}
+
+	return runs, nil
+}
+
+// RunJobNow makes a job due immediately, so the scheduler picks it up on its next check
+func (m *postgresDBRepo) RunJobNow(name string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `UPDATE jobs SET next_run_at = $1, updated_at = $1 WHERE name = $2`
+	_, err := m.DB.ExecContext(ctx, query, time.Now(), name)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// CreateReservation inserts a reservation, the room restriction holding its room, the guest's answers to the
+// booking questions and the notification emails in a single transaction, so that the emails are only queued
+// if the reservation is saved. A stay split across rooms gets a restriction for each segment. The emails are
+// built by notices once the new reservation ID is known.
+func (m *postgresDBRepo) CreateReservation(res models.Reservation, answers []models.ReservationAnswer, notices func(id int) ([]models.MailData, error)) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	newID, err := insertReservation(ctx, tx, res)
+	if err != nil {
+		return 0, err
+	}
+
+	segments := res.Segments
+	if len(segments) == 0 {
+		segments = []models.StaySegment{{RoomID: res.RoomID, StartDate: res.StartDate, EndDate: res.EndDate}}
+	}
+	for _, s := range segments {
+		err = insertRoomRestriction(ctx, tx, models.RoomRestriction{
+			StartDate:     s.StartDate,
+			EndDate:       s.EndDate,
+			RoomID:        s.RoomID,
+			ReservationID: newID,
+			RestrictionID: 1,
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = insertReservationAnswers(ctx, tx, newID, answers)
+	if err != nil {
+		return 0, err
+	}
+
+	messages, err := notices(newID)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, msg := range messages {
+		err = insertOutbox(ctx, tx, msg)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	return newID, nil
+}
+
+// insertOutbox queues an email using q, which may be the database or a transaction
+func insertOutbox(ctx context.Context, q queryer, msg models.MailData) error {
+	attachments := ""
+	if len(msg.Attachments) > 0 {
+		data, err := json.Marshal(msg.Attachments)
+		if err != nil {
+			return err
+		}
+		attachments = string(data)
+	}
+
+	query := `INSERT INTO outbox (to_address, from_address, subject, content, text_content, template, attachments, status, next_attempt_at, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+	_, err := q.ExecContext(ctx, query,
+		msg.To,
+		msg.From,
+		msg.Subject,
+		msg.Content,
+		msg.Text,
+		msg.Template,
+		attachments,
+		models.OutboxPending,
+		time.Now(),
+		time.Now(),
+		time.Now(),
+	)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// QueueMail adds an email to the outbox to be sent by the mail worker
+func (m *postgresDBRepo) QueueMail(msg models.MailData) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return insertOutbox(ctx, m.DB, msg)
+}
+
+// outboxColumns selects an outbox message
+const outboxColumns = `id, to_address, from_address, subject, content, text_content, template, attachments, status, attempts, next_attempt_at, last_error, sent_at, created_at, updated_at`
+
+// scanOutboxMessages scans rows selected with outboxColumns
+func scanOutboxMessages(rows *sql.Rows) ([]models.OutboxMessage, error) {
+	var messages []models.OutboxMessage
+
+	for rows.Next() {
+		var msg models.OutboxMessage
+		var sentAt sql.NullTime
+		var attachments string
+		err := rows.Scan(
+			&msg.ID,
+			&msg.To,
+			&msg.From,
+			&msg.Subject,
+			&msg.Content,
+			&msg.Text,
+			&msg.Template,
+			&attachments,
+			&msg.Status,
+			&msg.Attempts,
+			&msg.NextAttemptAt,
+			&msg.LastError,
+			&sentAt,
+			&msg.CreatedAt,
+			&msg.UpdatedAt,
+		)
+		if err != nil {
+			return messages, err
+		}
+		msg.SentAt = sentAt.Time
+		if attachments != "" {
+			err = json.Unmarshal([]byte(attachments), &msg.Attachments)
+			if err != nil {
+				return messages, err
+			}
+		}
+		messages = append(messages, msg)
+	}
+
+	if err := rows.Err(); err != nil {
+		return messages, err
+	}
+
+	return messages, nil
+}
+
+// ClaimOutboxMessages locks up to limit pending emails that are due to be sent, so that no other mail
+// worker sends them while this one tries. Rows locked by another worker are skipped.
+func (m *postgresDBRepo) ClaimOutboxMessages(limit int, now, lockedUntil time.Time) ([]models.OutboxMessage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `UPDATE outbox SET locked_until = $1, updated_at = $2
+	WHERE id IN (
+		SELECT id FROM outbox
+		WHERE status = $3 AND next_attempt_at <= $2 AND (locked_until IS NULL OR locked_until < $2)
+		ORDER BY id
+		LIMIT $4
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING ` + outboxColumns
+
+	rows, err := m.DB.QueryContext(ctx, query, lockedUntil, now, models.OutboxPending, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanOutboxMessages(rows)
+}
+
+// MarkOutboxSent records that an email was delivered
+func (m *postgresDBRepo) MarkOutboxSent(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `UPDATE outbox SET status = $1, attempts = attempts + 1, sent_at = $2, last_error = '', locked_until = NULL, updated_at = $2 WHERE id = $3`
+	_, err := m.DB.ExecContext(ctx, query, models.OutboxSent, time.Now(), id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// MarkOutboxFailed records a failed attempt to send an email. The email is tried again at nextAttemptAt,
+// or moved to the dead letter state when dead is true.
+func (m *postgresDBRepo) MarkOutboxFailed(id int, sendErr string, nextAttemptAt time.Time, dead bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	status := models.OutboxPending
+	if dead {
+		status = models.OutboxDead
+	}
+
+	query := `UPDATE outbox SET status = $1, attempts = attempts + 1, last_error = $2, next_attempt_at = $3, locked_until = NULL, updated_at = $4
+	WHERE id = $5`
+	_, err := m.DB.ExecContext(ctx, query, status, sendErr, nextAttemptAt, time.Now(), id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetOutboxMessages returns the most recent emails in the outbox, limited to those with status when it is not empty
+func (m *postgresDBRepo) GetOutboxMessages(status string) ([]models.OutboxMessage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT ` + outboxColumns + ` FROM outbox
+	WHERE ($1 = '' OR status = $1)
+	ORDER BY id DESC
+	LIMIT 200`
+
+	rows, err := m.DB.QueryContext(ctx, query, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanOutboxMessages(rows)
+}
+
+// ResendOutboxMessage puts an email back in the queue to be sent straight away, with a fresh set of attempts
+func (m *postgresDBRepo) ResendOutboxMessage(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `UPDATE outbox SET status = $1, attempts = 0, next_attempt_at = $2, locked_until = NULL, updated_at = $2 WHERE id = $3`
+	_, err := m.DB.ExecContext(ctx, query, models.OutboxPending, time.Now(), id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// UpdateRoomCalendarFeed sets the secret token in a room's calendar feed URL and whether the feed shows guest names
+func (m *postgresDBRepo) UpdateRoomCalendarFeed(roomID int, token string, showGuests bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `UPDATE rooms SET ical_token = $1, ical_show_guests = $2, updated_at = $3 WHERE id = $4`
+	_, err := m.DB.ExecContext(ctx, query, token, showGuests, time.Now(), roomID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetCalendarFeedRestrictions returns the reservations and blocks of a room that end on or after from,
+// with the guest's name for reservations
+func (m *postgresDBRepo) GetCalendarFeedRestrictions(roomID int, from time.Time) ([]models.RoomRestriction, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var restrictions []models.RoomRestriction
+
+	query := `SELECT rr.id, COALESCE(rr.reservation_id, 0), rr.restriction_id, rr.room_id, rr.start_date, rr.end_date, rr.updated_at,
+	COALESCE(r.first_name, ''), COALESCE(r.last_name, ''), COALESCE(r.ical_sequence, 0)
+	FROM room_restrictions rr
+	LEFT JOIN reservations r ON (r.id = rr.reservation_id)
+	WHERE rr.room_id = $1 AND rr.end_date >= $2
+	ORDER BY rr.start_date`
+
+	rows, err := m.DB.QueryContext(ctx, query, roomID, from)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r models.RoomRestriction
+		err := rows.Scan(
+			&r.ID,
+			&r.ReservationID,
+			&r.RestrictionID,
+			&r.RoomID,
+			&r.StartDate,
+			&r.EndDate,
+			&r.UpdatedAt,
+			&r.Reservation.FirstName,
+			&r.Reservation.LastName,
+			&r.Reservation.ICalSequence,
+		)
+		if err != nil {
+			return nil, err
+		}
+		r.Reservation.ID = r.ReservationID
+		restrictions = append(restrictions, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return restrictions, nil
+}
+
+// calendarImportColumns selects a calendar import along with the name of its room
+const calendarImportColumns = `SELECT ci.id, ci.room_id, ci.name, ci.url, ci.content, ci.last_synced_at, ci.last_error, ci.created_at, ci.updated_at,
+	rm.room_name
+	FROM calendar_imports ci
+	LEFT JOIN rooms rm ON (rm.id = ci.room_id)`
+
+// scanCalendarImport scans a row selected with calendarImportColumns into a calendar import
+func scanCalendarImport(scanner rowScanner) (models.CalendarImport, error) {
+	var ci models.CalendarImport
+	var lastSynced sql.NullTime
+
+	err := scanner.Scan(
+		&ci.ID,
+		&ci.RoomID,
+		&ci.Name,
+		&ci.URL,
+		&ci.Content,
+		&lastSynced,
+		&ci.LastError,
+		&ci.CreatedAt,
+		&ci.UpdatedAt,
+		&ci.Room.RoomName,
+	)
+	if err != nil {
+		return ci, err
+	}
+	ci.Room.ID = ci.RoomID
+	ci.LastSyncedAt = lastSynced.Time
+	return ci, nil
+}
+
+// AllCalendarImports returns every calendar import, with the conflicts found the last time each was synced
+func (m *postgresDBRepo) AllCalendarImports() ([]models.CalendarImport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var imports []models.CalendarImport
+
+	rows, err := m.DB.QueryContext(ctx, calendarImportColumns+` ORDER BY rm.room_name, ci.name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byID := make(map[int]int)
+	for rows.Next() {
+		ci, err := scanCalendarImport(rows)
+		if err != nil {
+			return nil, err
+		}
+		byID[ci.ID] = len(imports)
+		imports = append(imports, ci)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT c.id, c.import_id, c.external_uid, c.summary, c.start_date, c.end_date, c.reservation_id, c.created_at, c.updated_at,
+	r.first_name, r.last_name, r.start_date, r.end_date
+	FROM calendar_import_conflicts c
+	LEFT JOIN reservations r ON (r.id = c.reservation_id)
+	ORDER BY c.start_date`
+
+	conflictRows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer conflictRows.Close()
+
+	for conflictRows.Next() {
+		var c models.CalendarImportConflict
+		err := conflictRows.Scan(
+			&c.ID,
+			&c.ImportID,
+			&c.ExternalUID,
+			&c.Summary,
+			&c.StartDate,
+			&c.EndDate,
+			&c.ReservationID,
+			&c.CreatedAt,
+			&c.UpdatedAt,
+			&c.Reservation.FirstName,
+			&c.Reservation.LastName,
+			&c.Reservation.StartDate,
+			&c.Reservation.EndDate,
+		)
+		if err != nil {
+			return nil, err
+		}
+		c.Reservation.ID = c.ReservationID
+		if i, ok := byID[c.ImportID]; ok {
+			imports[i].Conflicts = append(imports[i].Conflicts, c)
+		}
+	}
+
+	if err = conflictRows.Err(); err != nil {
+		return nil, err
+	}
+
+	return imports, nil
+}
+
+// GetCalendarImportByID returns a calendar import by id
+func (m *postgresDBRepo) GetCalendarImportByID(id int) (models.CalendarImport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	row := m.DB.QueryRowContext(ctx, calendarImportColumns+` WHERE ci.id = $1`, id)
+	return scanCalendarImport(row)
+}
+
+// InsertCalendarImport inserts a calendar import, returning its id
+func (m *postgresDBRepo) InsertCalendarImport(ci models.CalendarImport) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var newID int
+
+	query := `INSERT INTO calendar_imports (room_id, name, url, content, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`
+	err := m.DB.QueryRowContext(ctx, query, ci.RoomID, ci.Name, ci.URL, ci.Content, time.Now(), time.Now()).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+	return newID, nil
+}
+
+// DeleteCalendarImport deletes a calendar import along with the blocks imported from it
+func (m *postgresDBRepo) DeleteCalendarImport(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM calendar_imports WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetImportedBlocks returns the blocks imported from a calendar
+func (m *postgresDBRepo) GetImportedBlocks(importID int) ([]models.RoomRestriction, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var blocks []models.RoomRestriction
+
+	query := `SELECT id, restriction_id, room_id, start_date, end_date, import_id, external_uid FROM room_restrictions WHERE import_id = $1`
+
+	rows, err := m.DB.QueryContext(ctx, query, importID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r models.RoomRestriction
+		err := rows.Scan(
+			&r.ID,
+			&r.RestrictionID,
+			&r.RoomID,
+			&r.StartDate,
+			&r.EndDate,
+			&r.ImportID,
+			&r.ExternalUID,
+		)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return blocks, nil
+}
+
+// ApplyCalendarImport creates, moves and removes the blocks imported from a calendar and replaces its
+// conflicts in a single transaction, then records when it was synced. It returns the ids of the blocks
+// created, in the order of sync.Create.
+func (m *postgresDBRepo) ApplyCalendarImport(sync models.CalendarImportSync) ([]int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var ids []int
+	query := `INSERT INTO room_restrictions (start_date, end_date, room_id, restriction_id, import_id, external_uid, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`
+	for _, b := range sync.Create {
+		var id int
+		err = tx.QueryRowContext(ctx, query, b.StartDate, b.EndDate, b.RoomID, b.RestrictionID, sync.ImportID, b.ExternalUID, time.Now(), time.Now()).Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	for _, b := range sync.Update {
+		_, err = tx.ExecContext(ctx, `UPDATE room_restrictions SET start_date = $1, end_date = $2, updated_at = $3 WHERE id = $4 AND import_id = $5`,
+			b.StartDate, b.EndDate, time.Now(), b.ID, sync.ImportID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, id := range sync.Delete {
+		_, err = tx.ExecContext(ctx, `DELETE FROM room_restrictions WHERE id = $1 AND import_id = $2`, id, sync.ImportID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM calendar_import_conflicts WHERE import_id = $1`, sync.ImportID)
+	if err != nil {
+		return nil, err
+	}
+
+	query = `INSERT INTO calendar_import_conflicts (import_id, external_uid, summary, start_date, end_date, reservation_id, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	for _, c := range sync.Conflicts {
+		_, err = tx.ExecContext(ctx, query, sync.ImportID, c.ExternalUID, c.Summary, c.StartDate, c.EndDate, c.ReservationID, time.Now(), time.Now())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE calendar_imports SET last_synced_at = $1, last_error = '', updated_at = $2 WHERE id = $3`,
+		sync.SyncedAt, time.Now(), sync.ImportID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// MarkCalendarImportFailed records why a calendar import could not be synced. Its blocks are left as they were.
+func (m *postgresDBRepo) MarkCalendarImportFailed(id int, syncErr string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `UPDATE calendar_imports SET last_error = $1, updated_at = $2 WHERE id = $3`, syncErr, time.Now(), id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// webhookEndpointColumns selects a webhook endpoint
+const webhookEndpointColumns = `SELECT id, url, description, secret, events, active, created_at, updated_at FROM webhook_endpoints`
+
+// scanWebhookEndpoint scans a row selected with webhookEndpointColumns into a webhook endpoint
+func scanWebhookEndpoint(scanner rowScanner) (models.WebhookEndpoint, error) {
+	var e models.WebhookEndpoint
+	var events string
+
+	err := scanner.Scan(
+		&e.ID,
+		&e.URL,
+		&e.Description,
+		&e.Secret,
+		&events,
+		&e.Active,
+		&e.CreatedAt,
+		&e.UpdatedAt,
+	)
+	if err != nil {
+		return e, err
+	}
+	if events != "" {
+		e.Events = strings.Split(events, ",")
+	}
+	return e, nil
+}
+
+// AllWebhookEndpoints returns every webhook endpoint
+func (m *postgresDBRepo) AllWebhookEndpoints() ([]models.WebhookEndpoint, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var endpoints []models.WebhookEndpoint
+
+	rows, err := m.DB.QueryContext(ctx, webhookEndpointColumns+` ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e, err := scanWebhookEndpoint(rows)
+		if err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return endpoints, nil
+}
+
+// GetWebhookEndpointByID returns a webhook endpoint by id
+func (m *postgresDBRepo) GetWebhookEndpointByID(id int) (models.WebhookEndpoint, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	row := m.DB.QueryRowContext(ctx, webhookEndpointColumns+` WHERE id = $1`, id)
+	return scanWebhookEndpoint(row)
+}
+
+// InsertWebhookEndpoint inserts a webhook endpoint, returning its id
+func (m *postgresDBRepo) InsertWebhookEndpoint(e models.WebhookEndpoint) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var newID int
+
+	query := `INSERT INTO webhook_endpoints (url, description, secret, events, active, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
+	err := m.DB.QueryRowContext(ctx, query,
+		e.URL,
+		e.Description,
+		e.Secret,
+		strings.Join(e.Events, ","),
+		e.Active,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+	return newID, nil
+}
+
+// UpdateWebhookEndpoint updates a webhook endpoint's address, description, events and whether it is active.
+// Its secret is kept.
+func (m *postgresDBRepo) UpdateWebhookEndpoint(e models.WebhookEndpoint) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `UPDATE webhook_endpoints SET url = $1, description = $2, events = $3, active = $4, updated_at = $5 WHERE id = $6`
+	_, err := m.DB.ExecContext(ctx, query, e.URL, e.Description, strings.Join(e.Events, ","), e.Active, time.Now(), e.ID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// DeleteWebhookEndpoint deletes a webhook endpoint along with its delivery log
+func (m *postgresDBRepo) DeleteWebhookEndpoint(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `DELETE FROM webhook_endpoints WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// QueueWebhookEvent queues a delivery of an event's payload to every active endpoint subscribed to it
+func (m *postgresDBRepo) QueueWebhookEvent(event string, payload []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `INSERT INTO webhook_deliveries (endpoint_id, event, payload, status, next_attempt_at, created_at, updated_at)
+	SELECT id, $1::text, $2, $3, $4, $4, $4 FROM webhook_endpoints
+	WHERE active AND ',' || events || ',' LIKE '%,' || $1::text || ',%'`
+	_, err := m.DB.ExecContext(ctx, query, event, string(payload), models.WebhookPending, time.Now())
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// webhookDeliveryColumns selects a webhook delivery along with its endpoint's address and secret
+const webhookDeliveryColumns = `d.id, d.endpoint_id, d.event, d.payload, d.status, d.attempts, d.next_attempt_at, d.response_code, d.last_error,
+	d.delivered_at, d.created_at, d.updated_at, e.url, e.secret`
+
+// scanWebhookDeliveries scans rows selected with webhookDeliveryColumns
+func scanWebhookDeliveries(rows *sql.Rows) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+
+	for rows.Next() {
+		var d models.WebhookDelivery
+		var deliveredAt sql.NullTime
+		err := rows.Scan(
+			&d.ID,
+			&d.EndpointID,
+			&d.Event,
+			&d.Payload,
+			&d.Status,
+			&d.Attempts,
+			&d.NextAttemptAt,
+			&d.ResponseCode,
+			&d.LastError,
+			&deliveredAt,
+			&d.CreatedAt,
+			&d.UpdatedAt,
+			&d.Endpoint.URL,
+			&d.Endpoint.Secret,
+		)
+		if err != nil {
+			return deliveries, err
+		}
+		d.DeliveredAt = deliveredAt.Time
+		d.Endpoint.ID = d.EndpointID
+		deliveries = append(deliveries, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return deliveries, err
+	}
+
+	return deliveries, nil
+}
+
+// ClaimWebhookDeliveries locks up to limit pending deliveries that are due, so that no other worker sends
+// them while this one tries. Rows locked by another worker are skipped.
+func (m *postgresDBRepo) ClaimWebhookDeliveries(limit int, now, lockedUntil time.Time) ([]models.WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `UPDATE webhook_deliveries d SET locked_until = $1, updated_at = $2
+	FROM webhook_endpoints e
+	WHERE e.id = d.endpoint_id AND d.id IN (
+		SELECT id FROM webhook_deliveries
+		WHERE status = $3 AND next_attempt_at <= $2 AND (locked_until IS NULL OR locked_until < $2)
+		ORDER BY id
+		LIMIT $4
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING ` + webhookDeliveryColumns
+
+	rows, err := m.DB.QueryContext(ctx, query, lockedUntil, now, models.WebhookPending, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanWebhookDeliveries(rows)
+}
+
+// MarkWebhookDelivered records that an endpoint accepted a delivery
+func (m *postgresDBRepo) MarkWebhookDelivered(id, responseCode int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `UPDATE webhook_deliveries SET status = $1, attempts = attempts + 1, response_code = $2, delivered_at = $3, last_error = '',
+	locked_until = NULL, updated_at = $3 WHERE id = $4`
+	_, err := m.DB.ExecContext(ctx, query, models.WebhookDelivered, responseCode, time.Now(), id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// MarkWebhookFailed records a failed attempt at a delivery. It is tried again at nextAttemptAt, or moved
+// to the dead letter state when dead is true.
+func (m *postgresDBRepo) MarkWebhookFailed(id, responseCode int, sendErr string, nextAttemptAt time.Time, dead bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	status := models.WebhookPending
+	if dead {
+		status = models.WebhookDead
+	}
+
+	query := `UPDATE webhook_deliveries SET status = $1, attempts = attempts + 1, response_code = $2, last_error = $3, next_attempt_at = $4,
+	locked_until = NULL, updated_at = $5 WHERE id = $6`
+	_, err := m.DB.ExecContext(ctx, query, status, responseCode, sendErr, nextAttemptAt, time.Now(), id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetWebhookDeliveries returns the most recent deliveries to an endpoint
+func (m *postgresDBRepo) GetWebhookDeliveries(endpointID int) ([]models.WebhookDelivery, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT ` + webhookDeliveryColumns + `
+	FROM webhook_deliveries d
+	LEFT JOIN webhook_endpoints e ON (e.id = d.endpoint_id)
+	WHERE d.endpoint_id = $1
+	ORDER BY d.id DESC
+	LIMIT 200`
+
+	rows, err := m.DB.QueryContext(ctx, query, endpointID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanWebhookDeliveries(rows)
+}
+
+// ReplayWebhookDelivery queues a delivery to be sent again straight away as a new delivery with the same
+// payload, keeping the original in the log
+func (m *postgresDBRepo) ReplayWebhookDelivery(endpointID, id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `INSERT INTO webhook_deliveries (endpoint_id, event, payload, status, next_attempt_at, created_at, updated_at)
+	SELECT endpoint_id, event, payload, $1, $2, $2, $2 FROM webhook_deliveries WHERE endpoint_id = $3 AND id = $4`
+	result, err := m.DB.ExecContext(ctx, query, models.WebhookPending, time.Now(), endpointID, id)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// channelColumns selects a channel
+const channelColumns = `SELECT id, name, kind, base_url, api_key, active, last_pulled_at, created_at, updated_at FROM channels`
+
+// scanChannel scans a row selected with channelColumns into a channel
+func scanChannel(scanner rowScanner) (models.Channel, error) {
+	var ch models.Channel
+	var lastPulled sql.NullTime
+
+	err := scanner.Scan(
+		&ch.ID,
+		&ch.Name,
+		&ch.Kind,
+		&ch.BaseURL,
+		&ch.APIKey,
+		&ch.Active,
+		&lastPulled,
+		&ch.CreatedAt,
+		&ch.UpdatedAt,
+	)
+	if err != nil {
+		return ch, err
+	}
+	ch.LastPulledAt = lastPulled.Time
+	return ch, nil
+}
+
+// getChannelRoomMappings returns the room mappings of a channel, or of every channel when channelID is 0,
+// keyed by channel id
+func (m *postgresDBRepo) getChannelRoomMappings(ctx context.Context, channelID int) (map[int][]models.ChannelRoomMapping, error) {
+	mappings := make(map[int][]models.ChannelRoomMapping)
+
+	query := `SELECT m.id, m.channel_id, m.room_id, m.room_code, m.created_at, m.updated_at, rm.room_name, rm.nightly_rate
+	FROM channel_room_mappings m
+	LEFT JOIN rooms rm ON (rm.id = m.room_id)
+	WHERE $1 = 0 OR m.channel_id = $1
+	ORDER BY rm.room_name`
+
+	rows, err := m.DB.QueryContext(ctx, query, channelID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cm models.ChannelRoomMapping
+		err := rows.Scan(
+			&cm.ID,
+			&cm.ChannelID,
+			&cm.RoomID,
+			&cm.RoomCode,
+			&cm.CreatedAt,
+			&cm.UpdatedAt,
+			&cm.Room.RoomName,
+			&cm.Room.NightlyRate,
+		)
+		if err != nil {
+			return nil, err
+		}
+		cm.Room.ID = cm.RoomID
+		mappings[cm.ChannelID] = append(mappings[cm.ChannelID], cm)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return mappings, nil
+}
+
+// AllChannels returns every channel, with its room mappings
+func (m *postgresDBRepo) AllChannels() ([]models.Channel, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var channels []models.Channel
+
+	rows, err := m.DB.QueryContext(ctx, channelColumns+` ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		ch, err := scanChannel(rows)
+		if err != nil {
+			return nil, err
+		}
+		channels = append(channels, ch)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	mappings, err := m.getChannelRoomMappings(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	for i := range channels {
+		channels[i].Mappings = mappings[channels[i].ID]
+	}
+
+	return channels, nil
+}
+
+// GetChannelByID returns a channel by id, with its room mappings
+func (m *postgresDBRepo) GetChannelByID(id int) (models.Channel, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	ch, err := scanChannel(m.DB.QueryRowContext(ctx, channelColumns+` WHERE id = $1`, id))
+	if err != nil {
+		return ch, err
+	}
+
+	mappings, err := m.getChannelRoomMappings(ctx, ch.ID)
+	if err != nil {
+		return ch, err
+	}
+	ch.Mappings = mappings[ch.ID]
+	return ch, nil
+}
+
+// InsertChannel inserts a channel, returning its id
+func (m *postgresDBRepo) InsertChannel(ch models.Channel) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var newID int
+
+	query := `INSERT INTO channels (name, kind, base_url, api_key, active, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
+	err := m.DB.QueryRowContext(ctx, query,
+		ch.Name,
+		ch.Kind,
+		ch.BaseURL,
+		ch.APIKey,
+		ch.Active,
+		time.Now(),
+		time.Now(),
+	).Scan(&newID)
+	if err != nil {
+		return 0, err
+	}
+	return newID, nil
+}
+
+// UpdateChannel updates a channel's name, connection and whether it is active. The API key is kept when
+// the new one is empty.
+func (m *postgresDBRepo) UpdateChannel(ch models.Channel) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `UPDATE channels SET name = $1, kind = $2, base_url = $3, api_key = COALESCE(NULLIF($4, ''), api_key), active = $5, updated_at = $6
+	WHERE id = $7`
+	_, err := m.DB.ExecContext(ctx, query, ch.Name, ch.Kind, ch.BaseURL, ch.APIKey, ch.Active, time.Now(), ch.ID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// SetChannelRoomMapping sets the code a channel knows a room by. An empty code stops selling the room on
+// the channel.
+func (m *postgresDBRepo) SetChannelRoomMapping(channelID, roomID int, code string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	if code == "" {
+		_, err := m.DB.ExecContext(ctx, `DELETE FROM channel_room_mappings WHERE channel_id = $1 AND room_id = $2`, channelID, roomID)
+		return err
+	}
+
+	query := `INSERT INTO channel_room_mappings (channel_id, room_id, room_code, created_at, updated_at) VALUES ($1, $2, $3, $4, $4)
+	ON CONFLICT (channel_id, room_id) DO UPDATE SET room_code = EXCLUDED.room_code, updated_at = EXCLUDED.updated_at`
+	_, err := m.DB.ExecContext(ctx, query, channelID, roomID, code, time.Now())
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// QueueChannelSync queues a push to a channel. Pushes carry the full state for the days they cover, so
+// older pushes of the same kind still waiting to be sent are superseded rather than sent after it.
+func (m *postgresDBRepo) QueueChannelSync(channelID int, operation, payload string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+
+	query := `UPDATE channel_syncs SET status = $1, locked_until = NULL, finished_at = $2, updated_at = $2
+	WHERE channel_id = $3 AND operation = $4 AND status = $5 AND (locked_until IS NULL OR locked_until < $2)`
+	_, err = tx.ExecContext(ctx, query, models.ChannelSyncSuperseded, now, channelID, operation, models.ChannelSyncPending)
+	if err != nil {
+		return err
+	}
+
+	query = `INSERT INTO channel_syncs (channel_id, operation, payload, status, next_attempt_at, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $5, $5)`
+	_, err = tx.ExecContext(ctx, query, channelID, operation, payload, models.ChannelSyncPending, now)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// LogChannelSync records a finished sync that was not queued, such as a pull of bookings
+func (m *postgresDBRepo) LogChannelSync(s models.ChannelSync) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `INSERT INTO channel_syncs (channel_id, operation, payload, status, attempts, next_attempt_at, summary, last_error,
+	finished_at, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, 1, $5, $6, $7, $5, $5, $5)`
+	_, err := m.DB.ExecContext(ctx, query, s.ChannelID, s.Operation, s.Payload, s.Status, time.Now(), s.Summary, s.LastError)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// channelSyncColumns selects a channel sync along with its channel's name and connection
+const channelSyncColumns = `s.id, s.channel_id, s.operation, s.payload, s.status, s.attempts, s.next_attempt_at, s.summary, s.last_error,
+	s.finished_at, s.created_at, s.updated_at, c.name, c.kind, c.base_url, c.api_key`
+
+// scanChannelSyncs scans rows selected with channelSyncColumns
+func scanChannelSyncs(rows *sql.Rows) ([]models.ChannelSync, error) {
+	var syncs []models.ChannelSync
+
+	for rows.Next() {
+		var s models.ChannelSync
+		var finishedAt sql.NullTime
+		err := rows.Scan(
+			&s.ID,
+			&s.ChannelID,
+			&s.Operation,
+			&s.Payload,
+			&s.Status,
+			&s.Attempts,
+			&s.NextAttemptAt,
+			&s.Summary,
+			&s.LastError,
+			&finishedAt,
+			&s.CreatedAt,
+			&s.UpdatedAt,
+			&s.Channel.Name,
+			&s.Channel.Kind,
+			&s.Channel.BaseURL,
+			&s.Channel.APIKey,
+		)
+		if err != nil {
+			return syncs, err
+		}
+		s.FinishedAt = finishedAt.Time
+		s.Channel.ID = s.ChannelID
+		syncs = append(syncs, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return syncs, err
+	}
+
+	return syncs, nil
+}
+
+// ClaimChannelSyncs locks up to limit pending pushes to active channels that are due, so that no other
+// worker sends them while this one tries. Rows locked by another worker are skipped.
+func (m *postgresDBRepo) ClaimChannelSyncs(limit int, now, lockedUntil time.Time) ([]models.ChannelSync, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `UPDATE channel_syncs s SET locked_until = $1, updated_at = $2
+	FROM channels c
+	WHERE c.id = s.channel_id AND s.id IN (
+		SELECT cs.id FROM channel_syncs cs
+		JOIN channels ch ON (ch.id = cs.channel_id)
+		WHERE ch.active AND cs.status = $3 AND cs.next_attempt_at <= $2 AND (cs.locked_until IS NULL OR cs.locked_until < $2)
+		ORDER BY cs.id
+		LIMIT $4
+		FOR UPDATE OF cs SKIP LOCKED
+	)
+	RETURNING ` + channelSyncColumns
+
+	rows, err := m.DB.QueryContext(ctx, query, lockedUntil, now, models.ChannelSyncPending, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanChannelSyncs(rows)
+}
+
+// MarkChannelSyncSucceeded records that a channel accepted a push
+func (m *postgresDBRepo) MarkChannelSyncSucceeded(id int, summary string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `UPDATE channel_syncs SET status = $1, attempts = attempts + 1, summary = $2, last_error = '', finished_at = $3,
+	locked_until = NULL, updated_at = $3 WHERE id = $4`
+	_, err := m.DB.ExecContext(ctx, query, models.ChannelSyncSucceeded, summary, time.Now(), id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// MarkChannelSyncFailed records a failed attempt at a push. It is tried again at nextAttemptAt, or given up
+// on when dead is true.
+func (m *postgresDBRepo) MarkChannelSyncFailed(id int, syncErr string, nextAttemptAt time.Time, dead bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	status := models.ChannelSyncPending
+	var finishedAt sql.NullTime
+	if dead {
+		status = models.ChannelSyncFailed
+		finishedAt = sql.NullTime{Time: now, Valid: true}
+	}
+
+	query := `UPDATE channel_syncs SET status = $1, attempts = attempts + 1, last_error = $2, next_attempt_at = $3, finished_at = $4,
+	locked_until = NULL, updated_at = $5 WHERE id = $6`
+	_, err := m.DB.ExecContext(ctx, query, status, syncErr, nextAttemptAt, finishedAt, now, id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetChannelSyncLog returns the most recent syncs with a channel
+func (m *postgresDBRepo) GetChannelSyncLog(channelID int) ([]models.ChannelSync, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `SELECT ` + channelSyncColumns + `
+	FROM channel_syncs s
+	LEFT JOIN channels c ON (c.id = s.channel_id)
+	WHERE s.channel_id = $1
+	ORDER BY s.id DESC
+	LIMIT 200`
+
+	rows, err := m.DB.QueryContext(ctx, query, channelID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanChannelSyncs(rows)
+}
+
+// RetryChannelSync queues a failed push to be sent again straight away
+func (m *postgresDBRepo) RetryChannelSync(channelID, id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `UPDATE channel_syncs SET status = $1, attempts = 0, next_attempt_at = $2, finished_at = NULL, updated_at = $2
+	WHERE channel_id = $3 AND id = $4 AND status = $5 AND operation <> $6`
+	result, err := m.DB.ExecContext(ctx, query, models.ChannelSyncPending, time.Now(), channelID, id, models.ChannelSyncFailed, models.ChannelPullBookings)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetReservationByChannelBooking returns the reservation made for a booking on a channel, reporting whether
+// there is one
+func (m *postgresDBRepo) GetReservationByChannelBooking(channelID int, bookingID string) (models.Reservation, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var res models.Reservation
+
+	query := `SELECT id, room_id, start_date, end_date, status FROM reservations
+	WHERE channel_id = $1 AND channel_booking_id = $2
+	ORDER BY id DESC
+	LIMIT 1`
+	err := m.DB.QueryRowContext(ctx, query, channelID, bookingID).Scan(
+		&res.ID,
+		&res.RoomID,
+		&res.StartDate,
+		&res.EndDate,
+		&res.Status,
+	)
+	if err == sql.ErrNoRows {
+		return res, false, nil
+	}
+	if err != nil {
+		return res, false, err
+	}
+	res.ChannelID = channelID
+	res.ChannelBookingID = bookingID
+	return res, true, nil
+}
+
+// UpdateChannelPulledAt records the time of the latest booking change pulled from a channel
+func (m *postgresDBRepo) UpdateChannelPulledAt(id int, pulledAt time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `UPDATE channels SET last_pulled_at = $1, updated_at = $2 WHERE id = $3`, pulledAt, time.Now(), id)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// occupiedNights lists each night from $1 up to $2 that a room is held, and whether a reservation holds it.
+// A night held by a reservation and a block, such as a block imported over a reservation, is sold.
+const occupiedNights = `WITH nights AS (
+	SELECT rr.room_id, d::date AS night, bool_or(rr.reservation_id IS NOT NULL) AS sold
+	FROM room_restrictions rr
+	CROSS JOIN LATERAL generate_series(GREATEST(rr.start_date, $1::date), LEAST(rr.end_date, $2::date) - 1, interval '1 day') d
+	WHERE rr.start_date < $2::date AND rr.end_date > $1::date
+	GROUP BY rr.room_id, d::date
+)`
+
+// GetOccupancyReport adds up the nights each room was reserved and blocked over the nights from start up
+// to end, the rooms reserved and blocked on each of those nights, and the reservations arriving in them.
+// Only the nights of a restriction that fall within the range are counted, and a night is only blocked
+// when no reservation holds the room.
+func (m *postgresDBRepo) GetOccupancyReport(start, end time.Time) (models.OccupancyReport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	report := models.OccupancyReport{Start: start, End: end}
+
+	query := occupiedNights + `
+	SELECT rm.id, rm.room_name, rm.nightly_rate,
+	COUNT(n.night) FILTER (WHERE n.sold),
+	COUNT(n.night) FILTER (WHERE NOT n.sold)
+	FROM rooms rm
+	LEFT JOIN nights n ON (n.room_id = rm.id)
+	GROUP BY rm.id, rm.room_name, rm.nightly_rate
+	ORDER BY rm.room_name`
+
+	rows, err := m.DB.QueryContext(ctx, query, start, end)
+	if err != nil {
+		return report, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ro models.RoomOccupancy
+		err := rows.Scan(&ro.RoomID, &ro.RoomName, &ro.NightlyRate, &ro.NightsSold, &ro.NightsBlocked)
+		if err != nil {
+			return report, err
+		}
+		report.Rooms = append(report.Rooms, ro)
+	}
+
+	if err = rows.Err(); err != nil {
+		return report, err
+	}
+
+	query = occupiedNights + `
+	SELECT d::date,
+	COUNT(n.room_id) FILTER (WHERE n.sold),
+	COUNT(n.room_id) FILTER (WHERE NOT n.sold)
+	FROM generate_series($1::date, $2::date - 1, interval '1 day') d
+	LEFT JOIN nights n ON (n.night = d::date)
+	GROUP BY d
+	ORDER BY d`
+
+	dayRows, err := m.DB.QueryContext(ctx, query, start, end)
+	if err != nil {
+		return report, err
+	}
+	defer dayRows.Close()
+
+	for dayRows.Next() {
+		var d models.DailyOccupancy
+		err := dayRows.Scan(&d.Date, &d.RoomsSold, &d.RoomsBlocked)
+		if err != nil {
+			return report, err
+		}
+		report.Daily = append(report.Daily, d)
+	}
+
+	if err = dayRows.Err(); err != nil {
+		return report, err
+	}
+
+	query = `SELECT COUNT(*),
+	COUNT(*) FILTER (WHERE status = $3),
+	COALESCE(SUM(end_date - start_date) FILTER (WHERE status <> $3), 0),
+	COALESCE(SUM(GREATEST(start_date - created_at::date, 0)) FILTER (WHERE status <> $3), 0)
+	FROM reservations
+	WHERE start_date >= $1::date AND start_date < $2::date`
+
+	err = m.DB.QueryRowContext(ctx, query, start, end, models.ReservationStatusCancelled).Scan(
+		&report.Stays.Reservations,
+		&report.Stays.Cancellations,
+		&report.Stays.StayNights,
+		&report.Stays.LeadDays,
+	)
+	if err != nil {
+		return report, err
+	}
+
+	return report, nil
+}
+
+// ImportReservations inserts a batch of reservations read from a file, with the restrictions that hold their
+// rooms, in a single transaction. Guests are found by email address, and those that are new are created as
+// part of the batch. If any stay overlaps a restriction already held on its room nothing is imported and
+// repository.ErrRoomUnavailable is returned. It returns the id of the batch.
+func (m *postgresDBRepo) ImportReservations(batch models.ImportBatch, reservations []models.Reservation) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, `INSERT INTO import_batches (file_name, user_id, reservations, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+		batch.FileName, nullableID(batch.UserID), len(reservations), time.Now(), time.Now()).Scan(&batch.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	guests := make(map[string]int)
+	for _, res := range reservations {
+		if res.Status != models.ReservationStatusCancelled {
+			var taken bool
+			err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM room_restrictions WHERE room_id = $1 AND $2 < end_date AND $3 > start_date)`,
+				res.RoomID, res.StartDate, res.EndDate).Scan(&taken)
+			if err != nil {
+				return 0, err
+			}
+			if taken {
+				return 0, fmt.Errorf("%s %s from %s: %w", res.FirstName, res.LastName, res.StartDate.Format("2006-01-02"), repository.ErrRoomUnavailable)
+			}
+		}
+
+		email := strings.ToLower(strings.TrimSpace(res.Email))
+		id, ok := guests[email]
+		if !ok {
+			id, err = importGuest(ctx, tx, res, batch.ID)
+			if err != nil {
+				return 0, err
+			}
+			guests[email] = id
+		}
+
+		res.GuestID = id
+		res.ImportBatchID = batch.ID
+		res.ID, err = insertReservation(ctx, tx, res)
+		if err != nil {
+			return 0, err
+		}
+
+		if res.Status != models.ReservationStatusCancelled {
+			err = insertRoomRestriction(ctx, tx, models.RoomRestriction{
+				StartDate:     res.StartDate,
+				EndDate:       res.EndDate,
+				RoomID:        res.RoomID,
+				ReservationID: res.ID,
+				RestrictionID: 1,
+			})
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	return batch.ID, nil
+}
+
+// importGuest returns the id of the guest with a reservation's email address. Like FindOrCreateGuest the
+// details of an existing guest are left alone; a guest who is new is created as part of the batch so that
+// undoing it removes them.
+func importGuest(ctx context.Context, q queryer, res models.Reservation, batchID int) (int, error) {
+	var id int
+	query := `INSERT INTO guests (first_name, last_name, email, phone, import_batch_id, created_at, updated_at)
+	VALUES ($1, $2, lower(trim($3)), $4, $5, $6, $7)
+	ON CONFLICT (email) DO NOTHING
+	RETURNING id`
+	err := q.QueryRowContext(ctx, query, res.FirstName, res.LastName, res.Email, res.Phone, batchID, time.Now(), time.Now()).Scan(&id)
+	if err == sql.ErrNoRows {
+		err = q.QueryRowContext(ctx, `SELECT id FROM guests WHERE email = lower(trim($1))`, res.Email).Scan(&id)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// AllImportBatches returns every import of reservations, newest first, with who imported it
+func (m *postgresDBRepo) AllImportBatches() ([]models.ImportBatch, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var batches []models.ImportBatch
+
+	query := `SELECT b.id, b.file_name, COALESCE(b.user_id, 0), b.reservations, b.reverted_at, b.created_at, b.updated_at,
+		COALESCE(u.first_name, ''), COALESCE(u.last_name, '')
+	FROM import_batches b
+	LEFT JOIN users u ON (u.id = b.user_id)
+	ORDER BY b.created_at DESC, b.id DESC`
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return batches, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var b models.ImportBatch
+		var revertedAt sql.NullTime
+		err = rows.Scan(
+			&b.ID,
+			&b.FileName,
+			&b.UserID,
+			&b.Reservations,
+			&revertedAt,
+			&b.CreatedAt,
+			&b.UpdatedAt,
+			&b.User.FirstName,
+			&b.User.LastName,
+		)
+		if err != nil {
+			return batches, err
+		}
+		b.RevertedAt = revertedAt.Time
+		b.User.ID = b.UserID
+		batches = append(batches, b)
+	}
+
+	if err = rows.Err(); err != nil {
+		return batches, err
+	}
+
+	return batches, nil
+}
+
+// RevertImportBatch removes the reservations imported in a batch, along with their restrictions and the
+// guests the batch created that have no other reservations, in a single transaction. The batch itself is
+// kept as a record of the import. It returns sql.ErrNoRows if there is no such batch or it was already
+// undone, and the number of reservations removed otherwise.
+func (m *postgresDBRepo) RevertImportBatch(id int) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `UPDATE import_batches SET reverted_at = $1, updated_at = $1 WHERE id = $2 AND reverted_at IS NULL`,
+		time.Now(), id)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		return 0, sql.ErrNoRows
+	}
+
+	// restrictions and everything else hanging off a reservation are removed with it
+	result, err = tx.ExecContext(ctx, `DELETE FROM reservations WHERE import_batch_id = $1`, id)
+	if err != nil {
+		return 0, err
+	}
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM guests g WHERE g.import_batch_id = $1
+	AND NOT EXISTS (SELECT 1 FROM reservations r WHERE r.guest_id = g.id)`, id)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	return int(removed), nil
+}
+
+// GetRestrictionsByDate returns the restrictions on every room that cover any of the nights from start up
+// to end, ordered by room and start date, along with the guest, status, tags and dates of their reservations
+func (m *postgresDBRepo) GetRestrictionsByDate(start, end time.Time) ([]models.RoomRestriction, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var restrictions []models.RoomRestriction
+
+	query := `SELECT rr.id, COALESCE(rr.reservation_id, 0), rr.restriction_id, rr.room_id, rr.start_date, rr.end_date,
+		COALESCE(rr.import_id, 0), COALESCE(x.restriction_name, ''),
+		COALESCE(r.first_name, ''), COALESCE(r.last_name, ''), COALESCE(r.status, ''), ` + reservationTagsColumn + `,
+		COALESCE(r.start_date, rr.start_date), COALESCE(r.end_date, rr.end_date)
+	FROM room_restrictions rr
+	LEFT JOIN restrictions x ON (x.id = rr.restriction_id)
+	LEFT JOIN reservations r ON (r.id = rr.reservation_id)
+	WHERE $1 < rr.end_date AND $2 > rr.start_date
+	ORDER BY rr.room_id, rr.start_date, rr.id`
+
+	rows, err := m.DB.QueryContext(ctx, query, start, end)
+	if err != nil {
+		return restrictions, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rr models.RoomRestriction
+		var tags string
+		err = rows.Scan(
+			&rr.ID,
+			&rr.ReservationID,
+			&rr.RestrictionID,
+			&rr.RoomID,
+			&rr.StartDate,
+			&rr.EndDate,
+			&rr.ImportID,
+			&rr.Restriction.RestrictionName,
+			&rr.Reservation.FirstName,
+			&rr.Reservation.LastName,
+			&rr.Reservation.Status,
+			&tags,
+			&rr.Reservation.StartDate,
+			&rr.Reservation.EndDate,
+		)
+		if err != nil {
+			return restrictions, err
+		}
+		rr.Restriction.ID = rr.RestrictionID
+		rr.Reservation.ID = rr.ReservationID
+		rr.Reservation.Tags = splitTags(tags)
+		restrictions = append(restrictions, rr)
+	}
+
+	if err = rows.Err(); err != nil {
+		return restrictions, err
+	}
+
+	return restrictions, nil
+}
+
+// ChangeReservationStay moves a reservation to a room and dates, updating the reservation and the restriction
+// holding its room together. The new stay is checked against the other restrictions on the room inside the
+// transaction, and ErrRoomUnavailable is returned if it overlaps one. The reservation's iCal sequence is
+// increased, and notices builds the emails telling the guest from the new sequence.
+func (m *postgresDBRepo) ChangeReservationStay(id, roomID int, start, end time.Time, notices func(sequence int) ([]models.MailData, error)) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var taken bool
+	query := `SELECT EXISTS (SELECT 1 FROM room_restrictions WHERE room_id = $1 AND $2 < end_date AND $3 > start_date
+	AND (reservation_id IS NULL OR reservation_id <> $4))`
+	err = tx.QueryRowContext(ctx, query, roomID, start, end, id).Scan(&taken)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return repository.ErrRoomUnavailable
+	}
+
+	var sequence int
+	query = `UPDATE reservations SET room_id = $1, start_date = $2, end_date = $3, ical_sequence = ical_sequence + 1,
+	updated_at = $4 WHERE id = $5 RETURNING ical_sequence`
+	err = tx.QueryRowContext(ctx, query, roomID, start, end, time.Now(), id).Scan(&sequence)
+	if err != nil {
+		return err
+	}
+
+	query = `UPDATE room_restrictions SET room_id = $1, start_date = $2, end_date = $3, updated_at = $4
+	WHERE reservation_id = $5`
+	_, err = tx.ExecContext(ctx, query, roomID, start, end, time.Now(), id)
+	if err != nil {
+		return err
+	}
+
+	messages, err := notices(sequence)
+	if err != nil {
+		return err
+	}
+
+	for _, msg := range messages {
+		err = insertOutbox(ctx, tx, msg)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
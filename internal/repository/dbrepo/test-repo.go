@@ -1,11 +1,13 @@
 package dbrepo
 
 import (
+	"database/sql"
 	"errors"
 	"log"
 	"time"
 
 	"github.com/Poojasadgir/room-reservation/internal/models"
+	"github.com/Poojasadgir/room-reservation/internal/repository"
 )
 
 func (m *testDBRepo) AllUsers() bool {
@@ -49,6 +51,11 @@ func (m *testDBRepo) SearchAvailabilityByDatesByRoomID(start, end time.Time, roo
 		return false, errors.New("some error")
 	}
 
+	// room 2, the last room of split stay 6, is free after the stay ends
+	if roomID == 2 && start.Equal(time.Date(2050, 1, 12, 0, 0, 0, 0, time.UTC)) {
+		return true, nil
+	}
+
 	// if the start date is after 2049-12-31, then return false,
 	// indicating no availability;
 	if start.After(t) {
@@ -101,6 +108,11 @@ func (m *testDBRepo) GetRoomByID(id int) (models.Room, error) {
 	if id > 2 {
 		return room, errors.New("some error")
 	}
+	// room 1 publishes a calendar feed, room 2 does not
+	if id == 1 {
+		room.ID = 1
+		room.ICalToken = "feed-token"
+	}
 	return room, nil
 }
 
@@ -124,29 +136,104 @@ func (m *testDBRepo) Authenticate(email, testPassword string) (int, string, erro
 	return 0, "", errors.New("some error")
 }
 
-// AllReservations returns a slice of all reservations
-func (m *testDBRepo) AllReservations() ([]models.Reservation, error) {
-	var reservations []models.Reservation
+// testReservations are the reservations of the test lists
+func testReservations() []models.Reservation {
+	start := time.Date(2050, 1, 10, 0, 0, 0, 0, time.UTC)
+	return []models.Reservation{
+		{ID: 1, FirstName: "Jane", LastName: "Smith", Email: "jane@example.com", StartDate: start, EndDate: start.AddDate(0, 0, 2), RoomID: 1, Status: models.ReservationStatusConfirmed, Tags: []string{"VIP"}, Room: models.Room{ID: 1, RoomName: "General's Quarters", NightlyRate: 12000}},
+		{ID: 2, FirstName: "John", LastName: "Doe", StartDate: start, EndDate: start.AddDate(0, 0, 1), RoomID: 2, Status: models.ReservationStatusCancelled, CancellationFee: 5000, Room: models.Room{ID: 2, RoomName: "Major's Suite"}},
+	}
+}
 
-	return reservations, nil
+// FindReservations returns a page of the two test reservations, or fails for the tag "fail"
+func (m *testDBRepo) FindReservations(q models.ReservationQuery) (models.ReservationPage, error) {
+	if q.Tag == "fail" {
+		return models.ReservationPage{}, errors.New("some error")
+	}
+
+	page := models.ReservationPage{Total: 2, Page: q.Page, PerPage: q.PerPage}
+	if page.Page > page.Pages() {
+		page.Page = page.Pages()
+	}
+	if page.Page < 1 {
+		page.Page = 1
+	}
+
+	reservations := testReservations()
+	for i := (page.Page - 1) * q.PerPage; i < len(reservations) && (q.PerPage == 0 || len(page.Reservations) < q.PerPage); i++ {
+		page.Reservations = append(page.Reservations, reservations[i])
+	}
+	return page, nil
 }
 
-// AllNewReservations returns a slice of all new reservations
-func (m *testDBRepo) AllNewReservations() ([]models.Reservation, error) {
-	var reservations []models.Reservation
+// EachReservation calls fn with the two test reservations, or fails for the tag "fail"
+func (m *testDBRepo) EachReservation(q models.ReservationQuery, fn func(models.Reservation) error) error {
+	if q.Tag == "fail" {
+		return errors.New("some error")
+	}
 
-	return reservations, nil
+	for _, res := range testReservations() {
+		if err := fn(res); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // GetReservationByID returns one reservation by ID
 func (m *testDBRepo) GetReservationByID(id int) (models.Reservation, error) {
 	var res models.Reservation
+	if id == 3 || id > 7 {
+		return res, errors.New("some error")
+	}
+
+	res.ID = id
+	res.Email = "john@smith.com"
+	res.RoomID = 1
+	res.Status = models.ReservationStatusConfirmed
+	res.StartDate = time.Date(2050, 1, 10, 0, 0, 0, 0, time.UTC)
+	res.EndDate = time.Date(2050, 1, 13, 0, 0, 0, 0, time.UTC)
+	res.Version = 1
+	res.CancelToken = "secret"
+	switch id {
+	case 2:
+		res.Status = models.ReservationStatusCheckedIn
+	case 4:
+		res.Status = models.ReservationStatusCancelled
+	case 5:
+		// arrives tomorrow, inside the flexible policy's free cancellation window
+		res.StartDate = time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 1)
+		res.EndDate = res.StartDate.AddDate(0, 0, 3)
+		res.Room.CancellationPolicyID = 1
+		res.Room.NightlyRate = 10000
+	case 6:
+		// checked in to room 1 and moves to room 2 for its last night
+		res.Status = models.ReservationStatusCheckedIn
+		res.EndDate = time.Date(2050, 1, 12, 0, 0, 0, 0, time.UTC)
+		res.Segments = []models.StaySegment{
+			{RoomID: 1, StartDate: res.StartDate, EndDate: time.Date(2050, 1, 11, 0, 0, 0, 0, time.UTC)},
+			{RoomID: 2, StartDate: time.Date(2050, 1, 11, 0, 0, 0, 0, time.UTC), EndDate: res.EndDate},
+		}
+	case 7:
+		// was due yesterday and has not checked in
+		res.StartDate = time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -1)
+		res.EndDate = res.StartDate.AddDate(0, 0, 3)
+	}
 
 	return res, nil
 }
 
-// UpdateReservation updates a reservation in the database
+// UpdateReservation updates a reservation in the database. Saving over any version but the first is a
+// conflict with changes made by someone else.
 func (m *testDBRepo) UpdateReservation(res models.Reservation) error {
+	if res.Version != 1 {
+		current, _ := m.GetReservationByID(res.ID)
+		current.FirstName = "Jane"
+		current.Email = "jane@example.com"
+		current.Version = 2
+		current.Tags = []string{"vip"}
+		return &repository.ConflictError{Current: current}
+	}
 	return nil
 }
 
@@ -161,7 +248,9 @@ func (m *testDBRepo) UpdateProcessedReservation(id, processed int) error {
 }
 
 func (m *testDBRepo) AllRooms() ([]models.Room, error) {
-	var rooms []models.Room
+	rooms := []models.Room{
+		{ID: 1, RoomName: "General's Quarters"},
+	}
 	return rooms, nil
 }
 
@@ -172,11 +261,828 @@ func (m *testDBRepo) GetRestrictionsForRoomByDate(roomID int, start, end time.Ti
 }
 
 // InsertBlockForRoom inserts a room restriction
-func (m *testDBRepo) InsertBlockForRoom(id int, startDate time.Time) error {
-	return nil
+func (m *testDBRepo) InsertBlockForRoom(id int, startDate time.Time) (int, error) {
+	return 1, nil
 }
 
 // DeleteBlockByID deletes a room restriction
 func (m *testDBRepo) DeleteBlockByID(id int) error {
 	return nil
 }
+
+// AllCancellationPolicies returns a slice of all cancellation policies
+func (m *testDBRepo) AllCancellationPolicies() ([]models.CancellationPolicy, error) {
+	var policies []models.CancellationPolicy
+	return policies, nil
+}
+
+// GetCancellationPolicyByID returns one cancellation policy by ID
+func (m *testDBRepo) GetCancellationPolicyByID(id int) (models.CancellationPolicy, error) {
+	var p models.CancellationPolicy
+	if id > 2 {
+		return p, errors.New("some error")
+	}
+
+	p.ID = id
+	p.PolicyName = "Flexible"
+	p.FreeCancellationHours = 48
+	p.FeeNights = 1
+	p.NoShowFeeNights = 1
+	p.ReleaseNoShows = true
+	return p, nil
+}
+
+// InsertCancellationPolicy inserts a new cancellation policy and returns its ID
+func (m *testDBRepo) InsertCancellationPolicy(p models.CancellationPolicy) (int, error) {
+	return 1, nil
+}
+
+// UpdateCancellationPolicy updates a cancellation policy in the database
+func (m *testDBRepo) UpdateCancellationPolicy(p models.CancellationPolicy) error {
+	return nil
+}
+
+// UpdateRoomCancellationPolicy sets the nightly rate and cancellation policy for a room
+func (m *testDBRepo) UpdateRoomCancellationPolicy(roomID, policyID, nightlyRate int) error {
+	return nil
+}
+
+// CancelReservation marks a reservation as cancelled and releases its room restrictions. Reservation 5 is
+// cancelled inside its free cancellation window, so anything but its one night fee is an error.
+func (m *testDBRepo) CancelReservation(id, fee int, cancelledBy string, notices []models.MailData) error {
+	if id == 5 && fee != 10000 {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+// FindOrCreateGuest returns the ID of the guest with the given email address, creating the guest if needed
+func (m *testDBRepo) FindOrCreateGuest(g models.Guest) (int, error) {
+	return 1, nil
+}
+
+// AllGuests returns a slice of all guests
+func (m *testDBRepo) AllGuests() ([]models.Guest, error) {
+	var guests []models.Guest
+	return guests, nil
+}
+
+// EachGuest calls fn with two guests
+func (m *testDBRepo) EachGuest(fn func(models.Guest) error) error {
+	guests := []models.Guest{
+		{ID: 1, FirstName: "Jane", LastName: "Smith", Email: "jane@example.com", Stays: 2, TotalNights: 5, LastStay: time.Date(2050, 1, 10, 0, 0, 0, 0, time.UTC)},
+		{ID: 2, FirstName: "John", LastName: "Doe", Email: "john@example.com"},
+	}
+	for _, g := range guests {
+		if err := fn(g); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetGuestByID returns one guest by ID
+func (m *testDBRepo) GetGuestByID(id int) (models.Guest, error) {
+	var g models.Guest
+	if id > 2 {
+		return g, errors.New("some error")
+	}
+	g.ID = id
+	return g, nil
+}
+
+// PossibleDuplicateGuests returns other guests sharing a name or phone number with the given guest
+func (m *testDBRepo) PossibleDuplicateGuests(id int) ([]models.Guest, error) {
+	var guests []models.Guest
+	return guests, nil
+}
+
+// GetReservationsForGuest returns the stay history of a guest
+func (m *testDBRepo) GetReservationsForGuest(guestID int) ([]models.Reservation, error) {
+	var reservations []models.Reservation
+	return reservations, nil
+}
+
+// UpdateGuest updates a guest in the database
+func (m *testDBRepo) UpdateGuest(g models.Guest) error {
+	if g.Email == "taken@example.com" {
+		return repository.ErrDuplicateEmail
+	}
+	return nil
+}
+
+// MergeGuests merges a duplicate guest into the guest being kept
+func (m *testDBRepo) MergeGuests(keepID, duplicateID int) error {
+	if keepID == duplicateID {
+		return errors.New("cannot merge a guest into themselves")
+	}
+	return nil
+}
+
+// GetNotesForReservation returns the internal notes on a reservation
+func (m *testDBRepo) GetNotesForReservation(reservationID int) ([]models.ReservationNote, error) {
+	var notes []models.ReservationNote
+	return notes, nil
+}
+
+// InsertReservationNote adds an internal note to a reservation
+func (m *testDBRepo) InsertReservationNote(n models.ReservationNote) error {
+	return nil
+}
+
+// GetTagsForReservation returns the tags on a reservation
+func (m *testDBRepo) GetTagsForReservation(reservationID int) ([]string, error) {
+	var tags []string
+	return tags, nil
+}
+
+// SetReservationTags replaces the tags on a reservation
+func (m *testDBRepo) SetReservationTags(reservationID int, tags []string) error {
+	return nil
+}
+
+// AllTags returns every tag in use
+func (m *testDBRepo) AllTags() ([]string, error) {
+	var tags []string
+	return tags, nil
+}
+
+// AllBookingQuestions returns every booking question
+func (m *testDBRepo) AllBookingQuestions() ([]models.BookingQuestion, error) {
+	var questions []models.BookingQuestion
+	return questions, nil
+}
+
+// GetBookingQuestionsForRoom returns the active booking questions asked when booking a room.
+// Room 1 asks a required choice question so that handler tests can exercise validation.
+func (m *testDBRepo) GetBookingQuestionsForRoom(roomID int) ([]models.BookingQuestion, error) {
+	var questions []models.BookingQuestion
+	if roomID == 1 {
+		questions = append(questions, models.BookingQuestion{
+			ID:       1,
+			Label:    "Bed type",
+			Kind:     models.QuestionKindChoice,
+			Choices:  []string{"Queen", "Twin"},
+			Required: true,
+			Active:   true,
+		})
+	}
+	return questions, nil
+}
+
+// InsertBookingQuestion inserts a new booking question
+func (m *testDBRepo) InsertBookingQuestion(q models.BookingQuestion) (int, error) {
+	return 1, nil
+}
+
+// UpdateBookingQuestion updates a booking question
+func (m *testDBRepo) UpdateBookingQuestion(q models.BookingQuestion) error {
+	return nil
+}
+
+// InsertReservationAnswers stores a guest's answers to the booking questions for a reservation
+func (m *testDBRepo) InsertReservationAnswers(reservationID int, answers []models.ReservationAnswer) error {
+	return nil
+}
+
+// GetAnswersForReservation returns the answers given to booking questions for a reservation
+func (m *testDBRepo) GetAnswersForReservation(reservationID int) ([]models.ReservationAnswer, error) {
+	var answers []models.ReservationAnswer
+	return answers, nil
+}
+
+// GetArrivalsByDate returns the reservations due to arrive on a date
+func (m *testDBRepo) GetArrivalsByDate(date time.Time) ([]models.Reservation, error) {
+	var reservations []models.Reservation
+	return reservations, nil
+}
+
+// GetDeparturesByDate returns the reservations due to depart on a date
+func (m *testDBRepo) GetDeparturesByDate(date time.Time) ([]models.Reservation, error) {
+	var reservations []models.Reservation
+	return reservations, nil
+}
+
+// CheckInReservation records a guest's arrival
+func (m *testDBRepo) CheckInReservation(id int, arrivedAt time.Time, idVerified bool) error {
+	return nil
+}
+
+// CheckOutReservation records a guest's departure
+func (m *testDBRepo) CheckOutReservation(id int, departedAt time.Time) error {
+	return nil
+}
+
+// UpdateRoomHousekeepingStatus sets the housekeeping status of a room
+func (m *testDBRepo) UpdateRoomHousekeepingStatus(roomID int, status string) error {
+	if roomID > 2 {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+// InsertHousekeepingTasks inserts cleaning tasks
+func (m *testDBRepo) InsertHousekeepingTasks(tasks []models.HousekeepingTask) error {
+	return nil
+}
+
+// GetHousekeepingTasksByDate returns the cleaning tasks for a date
+func (m *testDBRepo) GetHousekeepingTasksByDate(date time.Time) ([]models.HousekeepingTask, error) {
+	var tasks []models.HousekeepingTask
+	return tasks, nil
+}
+
+// CompleteHousekeepingTask marks a cleaning task as done
+func (m *testDBRepo) CompleteHousekeepingTask(id, userID int) error {
+	if id > 2 {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+// GetNoShowCandidates returns the confirmed reservations that were never checked in
+// A reservation arriving on 2050-01-10 is returned once arrivedBy reaches that date.
+func (m *testDBRepo) GetNoShowCandidates(arrivedBy time.Time) ([]models.Reservation, error) {
+	var reservations []models.Reservation
+
+	arrival := time.Date(2050, 1, 10, 0, 0, 0, 0, time.UTC)
+	if !arrivedBy.Before(arrival) {
+		reservations = append(reservations, models.Reservation{
+			ID:        1,
+			StartDate: arrival,
+			EndDate:   arrival.AddDate(0, 0, 3),
+			RoomID:    1,
+			Status:    models.ReservationStatusConfirmed,
+			Room:      models.Room{ID: 1, NightlyRate: 10000, CancellationPolicyID: 1},
+		})
+	}
+	return reservations, nil
+}
+
+// MarkNoShow flags a reservation as a no-show
+func (m *testDBRepo) MarkNoShow(id, fee int, release bool, at time.Time) error {
+	return nil
+}
+
+// GetNoShowsSince returns the reservations flagged as no-shows since a time
+func (m *testDBRepo) GetNoShowsSince(since time.Time) ([]models.Reservation, error) {
+	var reservations []models.Reservation
+	return reservations, nil
+}
+
+// GetArrivalsToRemind returns reservation 1 for arrivals on 2050-01-10, and reservation 2, whose guest has
+// already been reminded, for arrivals on 2050-01-11
+func (m *testDBRepo) GetArrivalsToRemind(arrival time.Time) ([]int, error) {
+	switch {
+	case arrival.Equal(time.Date(2050, 1, 10, 0, 0, 0, 0, time.UTC)):
+		return []int{1}, nil
+	case arrival.Equal(time.Date(2050, 1, 11, 0, 0, 0, 0, time.UTC)):
+		return []int{2}, nil
+	}
+	return nil, nil
+}
+
+// QueueArrivalReminder marks a reservation's guest as reminded and queues the reminder. The guest of
+// reservation 2 has already been reminded.
+func (m *testDBRepo) QueueArrivalReminder(id int, msg models.MailData) (bool, error) {
+	return id != 2, nil
+}
+
+// RegisterJob records a background job
+func (m *testDBRepo) RegisterJob(name, schedule string, nextRunAt time.Time) error {
+	return nil
+}
+
+// ClaimJob locks a due job for one app instance
+func (m *testDBRepo) ClaimJob(name, instance string, now, lockedUntil time.Time) (models.Job, bool, error) {
+	return models.Job{}, false, nil
+}
+
+// FinishJob records a run of a job
+func (m *testDBRepo) FinishJob(run models.JobRun, nextRunAt time.Time, attempts int) error {
+	return nil
+}
+
+// AllJobs returns every registered background job
+func (m *testDBRepo) AllJobs() ([]models.Job, error) {
+	var jobs []models.Job
+	return jobs, nil
+}
+
+// GetRecentJobRuns returns the most recent job runs
+func (m *testDBRepo) GetRecentJobRuns(limit int) ([]models.JobRun, error) {
+	var runs []models.JobRun
+	return runs, nil
+}
+
+// RunJobNow makes a job due immediately
+func (m *testDBRepo) RunJobNow(name string) error {
+	if name == "missing" {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+// CreateReservation inserts a reservation with its room restriction, answers and notification emails
+func (m *testDBRepo) CreateReservation(res models.Reservation, answers []models.ReservationAnswer, notices func(id int) ([]models.MailData, error)) (int, error) {
+	// if the room id is 2, then fail; otherwise, pass
+	if res.RoomID == 2 {
+		return 0, errors.New("some error")
+	}
+	_, err := notices(1)
+	if err != nil {
+		return 0, err
+	}
+	return 1, nil
+}
+
+// QueueMail adds an email to the outbox
+func (m *testDBRepo) QueueMail(msg models.MailData) error {
+	return nil
+}
+
+// ClaimOutboxMessages locks pending emails that are due to be sent
+func (m *testDBRepo) ClaimOutboxMessages(limit int, now, lockedUntil time.Time) ([]models.OutboxMessage, error) {
+	messages := []models.OutboxMessage{
+		{
+			ID: 1,
+			MailData: models.MailData{
+				To:       "john@smith.com",
+				From:     "me@here.com",
+				Subject:  "Reservation Confirmation",
+				Content:  "<strong>Reservation Confirmation</strong>",
+				Text:     "Reservation Confirmation",
+				Template: "confirmation",
+			},
+			Status: models.OutboxPending,
+		},
+		{
+			ID: 2,
+			MailData: models.MailData{
+				To:      "not an address",
+				From:    "me@here.com",
+				Subject: "Reservation Notification",
+			},
+			Status:   models.OutboxPending,
+			Attempts: 2,
+		},
+		{
+			ID: 3,
+			MailData: models.MailData{
+				To:       "jane@example.com",
+				From:     "me@here.com",
+				Subject:  "Reservation Notification",
+				Content:  "<strong>Reservation Notification</strong>",
+				Template: "basic.html",
+			},
+			Status: models.OutboxPending,
+		},
+	}
+	return messages, nil
+}
+
+// MarkOutboxSent records that an email was delivered
+func (m *testDBRepo) MarkOutboxSent(id int) error {
+	return nil
+}
+
+// MarkOutboxFailed records a failed attempt to send an email
+func (m *testDBRepo) MarkOutboxFailed(id int, sendErr string, nextAttemptAt time.Time, dead bool) error {
+	return nil
+}
+
+// GetOutboxMessages returns the most recent emails in the outbox
+func (m *testDBRepo) GetOutboxMessages(status string) ([]models.OutboxMessage, error) {
+	var messages []models.OutboxMessage
+	return messages, nil
+}
+
+// ResendOutboxMessage puts an email back in the queue
+func (m *testDBRepo) ResendOutboxMessage(id int) error {
+	if id > 2 {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+// UpdateRoomCalendarFeed sets the calendar feed settings of a room
+func (m *testDBRepo) UpdateRoomCalendarFeed(roomID int, token string, showGuests bool) error {
+	if roomID > 2 {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+// GetCalendarFeedRestrictions returns the reservations and blocks of a room
+func (m *testDBRepo) GetCalendarFeedRestrictions(roomID int, from time.Time) ([]models.RoomRestriction, error) {
+	restrictions := []models.RoomRestriction{
+		{
+			ID:            1,
+			RoomID:        roomID,
+			ReservationID: 1,
+			RestrictionID: 1,
+			StartDate:     time.Date(2050, 1, 10, 0, 0, 0, 0, time.UTC),
+			EndDate:       time.Date(2050, 1, 13, 0, 0, 0, 0, time.UTC),
+			Reservation:   models.Reservation{ID: 1, FirstName: "John", LastName: "Smith"},
+		},
+		{
+			ID:            2,
+			RoomID:        roomID,
+			RestrictionID: 2,
+			StartDate:     time.Date(2050, 1, 20, 0, 0, 0, 0, time.UTC),
+			EndDate:       time.Date(2050, 1, 21, 0, 0, 0, 0, time.UTC),
+		},
+	}
+	return restrictions, nil
+}
+
+// testCalendar is the uploaded calendar of the test calendar import
+const testCalendar = "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n" +
+	"BEGIN:VEVENT\r\nUID:ext-1@example.com\r\nDTSTART;VALUE=DATE:20500110\r\nDTEND;VALUE=DATE:20500113\r\nSUMMARY:Reserved\r\nEND:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+// AllCalendarImports returns every calendar import
+func (m *testDBRepo) AllCalendarImports() ([]models.CalendarImport, error) {
+	imports := []models.CalendarImport{
+		{
+			ID:      1,
+			RoomID:  1,
+			Name:    "Booking site",
+			Content: testCalendar,
+			Room:    models.Room{ID: 1, RoomName: "General's Quarters"},
+			Conflicts: []models.CalendarImportConflict{
+				{
+					ID:            1,
+					ImportID:      1,
+					ExternalUID:   "ext-1@example.com",
+					Summary:       "Reserved",
+					StartDate:     time.Date(2050, 1, 10, 0, 0, 0, 0, time.UTC),
+					EndDate:       time.Date(2050, 1, 13, 0, 0, 0, 0, time.UTC),
+					ReservationID: 1,
+					Reservation:   models.Reservation{ID: 1, FirstName: "John", LastName: "Smith"},
+				},
+			},
+		},
+	}
+	return imports, nil
+}
+
+// GetCalendarImportByID returns a calendar import by id. Import 1 is an uploaded file and import 2 is a URL
+// that cannot be reached.
+func (m *testDBRepo) GetCalendarImportByID(id int) (models.CalendarImport, error) {
+	switch id {
+	case 1:
+		return models.CalendarImport{ID: 1, RoomID: 1, Name: "Booking site", Content: testCalendar}, nil
+	case 2:
+		return models.CalendarImport{ID: 2, RoomID: 1, Name: "Other site", URL: "http://127.0.0.1:1/calendar.ics"}, nil
+	}
+	return models.CalendarImport{}, errors.New("some error")
+}
+
+// InsertCalendarImport inserts a calendar import
+func (m *testDBRepo) InsertCalendarImport(ci models.CalendarImport) (int, error) {
+	if ci.RoomID > 2 {
+		return 0, errors.New("some error")
+	}
+	return 1, nil
+}
+
+// DeleteCalendarImport deletes a calendar import
+func (m *testDBRepo) DeleteCalendarImport(id int) error {
+	if id > 2 {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+// GetImportedBlocks returns the blocks imported from a calendar. Import 4 has already imported a block for
+// an event in February.
+func (m *testDBRepo) GetImportedBlocks(importID int) ([]models.RoomRestriction, error) {
+	var blocks []models.RoomRestriction
+	if importID == 4 {
+		blocks = append(blocks, models.RoomRestriction{
+			ID:          7,
+			RoomID:      1,
+			ImportID:    4,
+			ExternalUID: "ext-2@example.com",
+			StartDate:   time.Date(2050, 2, 1, 0, 0, 0, 0, time.UTC),
+			EndDate:     time.Date(2050, 2, 3, 0, 0, 0, 0, time.UTC),
+		})
+	}
+	return blocks, nil
+}
+
+// ApplyCalendarImport saves the changes from syncing a calendar import
+func (m *testDBRepo) ApplyCalendarImport(sync models.CalendarImportSync) ([]int, error) {
+	if sync.ImportID > 2 {
+		return nil, errors.New("some error")
+	}
+	ids := make([]int, len(sync.Create))
+	for i := range ids {
+		ids[i] = i + 1
+	}
+	return ids, nil
+}
+
+// MarkCalendarImportFailed records why a calendar import could not be synced
+func (m *testDBRepo) MarkCalendarImportFailed(id int, syncErr string) error {
+	return nil
+}
+
+// AllWebhookEndpoints returns every webhook endpoint
+func (m *testDBRepo) AllWebhookEndpoints() ([]models.WebhookEndpoint, error) {
+	endpoints := []models.WebhookEndpoint{
+		{ID: 1, URL: "https://example.com/hooks", Secret: "secret", Events: []string{"reservation.created"}, Active: true},
+	}
+	return endpoints, nil
+}
+
+// GetWebhookEndpointByID returns a webhook endpoint by id
+func (m *testDBRepo) GetWebhookEndpointByID(id int) (models.WebhookEndpoint, error) {
+	if id > 2 {
+		return models.WebhookEndpoint{}, errors.New("some error")
+	}
+	return models.WebhookEndpoint{ID: id, URL: "https://example.com/hooks", Secret: "secret", Events: []string{"reservation.created"}, Active: true}, nil
+}
+
+// InsertWebhookEndpoint inserts a webhook endpoint
+func (m *testDBRepo) InsertWebhookEndpoint(e models.WebhookEndpoint) (int, error) {
+	return 1, nil
+}
+
+// UpdateWebhookEndpoint updates a webhook endpoint
+func (m *testDBRepo) UpdateWebhookEndpoint(e models.WebhookEndpoint) error {
+	if e.ID > 2 {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+// DeleteWebhookEndpoint deletes a webhook endpoint
+func (m *testDBRepo) DeleteWebhookEndpoint(id int) error {
+	if id > 2 {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+// QueueWebhookEvent queues an event for the endpoints subscribed to it
+func (m *testDBRepo) QueueWebhookEvent(event string, payload []byte) error {
+	return nil
+}
+
+// ClaimWebhookDeliveries returns one delivery to an endpoint that cannot be reached and one to an invalid address
+func (m *testDBRepo) ClaimWebhookDeliveries(limit int, now, lockedUntil time.Time) ([]models.WebhookDelivery, error) {
+	deliveries := []models.WebhookDelivery{
+		{
+			ID:         1,
+			EndpointID: 1,
+			Event:      "reservation.created",
+			Payload:    `{"event":"reservation.created"}`,
+			Endpoint:   models.WebhookEndpoint{ID: 1, URL: "http://127.0.0.1:1/hooks", Secret: "secret"},
+		},
+		{
+			ID:         2,
+			EndpointID: 2,
+			Event:      "block.deleted",
+			Payload:    `{"event":"block.deleted"}`,
+			Attempts:   9,
+			Endpoint:   models.WebhookEndpoint{ID: 2, URL: "://not a url", Secret: "secret"},
+		},
+	}
+	return deliveries, nil
+}
+
+// MarkWebhookDelivered records that an endpoint accepted a delivery
+func (m *testDBRepo) MarkWebhookDelivered(id, responseCode int) error {
+	return nil
+}
+
+// MarkWebhookFailed records a failed attempt at a delivery
+func (m *testDBRepo) MarkWebhookFailed(id, responseCode int, sendErr string, nextAttemptAt time.Time, dead bool) error {
+	return nil
+}
+
+// GetWebhookDeliveries returns the most recent deliveries to an endpoint
+func (m *testDBRepo) GetWebhookDeliveries(endpointID int) ([]models.WebhookDelivery, error) {
+	deliveries := []models.WebhookDelivery{
+		{ID: 2, EndpointID: endpointID, Event: "reservation.created", Payload: `{}`, Status: models.WebhookDead, Attempts: 10, ResponseCode: 500, LastError: "endpoint responded 500"},
+		{ID: 1, EndpointID: endpointID, Event: "reservation.created", Payload: `{}`, Status: models.WebhookDelivered, Attempts: 1, ResponseCode: 200, DeliveredAt: time.Now()},
+	}
+	return deliveries, nil
+}
+
+// ReplayWebhookDelivery queues a delivery to be sent again
+func (m *testDBRepo) ReplayWebhookDelivery(endpointID, id int) error {
+	if id > 2 {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+// AllChannels returns every channel
+func (m *testDBRepo) AllChannels() ([]models.Channel, error) {
+	ch, _ := m.GetChannelByID(1)
+	return []models.Channel{ch}, nil
+}
+
+// GetChannelByID returns a channel that cannot be reached, with room 1 mapped to it
+func (m *testDBRepo) GetChannelByID(id int) (models.Channel, error) {
+	if id > 2 {
+		return models.Channel{}, errors.New("some error")
+	}
+	return models.Channel{
+		ID:       id,
+		Name:     "Test OTA",
+		Kind:     "http",
+		BaseURL:  "http://127.0.0.1:1",
+		APIKey:   "test-key",
+		Active:   true,
+		Mappings: []models.ChannelRoomMapping{{ChannelID: id, RoomID: 1, RoomCode: "GQ", Room: models.Room{ID: 1, NightlyRate: 12000}}},
+	}, nil
+}
+
+// InsertChannel inserts a channel
+func (m *testDBRepo) InsertChannel(ch models.Channel) (int, error) {
+	return 1, nil
+}
+
+// UpdateChannel updates a channel
+func (m *testDBRepo) UpdateChannel(ch models.Channel) error {
+	if ch.ID > 2 {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+// SetChannelRoomMapping sets the code a channel knows a room by
+func (m *testDBRepo) SetChannelRoomMapping(channelID, roomID int, code string) error {
+	if channelID > 2 {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+// QueueChannelSync queues a push to a channel
+func (m *testDBRepo) QueueChannelSync(channelID int, operation, payload string) error {
+	return nil
+}
+
+// LogChannelSync records a finished sync
+func (m *testDBRepo) LogChannelSync(s models.ChannelSync) error {
+	return nil
+}
+
+// ClaimChannelSyncs returns one push to a channel that cannot be reached and one to a channel of an unknown kind
+func (m *testDBRepo) ClaimChannelSyncs(limit int, now, lockedUntil time.Time) ([]models.ChannelSync, error) {
+	syncs := []models.ChannelSync{
+		{
+			ID:        1,
+			ChannelID: 1,
+			Operation: models.ChannelPushAvailability,
+			Payload:   `[{"room_code":"GQ","date":"2050-01-01","available":1}]`,
+			Channel:   models.Channel{ID: 1, Name: "Test OTA", Kind: "http", BaseURL: "http://127.0.0.1:1"},
+		},
+		{
+			ID:        2,
+			ChannelID: 2,
+			Operation: models.ChannelPushRates,
+			Payload:   `[]`,
+			Attempts:  7,
+			Channel:   models.Channel{ID: 2, Name: "Unknown", Kind: "carrier-pigeon"},
+		},
+	}
+	return syncs, nil
+}
+
+// MarkChannelSyncSucceeded records that a channel accepted a push
+func (m *testDBRepo) MarkChannelSyncSucceeded(id int, summary string) error {
+	return nil
+}
+
+// MarkChannelSyncFailed records a failed attempt at a push
+func (m *testDBRepo) MarkChannelSyncFailed(id int, syncErr string, nextAttemptAt time.Time, dead bool) error {
+	return nil
+}
+
+// GetChannelSyncLog returns the most recent syncs with a channel
+func (m *testDBRepo) GetChannelSyncLog(channelID int) ([]models.ChannelSync, error) {
+	syncs := []models.ChannelSync{
+		{ID: 2, ChannelID: channelID, Operation: models.ChannelPushAvailability, Status: models.ChannelSyncFailed, Attempts: 8, LastError: "channel responded 503"},
+		{ID: 1, ChannelID: channelID, Operation: models.ChannelPullBookings, Status: models.ChannelSyncSucceeded, Attempts: 1, Summary: "1 booking(s) pulled", FinishedAt: time.Now()},
+	}
+	return syncs, nil
+}
+
+// RetryChannelSync queues a failed push to be sent again
+func (m *testDBRepo) RetryChannelSync(channelID, id int) error {
+	if id > 2 {
+		return errors.New("some error")
+	}
+	return nil
+}
+
+// GetReservationByChannelBooking returns the reservation made for a booking on a channel. Booking bk-cancel
+// has a confirmed reservation, and booking bk-moved a reservation for other dates.
+func (m *testDBRepo) GetReservationByChannelBooking(channelID int, bookingID string) (models.Reservation, bool, error) {
+	switch bookingID {
+	case "bk-cancel":
+		return models.Reservation{ID: 1, RoomID: 1, Status: models.ReservationStatusConfirmed}, true, nil
+	case "bk-moved":
+		start := time.Date(2049, 3, 1, 0, 0, 0, 0, time.UTC)
+		return models.Reservation{ID: 2, RoomID: 1, StartDate: start, EndDate: start.AddDate(0, 0, 2), Status: models.ReservationStatusConfirmed}, true, nil
+	case "bk-error":
+		return models.Reservation{}, false, errors.New("some error")
+	}
+	return models.Reservation{}, false, nil
+}
+
+// UpdateChannelPulledAt records the time of the latest booking change pulled from a channel
+func (m *testDBRepo) UpdateChannelPulledAt(id int, pulledAt time.Time) error {
+	return nil
+}
+
+// GetOccupancyReport returns a report of two rooms, one of them priced, or an error for ranges starting in 2060
+func (m *testDBRepo) GetOccupancyReport(start, end time.Time) (models.OccupancyReport, error) {
+	if start.Year() == 2060 {
+		return models.OccupancyReport{}, errors.New("some error")
+	}
+
+	report := models.OccupancyReport{
+		Start: start,
+		End:   end,
+		Rooms: []models.RoomOccupancy{
+			{RoomID: 1, RoomName: "General's Quarters", NightlyRate: 12000, NightsSold: 3, NightsBlocked: 1},
+			{RoomID: 2, RoomName: "Major's Suite"},
+		},
+		Stays: models.StayStatistics{Reservations: 2, Cancellations: 1, StayNights: 3, LeadDays: 14},
+	}
+	for d := start; d.Before(end); d = d.AddDate(0, 0, 1) {
+		report.Daily = append(report.Daily, models.DailyOccupancy{Date: d, RoomsSold: 1})
+	}
+	return report, nil
+}
+
+// ImportReservations imports a batch as batch 1. The file fail.csv fails, and stays arriving in 2060 find
+// their room taken.
+func (m *testDBRepo) ImportReservations(batch models.ImportBatch, reservations []models.Reservation) (int, error) {
+	if batch.FileName == "fail.csv" {
+		return 0, errors.New("some error")
+	}
+	for _, res := range reservations {
+		if res.StartDate.Year() == 2060 {
+			return 0, repository.ErrRoomUnavailable
+		}
+	}
+	return 1, nil
+}
+
+// AllImportBatches returns a batch that can be undone and one that already was
+func (m *testDBRepo) AllImportBatches() ([]models.ImportBatch, error) {
+	return []models.ImportBatch{
+		{ID: 1, FileName: "2048.csv", Reservations: 3, CreatedAt: time.Now(), User: models.User{FirstName: "Admin", LastName: "User"}},
+		{ID: 2, FileName: "2047.csv", Reservations: 5, CreatedAt: time.Now(), RevertedAt: time.Now()},
+	}, nil
+}
+
+// RevertImportBatch undoes batch 1. Batch 2 was already undone, and any other batch fails.
+func (m *testDBRepo) RevertImportBatch(id int) (int, error) {
+	switch id {
+	case 1:
+		return 3, nil
+	case 2:
+		return 0, sql.ErrNoRows
+	}
+	return 0, errors.New("some error")
+}
+
+// GetRestrictionsByDate returns a reservation and a block on room 1 starting on the first day asked for, and
+// the room 1 segment of a stay split across rooms, which moves in on the fifth day, or an error for dates in 2060
+func (m *testDBRepo) GetRestrictionsByDate(start, end time.Time) ([]models.RoomRestriction, error) {
+	if start.Year() == 2060 {
+		return nil, errors.New("some error")
+	}
+	return []models.RoomRestriction{
+		{ID: 1, RoomID: 1, ReservationID: 1, RestrictionID: 1, StartDate: start, EndDate: start.AddDate(0, 0, 3),
+			Reservation: models.Reservation{ID: 1, FirstName: "Jane", LastName: "Smith", Status: models.ReservationStatusConfirmed, Tags: []string{"VIP"},
+				StartDate: start, EndDate: start.AddDate(0, 0, 3)}},
+		{ID: 2, RoomID: 1, RestrictionID: 2, StartDate: start.AddDate(0, 0, 2), EndDate: start.AddDate(0, 0, 4),
+			Restriction: models.Restriction{ID: 2, RestrictionName: "Owner Block"}},
+		{ID: 3, RoomID: 1, ReservationID: 3, RestrictionID: 1, StartDate: start.AddDate(0, 0, 4), EndDate: start.AddDate(0, 0, 6),
+			Reservation: models.Reservation{ID: 3, FirstName: "Ann", LastName: "Lee", Status: models.ReservationStatusConfirmed,
+				StartDate: start.AddDate(0, 0, 2), EndDate: start.AddDate(0, 0, 6)}},
+	}, nil
+}
+
+// ChangeReservationStay builds the notices for any stay starting before 2060. Stays starting in 2060 find the
+// room taken, and any later stay fails.
+func (m *testDBRepo) ChangeReservationStay(id, roomID int, start, end time.Time, notices func(sequence int) ([]models.MailData, error)) error {
+	switch {
+	case start.Year() == 2060:
+		return repository.ErrRoomUnavailable
+	case start.Year() > 2060:
+		return errors.New("some error")
+	}
+	_, err := notices(1)
+	return err
+}
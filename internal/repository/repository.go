@@ -1,11 +1,29 @@
 package repository
 
 import (
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/Poojasadgir/room-reservation/internal/models"
 )
 
+// ErrRoomUnavailable is returned when a stay would overlap a restriction already held on its room
+var ErrRoomUnavailable = errors.New("the room is not available for those dates")
+
+// ErrDuplicateEmail is returned when a guest's email address is changed to one another guest already has
+var ErrDuplicateEmail = errors.New("another guest already has that email address")
+
+// ConflictError is returned when a reservation is saved over changes someone else made after it was loaded.
+// Current holds the reservation as the other person saved it.
+type ConflictError struct {
+	Current models.Reservation
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("reservation %d was changed by someone else", e.Current.ID)
+}
+
 type DatabaseRepo interface {
 	AllUsers() bool
 
@@ -19,14 +37,123 @@ type DatabaseRepo interface {
 	UpdateUser(users models.User) error
 	Authenticate(email, testPassword string) (int, string, error)
 
-	AllReservations() ([]models.Reservation, error)
-	AllNewReservations() ([]models.Reservation, error)
+	FindReservations(q models.ReservationQuery) (models.ReservationPage, error)
+	EachReservation(q models.ReservationQuery, fn func(models.Reservation) error) error
 	GetReservationByID(id int) (models.Reservation, error)
 	UpdateReservation(res models.Reservation) error
 	DeleteReservation(id int) error
 	UpdateProcessedReservation(id, processed int) error
 	AllRooms() ([]models.Room, error)
 	GetRestrictionsForRoomByDate(roomID int, start, end time.Time) ([]models.RoomRestriction, error)
-	InsertBlockForRoom(id int, startDate time.Time) error
+	InsertBlockForRoom(id int, startDate time.Time) (int, error)
 	DeleteBlockByID(id int) error
+
+	AllCancellationPolicies() ([]models.CancellationPolicy, error)
+	GetCancellationPolicyByID(id int) (models.CancellationPolicy, error)
+	InsertCancellationPolicy(p models.CancellationPolicy) (int, error)
+	UpdateCancellationPolicy(p models.CancellationPolicy) error
+	UpdateRoomCancellationPolicy(roomID, policyID, nightlyRate int) error
+	CancelReservation(id, fee int, cancelledBy string, notices []models.MailData) error
+
+	FindOrCreateGuest(g models.Guest) (int, error)
+	AllGuests() ([]models.Guest, error)
+	EachGuest(fn func(models.Guest) error) error
+	GetGuestByID(id int) (models.Guest, error)
+	PossibleDuplicateGuests(id int) ([]models.Guest, error)
+	GetReservationsForGuest(guestID int) ([]models.Reservation, error)
+	UpdateGuest(g models.Guest) error
+	MergeGuests(keepID, duplicateID int) error
+
+	GetNotesForReservation(reservationID int) ([]models.ReservationNote, error)
+	InsertReservationNote(n models.ReservationNote) error
+	GetTagsForReservation(reservationID int) ([]string, error)
+	SetReservationTags(reservationID int, tags []string) error
+	AllTags() ([]string, error)
+
+	AllBookingQuestions() ([]models.BookingQuestion, error)
+	GetBookingQuestionsForRoom(roomID int) ([]models.BookingQuestion, error)
+	InsertBookingQuestion(q models.BookingQuestion) (int, error)
+	UpdateBookingQuestion(q models.BookingQuestion) error
+	InsertReservationAnswers(reservationID int, answers []models.ReservationAnswer) error
+	GetAnswersForReservation(reservationID int) ([]models.ReservationAnswer, error)
+
+	GetArrivalsByDate(date time.Time) ([]models.Reservation, error)
+	GetDeparturesByDate(date time.Time) ([]models.Reservation, error)
+	CheckInReservation(id int, arrivedAt time.Time, idVerified bool) error
+	CheckOutReservation(id int, departedAt time.Time) error
+
+	UpdateRoomHousekeepingStatus(roomID int, status string) error
+	InsertHousekeepingTasks(tasks []models.HousekeepingTask) error
+	GetHousekeepingTasksByDate(date time.Time) ([]models.HousekeepingTask, error)
+	CompleteHousekeepingTask(id, userID int) error
+
+	GetNoShowCandidates(arrivedBy time.Time) ([]models.Reservation, error)
+	MarkNoShow(id, fee int, release bool, at time.Time) error
+	GetNoShowsSince(since time.Time) ([]models.Reservation, error)
+
+	GetArrivalsToRemind(arrival time.Time) ([]int, error)
+	QueueArrivalReminder(id int, msg models.MailData) (bool, error)
+
+	RegisterJob(name, schedule string, nextRunAt time.Time) error
+	ClaimJob(name, instance string, now, lockedUntil time.Time) (models.Job, bool, error)
+	FinishJob(run models.JobRun, nextRunAt time.Time, attempts int) error
+	AllJobs() ([]models.Job, error)
+	GetRecentJobRuns(limit int) ([]models.JobRun, error)
+	RunJobNow(name string) error
+
+	CreateReservation(res models.Reservation, answers []models.ReservationAnswer, notices func(id int) ([]models.MailData, error)) (int, error)
+	QueueMail(msg models.MailData) error
+	ClaimOutboxMessages(limit int, now, lockedUntil time.Time) ([]models.OutboxMessage, error)
+	MarkOutboxSent(id int) error
+	MarkOutboxFailed(id int, sendErr string, nextAttemptAt time.Time, dead bool) error
+	GetOutboxMessages(status string) ([]models.OutboxMessage, error)
+	ResendOutboxMessage(id int) error
+
+	UpdateRoomCalendarFeed(roomID int, token string, showGuests bool) error
+	GetCalendarFeedRestrictions(roomID int, from time.Time) ([]models.RoomRestriction, error)
+
+	AllCalendarImports() ([]models.CalendarImport, error)
+	GetCalendarImportByID(id int) (models.CalendarImport, error)
+	InsertCalendarImport(ci models.CalendarImport) (int, error)
+	DeleteCalendarImport(id int) error
+	GetImportedBlocks(importID int) ([]models.RoomRestriction, error)
+	ApplyCalendarImport(sync models.CalendarImportSync) ([]int, error)
+	MarkCalendarImportFailed(id int, syncErr string) error
+
+	AllWebhookEndpoints() ([]models.WebhookEndpoint, error)
+	GetWebhookEndpointByID(id int) (models.WebhookEndpoint, error)
+	InsertWebhookEndpoint(e models.WebhookEndpoint) (int, error)
+	UpdateWebhookEndpoint(e models.WebhookEndpoint) error
+	DeleteWebhookEndpoint(id int) error
+	QueueWebhookEvent(event string, payload []byte) error
+	ClaimWebhookDeliveries(limit int, now, lockedUntil time.Time) ([]models.WebhookDelivery, error)
+	MarkWebhookDelivered(id, responseCode int) error
+	MarkWebhookFailed(id, responseCode int, sendErr string, nextAttemptAt time.Time, dead bool) error
+	GetWebhookDeliveries(endpointID int) ([]models.WebhookDelivery, error)
+	ReplayWebhookDelivery(endpointID, id int) error
+
+	AllChannels() ([]models.Channel, error)
+	GetChannelByID(id int) (models.Channel, error)
+	InsertChannel(ch models.Channel) (int, error)
+	UpdateChannel(ch models.Channel) error
+	SetChannelRoomMapping(channelID, roomID int, code string) error
+	QueueChannelSync(channelID int, operation, payload string) error
+	LogChannelSync(s models.ChannelSync) error
+	ClaimChannelSyncs(limit int, now, lockedUntil time.Time) ([]models.ChannelSync, error)
+	MarkChannelSyncSucceeded(id int, summary string) error
+	MarkChannelSyncFailed(id int, syncErr string, nextAttemptAt time.Time, dead bool) error
+	GetChannelSyncLog(channelID int) ([]models.ChannelSync, error)
+	RetryChannelSync(channelID, id int) error
+	GetReservationByChannelBooking(channelID int, bookingID string) (models.Reservation, bool, error)
+	UpdateChannelPulledAt(id int, pulledAt time.Time) error
+
+	GetOccupancyReport(start, end time.Time) (models.OccupancyReport, error)
+
+	ImportReservations(batch models.ImportBatch, reservations []models.Reservation) (int, error)
+	AllImportBatches() ([]models.ImportBatch, error)
+	RevertImportBatch(id int) (int, error)
+
+	GetRestrictionsByDate(start, end time.Time) ([]models.RoomRestriction, error)
+
+	ChangeReservationStay(id, roomID int, start, end time.Time, notices func(sequence int) ([]models.MailData, error)) error
 }
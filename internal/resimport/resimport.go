@@ -0,0 +1,362 @@
+package resimport
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Poojasadgir/room-reservation/internal/models"
+	"github.com/asaskevich/govalidator"
+)
+
+// MaxRows is the most reservations a single file may hold
+const MaxRows = 5000
+
+// DateLayouts are the date formats accepted for arrival and departure, tried in order
+var DateLayouts = []string{"2006-01-02", "01/02/2006", "1/2/2006", "2006/01/02"}
+
+// ErrEmptyFile is returned when a file has no header row
+var ErrEmptyFile = errors.New("the file is empty")
+
+// ErrTooManyRows is returned when a file holds more than MaxRows reservations
+var ErrTooManyRows = fmt.Errorf("the file has more than %d rows; split it into smaller files", MaxRows)
+
+// Field is a reservation field a column of the file can be mapped to
+type Field struct {
+	Name     string
+	Label    string
+	Required bool
+	aliases  []string
+}
+
+// Fields lists the reservation fields that can be imported, in the order they are shown
+var Fields = []Field{
+	{Name: "first_name", Label: "First Name", Required: true, aliases: []string{"first", "firstname", "given name"}},
+	{Name: "last_name", Label: "Last Name", Required: true, aliases: []string{"last", "lastname", "surname", "family name"}},
+	{Name: "email", Label: "Email", Required: true, aliases: []string{"email address", "e-mail"}},
+	{Name: "phone", Label: "Phone", aliases: []string{"phone number", "telephone", "mobile"}},
+	{Name: "room", Label: "Room", Required: true, aliases: []string{"room name", "room id"}},
+	{Name: "arrival", Label: "Arrival", Required: true, aliases: []string{"start", "start date", "check in", "check-in", "arrival date"}},
+	{Name: "departure", Label: "Departure", Required: true, aliases: []string{"end", "end date", "check out", "check-out", "departure date"}},
+	{Name: "status", Label: "Status"},
+}
+
+// Mapping gives the column each field is read from. Fields missing from the mapping are not imported.
+type Mapping map[string]int
+
+// Guess maps each field to the first column whose heading matches its name, label or a common alternative
+func Guess(header []string) Mapping {
+	mapping := make(Mapping)
+	for _, f := range Fields {
+		names := append([]string{f.Name, f.Label}, f.aliases...)
+	columns:
+		for i, h := range header {
+			h = normalize(h)
+			for _, n := range names {
+				if h == normalize(n) {
+					mapping[f.Name] = i
+					break columns
+				}
+			}
+		}
+	}
+	return mapping
+}
+
+// normalize makes headings that differ only in case, spacing or punctuation compare equal
+func normalize(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	return strings.NewReplacer("_", " ", "-", " ", ".", "").Replace(s)
+}
+
+// Read reads the heading and rows of a CSV file. Rows may have fewer columns than the heading.
+func Read(r io.Reader) ([]string, [][]string, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, nil, ErrEmptyFile
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	// spreadsheets often save a byte order mark before the first heading
+	header[0] = strings.TrimPrefix(header[0], "\ufeff")
+
+	var records [][]string
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if blank(record) {
+			continue
+		}
+		if len(records) == MaxRows {
+			return nil, nil, ErrTooManyRows
+		}
+		records = append(records, record)
+	}
+	return header, records, nil
+}
+
+// blank reports whether every column of a row is empty
+func blank(record []string) bool {
+	for _, v := range record {
+		if strings.TrimSpace(v) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// Row is a line of the file read into a reservation, with anything that stops it being imported
+type Row struct {
+	Line        int
+	Reservation models.Reservation
+	Errors      []string
+	Conflicts   []string
+}
+
+// Valid reports whether the row can be imported
+func (r Row) Valid() bool {
+	return len(r.Errors) == 0 && len(r.Conflicts) == 0
+}
+
+// Preview is the outcome of reading a file with a mapping, before anything is imported
+type Preview struct {
+	Header  []string
+	Mapping Mapping
+	Rows    []Row
+	Errors  []string
+}
+
+// Valid reports whether every row can be imported
+func (p Preview) Valid() bool {
+	if len(p.Errors) > 0 || len(p.Rows) == 0 {
+		return false
+	}
+	for _, r := range p.Rows {
+		if !r.Valid() {
+			return false
+		}
+	}
+	return true
+}
+
+// Invalid returns the number of rows that cannot be imported
+func (p Preview) Invalid() int {
+	n := 0
+	for _, r := range p.Rows {
+		if !r.Valid() {
+			n++
+		}
+	}
+	return n
+}
+
+// Reservations returns the reservations read from the file, in file order
+func (p Preview) Reservations() []models.Reservation {
+	reservations := make([]models.Reservation, len(p.Rows))
+	for i, r := range p.Rows {
+		reservations[i] = r.Reservation
+	}
+	return reservations
+}
+
+// Parse reads each row into a reservation using the mapping, matching rooms by name or id. The heading is
+// line 1 of the file, so rows are numbered from line 2. Imported reservations are historical, so they are
+// marked processed and default to checked out once their departure is before today.
+func Parse(header []string, records [][]string, mapping Mapping, rooms []models.Room, today time.Time) Preview {
+	p := Preview{Header: header, Mapping: mapping}
+
+	for _, f := range Fields {
+		i, ok := mapping[f.Name]
+		if ok && (i < 0 || i >= len(header)) {
+			delete(mapping, f.Name)
+			ok = false
+		}
+		if f.Required && !ok {
+			p.Errors = append(p.Errors, fmt.Sprintf("Choose the column that holds %s", f.Label))
+		}
+	}
+	if len(p.Errors) > 0 {
+		return p
+	}
+
+	for n, record := range records {
+		p.Rows = append(p.Rows, parseRow(n+2, record, mapping, rooms, today))
+	}
+	return p
+}
+
+// parseRow reads a single row of the file
+func parseRow(line int, record []string, mapping Mapping, rooms []models.Room, today time.Time) Row {
+	row := Row{Line: line}
+	value := func(field string) string {
+		i, ok := mapping[field]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	res := &row.Reservation
+	res.FirstName = value("first_name")
+	res.LastName = value("last_name")
+	res.Email = strings.ToLower(value("email"))
+	res.Phone = value("phone")
+	res.Processed = 1
+
+	for _, f := range Fields {
+		if f.Required && value(f.Name) == "" {
+			row.Errors = append(row.Errors, f.Label+" is blank")
+		}
+	}
+	if res.Email != "" && !govalidator.IsEmail(res.Email) {
+		row.Errors = append(row.Errors, "Email is not a valid address")
+	}
+
+	if name := value("room"); name != "" {
+		room, ok := findRoom(rooms, name)
+		if ok {
+			res.RoomID = room.ID
+			res.Room = room
+		} else {
+			row.Errors = append(row.Errors, fmt.Sprintf("Room %q does not exist", name))
+		}
+	}
+
+	var err error
+	if v := value("arrival"); v != "" {
+		res.StartDate, err = parseDate(v)
+		if err != nil {
+			row.Errors = append(row.Errors, fmt.Sprintf("Arrival %q is not a date", v))
+		}
+	}
+	if v := value("departure"); v != "" {
+		res.EndDate, err = parseDate(v)
+		if err != nil {
+			row.Errors = append(row.Errors, fmt.Sprintf("Departure %q is not a date", v))
+		}
+	}
+	if !res.StartDate.IsZero() && !res.EndDate.IsZero() && !res.EndDate.After(res.StartDate) {
+		row.Errors = append(row.Errors, "Departure must be after arrival")
+	}
+
+	res.Status = models.ReservationStatusConfirmed
+	if !res.EndDate.IsZero() && res.EndDate.Before(today) {
+		res.Status = models.ReservationStatusCheckedOut
+	}
+	if v := value("status"); v != "" {
+		status, ok := parseStatus(v)
+		if ok {
+			res.Status = status
+		} else {
+			row.Errors = append(row.Errors, fmt.Sprintf("Status %q is not one of confirmed, checked in, checked out, no show or cancelled", v))
+		}
+	}
+
+	return row
+}
+
+// findRoom finds a room by name, ignoring case, or by id
+func findRoom(rooms []models.Room, name string) (models.Room, bool) {
+	id, err := strconv.Atoi(name)
+	for _, room := range rooms {
+		if strings.EqualFold(room.RoomName, name) || (err == nil && room.ID == id) {
+			return room, true
+		}
+	}
+	return models.Room{}, false
+}
+
+// parseDate reads a date in any of the accepted layouts
+func parseDate(v string) (time.Time, error) {
+	var err error
+	for _, layout := range DateLayouts {
+		var d time.Time
+		d, err = time.Parse(layout, v)
+		if err == nil {
+			return d, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// parseStatus reads a reservation status, allowing spaces or hyphens in place of underscores
+func parseStatus(v string) (string, bool) {
+	v = strings.NewReplacer(" ", "_", "-", "_").Replace(strings.ToLower(v))
+	switch v {
+	case models.ReservationStatusConfirmed, models.ReservationStatusCheckedIn, models.ReservationStatusCheckedOut,
+		models.ReservationStatusNoShow, models.ReservationStatusCancelled:
+		return v, true
+	}
+	return "", false
+}
+
+// Occupies reports whether a reservation holds its room, which cancelled reservations do not
+func Occupies(res models.Reservation) bool {
+	return res.Status != models.ReservationStatusCancelled
+}
+
+// Check records a conflict on each row whose stay overlaps one of the restrictions already held on its
+// room, or an earlier row of the file for the same room. Rows with errors or cancelled stays are skipped.
+func (p *Preview) Check(restrictions []models.RoomRestriction) {
+	for i := range p.Rows {
+		row := &p.Rows[i]
+		res := row.Reservation
+		if len(row.Errors) > 0 || !Occupies(res) {
+			continue
+		}
+
+		for _, r := range restrictions {
+			if r.RoomID == res.RoomID && res.StartDate.Before(r.EndDate) && res.EndDate.After(r.StartDate) {
+				if r.ReservationID > 0 {
+					row.Conflicts = append(row.Conflicts, fmt.Sprintf("Overlaps reservation %d", r.ReservationID))
+				} else {
+					row.Conflicts = append(row.Conflicts, fmt.Sprintf("Overlaps a block from %s to %s",
+						r.StartDate.Format("2006-01-02"), r.EndDate.Format("2006-01-02")))
+				}
+			}
+		}
+
+		for _, earlier := range p.Rows[:i] {
+			other := earlier.Reservation
+			if len(earlier.Errors) == 0 && Occupies(other) && other.RoomID == res.RoomID &&
+				res.StartDate.Before(other.EndDate) && res.EndDate.After(other.StartDate) {
+				row.Conflicts = append(row.Conflicts, fmt.Sprintf("Overlaps line %d of the file", earlier.Line))
+			}
+		}
+	}
+}
+
+// Span returns the first arrival and last departure of the rows for each room, for looking up the
+// restrictions they could conflict with
+func (p Preview) Span() map[int][2]time.Time {
+	spans := make(map[int][2]time.Time)
+	for _, row := range p.Rows {
+		res := row.Reservation
+		if len(row.Errors) > 0 || !Occupies(res) {
+			continue
+		}
+		span, ok := spans[res.RoomID]
+		if !ok || res.StartDate.Before(span[0]) {
+			span[0] = res.StartDate
+		}
+		if !ok || res.EndDate.After(span[1]) {
+			span[1] = res.EndDate
+		}
+		spans[res.RoomID] = span
+	}
+	return spans
+}
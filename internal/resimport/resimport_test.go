@@ -0,0 +1,144 @@
+package resimport
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Poojasadgir/room-reservation/internal/models"
+)
+
+var today = time.Date(2050, 6, 1, 0, 0, 0, 0, time.UTC)
+
+var rooms = []models.Room{
+	{ID: 1, RoomName: "General's Quarters"},
+	{ID: 2, RoomName: "Major's Suite"},
+}
+
+func date(s string) time.Time {
+	d, _ := time.Parse("2006-01-02", s)
+	return d
+}
+
+func TestGuess(t *testing.T) {
+	header := []string{"Surname", "First Name", "E-Mail", "Room", "Check-in", "Check_out", "Notes"}
+	mapping := Guess(header)
+
+	expected := Mapping{"first_name": 1, "last_name": 0, "email": 2, "room": 3, "arrival": 4, "departure": 5}
+	if len(mapping) != len(expected) {
+		t.Errorf("expected %v but got %v", expected, mapping)
+	}
+	for field, i := range expected {
+		if mapping[field] != i {
+			t.Errorf("expected %s in column %d but got %d", field, i, mapping[field])
+		}
+	}
+}
+
+func TestRead(t *testing.T) {
+	header, records, err := Read(strings.NewReader("\ufeffFirst,Last\nJohn,Smith\n,\nJane\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header[0] != "First" || len(records) != 2 || len(records[1]) != 1 {
+		t.Errorf("expected the heading without a byte order mark and two rows but got %q and %q", header, records)
+	}
+
+	_, _, err = Read(strings.NewReader(""))
+	if err != ErrEmptyFile {
+		t.Errorf("expected ErrEmptyFile for an empty file but got %v", err)
+	}
+
+	_, _, err = Read(strings.NewReader("First\n\"John\n"))
+	if err == nil {
+		t.Error("expected an error for an unterminated quote but got none")
+	}
+
+	_, _, err = Read(strings.NewReader("First\n" + strings.Repeat("John\n", MaxRows+1)))
+	if err != ErrTooManyRows {
+		t.Errorf("expected ErrTooManyRows but got %v", err)
+	}
+}
+
+func TestParse(t *testing.T) {
+	header := []string{"first_name", "last_name", "email", "room", "arrival", "departure", "status"}
+	records := [][]string{
+		{"John", "Smith", "John@Example.com", "general's quarters", "2049-01-10", "2049-01-12", ""},
+		{"Jane", "Doe", "jane@example.com", "2", "08/01/2050", "08/05/2050", ""},
+		{"Bill", "Jones", "bill@example.com", "1", "2049-02-01", "2049-02-03", "No Show"},
+		{"", "Brown", "not-an-email", "Penthouse", "tomorrow", "2049-01-01", "maybe"},
+		{"Ann", "Lee", "ann@example.com", "1", "2049-03-05", "2049-03-05"},
+	}
+
+	p := Parse(header, records, Guess(header), rooms, today)
+	if len(p.Errors) > 0 || len(p.Rows) != 5 {
+		t.Fatalf("expected 5 rows but got %d with %v", len(p.Rows), p.Errors)
+	}
+
+	john := p.Rows[0].Reservation
+	if !p.Rows[0].Valid() || john.Email != "john@example.com" || john.RoomID != 1 || !john.StartDate.Equal(date("2049-01-10")) ||
+		john.Status != models.ReservationStatusCheckedOut || john.Processed != 1 {
+		t.Errorf("expected a processed, checked out stay in room 1 but got %+v with %v", john, p.Rows[0].Errors)
+	}
+
+	jane := p.Rows[1].Reservation
+	if !p.Rows[1].Valid() || jane.RoomID != 2 || !jane.EndDate.Equal(date("2050-08-05")) || jane.Status != models.ReservationStatusConfirmed {
+		t.Errorf("expected a confirmed future stay in room 2 but got %+v with %v", jane, p.Rows[1].Errors)
+	}
+
+	if p.Rows[2].Reservation.Status != models.ReservationStatusNoShow {
+		t.Errorf("expected the status to be read but got %s", p.Rows[2].Reservation.Status)
+	}
+
+	if p.Rows[3].Line != 5 || len(p.Rows[3].Errors) != 5 {
+		t.Errorf("expected 5 errors on line 5 but got %d on line %d: %v", len(p.Rows[3].Errors), p.Rows[3].Line, p.Rows[3].Errors)
+	}
+	if len(p.Rows[4].Errors) != 1 {
+		t.Errorf("expected a departure on the day of arrival to be an error but got %v", p.Rows[4].Errors)
+	}
+
+	if p.Valid() || p.Invalid() != 2 {
+		t.Errorf("expected 2 invalid rows but got %d", p.Invalid())
+	}
+
+	p = Parse(header, records, Mapping{"first_name": 0, "last_name": 1, "email": 9}, rooms, today)
+	if len(p.Errors) != 4 || len(p.Rows) != 0 {
+		t.Errorf("expected errors for the 4 fields without a column but got %v", p.Errors)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	row := func(line, roomID int, start, end, status string) Row {
+		return Row{Line: line, Reservation: models.Reservation{RoomID: roomID, StartDate: date(start), EndDate: date(end), Status: status}}
+	}
+
+	p := Preview{Rows: []Row{
+		row(2, 1, "2049-01-10", "2049-01-12", models.ReservationStatusCheckedOut),
+		row(3, 1, "2049-01-11", "2049-01-13", models.ReservationStatusCheckedOut),
+		row(4, 1, "2049-01-11", "2049-01-13", models.ReservationStatusCancelled),
+		row(5, 2, "2049-01-11", "2049-01-13", models.ReservationStatusCheckedOut),
+		row(6, 2, "2049-01-20", "2049-01-22", models.ReservationStatusCheckedOut),
+		row(7, 1, "2049-01-12", "2049-01-14", models.ReservationStatusCheckedOut),
+	}}
+
+	restrictions := []models.RoomRestriction{
+		{RoomID: 2, ReservationID: 9, StartDate: date("2049-01-12"), EndDate: date("2049-01-15")},
+		{RoomID: 2, StartDate: date("2049-01-21"), EndDate: date("2049-01-22")},
+		{RoomID: 1, StartDate: date("2049-01-20"), EndDate: date("2049-01-22")},
+	}
+
+	spans := p.Span()
+	if !spans[1][0].Equal(date("2049-01-10")) || !spans[1][1].Equal(date("2049-01-14")) {
+		t.Errorf("expected room 1 to span 2049-01-10 to 2049-01-14 but got %v", spans[1])
+	}
+
+	p.Check(restrictions)
+
+	expected := []string{"", "Overlaps line 2 of the file", "", "Overlaps reservation 9", "Overlaps a block from 2049-01-21 to 2049-01-22", "Overlaps line 3 of the file"}
+	for i, e := range expected {
+		conflicts := strings.Join(p.Rows[i].Conflicts, "; ")
+		if conflicts != e {
+			t.Errorf("line %d: expected %q but got %q", p.Rows[i].Line, e, conflicts)
+		}
+	}
+}
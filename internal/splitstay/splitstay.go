@@ -0,0 +1,156 @@
+package splitstay
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Poojasadgir/room-reservation/internal/models"
+)
+
+// MaxSegments is the most rooms a stay is split across. More moves than this are not worth offering.
+const MaxSegments = 3
+
+// MaxOptions is the most split stays proposed for a search
+const MaxOptions = 3
+
+// ErrInvalid is returned when an encoded option cannot be read
+var ErrInvalid = errors.New("the split stay is not valid")
+
+// Option is a way of covering a stay by moving between rooms
+type Option struct {
+	Segments []models.StaySegment
+}
+
+// Moves returns the number of times the guest changes rooms
+func (o Option) Moves() int {
+	return len(o.Segments) - 1
+}
+
+// Start returns the arrival date of the stay
+func (o Option) Start() time.Time {
+	return o.Segments[0].StartDate
+}
+
+// End returns the departure date of the stay
+func (o Option) End() time.Time {
+	return o.Segments[len(o.Segments)-1].EndDate
+}
+
+// Encode writes the option as room:arrival:departure for each segment, separated by commas, so it can be
+// passed in a link
+func (o Option) Encode() string {
+	parts := make([]string, len(o.Segments))
+	for i, s := range o.Segments {
+		parts[i] = fmt.Sprintf("%d:%s:%s", s.RoomID, s.StartDate.Format("2006-01-02"), s.EndDate.Format("2006-01-02"))
+	}
+	return strings.Join(parts, ",")
+}
+
+// Decode reads an option written by Encode. Each segment must start on the day the one before it ends.
+func Decode(v string) (Option, error) {
+	var o Option
+	parts := strings.Split(v, ",")
+	if len(parts) > MaxSegments {
+		return o, ErrInvalid
+	}
+
+	for _, part := range parts {
+		fields := strings.Split(part, ":")
+		if len(fields) != 3 {
+			return o, ErrInvalid
+		}
+		roomID, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return o, ErrInvalid
+		}
+		start, err := time.Parse("2006-01-02", fields[1])
+		if err != nil {
+			return o, ErrInvalid
+		}
+		end, err := time.Parse("2006-01-02", fields[2])
+		if err != nil || !end.After(start) {
+			return o, ErrInvalid
+		}
+		if n := len(o.Segments); n > 0 && !o.Segments[n-1].EndDate.Equal(start) {
+			return o, ErrInvalid
+		}
+		o.Segments = append(o.Segments, models.StaySegment{RoomID: roomID, StartDate: start, EndDate: end})
+	}
+	return o, nil
+}
+
+// Propose returns the ways of covering the nights from start to end by moving between rooms, fewest moves
+// first. Each option begins in a different room that is free on the first night, stays there as long as it
+// can and then moves to whichever other room is free for longest. Options needing more than MaxSegments
+// rooms are left out, and at most MaxOptions are returned. Rooms are tried in the order given.
+func Propose(start, end time.Time, rooms []models.Room, restrictions []models.RoomRestriction) []Option {
+	byRoom := make(map[int][]models.RoomRestriction)
+	for _, r := range restrictions {
+		byRoom[r.RoomID] = append(byRoom[r.RoomID], r)
+	}
+
+	// freeUntil returns the day a room stops being free from a night onwards, which is the night itself
+	// when the room is taken that night
+	freeUntil := func(roomID int, night time.Time) time.Time {
+		until := end
+		for _, r := range byRoom[roomID] {
+			if !r.EndDate.After(night) {
+				continue
+			}
+			if !r.StartDate.After(night) {
+				return night
+			}
+			if r.StartDate.Before(until) {
+				until = r.StartDate
+			}
+		}
+		return until
+	}
+
+	var options []Option
+	seen := make(map[string]bool)
+
+	for _, first := range rooms {
+		until := freeUntil(first.ID, start)
+		if !until.After(start) {
+			continue
+		}
+
+		o := Option{Segments: []models.StaySegment{{RoomID: first.ID, StartDate: start, EndDate: until, Room: first}}}
+		for until.Before(end) && len(o.Segments) < MaxSegments {
+			current := o.Segments[len(o.Segments)-1].RoomID
+			next, nextUntil := models.Room{}, until
+			for _, room := range rooms {
+				if room.ID == current {
+					continue
+				}
+				if u := freeUntil(room.ID, until); u.After(nextUntil) {
+					next, nextUntil = room, u
+				}
+			}
+			if !nextUntil.After(until) {
+				break
+			}
+			o.Segments = append(o.Segments, models.StaySegment{RoomID: next.ID, StartDate: until, EndDate: nextUntil, Room: next})
+			until = nextUntil
+		}
+
+		if until.Before(end) || seen[o.Encode()] {
+			continue
+		}
+		seen[o.Encode()] = true
+		options = append(options, o)
+	}
+
+	sort.SliceStable(options, func(i, j int) bool {
+		return options[i].Moves() < options[j].Moves()
+	})
+	if len(options) > MaxOptions {
+		options = options[:MaxOptions]
+	}
+	return options
+}
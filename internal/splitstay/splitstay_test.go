@@ -0,0 +1,91 @@
+package splitstay
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Poojasadgir/room-reservation/internal/models"
+)
+
+var rooms = []models.Room{
+	{ID: 1, RoomName: "General's Quarters"},
+	{ID: 2, RoomName: "Major's Suite"},
+	{ID: 3, RoomName: "Colonel's Cabin"},
+}
+
+func date(s string) time.Time {
+	d, _ := time.Parse("2006-01-02", s)
+	return d
+}
+
+func block(roomID int, start, end string) models.RoomRestriction {
+	return models.RoomRestriction{RoomID: roomID, StartDate: date(start), EndDate: date(end)}
+}
+
+func TestPropose(t *testing.T) {
+	start, end := date("2050-01-10"), date("2050-01-16")
+
+	tests := []struct {
+		name         string
+		restrictions []models.RoomRestriction
+		expected     []string
+	}{
+		{
+			"one move",
+			[]models.RoomRestriction{block(1, "2050-01-13", "2050-01-20"), block(2, "2050-01-01", "2050-01-12"), block(3, "2050-01-09", "2050-01-30")},
+			[]string{"1:2050-01-10:2050-01-13,2:2050-01-13:2050-01-16"},
+		},
+		{
+			"two moves",
+			[]models.RoomRestriction{block(1, "2050-01-12", "2050-01-20"), block(2, "2050-01-10", "2050-01-12"), block(2, "2050-01-14", "2050-01-20"),
+				block(3, "2050-01-10", "2050-01-14")},
+			[]string{"1:2050-01-10:2050-01-12,2:2050-01-12:2050-01-14,3:2050-01-14:2050-01-16"},
+		},
+		{
+			"fewest moves first",
+			[]models.RoomRestriction{block(1, "2050-01-11", "2050-01-20"), block(2, "2050-01-01", "2050-01-13"), block(3, "2050-01-13", "2050-01-20")},
+			[]string{"3:2050-01-10:2050-01-13,2:2050-01-13:2050-01-16", "1:2050-01-10:2050-01-11,3:2050-01-11:2050-01-13,2:2050-01-13:2050-01-16"},
+		},
+		{
+			"no night free",
+			[]models.RoomRestriction{block(1, "2050-01-12", "2050-01-13"), block(2, "2050-01-12", "2050-01-13"), block(3, "2050-01-12", "2050-01-13")},
+			nil,
+		},
+	}
+
+	for _, e := range tests {
+		options := Propose(start, end, rooms, e.restrictions)
+		if len(options) != len(e.expected) {
+			t.Errorf("%s: expected %d options but got %d: %v", e.name, len(e.expected), len(options), options)
+			continue
+		}
+		for i, o := range options {
+			if o.Encode() != e.expected[i] {
+				t.Errorf("%s: expected option %d to be %s but got %s", e.name, i, e.expected[i], o.Encode())
+			}
+			if !o.Start().Equal(start) || !o.End().Equal(end) || o.Segments[0].Room.RoomName == "" {
+				t.Errorf("%s: expected option %d to cover the stay with named rooms but got %v", e.name, i, o)
+			}
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	o, err := Decode("1:2050-01-10:2050-01-13,2:2050-01-13:2050-01-16")
+	if err != nil || o.Moves() != 1 || o.Segments[1].RoomID != 2 || !o.End().Equal(date("2050-01-16")) {
+		t.Errorf("expected a stay moving to room 2 but got %v with %v", o, err)
+	}
+
+	for _, v := range []string{
+		"",
+		"1:2050-01-10",
+		"x:2050-01-10:2050-01-13",
+		"1:2050-01-13:2050-01-10",
+		"1:2050-01-10:2050-01-13,2:2050-01-14:2050-01-16",
+		"1:2050-01-10:2050-01-11,2:2050-01-11:2050-01-12,1:2050-01-12:2050-01-13,2:2050-01-13:2050-01-14",
+	} {
+		if _, err := Decode(v); err != ErrInvalid {
+			t.Errorf("expected %q to be invalid but got %v", v, err)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package timeline
+
+import (
+	"time"
+
+	"github.com/Poojasadgir/room-reservation/internal/models"
+)
+
+// Ranges are the numbers of days a timeline can show
+var Ranges = []int{7, 14, 30, 90}
+
+// DefaultRange is the number of days shown unless another range is asked for
+const DefaultRange = 14
+
+// ValidRange reports whether a timeline can show the given number of days
+func ValidRange(days int) bool {
+	for _, r := range Ranges {
+		if r == days {
+			return true
+		}
+	}
+	return false
+}
+
+// Day is a column of the timeline
+type Day struct {
+	Date    time.Time
+	Label   string
+	Weekend bool
+	Today   bool
+}
+
+// Bar is a reservation or block drawn across the nights of the timeline it covers. Left and Width place
+// it as percentages of the timeline, and Lane is the line of the room's row it is drawn on, so that bars
+// which overlap, such as a block imported over a reservation, do not hide each other.
+type Bar struct {
+	Restriction     models.RoomRestriction
+	Left            float64
+	Width           float64
+	Lane            int
+	ContinuesBefore bool
+	ContinuesAfter  bool
+}
+
+// IsReservation reports whether the bar is a reservation rather than a block
+func (b Bar) IsReservation() bool {
+	return b.Restriction.ReservationID > 0
+}
+
+// Row is a room's line of the timeline
+type Row struct {
+	Room  models.Room
+	Bars  []Bar
+	Lanes int
+}
+
+// Timeline shows the nights from Start for a number of days, with the restrictions on each room as bars
+type Timeline struct {
+	Start time.Time
+	Days  []Day
+	Rows  []Row
+}
+
+// End returns the day after the last night shown
+func (t Timeline) End() time.Time {
+	return t.Start.AddDate(0, 0, len(t.Days))
+}
+
+// Build lays out the restrictions on each room over the nights from start for the given number of days.
+// Restrictions must be ordered by start date; those for rooms not listed are left out. Short ranges label
+// every day, while long ones label only the first of each month and Mondays to stay readable.
+func Build(start time.Time, days int, today time.Time, rooms []models.Room, restrictions []models.RoomRestriction) Timeline {
+	t := Timeline{Start: start}
+	end := start.AddDate(0, 0, days)
+
+	for d := start; d.Before(end); d = d.AddDate(0, 0, 1) {
+		day := Day{
+			Date:    d,
+			Weekend: d.Weekday() == time.Saturday || d.Weekday() == time.Sunday,
+			Today:   sameDay(d, today),
+		}
+		switch {
+		case days <= 30:
+			day.Label = d.Format("Mon 2")
+		case d.Day() == 1 || d.Equal(start):
+			day.Label = d.Format("Jan 2")
+		case d.Weekday() == time.Monday:
+			day.Label = d.Format("2")
+		}
+		t.Days = append(t.Days, day)
+	}
+
+	rows := make(map[int]int, len(rooms))
+	for i, room := range rooms {
+		rows[room.ID] = i
+		t.Rows = append(t.Rows, Row{Room: room, Lanes: 1})
+	}
+
+	// the last night drawn on each lane of each room, to find a free lane for the next bar
+	lanes := make(map[int][]time.Time)
+
+	for _, r := range restrictions {
+		i, ok := rows[r.RoomID]
+		if !ok || !r.StartDate.Before(end) || !r.EndDate.After(start) {
+			continue
+		}
+
+		first, last := r.StartDate, r.EndDate
+		if first.Before(start) {
+			first = start
+		}
+		if last.After(end) {
+			last = end
+		}
+		if !last.After(first) {
+			last = first.AddDate(0, 0, 1)
+		}
+
+		bar := Bar{
+			Restriction:     r,
+			Left:            percent(nights(start, first), days),
+			Width:           percent(nights(first, last), days),
+			ContinuesBefore: r.StartDate.Before(start),
+			ContinuesAfter:  r.EndDate.After(end),
+		}
+
+		used := lanes[r.RoomID]
+		for bar.Lane < len(used) && used[bar.Lane].After(first) {
+			bar.Lane++
+		}
+		if bar.Lane == len(used) {
+			used = append(used, last)
+		} else {
+			used[bar.Lane] = last
+		}
+		lanes[r.RoomID] = used
+
+		row := &t.Rows[i]
+		row.Bars = append(row.Bars, bar)
+		if bar.Lane+1 > row.Lanes {
+			row.Lanes = bar.Lane + 1
+		}
+	}
+
+	return t
+}
+
+// nights returns the number of nights from one date to another
+func nights(from, to time.Time) int {
+	return int(to.Sub(from).Hours()/24 + 0.5)
+}
+
+// percent returns n days as a percentage of the timeline, to two decimal places
+func percent(n, days int) float64 {
+	return float64(n*10000/days) / 100
+}
+
+// sameDay reports whether two times fall on the same calendar date
+func sameDay(a, b time.Time) bool {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	return ay == by && am == bm && ad == bd
+}
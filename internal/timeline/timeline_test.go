@@ -0,0 +1,83 @@
+package timeline
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Poojasadgir/room-reservation/internal/models"
+)
+
+var start = time.Date(2050, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func day(d int) time.Time {
+	return start.AddDate(0, 0, d-1)
+}
+
+func TestValidRange(t *testing.T) {
+	for _, days := range []int{7, 14, 30, 90} {
+		if !ValidRange(days) {
+			t.Errorf("expected %d days to be a valid range", days)
+		}
+	}
+	for _, days := range []int{0, 1, 31, 365} {
+		if ValidRange(days) {
+			t.Errorf("expected %d days not to be a valid range", days)
+		}
+	}
+}
+
+func TestBuild(t *testing.T) {
+	rooms := []models.Room{{ID: 1, RoomName: "General's Quarters"}, {ID: 2, RoomName: "Major's Suite"}}
+	restrictions := []models.RoomRestriction{
+		{ID: 1, RoomID: 1, ReservationID: 1, StartDate: day(-2), EndDate: day(3)},
+		{ID: 2, RoomID: 1, StartDate: day(2), EndDate: day(4)},
+		{ID: 3, RoomID: 1, ReservationID: 2, StartDate: day(3), EndDate: day(5)},
+		{ID: 4, RoomID: 2, ReservationID: 3, StartDate: day(6), EndDate: day(12)},
+		{ID: 5, RoomID: 3, ReservationID: 4, StartDate: day(1), EndDate: day(2)},
+		{ID: 6, RoomID: 2, ReservationID: 5, StartDate: day(20), EndDate: day(22)},
+	}
+
+	tl := Build(start, 7, day(3), rooms, restrictions)
+
+	if len(tl.Days) != 7 || !tl.End().Equal(day(8)) {
+		t.Fatalf("expected 7 days ending on %s but got %d ending on %s", day(8), len(tl.Days), tl.End())
+	}
+	if tl.Days[0].Label != "Sat 1" || !tl.Days[0].Weekend || tl.Days[2].Weekend || !tl.Days[2].Today {
+		t.Errorf("expected the days to be labelled with weekends and today marked but got %+v", tl.Days[:3])
+	}
+
+	if len(tl.Rows) != 2 || len(tl.Rows[0].Bars) != 3 || len(tl.Rows[1].Bars) != 1 {
+		t.Fatalf("expected 3 bars on the first room and 1 on the second but got %+v", tl.Rows)
+	}
+
+	expected := []struct {
+		left, width float64
+		lane        int
+		before      bool
+		after       bool
+	}{
+		{0, 28.57, 0, true, false},
+		{14.28, 28.57, 1, false, false},
+		{28.57, 28.57, 0, false, false},
+	}
+	for i, e := range expected {
+		b := tl.Rows[0].Bars[i]
+		if b.Left != e.left || b.Width != e.width || b.Lane != e.lane || b.ContinuesBefore != e.before || b.ContinuesAfter != e.after {
+			t.Errorf("bar %d: expected %+v but got %+v", i, e, b)
+		}
+	}
+	if tl.Rows[0].Lanes != 2 || tl.Rows[1].Lanes != 1 {
+		t.Errorf("expected 2 lanes on the first room and 1 on the second but got %d and %d", tl.Rows[0].Lanes, tl.Rows[1].Lanes)
+	}
+
+	last := tl.Rows[1].Bars[0]
+	if last.Width != 28.57 || !last.ContinuesAfter || !last.IsReservation() {
+		t.Errorf("expected a reservation cut off at the end of the timeline but got %+v", last)
+	}
+
+	tl = Build(start, 90, day(3), rooms, nil)
+	if tl.Days[0].Label != "Jan 1" || tl.Days[1].Label != "" || tl.Days[2].Label != "3" || tl.Days[31].Label != "Feb 1" {
+		t.Errorf("expected long ranges to label only months and Mondays but got %q, %q, %q and %q",
+			tl.Days[0].Label, tl.Days[1].Label, tl.Days[2].Label, tl.Days[31].Label)
+	}
+}
@@ -0,0 +1,225 @@
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Poojasadgir/room-reservation/internal/models"
+)
+
+// Events that webhook endpoints can subscribe to
+const (
+	ReservationCreated   = "reservation.created"
+	ReservationUpdated   = "reservation.updated"
+	ReservationCancelled = "reservation.cancelled"
+	ReservationDeleted   = "reservation.deleted"
+	BlockCreated         = "block.created"
+	BlockUpdated         = "block.updated"
+	BlockDeleted         = "block.deleted"
+)
+
+// Events lists every event, in the order they are offered to staff
+var Events = []string{
+	ReservationCreated,
+	ReservationUpdated,
+	ReservationCancelled,
+	ReservationDeleted,
+	BlockCreated,
+	BlockUpdated,
+	BlockDeleted,
+}
+
+// Headers sent with every delivery
+const (
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+	SignatureHeader = "X-Webhook-Signature"
+)
+
+// Payload is the JSON body posted to webhook endpoints
+type Payload struct {
+	ID        string      `json:"id"`
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// NewPayload returns the JSON body for an event. Every endpoint receives the same body, so receivers
+// can use its id to ignore an event they have already seen.
+func NewPayload(event string, data interface{}, now time.Time) ([]byte, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(Payload{
+		ID:        "evt_" + hex.EncodeToString(b),
+		Event:     event,
+		CreatedAt: now.UTC(),
+		Data:      data,
+	})
+}
+
+// Reservation is the data sent with reservation events
+type Reservation struct {
+	ID              int    `json:"id"`
+	Status          string `json:"status"`
+	FirstName       string `json:"first_name"`
+	LastName        string `json:"last_name"`
+	Email           string `json:"email"`
+	Phone           string `json:"phone"`
+	RoomID          int    `json:"room_id"`
+	RoomName        string `json:"room_name,omitempty"`
+	StartDate       string `json:"start_date"`
+	EndDate         string `json:"end_date"`
+	Processed       bool   `json:"processed"`
+	CancellationFee int    `json:"cancellation_fee,omitempty"`
+	// Segments lists the rooms of a stay split across rooms, in order
+	Segments []Segment `json:"segments,omitempty"`
+}
+
+// Segment is the part of a split stay spent in one room
+type Segment struct {
+	RoomID    int    `json:"room_id"`
+	RoomName  string `json:"room_name,omitempty"`
+	StartDate string `json:"start_date"`
+	EndDate   string `json:"end_date"`
+}
+
+// NewReservation returns the event data for a reservation
+func NewReservation(res models.Reservation) Reservation {
+	r := Reservation{
+		ID:              res.ID,
+		Status:          res.Status,
+		FirstName:       res.FirstName,
+		LastName:        res.LastName,
+		Email:           res.Email,
+		Phone:           res.Phone,
+		RoomID:          res.RoomID,
+		RoomName:        res.Room.RoomName,
+		StartDate:       res.StartDate.Format("2006-01-02"),
+		EndDate:         res.EndDate.Format("2006-01-02"),
+		Processed:       res.Processed == 1,
+		CancellationFee: res.CancellationFee,
+	}
+	if res.Split() {
+		for _, s := range res.Segments {
+			r.Segments = append(r.Segments, Segment{
+				RoomID:    s.RoomID,
+				RoomName:  s.Room.RoomName,
+				StartDate: s.StartDate.Format("2006-01-02"),
+				EndDate:   s.EndDate.Format("2006-01-02"),
+			})
+		}
+	}
+	return r
+}
+
+// Block is the data sent with block events. Dates are left out of block.deleted events.
+type Block struct {
+	ID        int    `json:"id"`
+	RoomID    int    `json:"room_id"`
+	StartDate string `json:"start_date,omitempty"`
+	EndDate   string `json:"end_date,omitempty"`
+	ImportID  int    `json:"import_id,omitempty"`
+}
+
+// NewBlock returns the event data for a block
+func NewBlock(rr models.RoomRestriction) Block {
+	b := Block{
+		ID:       rr.ID,
+		RoomID:   rr.RoomID,
+		ImportID: rr.ImportID,
+	}
+	if !rr.StartDate.IsZero() {
+		b.StartDate = rr.StartDate.Format("2006-01-02")
+		b.EndDate = rr.EndDate.Format("2006-01-02")
+	}
+	return b
+}
+
+// Sign returns the signature header for a body sent at a time. The signature is the hex HMAC-SHA256 of
+// the unix timestamp, a full stop and the body, keyed with the endpoint's secret.
+func Sign(secret string, at time.Time, body []byte) string {
+	ts := strconv.FormatInt(at.Unix(), 10)
+	return fmt.Sprintf("t=%s,v1=%s", ts, signature(secret, ts, body))
+}
+
+func signature(secret, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ErrInvalidSignature is returned by Verify for a signature that does not match, or is too old
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// Verify checks a signature header made by Sign, rejecting signatures made more than tolerance before now
+func Verify(secret, header string, body []byte, tolerance time.Duration, now time.Time) error {
+	var ts, sig string
+	for _, part := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(part, "=")
+		switch k {
+		case "t":
+			ts = v
+		case "v1":
+			sig = v
+		}
+	}
+
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || sig == "" {
+		return ErrInvalidSignature
+	}
+	if now.Sub(time.Unix(unix, 0)) > tolerance {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(sig), []byte(signature(secret, ts, body))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// Send posts a delivery to its endpoint, returning the response status code. Any response other than a
+// 2xx is an error.
+func Send(client *http.Client, d models.WebhookDelivery, now time.Time) (int, error) {
+	body := []byte(d.Payload)
+
+	req, err := http.NewRequest(http.MethodPost, d.Endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "room-reservation-webhooks/1.0")
+	req.Header.Set(EventHeader, d.Event)
+	req.Header.Set(DeliveryHeader, strconv.Itoa(d.ID))
+	req.Header.Set(SignatureHeader, Sign(d.Endpoint.Secret, now, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 200))
+		return resp.StatusCode, fmt.Errorf("endpoint responded %s: %s", resp.Status, strings.TrimSpace(string(snippet)))
+	}
+
+	// drain the body so that the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	return resp.StatusCode, nil
+}
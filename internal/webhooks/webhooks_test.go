@@ -0,0 +1,145 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Poojasadgir/room-reservation/internal/models"
+)
+
+var now = time.Date(2050, 1, 10, 12, 0, 0, 0, time.UTC)
+
+func TestNewPayload(t *testing.T) {
+	res := models.Reservation{
+		ID:        7,
+		FirstName: "Jane",
+		LastName:  "Smith",
+		RoomID:    1,
+		Status:    models.ReservationStatusConfirmed,
+		StartDate: time.Date(2050, 1, 10, 0, 0, 0, 0, time.UTC),
+		EndDate:   time.Date(2050, 1, 13, 0, 0, 0, 0, time.UTC),
+	}
+
+	body, err := NewPayload(ReservationCreated, NewReservation(res), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var p struct {
+		ID    string `json:"id"`
+		Event string `json:"event"`
+		Data  struct {
+			ID        int    `json:"id"`
+			StartDate string `json:"start_date"`
+			EndDate   string `json:"end_date"`
+		} `json:"data"`
+	}
+	err = json.Unmarshal(body, &p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.ID == "" || p.Event != ReservationCreated {
+		t.Errorf("expected an id and the event name but got %+v", p)
+	}
+	if p.Data.ID != 7 || p.Data.StartDate != "2050-01-10" || p.Data.EndDate != "2050-01-13" {
+		t.Errorf("expected the reservation's id and dates but got %+v", p.Data)
+	}
+
+	other, _ := NewPayload(ReservationCreated, NewReservation(res), now)
+	if string(other) == string(body) {
+		t.Error("expected each payload to have its own id")
+	}
+}
+
+func TestNewReservationSegments(t *testing.T) {
+	start := time.Date(2050, 1, 10, 0, 0, 0, 0, time.UTC)
+	res := models.Reservation{ID: 7, RoomID: 1, StartDate: start, EndDate: start.AddDate(0, 0, 3)}
+	if r := NewReservation(res); r.Segments != nil {
+		t.Errorf("expected no segments for a stay in one room but got %v", r.Segments)
+	}
+
+	res.Segments = []models.StaySegment{
+		{RoomID: 1, StartDate: start, EndDate: start.AddDate(0, 0, 1)},
+		{RoomID: 2, StartDate: start.AddDate(0, 0, 1), EndDate: start.AddDate(0, 0, 3), Room: models.Room{RoomName: "Major's Suite"}},
+	}
+	r := NewReservation(res)
+	if len(r.Segments) != 2 || r.Segments[1] != (Segment{RoomID: 2, RoomName: "Major's Suite", StartDate: "2050-01-11", EndDate: "2050-01-13"}) {
+		t.Errorf("expected both rooms of the split stay but got %+v", r.Segments)
+	}
+}
+
+func TestSignAndVerify(t *testing.T) {
+	body := []byte(`{"event":"block.created"}`)
+	header := Sign("secret", now, body)
+
+	tests := []struct {
+		name      string
+		secret    string
+		header    string
+		body      []byte
+		at        time.Time
+		expectErr bool
+	}{
+		{"valid", "secret", header, body, now.Add(time.Minute), false},
+		{"wrong-secret", "other", header, body, now, true},
+		{"changed-body", "secret", header, []byte(`{"event":"block.deleted"}`), now, true},
+		{"too-old", "secret", header, body, now.Add(10 * time.Minute), true},
+		{"malformed", "secret", "v1=abc", body, now, true},
+	}
+
+	for _, e := range tests {
+		err := Verify(e.secret, e.header, e.body, 5*time.Minute, e.at)
+		if e.expectErr && err == nil {
+			t.Errorf("%s: expected an error but got none", e.name)
+		}
+		if !e.expectErr && err != nil {
+			t.Errorf("%s: unexpected error %s", e.name, err)
+		}
+	}
+}
+
+func TestSend(t *testing.T) {
+	var received *http.Request
+	var receivedBody []byte
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		receivedBody, _ = io.ReadAll(r.Body)
+		if r.URL.Path == "/fail" {
+			http.Error(w, "broken", http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	d := models.WebhookDelivery{
+		ID:       12,
+		Event:    BlockCreated,
+		Payload:  `{"event":"block.created"}`,
+		Endpoint: models.WebhookEndpoint{URL: srv.URL + "/hooks", Secret: "secret"},
+	}
+
+	code, err := Send(srv.Client(), d, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != http.StatusOK {
+		t.Errorf("expected 200 but got %d", code)
+	}
+	if received.Header.Get(EventHeader) != BlockCreated || received.Header.Get(DeliveryHeader) != "12" {
+		t.Errorf("expected the event and delivery headers but got %v", received.Header)
+	}
+	if err := Verify("secret", received.Header.Get(SignatureHeader), receivedBody, time.Minute, now); err != nil {
+		t.Errorf("expected a valid signature: %s", err)
+	}
+
+	d.Endpoint.URL = srv.URL + "/fail"
+	code, err = Send(srv.Client(), d, now)
+	if err == nil || code != http.StatusInternalServerError {
+		t.Errorf("expected an error with status 500 but got %d, %v", code, err)
+	}
+}
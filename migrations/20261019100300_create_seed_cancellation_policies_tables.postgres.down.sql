@@ -0,0 +1 @@
+DELETE FROM cancellation_policies;
\ No newline at end of file
@@ -0,0 +1,3 @@
+INSERT INTO public.cancellation_policies (policy_name,description,free_cancellation_hours,fee_nights,fee_percent,created_at,updated_at) VALUES
+	 ('Flexible','Free cancellation until 48 hours before arrival, then the first night is charged.',48,1,0,'2026-10-19 00:00:00.000','2026-10-19 00:00:00.000'),
+	 ('Non-refundable','The full stay is charged whenever the reservation is cancelled.',0,0,100,'2026-10-19 00:00:00.000','2026-10-19 00:00:00.000');
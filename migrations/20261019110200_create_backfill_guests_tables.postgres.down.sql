@@ -0,0 +1,2 @@
+UPDATE reservations SET guest_id = NULL;
+DELETE FROM guests;
\ No newline at end of file
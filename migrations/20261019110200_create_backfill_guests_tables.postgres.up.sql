@@ -0,0 +1,10 @@
+INSERT INTO public.guests (first_name, last_name, email, phone, created_at, updated_at)
+SELECT DISTINCT ON (lower(trim(r.email))) r.first_name, r.last_name, lower(trim(r.email)), r.phone, now(), now()
+FROM public.reservations r
+WHERE trim(r.email) <> ''
+ORDER BY lower(trim(r.email)), r.created_at DESC
+ON CONFLICT (email) DO NOTHING;
+
+UPDATE public.reservations r SET guest_id = g.id
+FROM public.guests g
+WHERE g.email = lower(trim(r.email)) AND r.guest_id IS NULL;